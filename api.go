@@ -0,0 +1,10 @@
+// Package spuser embeds the OpenAPI specification of the service, the x-permissions extension of its operations
+// is read by the permission package to authorize the requests.
+package spuser
+
+import _ "embed"
+
+// Spec is the OpenAPI specification of the service, see api.yml
+//
+//go:embed api.yml
+var Spec []byte
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/basriyasin/sp-user/handler"
+	"github.com/basriyasin/sp-user/repository"
+)
+
+// run the export command, e.g. "export -tenant brand-a -format ndjson -status active -o users.ndjson",
+// the users are written into the stdout unless -o is given and the exit code is 1 when the export fails
+func runExport(args []string) int {
+	var filter repository.ProfileFilter
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "the file format, csv or ndjson")
+	fields := flags.String("fields", "", "the exported fields separated by comma, default is every field")
+	output := flags.String("o", "", "the output file, default is the stdout")
+	tenant := flags.String("tenant", handler.DefaultTenant, "the slug of the tenant whose users are exported")
+	flags.StringVar(&filter.PhonePrefix, "phone", "", "only export users whose phone starts with this E.164 prefix")
+	flags.StringVar(&filter.Name, "name", "", "only export users whose name contains this text, case insensitive")
+	flags.StringVar(&filter.Status, "status", "", "only export users with this status, e.g. active")
+	flags.Func("created-from", "only export users created at or after this time (RFC 3339)", nullTimeFlag(&filter.CreatedFrom))
+	flags.Func("created-to", "only export users created before this time (RFC 3339)", nullTimeFlag(&filter.CreatedTo))
+	flags.Func("min-login-count", "only export users who have signed in at least this many times", nullIntFlag(&filter.MinLoginCount))
+	flags.Func("max-login-count", "only export users who have signed in at most this many times", nullIntFlag(&filter.MaxLoginCount))
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, server := context.Background(), newServer()
+	tenantID, err := getTenantID(ctx, server, *tenant)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count, err := server.BulkExport(ctx, tenantID, w, *format, *fields, filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "%d users have been exported\n", count)
+	return 0
+}
+
+// parse the RFC 3339 flag value into the nullable time
+func nullTimeFlag(t *sql.NullTime) func(string) error {
+	return func(value string) error {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		*t = sql.NullTime{Time: parsed, Valid: true}
+		return nil
+	}
+}
+
+// parse the integer flag value into the nullable integer
+func nullIntFlag(i *sql.NullInt64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*i = sql.NullInt64{Int64: parsed, Valid: true}
+		return nil
+	}
+}
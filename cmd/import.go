@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/basriyasin/sp-user/handler"
+)
+
+// run the import command, e.g. "import -tenant brand-a -dry-run users.csv" or "import -format ndjson < users.ndjson",
+// the report is written into the stdout as JSON and the exit code is 1 when the file can not be imported
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "the file format, csv or ndjson, default is the file extension or csv for the stdin")
+	dryRun := flags.Bool("dry-run", false, "only validate the rows and check the duplicates without importing them")
+	tenant := flags.String("tenant", handler.DefaultTenant, "the slug of the tenant the users are imported into")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: import [-tenant slug] [-format csv|ndjson] [-dry-run] [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var input io.Reader = os.Stdin
+	if name := flags.Arg(0); name != "" && name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+
+		if *format == "" {
+			*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		}
+	}
+	if *format == "" {
+		*format = handler.FormatCSV
+	}
+
+	ctx, server := context.Background(), newServer()
+	tenantID, err := getTenantID(ctx, server, *tenant)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	report, err := server.BulkImport(ctx, tenantID, input, *format, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"database/sql"
 	"encoding/pem"
+	"fmt"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/basriyasin/sp-user/generated"
 	"github.com/basriyasin/sp-user/handler"
@@ -15,6 +21,7 @@ import (
 	"github.com/golang-jwt/jwt"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 const (
@@ -23,17 +30,51 @@ const (
 	RSAKeySize     = 4096
 
 	// environtment
-	EnvDatabaseURL = "DATABASE_URL"
-	HTTPPort       = ":1323"
+	EnvDatabaseURL     = "DATABASE_URL"
+	EnvAdminProfileIDs = "ADMIN_PROFILE_IDS"
+	EnvPhoneCountries  = "ALLOWED_PHONE_COUNTRIES"
+	EnvMailDir         = "MAIL_DIR"
+	EnvPublicURL       = "PUBLIC_URL"
+	EnvDeletionGrace   = "DELETION_GRACE_PERIOD"
+	EnvPurgeInterval   = "PURGE_INTERVAL"
+	EnvImpersonation   = "IMPERSONATION_TTL"
+	EnvDefaultTenant   = "DEFAULT_TENANT"
+	EnvTrustedProxies  = "TRUSTED_PROXIES"
+	HTTPPort           = ":1323"
 )
 
 func main() {
+	// the subcommands run once and exit instead of starting the HTTP server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		}
+	}
+
 	e := echo.New()
 	e.Debug = true
+	e.HTTPErrorHandler = handler.ErrorHandler
+	e.IPExtractor = getIPExtractor()
+	e.Use(middleware.RequestID())
+
+	// the tenant of the request is resolved before the permissions declared by the x-permissions extension of api.yml
+	// are checked once the route is matched
+	server := newServer()
+	e.Use(server.ResolveTenant)
+	e.Use(server.Authorize)
+	generated.RegisterHandlers(e, server)
 
-	var server generated.ServerInterface = newServer()
+	// permanently delete the accounts whose deletion grace period has passed
+	go server.RunPurgeJob(context.Background(), getDuration(EnvPurgeInterval, handler.DefaultPurgeInterval))
 
-	generated.RegisterHandlers(e, server)
+	// assemble the archives of the requested data exports
+	go server.RunExportJob(context.Background(), handler.DefaultExportInterval)
+
+	// the uploaded files, e.g. the avatars, of the default blob store
+	e.Static(handler.BlobURLPath, handler.DefaultBlobDir)
 	e.Logger.Fatal(e.Start(HTTPPort))
 }
 
@@ -43,12 +84,91 @@ func newServer() *handler.Server {
 
 	rsaPrivateKey := getRSAKey()
 	opts := handler.NewServerOptions{
-		Repository:    repo,
-		RSAPrivateKey: rsaPrivateKey,
+		Repository:     repo,
+		RSAPrivateKey:  rsaPrivateKey,
+		AdminIDs:       getAdminIDs(),
+		PhoneCountries: getPhoneCountries(),
+		PublicURL:      os.Getenv(EnvPublicURL),
+		DefaultTenant:  os.Getenv(EnvDefaultTenant),
+
+		DeletionGracePeriod: getDuration(EnvDeletionGrace, handler.DefaultDeletionGracePeriod),
+		ImpersonationTTL:    getDuration(EnvImpersonation, handler.DefaultImpersonationTTL),
+	}
+
+	// the emails are written into the files of MAIL_DIR for development, otherwise they are only logged
+	if dir := os.Getenv(EnvMailDir); dir != "" {
+		opts.Mailer = handler.FileMailer{Dir: dir}
 	}
 	return handler.NewServer(opts)
 }
 
+// get the id of the tenant by its slug for the subcommands
+func getTenantID(ctx context.Context, server *handler.Server, slug string) (int64, error) {
+	tenant, err := server.Repository.GetTenantBySlug(ctx, slug)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("tenant %q does not exist", slug)
+	}
+	return tenant.ID, err
+}
+
+// get the admin profile ids from comma separated environment variable, e.g. "1,2,3"
+func getAdminIDs() (ids []int64) {
+	for _, s := range strings.Split(os.Getenv(EnvAdminProfileIDs), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// get the allowed phone countries from comma separated environment variable, e.g. "ID,MY,SG"
+func getPhoneCountries() (countries []string) {
+	for _, s := range strings.Split(os.Getenv(EnvPhoneCountries), ",") {
+		country := strings.TrimSpace(s)
+		if country == "" {
+			continue
+		}
+		countries = append(countries, country)
+	}
+	return
+}
+
+// get the client IP address extractor recorded in the audit trail, the X-Forwarded-For header is only trusted when sent
+// by the proxies of the comma separated CIDRs environment variable, e.g. "10.0.0.0/8", otherwise the peer address is used
+func getIPExtractor() echo.IPExtractor {
+	var trusted []echo.TrustOption
+	for _, s := range strings.Split(os.Getenv(EnvTrustedProxies), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			log.Fatalf("invalid %s %q: %v", EnvTrustedProxies, s, err)
+		}
+		trusted = append(trusted, echo.TrustIPRange(ipNet))
+	}
+	if len(trusted) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// only the listed proxies are trusted, not every private or loopback address
+	trusted = append(trusted, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(trusted...)
+}
+
+// get the duration from environment variable in Go duration format, e.g. "720h",
+// the default value is returned when it is not set or invalid
+func getDuration(env string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(env))
+	if err != nil || d <= 0 {
+		return defaultValue
+	}
+	return d
+}
+
 // init the repository dependencies
 func initRepository() repository.RepositoryInterface {
 	dbDsn := os.Getenv(EnvDatabaseURL)
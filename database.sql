@@ -8,6 +8,21 @@
   */
 
 
+-- the brands served by the same service, every profile and every data related
+-- to it belongs to one tenant and is never visible to the other tenants.
+-- the request is resolved to the tenant by the tenant id of its token, the
+-- slug in the X-Tenant header or the host it is sent to.
+create table if not exists tenant (
+    id         serial primary key,
+    slug       varchar(64) unique not null,
+    name       varchar(128) not null,
+    host       varchar(253) unique, -- lower cased without the port, e.g. accounts.example.com
+    created_at timestamp not null default current_timestamp
+);
+
+-- the tenant of the requests which are not resolved to any other tenant
+insert into tenant (id, slug, name) values (1, 'default', 'Default') on conflict do nothing;
+
 -- Considering the simplicity of the project architecture,
 -- authentication, profile, and user phone number will be
 -- put into one table to maintain simplicity.
@@ -19,13 +34,243 @@
 -- phone numbers, etc.
 create table if not exists profile (
     id          serial,
+    tenant_id   integer not null,
     name        varchar(60) not null,
     password    varchar(60) not null,
-    phone       varchar(14) unique not null,
+    phone       varchar(16) not null, -- E.164, e.g. +6281234567890
+    email       varchar(254), -- lower cased, only usable to sign in once verified
+    email_verified_at timestamp,
+    avatar_key  varchar(255), -- prefix of the avatar blobs, e.g. avatars/1/<random>
+    deletion_scheduled_at timestamp, -- the account can not sign in and is purged once this time has passed
+    status      varchar(16) not null default 'active', -- active, suspended or disabled, only active accounts can sign in and use their tokens
+    status_reason     varchar(256), -- why the account has been suspended or disabled
+    status_changed_by integer, -- the admin who changed the status
+    status_changed_at timestamp,
     login_count integer default 0,
     created_at  timestamp default current_timestamp,
-    updated_at  timestamp
+    updated_at  timestamp,
+    version     integer not null default 1, -- incremented on every update, used for optimistic concurrency control
+    -- the phone and the email are only unique within the tenant, so the same person can register to every brand
+    constraint profile_phone_key unique (tenant_id, phone)
 );
+-- only the verified email is unique, so nobody can hold an email they do not own against its owner,
+-- the first profile verifying the email keeps it and the others can no longer verify it
+create unique index profile_email_key on profile (tenant_id, email) where email_verified_at is not null;
 create index on profile (id);
-create index on profile (phone,password);
-create index on profile (created_at);
\ No newline at end of file
+create index on profile (tenant_id, created_at);
+create index on profile (tenant_id, deletion_scheduled_at) where deletion_scheduled_at is not null;
+create index on profile (tenant_id, status) where status <> 'active';
+
+-- devices that have been used to sign in to a profile,
+-- a login from a fingerprint which is not listed here
+-- will be reported as a new device login.
+create table if not exists profile_device (
+    id           serial primary key,
+    tenant_id    integer not null,
+    profile_id   integer not null,
+    fingerprint  varchar(64) not null,
+    user_agent   text not null default '',
+    created_at   timestamp default current_timestamp,
+    last_seen_at timestamp default current_timestamp,
+    unique (profile_id, fingerprint)
+);
+
+-- append-only security audit trail, every event stores the hash
+-- of the previous event so any modification or removal of an
+-- existing event breaks the chain and can be detected.
+-- before and after are stored as json (not jsonb) to keep the
+-- exact text used to compute the hash. every tenant has its own chain.
+create table if not exists audit_log (
+    id         bigserial primary key,
+    tenant_id  integer not null,
+    actor_id   integer,
+    target_id  integer,
+    action     varchar(64) not null,
+    before     json,
+    after      json,
+    request_id varchar(64) not null default '',
+    ip_address varchar(45) not null default '',
+    created_at timestamp not null,
+    prev_hash  varchar(64) not null,
+    hash       varchar(64) not null unique
+);
+create index on audit_log (tenant_id, id);
+create index on audit_log (actor_id);
+create index on audit_log (target_id);
+create index on audit_log (action);
+create index on audit_log (created_at);
+
+create or replace function audit_log_append_only() returns trigger as $$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_log_append_only
+    before update or delete on audit_log
+    for each row execute function audit_log_append_only();
+
+create trigger audit_log_no_truncate
+    before truncate on audit_log
+    for each statement execute function audit_log_append_only();
+
+-- previous name and phone of the profile, a new row is added every
+-- time the name or phone is changed together with who changed it.
+create table if not exists profile_history (
+    id         bigserial primary key,
+    tenant_id  integer not null,
+    profile_id integer not null,
+    actor_id   integer not null,
+    name       varchar(60) not null,
+    phone      varchar(16) not null,
+    changed_at timestamp not null default current_timestamp
+);
+create index on profile_history (profile_id, id);
+
+-- pending phone number change, the new phone is only applied to the
+-- profile once the OTP sent to it is confirmed, so the old phone keeps
+-- working until then. only the bcrypt hash of the OTP is stored.
+create table if not exists phone_change (
+    profile_id integer primary key,
+    tenant_id  integer not null,
+    phone      varchar(16) not null,
+    code_hash  varchar(60) not null,
+    attempts   integer not null default 0,
+    expires_at timestamp not null,
+    created_at timestamp not null default current_timestamp
+);
+
+-- email verification links sent to the profile email, the link is a
+-- signed token containing the id of this row so it can only be used
+-- once and only for the email it was sent to.
+create table if not exists email_verification (
+    id         varchar(32) primary key,
+    tenant_id  integer not null,
+    profile_id integer not null,
+    email      varchar(254) not null,
+    expires_at timestamp not null,
+    used_at    timestamp,
+    created_at timestamp not null default current_timestamp
+);
+create index on email_verification (profile_id);
+
+-- the profile preferences by key, the value is validated against the JSON Schema
+-- of the key by the application, the key without a row uses its default value.
+create table if not exists profile_preference (
+    tenant_id  integer not null,
+    profile_id integer not null,
+    key        varchar(64) not null,
+    value      jsonb not null,
+    updated_at timestamp not null default current_timestamp,
+    primary key (profile_id, key)
+);
+
+-- personal data export requested by the user, the archive is assembled by
+-- a background job and removed together with the row once it has expired.
+create table if not exists data_export (
+    id          varchar(32) primary key,
+    tenant_id   integer not null,
+    profile_id  integer not null,
+    status      varchar(16) not null default 'pending', -- pending, processing, completed or failed
+    archive_key varchar(255), -- key of the archive in the export store once completed
+    created_at  timestamp not null default current_timestamp,
+    started_at  timestamp,
+    finished_at timestamp,
+    expires_at  timestamp
+);
+create index on data_export (profile_id);
+-- a profile has at most one export in progress
+create unique index data_export_in_progress_key on data_export (tenant_id, profile_id) where status in ('pending', 'processing');
+create index on data_export (tenant_id, status, created_at);
+create index on data_export (tenant_id, expires_at) where expires_at is not null;
+
+-- the versions of the terms of service, the current version is the latest one
+-- published. a version can be published ahead of time with a future published_at.
+-- every tenant publishes its own versions.
+create table if not exists terms_version (
+    tenant_id    integer not null,
+    version      varchar(32) not null,
+    url          varchar(2048) not null,
+    published_at timestamp not null,
+    created_at   timestamp not null default current_timestamp,
+    primary key (tenant_id, version)
+);
+create index on terms_version (tenant_id, published_at);
+
+-- the terms of service accepted by the profile, one row per acceptance so the
+-- acceptance of every version is kept together with the client it was made from.
+create table if not exists profile_consent (
+    id            bigserial primary key,
+    tenant_id     integer not null,
+    profile_id    integer not null,
+    terms_version varchar(32) not null,
+    ip_address    varchar(45) not null default '',
+    user_agent    text not null default '',
+    accepted_at   timestamp not null default current_timestamp
+);
+create index on profile_consent (profile_id, terms_version);
+
+-- the roles granting the permissions declared by the x-permissions extension of
+-- the API operations, e.g. users:read. the profile gets the permissions of every
+-- assigned role. every tenant has its own roles, the permissions of a role
+-- belong to the tenant of the role.
+create table if not exists role (
+    id          bigserial primary key,
+    tenant_id   integer not null,
+    name        varchar(64) not null,
+    description varchar(256) not null default '',
+    created_at  timestamp not null default current_timestamp,
+    unique (tenant_id, name)
+);
+
+create table if not exists role_permission (
+    role_id    bigint not null,
+    permission varchar(64) not null,
+    primary key (role_id, permission)
+);
+
+create table if not exists profile_role (
+    tenant_id  integer not null,
+    profile_id integer not null,
+    role_id    bigint not null,
+    created_at timestamp not null default current_timestamp,
+    primary key (profile_id, role_id)
+);
+create index on profile_role (role_id);
+
+-- the organizations grouping the profiles of the tenant, e.g. the company of a
+-- B2B customer. every member has one organization role: owner, admin or member.
+create table if not exists organization (
+    id         bigserial primary key,
+    tenant_id  integer not null,
+    name       varchar(128) not null,
+    created_by integer not null,
+    created_at timestamp not null default current_timestamp
+);
+
+create table if not exists organization_member (
+    tenant_id       integer not null,
+    organization_id bigint not null,
+    profile_id      integer not null,
+    role            varchar(16) not null, -- owner, admin or member
+    created_at      timestamp not null default current_timestamp,
+    primary key (organization_id, profile_id)
+);
+create index on organization_member (profile_id);
+
+-- the invitation of a phone number to join the organization, the id is carried by
+-- the invitation token sent to the phone. the invitation is accepted by the profile
+-- of the phone or declined once, until it expires.
+create table if not exists organization_invitation (
+    id              varchar(32) primary key,
+    tenant_id       integer not null,
+    organization_id bigint not null,
+    phone           varchar(16) not null, -- E.164, e.g. +6281234567890
+    role            varchar(16) not null, -- the organization role granted once accepted
+    invited_by      integer not null,
+    status          varchar(16) not null default 'pending', -- pending, accepted or declined
+    expires_at      timestamp not null,
+    responded_at    timestamp,
+    created_at      timestamp not null default current_timestamp
+);
+create index on organization_invitation (organization_id, phone);
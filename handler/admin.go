@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+)
+
+const (
+	// users pagination and sorting
+	userDefaultLimit = 20
+	userMaxLimit     = 100
+	userDefaultSort  = "-" + repository.ProfileSortCreatedAt
+)
+
+var (
+	// the fields the admin can sort the users by
+	userSortFields = []string{
+		repository.ProfileSortCreatedAt,
+		repository.ProfileSortName,
+		repository.ProfileSortLoginCount,
+		repository.ProfileSortID,
+	}
+
+	// the statuses the admin can filter the users by
+	userStatuses = []string{
+		repository.ProfileStatusActive,
+		repository.ProfileStatusSuspended,
+		repository.ProfileStatusDisabled,
+		repository.ProfileStatusPendingDeletion,
+	}
+)
+
+// userFilterParams are the filters shared by the users list and the users export
+type userFilterParams struct {
+	Phone         *string
+	Name          *string
+	CreatedFrom   *time.Time
+	CreatedTo     *time.Time
+	Status        *string
+	MinLoginCount *int
+	MaxLoginCount *int
+}
+
+// convert the filters of the users list or export into the profile filter, the unknown status is an invalid request
+func toProfileFilter(params userFilterParams) (filter repository.ProfileFilter, err error) {
+	if params.Phone != nil {
+		filter.PhonePrefix = *params.Phone
+	}
+	if params.Name != nil {
+		filter.Name = *params.Name
+	}
+	if params.CreatedFrom != nil {
+		filter.CreatedFrom = sql.NullTime{Time: *params.CreatedFrom, Valid: true}
+	}
+	if params.CreatedTo != nil {
+		filter.CreatedTo = sql.NullTime{Time: *params.CreatedTo, Valid: true}
+	}
+	if params.Status != nil {
+		if !isUserStatus(*params.Status) {
+			return filter, errInvalidRequest.withDetail("detail.invalid-status", map[string]interface{}{"statuses": strings.Join(userStatuses, ", ")})
+		}
+		filter.Status = *params.Status
+	}
+	if params.MinLoginCount != nil {
+		filter.MinLoginCount = sql.NullInt64{Int64: int64(*params.MinLoginCount), Valid: true}
+	}
+	if params.MaxLoginCount != nil {
+		filter.MaxLoginCount = sql.NullInt64{Int64: int64(*params.MaxLoginCount), Valid: true}
+	}
+	return
+}
+
+// userCursor is the content of the opaque cursor of the users list, the sort is kept
+// so the cursor can not be used with another sort
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// parse the sort of the users list, e.g. "-created_at" is sorted by created_at in the descending order
+func parseUserSort(sort string) (field string, desc bool, ok bool) {
+	field = strings.TrimPrefix(sort, "-")
+	for _, f := range userSortFields {
+		if f == field {
+			return field, field != sort, true
+		}
+	}
+	return "", false, false
+}
+
+// the value of the sort field of the user in the text format of its column
+func userSortValue(field string, user repository.User) string {
+	switch field {
+	case repository.ProfileSortName:
+		return user.Name
+	case repository.ProfileSortLoginCount:
+		return strconv.Itoa(user.LoginCount)
+	case repository.ProfileSortCreatedAt:
+		return user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return strconv.FormatInt(user.ID, 10)
+}
+
+// encode the cursor of the page after the given user
+func encodeUserCursor(sort, field string, user repository.User) string {
+	c, _ := json.Marshal(userCursor{Sort: sort, Value: userSortValue(field, user), ID: user.ID})
+	return base64.RawURLEncoding.EncodeToString(c)
+}
+
+// decode the cursor of the users list, the error is returned when the cursor is malformed or made for another sort
+func decodeUserCursor(cursor, sort string) (*repository.ProfileCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var c userCursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Sort != sort || c.ID == 0 {
+		return nil, errors.New("the cursor is made for another sort")
+	}
+	return &repository.ProfileCursor{Value: c.Value, ID: c.ID}, nil
+}
+
+// check whether the status is one of the statuses the users can be filtered by
+func isUserStatus(status string) bool {
+	for _, s := range userStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// the status of the profile, the active profile scheduled for deletion is pending deletion
+func profileStatus(user repository.User) string {
+	if user.Status != "" && user.Status != repository.ProfileStatusActive {
+		return user.Status
+	}
+	if user.DeletionScheduledAt.Valid {
+		return repository.ProfileStatusPendingDeletion
+	}
+	return repository.ProfileStatusActive
+}
+
+// convert the profile into the admin users list item, the password hash is never included
+func toAdminUserResponse(user repository.User) generated.AdminUser {
+	res := generated.AdminUser{
+		Id:         user.ID,
+		Name:       user.Name,
+		Phone:      user.Phone,
+		Status:     profileStatus(user),
+		LoginCount: user.LoginCount,
+		CreatedAt:  user.CreatedAt,
+	}
+	if user.Email != "" {
+		res.Email = &user.Email
+	}
+	if user.EmailVerifiedAt.Valid {
+		res.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+	if user.StatusReason != "" {
+		res.StatusReason = &user.StatusReason
+	}
+	if user.DeletionScheduledAt.Valid {
+		res.DeletionScheduledAt = &user.DeletionScheduledAt.Time
+	}
+	if user.UpdatedAt.Valid {
+		res.UpdatedAt = &user.UpdatedAt.Time
+	}
+	return res
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserSort(t *testing.T) {
+	test := []struct {
+		sort       string
+		expectSort string
+		expectDesc bool
+		expectOK   bool
+	}{
+		{sort: "-created_at", expectSort: "created_at", expectDesc: true, expectOK: true},
+		{sort: "name", expectSort: "name", expectOK: true},
+		{sort: "-login_count", expectSort: "login_count", expectDesc: true, expectOK: true},
+		{sort: "id", expectSort: "id", expectOK: true},
+		{sort: "--id"},
+		{sort: "password"},
+		{sort: ""},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.sort, func(t *testing.T) {
+			field, desc, ok := parseUserSort(tt.sort)
+			assert.Equal(t, tt.expectSort, field)
+			assert.Equal(t, tt.expectDesc, desc)
+			assert.Equal(t, tt.expectOK, ok)
+		})
+	}
+}
+
+func TestUserCursor(t *testing.T) {
+	mockUser := repository.User{
+		ID:         7,
+		Name:       "narto",
+		LoginCount: 3,
+		CreatedAt:  time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC),
+	}
+
+	test := []struct {
+		sort        string
+		field       string
+		expectValue string
+	}{
+		{sort: "-created_at", field: repository.ProfileSortCreatedAt, expectValue: "2024-01-02T03:04:05.000006Z"},
+		{sort: "name", field: repository.ProfileSortName, expectValue: "narto"},
+		{sort: "login_count", field: repository.ProfileSortLoginCount, expectValue: "3"},
+		{sort: "-id", field: repository.ProfileSortID, expectValue: "7"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.sort, func(t *testing.T) {
+			cursor := encodeUserCursor(tt.sort, tt.field, mockUser)
+
+			after, err := decodeUserCursor(cursor, tt.sort)
+			assert.NoError(t, err)
+			assert.Equal(t, &repository.ProfileCursor{Value: tt.expectValue, ID: 7}, after)
+
+			// the cursor of another sort is rejected
+			_, err = decodeUserCursor(cursor, "-"+tt.sort)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := decodeUserCursor("not base64!", "id")
+	assert.Error(t, err)
+	_, err = decodeUserCursor("bm90IGpzb24", "id")
+	assert.Error(t, err)
+}
+
+func TestToAdminUserResponse(t *testing.T) {
+	now := time.Now()
+
+	res := toAdminUserResponse(repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Password: "hash"})
+	assert.Equal(t, repository.ProfileStatusActive, res.Status)
+	assert.Nil(t, res.Email)
+	assert.Nil(t, res.EmailVerifiedAt)
+	assert.Nil(t, res.DeletionScheduledAt)
+	assert.Nil(t, res.UpdatedAt)
+
+	res = toAdminUserResponse(repository.User{
+		ID:                  1,
+		Email:               "narto@example.com",
+		EmailVerifiedAt:     sql.NullTime{Time: now, Valid: true},
+		DeletionScheduledAt: sql.NullTime{Time: now, Valid: true},
+		UpdatedAt:           sql.NullTime{Time: now, Valid: true},
+	})
+	assert.Equal(t, repository.ProfileStatusPendingDeletion, res.Status)
+	assert.Equal(t, "narto@example.com", *res.Email)
+	assert.Equal(t, now, *res.EmailVerifiedAt)
+	assert.Equal(t, now, *res.DeletionScheduledAt)
+	assert.Equal(t, now, *res.UpdatedAt)
+	assert.Nil(t, res.StatusReason)
+
+	// the suspended or disabled status takes precedence over the deletion schedule
+	res = toAdminUserResponse(repository.User{
+		Status:              repository.ProfileStatusSuspended,
+		StatusReason:        "spam",
+		DeletionScheduledAt: sql.NullTime{Time: now, Valid: true},
+	})
+	assert.Equal(t, repository.ProfileStatusSuspended, res.Status)
+	assert.Equal(t, "spam", *res.StatusReason)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// audit event actions
+	auditActionRegister      = "profile.register"
+	auditActionProfileUpdate = "profile.update"
+	auditActionPhoneRequest  = "profile.phone_change_request"
+	auditActionPhoneChange   = "profile.phone_change"
+	auditActionEmailRequest  = "profile.email_verification_request"
+	auditActionEmailVerify   = "profile.email_verify"
+	auditActionAvatarUpdate  = "profile.avatar_update"
+	auditActionPreferences   = "profile.preferences_update"
+	auditActionDeletion      = "profile.deletion_request"
+	auditActionDeletionAbort = "profile.deletion_cancel"
+	auditActionPurge         = "profile.purge"
+	auditActionExport        = "profile.data_export_request"
+	auditActionExportGet     = "profile.data_export_download"
+	auditActionConsent       = "profile.terms_accept"
+	auditActionOrgCreate     = "organization.create"
+	auditActionOrgRole       = "organization.member_role"
+	auditActionOrgRemove     = "organization.member_remove"
+	auditActionOrgInvite     = "organization.invite"
+	auditActionOrgAccept     = "organization.invitation_accept"
+	auditActionOrgDecline    = "organization.invitation_decline"
+	auditActionLogin         = "auth.login"
+	auditActionLoginFailed   = "auth.login_failed"
+	auditActionAuditList     = "admin.audit_list"
+	auditActionUserList      = "admin.user_list"
+	auditActionUserStatus    = "admin.user_status"
+	auditActionUserImport    = "admin.user_import"
+	auditActionUserExport    = "admin.user_export"
+	auditActionImpersonate   = "admin.impersonate"
+	auditActionTermsPublish  = "admin.terms_publish"
+	auditActionRoleCreate    = "admin.role_create"
+	auditActionRoleUpdate    = "admin.role_update"
+	auditActionRoleDelete    = "admin.role_delete"
+	auditActionRoleAssign    = "admin.role_assign"
+	auditActionRoleRevoke    = "admin.role_revoke"
+
+	// audit events pagination
+	auditEventDefaultLimit = 20
+	auditEventMaxLimit     = 100
+)
+
+// auditRecord describe who did what to whom, the before and after values are reduced to the changed fields only
+type auditRecord struct {
+	ActorID  int64
+	TargetID int64
+	Action   string
+	Before   map[string]interface{}
+	After    map[string]interface{}
+}
+
+// append the record into the audit trail together with the request id and the client ip address.
+// The action made with the impersonation token is recorded with the impersonator as the actor and the impersonation session
+func (s Server) audit(ctx echo.Context, record auditRecord) error {
+	if imp, ok := ctx.Get(contextKeyImpersonation).(impersonation); ok {
+		record.ActorID = imp.ActorID
+		after := make(map[string]interface{}, len(record.After)+1)
+		for k, v := range record.After {
+			after[k] = v
+		}
+		after["impersonation_session"] = imp.SessionID
+		record.After = after
+	}
+
+	before, after := auditDiff(record.Before, record.After)
+	_, err := s.Repository.SaveAuditEvent(ctx.Request().Context(), tenantID(ctx), repository.AuditEvent{
+		ActorID:   nullID(record.ActorID),
+		TargetID:  nullID(record.TargetID),
+		Action:    record.Action,
+		Before:    before,
+		After:     after,
+		RequestID: requestID(ctx),
+		IPAddress: ctx.RealIP(),
+	})
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	return nil
+}
+
+// reduce the before and after values into the changed fields only
+func auditDiff(before, after map[string]interface{}) (b, a json.RawMessage) {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for k, v := range after {
+		if prev, ok := before[k]; !ok || !reflect.DeepEqual(prev, v) {
+			changedAfter[k] = v
+			if ok {
+				changedBefore[k] = prev
+			}
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			changedBefore[k] = v
+		}
+	}
+
+	if len(changedBefore) > 0 {
+		b, _ = json.Marshal(changedBefore)
+	}
+	if len(changedAfter) > 0 {
+		a, _ = json.Marshal(changedAfter)
+	}
+	return
+}
+
+// get the request id assigned by the request id middleware or provided by the client
+func requestID(ctx echo.Context) string {
+	id := ctx.Response().Header().Get(echo.HeaderXRequestID)
+	if id == "" {
+		id = ctx.Request().Header.Get(echo.HeaderXRequestID)
+	}
+	return id
+}
+
+// convert the profile id into nullable sql value, zero id is stored as null
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// convert the stored audit event into the API response
+func toAuditEventResponse(event repository.AuditEvent) generated.AuditEvent {
+	res := generated.AuditEvent{
+		Id:        event.ID,
+		Action:    event.Action,
+		RequestId: event.RequestID,
+		IpAddress: event.IPAddress,
+		CreatedAt: event.CreatedAt,
+		PrevHash:  event.PrevHash,
+		Hash:      event.Hash,
+	}
+	if event.ActorID.Valid {
+		res.ActorId = &event.ActorID.Int64
+	}
+	if event.TargetID.Valid {
+		res.TargetId = &event.TargetID.Int64
+	}
+	if len(event.Before) > 0 {
+		var before map[string]interface{}
+		if json.Unmarshal(event.Before, &before) == nil {
+			res.Before = &before
+		}
+	}
+	if len(event.After) > 0 {
+		var after map[string]interface{}
+		if json.Unmarshal(event.After, &after) == nil {
+			res.After = &after
+		}
+	}
+	return res
+}
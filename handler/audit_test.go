@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditDiff(t *testing.T) {
+	test := []struct {
+		name         string
+		before       map[string]interface{}
+		after        map[string]interface{}
+		expectBefore string
+		expectAfter  string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:        "created",
+			after:       map[string]interface{}{"name": "narto"},
+			expectAfter: `{"name":"narto"}`,
+		},
+		{
+			name:         "removed",
+			before:       map[string]interface{}{"name": "narto"},
+			expectBefore: `{"name":"narto"}`,
+		},
+		{
+			name:         "only changed fields",
+			before:       map[string]interface{}{"name": "narto", "phone": "+6281122334455"},
+			after:        map[string]interface{}{"name": "sasuke", "phone": "+6281122334455"},
+			expectBefore: `{"name":"narto"}`,
+			expectAfter:  `{"name":"sasuke"}`,
+		},
+		{
+			name:   "nothing changed",
+			before: map[string]interface{}{"name": "narto"},
+			after:  map[string]interface{}{"name": "narto"},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := auditDiff(tt.before, tt.after)
+			assert.Equal(t, tt.expectBefore, string(before))
+			assert.Equal(t, tt.expectAfter, string(after))
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set(echo.HeaderXRequestID, "from-client")
+	c := e.NewContext(req, httptest.NewRecorder())
+	assert.Equal(t, "from-client", requestID(c))
+
+	c.Response().Header().Set(echo.HeaderXRequestID, "from-middleware")
+	assert.Equal(t, "from-middleware", requestID(c))
+}
+
+func TestToAuditEventResponse(t *testing.T) {
+	event := repository.AuditEvent{
+		ID:        1,
+		ActorID:   sql.NullInt64{Int64: 2, Valid: true},
+		TargetID:  sql.NullInt64{Int64: 3, Valid: true},
+		Action:    auditActionProfileUpdate,
+		Before:    json.RawMessage(`{"name":"narto"}`),
+		After:     json.RawMessage(`{"name":"sasuke"}`),
+		CreatedAt: time.Now(),
+		Hash:      "abc",
+	}
+
+	res := toAuditEventResponse(event)
+	assert.Equal(t, int64(2), *res.ActorId)
+	assert.Equal(t, int64(3), *res.TargetId)
+	assert.Equal(t, "narto", (*res.Before)["name"])
+	assert.Equal(t, "sasuke", (*res.After)["name"])
+
+	res = toAuditEventResponse(repository.AuditEvent{ID: 1})
+	assert.Nil(t, res.ActorId)
+	assert.Nil(t, res.TargetId)
+	assert.Nil(t, res.Before)
+	assert.Nil(t, res.After)
+}
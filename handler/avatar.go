@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	// register the decoders of the accepted avatar formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// the multipart form field of the avatar image
+	avatarField = "avatar"
+
+	// the accepted avatar image
+	avatarMaxSize           = 5 << 20
+	avatarMultipartOverhead = 1 << 20
+	avatarMaxDimension      = 4096
+
+	// the avatar is saved as a square JPEG in the following sizes
+	avatarSize          = 512
+	avatarThumbnailSize = 128
+	avatarQuality       = 85
+	avatarContentType   = "image/jpeg"
+)
+
+var (
+	// the accepted avatar content types, sniffed from the image content instead of trusting the client
+	avatarContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+	// every avatar is saved in all of these sizes
+	avatarSizes = []int{avatarSize, avatarThumbnailSize}
+)
+
+// the blob key of the avatar in the given size
+func avatarBlobKey(prefix string, size int) string {
+	return fmt.Sprintf("%s/%d.jpg", prefix, size)
+}
+
+// read and decode the avatar image, the invalid image is returned as the field error of the avatar field
+func decodeAvatar(r io.Reader) (img image.Image, fieldErr *FieldError, err error) {
+	data, err := io.ReadAll(io.LimitReader(r, avatarMaxSize+1))
+	if err != nil {
+		return
+	}
+	if len(data) > avatarMaxSize {
+		fieldErr = newFieldError(avatarField, "file_size", map[string]interface{}{"max": avatarMaxSize >> 20})
+		return
+	}
+
+	invalidType := newFieldError(avatarField, "image_type", map[string]interface{}{"types": strings.Join(avatarContentTypes, ", ")})
+	if !isAvatarContentType(http.DetectContentType(data)) {
+		fieldErr = invalidType
+		return
+	}
+
+	// check the dimension before decoding so a small file can not allocate a huge image
+	config, _, decodeErr := image.DecodeConfig(bytes.NewReader(data))
+	if decodeErr != nil {
+		fieldErr = invalidType
+		return
+	}
+	if config.Width > avatarMaxDimension || config.Height > avatarMaxDimension || config.Width == 0 || config.Height == 0 {
+		fieldErr = newFieldError(avatarField, "image_dimensions", map[string]interface{}{"max": avatarMaxDimension})
+		return
+	}
+
+	img, _, decodeErr = image.Decode(bytes.NewReader(data))
+	if decodeErr != nil {
+		fieldErr = invalidType
+	}
+	return
+}
+
+// check whether the sniffed content type is one of the accepted avatar content types
+func isAvatarContentType(contentType string) bool {
+	for _, t := range avatarContentTypes {
+		if contentType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// crop the center square of the image and shrink it into the given size by averaging the pixels,
+// the smaller image is never enlarged and the transparent pixels are drawn over white
+func resizeSquare(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	if size > side {
+		size = side
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for dy := 0; dy < size; dy++ {
+		sy0, sy1 := y0+dy*side/size, y0+(dy+1)*side/size
+		for dx := 0; dx < size; dx++ {
+			sx0, sx1 := x0+dx*side/size, x0+(dx+1)*side/size
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+
+			// the colors are premultiplied by the alpha, so adding the missing alpha draws them over white
+			white := 0xffff - a/n
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8((r/n + white) >> 8),
+				G: uint8((g/n + white) >> 8),
+				B: uint8((b/n + white) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// encode the resized avatar as JPEG
+func encodeAvatar(img image.Image, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, resizeSquare(img, size), &jpeg.Options{Quality: avatarQuality})
+	return buf.Bytes(), err
+}
+
+// resize the avatar into all sizes and save them under the given blob key prefix,
+// the saved sizes are removed when any of them fails to be saved
+func (s Server) saveAvatar(ctx echo.Context, prefix string, img image.Image) error {
+	for _, size := range avatarSizes {
+		data, err := encodeAvatar(img, size)
+		if err == nil {
+			err = s.blobs.Put(ctx.Request().Context(), avatarBlobKey(prefix, size), avatarContentType, data)
+		}
+		if err != nil {
+			s.deleteAvatar(ctx, prefix)
+			return err
+		}
+	}
+	return nil
+}
+
+// remove all sizes of the avatar, the failure is only logged as the orphan blobs are harmless
+func (s Server) deleteAvatar(ctx echo.Context, prefix string) {
+	for _, size := range avatarSizes {
+		err := s.blobs.Delete(ctx.Request().Context(), avatarBlobKey(prefix, size))
+		if err != nil {
+			ctx.Logger().Error(err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reader which always fails
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("an error")
+}
+
+// encode a filled image with the given encoder
+func encodeTestImage(t *testing.T, width, height int, c color.Color, encode func(io.Writer, image.Image) error) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDecodeAvatar(t *testing.T) {
+	var (
+		red     = color.RGBA{R: 0xff, A: 0xff}
+		pngData = encodeTestImage(t, 30, 20, red, png.Encode)
+	)
+
+	test := []struct {
+		name       string
+		body       io.Reader
+		expectRule string
+		expectErr  bool
+	}{
+		{
+			name:      "err read",
+			body:      errReader{},
+			expectErr: true,
+		},
+		{
+			name:       "too large",
+			body:       bytes.NewReader(make([]byte, avatarMaxSize+1)),
+			expectRule: "file_size",
+		},
+		{
+			name:       "not an image",
+			body:       strings.NewReader("hello world"),
+			expectRule: "image_type",
+		},
+		{
+			name:       "corrupted image",
+			body:       bytes.NewReader(pngData[:len(pngData)/2]),
+			expectRule: "image_type",
+		},
+		{
+			name:       "truncated header",
+			body:       bytes.NewReader(pngData[:16]),
+			expectRule: "image_type",
+		},
+		{
+			name:       "too wide",
+			body:       bytes.NewReader(encodeTestImage(t, avatarMaxDimension+1, 1, red, png.Encode)),
+			expectRule: "image_dimensions",
+		},
+		{
+			name: "png",
+			body: bytes.NewReader(pngData),
+		},
+		{
+			name: "jpeg",
+			body: bytes.NewReader(encodeTestImage(t, 30, 20, red, func(w io.Writer, img image.Image) error {
+				return jpeg.Encode(w, img, nil)
+			})),
+		},
+		{
+			name: "gif",
+			body: bytes.NewReader(encodeTestImage(t, 30, 20, red, func(w io.Writer, img image.Image) error {
+				return gif.Encode(w, img, nil)
+			})),
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			img, fieldErr, err := decodeAvatar(tt.body)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.expectRule != "" {
+				if assert.NotNil(t, fieldErr) {
+					assert.Equal(t, avatarField, fieldErr.Field)
+					assert.Equal(t, tt.expectRule, fieldErr.Rule)
+				}
+				return
+			}
+			assert.Nil(t, fieldErr)
+			assert.Equal(t, image.Rect(0, 0, 30, 20), img.Bounds())
+		})
+	}
+}
+
+func TestResizeSquare(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			// the left and right 50 pixels are cropped, the rest is transparent on the top half
+			c := color.NRGBA{B: 0xff, A: 0xff}
+			if x < 50 || x >= 250 {
+				c = color.NRGBA{R: 0xff, A: 0xff}
+			} else if y < 100 {
+				c = color.NRGBA{}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	// the smaller image is never enlarged
+	assert.Equal(t, image.Rect(0, 0, 200, 200), resizeSquare(src, avatarSize).Bounds())
+
+	dst := resizeSquare(src, 100)
+	assert.Equal(t, image.Rect(0, 0, 100, 100), dst.Bounds())
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, dst.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{B: 0xff, A: 0xff}, dst.RGBAAt(0, 99))
+	assert.Equal(t, color.RGBA{B: 0xff, A: 0xff}, dst.RGBAAt(99, 99))
+}
+
+func TestEncodeAvatar(t *testing.T) {
+	data, err := encodeAvatar(image.NewRGBA(image.Rect(0, 0, 600, 400)), avatarThumbnailSize)
+	assert.NoError(t, err)
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, avatarThumbnailSize, config.Width)
+	assert.Equal(t, avatarThumbnailSize, config.Height)
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// the directory of the default file blob store and the path where it is served by the HTTP server
+	DefaultBlobDir = "blobs"
+	BlobURLPath    = "/blobs"
+)
+
+type (
+	// BlobStore keep the uploaded files, e.g. in the local filesystem or an object storage such as S3.
+	// The key is a slash separated path, e.g. "avatars/1/abc/512.jpg".
+	BlobStore interface {
+		Put(ctx context.Context, key, contentType string, data []byte) error
+		Get(ctx context.Context, key string) ([]byte, error)
+		Delete(ctx context.Context, key string) error
+		URL(key string) string
+	}
+
+	// FileBlobStore keep the blobs as files inside Dir which are served by the HTTP server under BaseURL
+	FileBlobStore struct {
+		Dir     string
+		BaseURL string
+	}
+)
+
+// the file path of the key, the key can not point outside of the store directory
+func (s FileBlobStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", errors.New("invalid blob key: " + key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(strings.TrimPrefix(clean, "/"))), nil
+}
+
+// write the blob into the file of the key, the content type is inferred from the key extension when it is served
+func (s FileBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+// read the file of the key
+func (s FileBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(name)
+}
+
+// remove the file of the key, removing an unknown key is not an error
+func (s FileBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// the public URL of the key
+func (s FileBlobStore) URL(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blob store stub which keeps the blobs in memory
+type stubBlobStore struct {
+	err   error
+	blobs map[string][]byte
+}
+
+func (s *stubBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.blobs == nil {
+		s.blobs = map[string][]byte{}
+	}
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *stubBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (s *stubBlobStore) Delete(ctx context.Context, key string) error {
+	delete(s.blobs, key)
+	return s.err
+}
+
+func (s *stubBlobStore) URL(key string) string {
+	return "https://example.com/" + key
+}
+
+func TestFileBlobStore(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		dir   = t.TempDir()
+		store = FileBlobStore{Dir: dir, BaseURL: "https://example.com/blobs/"}
+	)
+
+	assert.NoError(t, store.Put(ctx, "avatars/1/abc/512.jpg", avatarContentType, []byte("image")))
+	data, err := os.ReadFile(filepath.Join(dir, "avatars", "1", "abc", "512.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+	data, err = store.Get(ctx, "avatars/1/abc/512.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+	assert.Equal(t, "https://example.com/blobs/avatars/1/abc/512.jpg", store.URL("avatars/1/abc/512.jpg"))
+
+	assert.NoError(t, store.Delete(ctx, "avatars/1/abc/512.jpg"))
+	_, err = os.Stat(filepath.Join(dir, "avatars", "1", "abc", "512.jpg"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = store.Get(ctx, "avatars/1/abc/512.jpg")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// removing an unknown key is not an error
+	assert.NoError(t, store.Delete(ctx, "avatars/1/abc/512.jpg"))
+
+	// the key can not point outside of the store directory
+	for _, key := range []string{"", "/abs", "../outside", "avatars/../../outside", "avatars//512.jpg"} {
+		assert.Error(t, store.Put(ctx, key, avatarContentType, nil), key)
+		assert.Error(t, store.Delete(ctx, key), key)
+		_, err = store.Get(ctx, key)
+		assert.Error(t, err, key)
+	}
+
+	// the directory can not be created inside a file
+	assert.NoError(t, store.Put(ctx, "file", avatarContentType, nil))
+	assert.Error(t, store.Put(ctx, "file/512.jpg", avatarContentType, nil))
+}
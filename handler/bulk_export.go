@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// the size of the buffer written into the response at once
+	exportBufferSize = 32 * 1024
+)
+
+var (
+	// the fields of the users export in the default order, the password hash is never exported
+	userExportFields = []string{
+		"id",
+		"name",
+		"phone",
+		"email",
+		"email_verified_at",
+		"status",
+		"status_reason",
+		"login_count",
+		"created_at",
+		"updated_at",
+		"deletion_scheduled_at",
+	}
+
+	// the content type of the export format
+	exportMediaTypes = map[string]string{
+		FormatCSV:    MIMETextCSV,
+		FormatNDJSON: MIMEApplicationNDJSON,
+	}
+)
+
+type (
+	// userExport is the format and the fields of the users export
+	userExport struct {
+		format string
+		fields []string
+	}
+
+	// exportResponseWriter writes the export into the response, the headers are only written along with the first bytes
+	// so the error found before anything is exported is still rendered as the problem details
+	exportResponseWriter struct {
+		ctx      echo.Context
+		format   string
+		filename string
+	}
+)
+
+// BulkExport writes the users of the tenant matching the filter into w in the order of their id, the sort, the cursor and the limit
+// of the filter are ignored. The fields are separated by comma, empty for every field. The users are read through
+// a server-side cursor so they are never loaded into memory at once. Unlike the admin endpoint, the export is
+// recorded in the audit trail without an actor.
+func (s Server) BulkExport(ctx context.Context, tenantID int64, w io.Writer, format, fields string, filter repository.ProfileFilter) (count int, err error) {
+	export, err := newUserExport(format, fields)
+	if err != nil {
+		return
+	}
+	if filter.Status != "" && !isUserStatus(filter.Status) {
+		return 0, errInvalidRequest.withDetail("detail.invalid-status", map[string]interface{}{"statuses": strings.Join(userStatuses, ", ")})
+	}
+
+	after, _ := json.Marshal(exportSummary(export, filter))
+	_, err = s.Repository.SaveAuditEvent(ctx, tenantID, repository.AuditEvent{
+		Action: auditActionUserExport,
+		After:  after,
+	})
+	if err != nil {
+		return
+	}
+
+	return s.exportUsers(ctx, tenantID, w, export, filter)
+}
+
+// parse the format and the fields separated by comma, the invalid request error is returned for the unknown ones
+func newUserExport(format, fields string) (export userExport, err error) {
+	export.format = format
+	if export.format == "" {
+		export.format = FormatCSV
+	}
+	if _, ok := exportMediaTypes[export.format]; !ok {
+		return export, errInvalidRequest.withDetail("detail.invalid-format", map[string]interface{}{"formats": FormatCSV + ", " + FormatNDJSON})
+	}
+
+	if strings.TrimSpace(fields) == "" {
+		export.fields = userExportFields
+		return
+	}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if !isUserExportField(field) {
+			return export, errInvalidRequest.withDetail("detail.invalid-fields", map[string]interface{}{"fields": strings.Join(userExportFields, ", ")})
+		}
+		export.fields = append(export.fields, field)
+	}
+	return
+}
+
+// write the users of the tenant matching the filter into w and return the number of the exported users,
+// the error of w stops the export
+func (s Server) exportUsers(ctx context.Context, tenantID int64, w io.Writer, export userExport, filter repository.ProfileFilter) (count int, err error) {
+	buf := bufio.NewWriterSize(w, exportBufferSize)
+	var (
+		encode func(user repository.User) error
+		flush  = buf.Flush
+	)
+	switch export.format {
+	case FormatCSV:
+		writer := csv.NewWriter(buf)
+		encode = func(user repository.User) error {
+			return writer.Write(export.csvRecord(user))
+		}
+		flush = func() error {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+		err = writer.Write(export.fields)
+	case FormatNDJSON:
+		encoder := json.NewEncoder(buf)
+		encode = func(user repository.User) error {
+			return encoder.Encode(export.object(user))
+		}
+	}
+	if err != nil {
+		return count, errInternal.wrap(err)
+	}
+
+	err = s.Repository.ExportProfiles(ctx, tenantID, filter, func(user repository.User) error {
+		err := encode(user)
+		if err == nil {
+			count++
+		}
+		return err
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return count, errInternal.wrap(err)
+	}
+	return count, nil
+}
+
+// the values of the exported fields of the user, the null values are left empty
+func (e userExport) csvRecord(user repository.User) []string {
+	record := make([]string, 0, len(e.fields))
+	for _, field := range e.fields {
+		var value string
+		switch v := userExportValue(user, field).(type) {
+		case string:
+			value = v
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case int:
+			value = strconv.Itoa(v)
+		case time.Time:
+			value = v.Format(time.RFC3339Nano)
+		}
+		record = append(record, value)
+	}
+	return record
+}
+
+// the exported fields of the user as a JSON object
+func (e userExport) object(user repository.User) map[string]interface{} {
+	object := make(map[string]interface{}, len(e.fields))
+	for _, field := range e.fields {
+		object[field] = userExportValue(user, field)
+	}
+	return object
+}
+
+// the value of the exported field, nil for the null time and the empty optional text
+func userExportValue(user repository.User, field string) interface{} {
+	switch field {
+	case "id":
+		return user.ID
+	case "name":
+		return user.Name
+	case "phone":
+		return user.Phone
+	case "email":
+		return optionalText(user.Email)
+	case "email_verified_at":
+		return nullTimeValue(user.EmailVerifiedAt.Time, user.EmailVerifiedAt.Valid)
+	case "status":
+		return profileStatus(user)
+	case "status_reason":
+		return optionalText(user.StatusReason)
+	case "login_count":
+		return user.LoginCount
+	case "created_at":
+		return user.CreatedAt.UTC()
+	case "updated_at":
+		return nullTimeValue(user.UpdatedAt.Time, user.UpdatedAt.Valid)
+	case "deletion_scheduled_at":
+		return nullTimeValue(user.DeletionScheduledAt.Time, user.DeletionScheduledAt.Valid)
+	}
+	return nil
+}
+
+// the optional text of the export, nil when it is empty
+func optionalText(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// the nullable time of the export in UTC, nil when it is null
+func nullTimeValue(t time.Time, valid bool) interface{} {
+	if !valid {
+		return nil
+	}
+	return t.UTC()
+}
+
+// check whether the field is one of the fields the users can be exported with
+func isUserExportField(field string) bool {
+	for _, f := range userExportFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// the format, the fields and the filters of the export recorded in the audit trail
+func exportSummary(export userExport, filter repository.ProfileFilter) map[string]interface{} {
+	summary := map[string]interface{}{
+		"format": export.format,
+		"fields": strings.Join(export.fields, ","),
+	}
+	if filter.PhonePrefix != "" {
+		summary["phone"] = filter.PhonePrefix
+	}
+	if filter.Name != "" {
+		summary["name"] = filter.Name
+	}
+	if filter.CreatedFrom.Valid {
+		summary["created_from"] = filter.CreatedFrom.Time.UTC().Format(time.RFC3339)
+	}
+	if filter.CreatedTo.Valid {
+		summary["created_to"] = filter.CreatedTo.Time.UTC().Format(time.RFC3339)
+	}
+	if filter.Status != "" {
+		summary["status"] = filter.Status
+	}
+	if filter.MinLoginCount.Valid {
+		summary["min_login_count"] = filter.MinLoginCount.Int64
+	}
+	if filter.MaxLoginCount.Valid {
+		summary["max_login_count"] = filter.MaxLoginCount.Int64
+	}
+	return summary
+}
+
+// write the headers and the status of the response unless they have been written
+func (w *exportResponseWriter) commit() {
+	res := w.ctx.Response()
+	if res.Committed {
+		return
+	}
+	res.Header().Set(echo.HeaderContentType, exportMediaTypes[w.format])
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", w.filename))
+	res.WriteHeader(http.StatusOK)
+}
+
+// write the exported bytes into the response and send them to the client right away
+func (w *exportResponseWriter) Write(p []byte) (int, error) {
+	w.commit()
+	n, err := w.ctx.Response().Write(p)
+	if err != nil {
+		return n, err
+	}
+	w.ctx.Response().Flush()
+	return n, nil
+}
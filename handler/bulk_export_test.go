@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// export the given users from the mocked repository
+func exportUsersOf(users ...repository.User) func(context.Context, int64, repository.ProfileFilter, func(repository.User) error) error {
+	return func(_ context.Context, _ int64, _ repository.ProfileFilter, fn func(repository.User) error) error {
+		for _, user := range users {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestBulkExport(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		createdAt = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		narto     = repository.User{ID: 1, Name: "narto", Phone: "+6281234567890", Email: "narto@konoha.id", Password: "hash", LoginCount: 2, CreatedAt: createdAt}
+		sasuke    = repository.User{ID: 2, Name: "sasuke, uchiha", Phone: "+6281234567891", Password: "hash", Status: repository.ProfileStatusSuspended, StatusReason: "spam", CreatedAt: createdAt}
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name        string
+		format      string
+		fields      string
+		filter      repository.ProfileFilter
+		expectErr   error
+		expectCount int
+		expectBody  string
+		mock        func()
+	}{
+		{
+			name:      "err unknown format",
+			format:    "xml",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err unknown field",
+			fields:    "id,password",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err unknown status",
+			filter:    repository.ProfileFilter{Status: "deleted"},
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err audit",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:      "err export profiles",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().ExportProfiles(any, any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:        "success csv",
+			fields:      "id, name,status,email,created_at",
+			filter:      repository.ProfileFilter{PhonePrefix: "+62", MinLoginCount: sql.NullInt64{Int64: 1, Valid: true}},
+			expectCount: 2,
+			expectBody: "id,name,status,email,created_at\n" +
+				"1,narto,active,narto@konoha.id,2023-01-02T03:04:05Z\n" +
+				"2,\"sasuke, uchiha\",suspended,,2023-01-02T03:04:05Z\n",
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionUserExport, event.Action)
+					assert.False(t, event.ActorID.Valid)
+					assert.JSONEq(t, `{"format":"csv","fields":"id,name,status,email,created_at","phone":"+62","min_login_count":1}`, string(event.After))
+					return 1, nil
+				})
+				mockRepo.EXPECT().ExportProfiles(any, any, repository.ProfileFilter{PhonePrefix: "+62", MinLoginCount: sql.NullInt64{Int64: 1, Valid: true}}, any).
+					DoAndReturn(exportUsersOf(narto, sasuke))
+			},
+		},
+		{
+			name:        "success ndjson",
+			format:      FormatNDJSON,
+			expectCount: 1,
+			expectBody: `{"created_at":"2023-01-02T03:04:05Z","deletion_scheduled_at":null,"email":null,"email_verified_at":null,"id":2,` +
+				`"login_count":0,"name":"sasuke, uchiha","phone":"+6281234567891","status":"suspended","status_reason":"spam","updated_at":null}` + "\n",
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().ExportProfiles(any, any, any, any).DoAndReturn(exportUsersOf(sasuke))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			var buf bytes.Buffer
+			count, err := server.BulkExport(context.Background(), 1, &buf, tt.format, tt.fields, tt.filter)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectCount, count)
+			assert.Equal(t, tt.expectBody, buf.String())
+			assert.NotContains(t, buf.String(), "hash")
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+)
+
+const (
+	// DefaultDeletionGracePeriod is how long the account deletion can be cancelled before the account is purged
+	DefaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+	// DefaultPurgeInterval is how often the purge job looks for the accounts whose grace period has passed
+	DefaultPurgeInterval = time.Hour
+
+	// the accounts are purged in batches so a large backlog does not hold a long running query
+	purgeBatchSize = 100
+)
+
+// the error of the account scheduled for deletion, which can neither sign in nor use its tokens until the deletion is cancelled
+func pendingDeletionError(purgeAt time.Time) error {
+	return errPendingDeletion.withDetail("detail.pending-deletion", map[string]interface{}{
+		"purge_at": purgeAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// PurgeProfiles permanently deletes the accounts of every tenant whose deletion grace period has passed together with
+// their related data and avatar images, and returns the number of purged accounts. The audit trail is append-only
+// so the previous events of the purged accounts are kept.
+func (s Server) PurgeProfiles(ctx context.Context) (purged int, err error) {
+	tenants, err := s.Repository.GetTenants(ctx)
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, tenant := range tenants {
+		var n int
+		n, err = s.purgeTenantProfiles(ctx, tenant.ID, now)
+		purged += n
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// purge the accounts of the tenant whose deletion schedule has passed the given time
+func (s Server) purgeTenantProfiles(ctx context.Context, tenantID int64, now time.Time) (purged int, err error) {
+	for {
+		var users []repository.User
+		users, err = s.Repository.GetProfilesToPurge(ctx, tenantID, now, purgeBatchSize)
+		if err != nil {
+			return
+		}
+
+		for _, user := range users {
+			err = s.Repository.PurgeProfile(ctx, tenantID, user.ID, now)
+			if err == sql.ErrNoRows {
+				// the deletion has been cancelled in the meantime
+				continue
+			}
+			if err != nil {
+				return
+			}
+			purged++
+
+			// the orphan avatar images are harmless, so the failure is only logged
+			if user.AvatarKey != "" {
+				for _, size := range avatarSizes {
+					blobErr := s.blobs.Delete(ctx, avatarBlobKey(user.AvatarKey, size))
+					if blobErr != nil {
+						log.Printf("purge: profile=%d delete avatar: %v", user.ID, blobErr)
+					}
+				}
+			}
+
+			_, err = s.Repository.SaveAuditEvent(ctx, tenantID, repository.AuditEvent{
+				TargetID: nullID(user.ID),
+				Action:   auditActionPurge,
+			})
+			if err != nil {
+				return
+			}
+		}
+
+		if len(users) < purgeBatchSize {
+			return
+		}
+	}
+}
+
+// RunPurgeJob purges the accounts whose deletion grace period has passed every interval until the context is done,
+// the failures are written into the application log and retried on the next interval
+func (s Server) RunPurgeJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeProfiles(ctx)
+		if err != nil {
+			log.Printf("purge: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("purge: %d accounts have been deleted", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
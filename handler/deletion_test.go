@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeProfiles(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+		blobs    = &stubBlobStore{}
+
+		// request and response mock
+		any         = gomock.Any()
+		mockErr     = errors.New("an error")
+		mockUser    = repository.User{ID: 1, AvatarKey: "avatars/1/abc"}
+		mockTenants = []repository.Tenant{{ID: 1}}
+		avatar      = avatarBlobKey(mockUser.AvatarKey, avatarSize)
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), BlobStore: blobs})
+	)
+
+	// a full batch is followed by another batch
+	fullBatch := make([]repository.User, purgeBatchSize)
+	for i := range fullBatch {
+		fullBatch[i] = repository.User{ID: int64(i + 2)}
+	}
+
+	test := []struct {
+		name                string
+		expectErr           error
+		expectPurged        int
+		expectAvatarDeleted bool
+		mock                func()
+	}{
+		{
+			name:      "err get tenants",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get profiles",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(mockTenants, nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, purgeBatchSize).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err purge profile",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(mockTenants, nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, any).Return([]repository.User{mockUser}, nil)
+				mockRepo.EXPECT().PurgeProfile(any, int64(1), int64(1), any).Return(mockErr)
+			},
+		},
+		{
+			name:         "err save audit event",
+			expectErr:    mockErr,
+			expectPurged: 1,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(mockTenants, nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, any).Return([]repository.User{mockUser}, nil)
+				mockRepo.EXPECT().PurgeProfile(any, int64(1), int64(1), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, int64(1), any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:                "success skip cancelled deletion",
+			expectPurged:        1,
+			expectAvatarDeleted: true,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(mockTenants, nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, any).Return([]repository.User{{ID: 2}, mockUser}, nil)
+				mockRepo.EXPECT().PurgeProfile(any, int64(1), int64(2), any).Return(sql.ErrNoRows)
+				mockRepo.EXPECT().PurgeProfile(any, int64(1), int64(1), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, int64(1), gomock.AssignableToTypeOf(repository.AuditEvent{})).
+					DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+						assert.Equal(t, auditActionPurge, event.Action)
+						assert.Equal(t, int64(1), event.TargetID.Int64)
+						return 1, nil
+					})
+			},
+		},
+		{
+			name:         "success multiple batches",
+			expectPurged: purgeBatchSize,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(mockTenants, nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, any).Return(fullBatch, nil)
+				mockRepo.EXPECT().PurgeProfile(any, int64(1), any, any).Return(nil).Times(purgeBatchSize)
+				mockRepo.EXPECT().SaveAuditEvent(any, int64(1), any).Return(int64(1), nil).Times(purgeBatchSize)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, any).Return(nil, nil)
+			},
+		},
+		{
+			name:         "success every tenant",
+			expectPurged: 2,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}, {ID: 2}}, nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(1), any, any).Return([]repository.User{{ID: 2}}, nil)
+				mockRepo.EXPECT().PurgeProfile(any, int64(1), int64(2), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, int64(1), any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetProfilesToPurge(any, int64(2), any, any).Return([]repository.User{{ID: 3}}, nil)
+				mockRepo.EXPECT().PurgeProfile(any, int64(2), int64(3), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, int64(2), any).Return(int64(2), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs.blobs = map[string][]byte{avatar: []byte("image")}
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			purged, err := server.PurgeProfiles(context.Background())
+			assert.Equal(t, tt.expectPurged, purged)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.expectAvatarDeleted {
+				assert.NotContains(t, blobs.blobs, avatar)
+			}
+		})
+	}
+}
+
+func TestRunPurgeJob(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		any = gomock.Any()
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil).Times(2)
+	mockRepo.EXPECT().GetProfilesToPurge(any, any, any, any).Return(nil, errors.New("an error"))
+	mockRepo.EXPECT().GetProfilesToPurge(any, any, any, any).Return([]repository.User{{ID: 1}}, nil)
+	mockRepo.EXPECT().PurgeProfile(any, any, int64(1), any).Return(nil)
+	mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, _ repository.AuditEvent) (int64, error) {
+		// stop the job once the second run has purged the account
+		cancel()
+		return 1, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		server.RunPurgeJob(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the purge job has not stopped")
+	}
+}
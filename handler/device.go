@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// generate the device fingerprint from the client supplied device id and the user agent
+func deviceFingerprint(deviceID, userAgent string) string {
+	sum := sha256.Sum256([]byte(deviceID + "\n" + userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+// remember the device used to sign in and notify the user when the device has never been used before.
+// the first device of a profile will not be notified since there is no known device to compare with,
+// and the user can turn the notification off with the "notifications.new_device_login" preference.
+func (s Server) trackDevice(ctx echo.Context, user repository.User, deviceID string) error {
+	var (
+		userAgent   = ctx.Request().UserAgent()
+		fingerprint = deviceFingerprint(deviceID, userAgent)
+	)
+
+	device, err := s.Repository.GetDeviceByFingerprint(ctx.Request().Context(), tenantID(ctx), user.ID, fingerprint)
+	if err == nil {
+		err = s.Repository.UpdateDeviceLastSeen(ctx.Request().Context(), tenantID(ctx), device.ID)
+		if err != nil {
+			return errInternal.wrap(err)
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return errInternal.wrap(err)
+	}
+
+	known, err := s.Repository.HasDevices(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	_, err = s.Repository.SaveDevice(ctx.Request().Context(), tenantID(ctx), repository.Device{
+		ProfileID:   user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   userAgent,
+	})
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	if !known || !s.wantsNewDeviceLogin(ctx, user.ID) {
+		return nil
+	}
+
+	// failing to deliver the notification should not prevent the user from signing in
+	err = s.notifier.NotifyNewDeviceLogin(ctx.Request().Context(), NewDeviceLoginEvent{
+		ProfileID: user.ID,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		DeviceID:  deviceID,
+		UserAgent: userAgent,
+		IPAddress: ctx.RealIP(),
+		LoginAt:   time.Now(),
+	})
+	if err != nil {
+		ctx.Logger().Errorf("failed to notify new device login: %v", err)
+	}
+
+	return nil
+}
+
+// check whether the user wants to be notified of the sign in from a new device, the notification is enabled
+// when the preference can not be read so a failing preference store never silences it
+func (s Server) wantsNewDeviceLogin(ctx echo.Context, profileID int64) bool {
+	saved, err := s.Repository.GetPreferences(ctx.Request().Context(), tenantID(ctx), profileID)
+	if err != nil {
+		ctx.Logger().Errorf("failed to get the new device login preference: %v", err)
+		return true
+	}
+
+	var notifications struct {
+		NewDeviceLogin *bool `json:"new_device_login"`
+	}
+	err = json.Unmarshal(s.withDefaultPreferences(saved)["notifications"], &notifications)
+	return err != nil || notifications.NewDeviceLogin == nil || *notifications.NewDeviceLogin
+}
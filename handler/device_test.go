@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// notifier stub which records the delivered events
+type stubNotifier struct {
+	err    error
+	events []NewDeviceLoginEvent
+}
+
+func (n *stubNotifier) NotifyNewDeviceLogin(ctx context.Context, event NewDeviceLoginEvent) error {
+	n.events = append(n.events, event)
+	return n.err
+}
+
+func TestDeviceFingerprint(t *testing.T) {
+	assert.Equal(t, deviceFingerprint("device-1", "curl/8.0"), deviceFingerprint("device-1", "curl/8.0"))
+	assert.NotEqual(t, deviceFingerprint("device-1", "curl/8.0"), deviceFingerprint("device-2", "curl/8.0"))
+	assert.NotEqual(t, deviceFingerprint("device-1", "curl/8.0"), deviceFingerprint("device-1", "curl/8.1"))
+	assert.Len(t, deviceFingerprint("", ""), 64)
+}
+
+func TestTrackDevice(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any           = gomock.Any()
+		mockErr       = errors.New("an error")
+		mockUser      = repository.User{ID: 1, LoginCount: 3}
+		mockOptOut    = repository.Preferences{"notifications": []byte(`{"email": true, "new_device_login": false}`)}
+		mockPartial   = repository.Preferences{"notifications": []byte(`{"email": false}`)}
+		mockUserAgent = "curl/8.0"
+
+		// echo server mock
+		e = echo.New()
+	)
+
+	test := []struct {
+		name         string
+		user         repository.User
+		notifierErr  error
+		expectErr    bool
+		expectNotify bool
+		mock         func()
+	}{
+		{
+			name:      "err get device",
+			user:      mockUser,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, mockErr)
+			},
+		},
+		{
+			name:      "err update last seen",
+			user:      mockUser,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{ID: 1}, nil)
+				mockRepo.EXPECT().UpdateDeviceLastSeen(any, any, int64(1)).Return(mockErr)
+			},
+		},
+		{
+			name: "known device",
+			user: mockUser,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{ID: 1}, nil)
+				mockRepo.EXPECT().UpdateDeviceLastSeen(any, any, int64(1)).Return(nil)
+			},
+		},
+		{
+			name:      "err has devices",
+			user:      mockUser,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(false, mockErr)
+			},
+		},
+		{
+			name:      "err save device",
+			user:      mockUser,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(true, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			// the profiles signed in before the devices were tracked have a login count but no known device
+			name: "first device is not notified",
+			user: mockUser,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(false, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:         "new device is notified",
+			user:         mockUser,
+			expectNotify: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(true, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, repository.Device{
+					ProfileID:   mockUser.ID,
+					Fingerprint: deviceFingerprint("device-1", mockUserAgent),
+					UserAgent:   mockUserAgent,
+				}).Return(int64(1), nil)
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(repository.Preferences{}, nil)
+			},
+		},
+		{
+			name: "new device is not notified when the preference is off",
+			user: mockUser,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(true, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(mockOptOut, nil)
+			},
+		},
+		{
+			name:         "new device is notified when the preference is omitted",
+			user:         mockUser,
+			expectNotify: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(true, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(mockPartial, nil)
+			},
+		},
+		{
+			name:         "failed preference does not silence the notification",
+			user:         mockUser,
+			expectNotify: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(true, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:         "failed notification does not fail the login",
+			user:         mockUser,
+			notifierErr:  mockErr,
+			expectNotify: true,
+			mock: func() {
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, sql.ErrNoRows)
+				mockRepo.EXPECT().HasDevices(any, any, int64(1)).Return(true, nil)
+				mockRepo.EXPECT().SaveDevice(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(nil, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			notifier := &stubNotifier{err: tt.notifierErr}
+			server := NewServer(NewServerOptions{
+				Repository:    mockRepo,
+				RSAPrivateKey: getDummyRSAKey(),
+				Notifier:      notifier,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/authenticate", nil)
+			req.Header.Set("User-Agent", mockUserAgent)
+			c := e.NewContext(req, httptest.NewRecorder())
+			err := server.trackDevice(c, tt.user, "device-1")
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tt.expectNotify {
+				assert.Len(t, notifier.events, 1)
+				assert.Equal(t, "device-1", notifier.events[0].DeviceID)
+				assert.Equal(t, mockUserAgent, notifier.events[0].UserAgent)
+			} else {
+				assert.Empty(t, notifier.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// the single-use link sent to verify the ownership of an email
+	emailVerificationTTL     = 24 * time.Hour
+	emailVerificationPath    = "/email/verify"
+	emailVerificationPurpose = "email-verification"
+
+	defaultPublicURL = "http://localhost:1323"
+)
+
+// the claim of the email verification token, the id is the email_verification row
+// and the subject is the profile id
+type emailVerificationClaim struct {
+	jwt.StandardClaims
+	Email string `json:"email"`
+}
+
+// lower case the email so the same address can not be registered twice with different cases
+func normalizeEmail(raw string) string {
+	return strings.ToLower(strings.TrimSpace(raw))
+}
+
+// sign the email verification token
+func generateEmailVerificationToken(key *rsa.PrivateKey, verification repository.EmailVerification) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, emailVerificationClaim{
+		StandardClaims: jwt.StandardClaims{
+			Id:        verification.ID,
+			Subject:   strconv.FormatInt(verification.ProfileID, 10),
+			ExpiresAt: verification.ExpiresAt.Unix(),
+		},
+		Email: verification.Email,
+	})
+	return token.SignedString(purposeKey(key, emailVerificationPurpose))
+}
+
+// verify the signature and the expiry of the email verification token and return the verification inside its claim,
+// whether the verification has been used is checked by the repository
+func parseEmailVerificationToken(key *rsa.PrivateKey, token string) (verification repository.EmailVerification, err error) {
+	var claim emailVerificationClaim
+	_, err = jwt.ParseWithClaims(token, &claim, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return purposeKey(key, emailVerificationPurpose), nil
+	})
+	if err != nil {
+		return
+	}
+
+	profileID, err := strconv.ParseInt(claim.Subject, 10, 64)
+	if err != nil {
+		return
+	}
+	if claim.Id == "" || claim.Email == "" {
+		err = errors.New("incomplete email verification token")
+		return
+	}
+
+	verification = repository.EmailVerification{
+		ID:        claim.Id,
+		ProfileID: profileID,
+		Email:     claim.Email,
+		ExpiresAt: time.Unix(claim.ExpiresAt, 0),
+	}
+	return
+}
+
+// send a new verification link to the user email in the language requested by the client
+func (s Server) sendEmailVerification(ctx echo.Context, user repository.User) (verification repository.EmailVerification, err error) {
+	id, err := generateRandomID()
+	if err != nil {
+		return
+	}
+
+	verification = repository.EmailVerification{
+		ID:        id,
+		ProfileID: user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(emailVerificationTTL).Truncate(time.Second),
+	}
+	err = s.Repository.SaveEmailVerification(ctx.Request().Context(), tenantID(ctx), verification)
+	if err != nil {
+		return
+	}
+
+	token, err := generateEmailVerificationToken(s.rsaPrivateKey, verification)
+	if err != nil {
+		return
+	}
+
+	lang := catalog.Match(ctx.Request().Header.Get(HeaderAcceptLanguage))
+	params := map[string]interface{}{
+		"name": user.Name,
+		"link": s.tenantLink(tenantOf(ctx), emailVerificationPath, url.Values{"token": {token}}),
+	}
+	err = s.mailer.SendMail(ctx.Request().Context(), Mail{
+		To:      user.Email,
+		Subject: catalog.Message(lang, "mail.email-verification.subject", nil),
+		Body:    catalog.Message(lang, "mail.email-verification.body", params),
+	})
+	return
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "narto@example.com", normalizeEmail(" Narto@Example.COM "))
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+	var (
+		key          = getDummyRSAKey()
+		verification = repository.EmailVerification{
+			ID:        "abc",
+			ProfileID: 1,
+			Email:     "narto@example.com",
+			ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+		}
+	)
+
+	valid, err := generateEmailVerificationToken(key, verification)
+	assert.NoError(t, err)
+
+	expired := verification
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+	expiredToken, err := generateEmailVerificationToken(key, expired)
+	assert.NoError(t, err)
+
+	incomplete := verification
+	incomplete.Email = ""
+	incompleteToken, err := generateEmailVerificationToken(key, incomplete)
+	assert.NoError(t, err)
+
+	// the bearer token is signed by another key so it can not be used to verify the email
+	bearer, err := generateToken(key, 0, repository.User{ID: 1}, nil, nil, nil)
+	assert.NoError(t, err)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr bool
+	}{
+		{name: "err malformed", token: "asd", expectErr: true},
+		{name: "err bearer token", token: bearer, expectErr: true},
+		{name: "err expired", token: expiredToken, expectErr: true},
+		{name: "err incomplete claim", token: incompleteToken, expectErr: true},
+		{name: "success", token: valid},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEmailVerificationToken(key, tt.token)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, verification.ID, got.ID)
+			assert.Equal(t, verification.ProfileID, got.ProfileID)
+			assert.Equal(t, verification.Email, got.Email)
+			assert.True(t, verification.ExpiresAt.Equal(got.ExpiresAt))
+		})
+	}
+}
+
+func TestSendEmailVerification(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+		mailer   = &MemoryMailer{}
+
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		user    = repository.User{ID: 1, Name: "narto", Email: "narto@example.com"}
+
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), Mailer: mailer, PublicURL: "https://example.com/"})
+	)
+
+	newContext := func() echo.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(HeaderAcceptLanguage, "id")
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	mockRepo.EXPECT().SaveEmailVerification(any, any, any).Return(mockErr)
+	_, err := server.sendEmailVerification(newContext(), user)
+	assert.ErrorIs(t, err, mockErr)
+	assert.Empty(t, mailer.Mails())
+
+	mockRepo.EXPECT().SaveEmailVerification(any, any, any).Return(nil)
+	verification, err := server.sendEmailVerification(newContext(), user)
+	assert.NoError(t, err)
+	assert.Equal(t, user.Email, verification.Email)
+
+	mails := mailer.Mails()
+	if assert.Len(t, mails, 1) {
+		assert.Equal(t, user.Email, mails[0].To)
+		assert.Equal(t, "Verifikasi alamat email Anda", mails[0].Subject)
+
+		// the link sent in the mail verifies the saved verification
+		i := strings.Index(mails[0].Body, "https://example.com/email/verify?token=")
+		if assert.GreaterOrEqual(t, i, 0) {
+			link, err := url.Parse(strings.Fields(mails[0].Body[i:])[0])
+			assert.NoError(t, err)
+
+			got, err := parseEmailVerificationToken(server.rsaPrivateKey, link.Query().Get("token"))
+			assert.NoError(t, err)
+			assert.Equal(t, verification.ID, got.ID)
+		}
+	}
+}
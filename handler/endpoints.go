@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/basriyasin/sp-user/generated"
 	"github.com/basriyasin/sp-user/repository"
@@ -16,35 +22,58 @@ func (s Server) Register(ctx echo.Context) error {
 	var req generated.RegisterRequest
 	err := ctx.Bind(&req)
 	if err != nil {
-		return echo.ErrBadRequest
+		return errInvalidRequest.wrap(err)
+	}
+
+	phone, phoneErr := s.normalizePhone("phone", req.Phone)
+	terms, termsErr, err := s.checkTermsVersion(ctx, "terms_version", req.TermsVersion)
+	if err != nil {
+		return err
 	}
 
 	user := repository.User{
 		Name:     req.Name,
-		Phone:    req.Phone,
+		Phone:    phone,
 		Password: req.Password,
 	}
-	err = Validate(user)
+	err = withFieldError(withFieldError(Validate(user), phoneErr), termsErr)
 	if err != nil {
-		return err
+		return validationError(err)
 	}
 
 	bytes, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return ctx.JSON(http.StatusBadRequest, err)
+		return errInternal.wrap(err)
 	}
 
 	user.Password = string(bytes)
-	userID, err := s.Repository.SaveProfile(ctx.Request().Context(), user)
+
+	// the profile is saved together with the accepted terms of service, so a failed registration saves neither and can be retried
+	after := map[string]interface{}{"name": user.Name, "phone": user.Phone}
+	if terms.Version != "" {
+		user, err = s.Repository.SaveProfileWithConsent(ctx.Request().Context(), tenantID(ctx), user, newConsent(ctx, 0, terms.Version))
+		after["terms_version"] = terms.Version
+	} else {
+		user, err = s.Repository.SaveProfile(ctx.Request().Context(), tenantID(ctx), user)
+	}
+	if err == repository.ErrDuplicate {
+		return errPhoneConflict
+	}
 	if err != nil {
-		return err
+		return errInternal.wrap(err)
 	}
 
-	return ctx.JSON(http.StatusOK, generated.Profile{
-		Id:    &userID,
-		Name:  req.Name,
-		Phone: req.Phone,
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionRegister,
+		After:    after,
 	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, s.toProfileResponse(user))
 }
 
 // [POST] /authenticate
@@ -54,110 +83,2135 @@ func (s Server) Authenticate(ctx echo.Context) error {
 	var req generated.AuthenticateRequest
 	err := ctx.Bind(&req)
 	if err != nil {
-		return err
+		return errInvalidRequest.wrap(err)
 	}
 
-	user, err := s.Repository.GetProfileByPhone(ctx.Request().Context(), req.Phone)
+	user, err := s.checkCredentials(ctx, req)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return echo.ErrBadRequest
+		return err
+	}
+
+	// the account scheduled for deletion can only be used to cancel the deletion
+	if user.DeletionScheduledAt.Valid {
+		err = s.audit(ctx, auditRecord{
+			TargetID: user.ID,
+			Action:   auditActionLoginFailed,
+			After:    map[string]interface{}{"reason": "pending_deletion"},
+		})
+		if err != nil {
+			return err
 		}
-		return echo.ErrInternalServerError
+		return pendingDeletionError(user.DeletionScheduledAt.Time)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	roles, permissions, err := s.userAccess(ctx, user.ID)
 	if err != nil {
-		return echo.ErrBadRequest
+		return errInternal.wrap(err)
 	}
 
-	token, err := generateToken(s.rsaPrivateKey, user)
+	orgs, err := s.userOrganizations(ctx, user.ID)
 	if err != nil {
-		return err
+		return errInternal.wrap(err)
+	}
+
+	token, err := generateToken(s.rsaPrivateKey, tenantID(ctx), user, roles, permissions, orgs)
+	if err != nil {
+		return errInternal.wrap(err)
 	}
 
-	err = s.Repository.UpdateLoginCount(ctx.Request().Context(), user.ID, user.LoginCount+1)
+	// the sign in is recorded before it takes effect, so a sign in is never left out of the audit trail
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionLogin,
+	})
 	if err != nil {
 		return err
 	}
 
-	createdAt := user.CreatedAt.Format(DateTimeFormat)
-	var updatedAt string
-	if user.UpdatedAt.Valid {
-		updatedAt = user.UpdatedAt.Time.Format(DateTimeFormat)
+	err = s.Repository.UpdateLoginCount(ctx.Request().Context(), tenantID(ctx), user.ID, user.LoginCount+1)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	var deviceID string
+	if req.DeviceId != nil {
+		deviceID = *req.DeviceId
 	}
+	err = s.trackDevice(ctx, user, deviceID)
+	if err != nil {
+		return err
+	}
+
+	profile := s.toProfileResponse(user)
 	return ctx.JSON(http.StatusOK, generated.AuthenticateResponse{
-		Id:        &user.ID,
-		Name:      user.Name,
-		Phone:     user.Phone,
-		Token:     token,
-		UpdateAt:  &updatedAt,
-		CreatedAt: &createdAt,
+		Id:              profile.Id,
+		Name:            profile.Name,
+		Phone:           profile.Phone,
+		Email:           profile.Email,
+		EmailVerifiedAt: profile.EmailVerifiedAt,
+		CreatedAt:       profile.CreatedAt,
+		UpdatedAt:       profile.UpdatedAt,
+		UpdateAt:        profile.UpdateAt,
+		Token:           token,
+		Roles:           roles,
+		Permissions:     permissions,
 	})
 }
 
+// find the profile by the phone or email of the request and compare the password,
+// every failed attempt is recorded into the audit trail
+func (s Server) checkCredentials(ctx echo.Context, req generated.AuthenticateRequest) (user repository.User, err error) {
+	// the email is used when both are provided and only the verified email can be used to sign in,
+	// the invalid phone number is looked up as is, so it fails as an unknown phone number
+	var identifier map[string]interface{}
+	switch {
+	case req.Email != nil && *req.Email != "":
+		email := normalizeEmail(*req.Email)
+		identifier = map[string]interface{}{"email": email}
+		user, err = s.Repository.GetProfileByEmail(ctx.Request().Context(), tenantID(ctx), email)
+	case req.Phone != nil && *req.Phone != "":
+		phone, _ := s.normalizePhone("phone", *req.Phone)
+		identifier = map[string]interface{}{"phone": phone}
+		user, err = s.Repository.GetProfileByPhone(ctx.Request().Context(), tenantID(ctx), phone)
+	default:
+		return user, validationError(ValidationErrors{*newFieldError("phone", "required", nil)})
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = s.audit(ctx, auditRecord{
+				Action: auditActionLoginFailed,
+				After:  identifier,
+			})
+			if err != nil {
+				return
+			}
+			return user, errInvalidCredentials
+		}
+		return user, errInternal.wrap(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	if err != nil {
+		err = s.audit(ctx, auditRecord{
+			TargetID: user.ID,
+			Action:   auditActionLoginFailed,
+		})
+		if err != nil {
+			return
+		}
+		return user, errInvalidCredentials
+	}
+
+	// the suspended or disabled account is only told apart once the password is confirmed
+	if statusErr := accountStatusError(user.Status); statusErr != nil {
+		err = s.audit(ctx, auditRecord{
+			TargetID: user.ID,
+			Action:   auditActionLoginFailed,
+			After:    map[string]interface{}{"reason": user.Status},
+		})
+		if err != nil {
+			return
+		}
+		return user, statusErr
+	}
+	return
+}
+
 // [GET] /profile
 // retrieve the latest profile information of the currently logged-in user
 func (s Server) Profile(ctx echo.Context) error {
-	user, err := verifyToken(ctx, s.rsaPrivateKey)
+	user, err := s.verifyUser(ctx)
 	if err != nil {
 		return err
 	}
 
 	// get latest updated profile
-	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), user.ID)
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
 	if err != nil {
-		return err
+		return errInternal.wrap(err)
 	}
 
-	return ctx.JSON(http.StatusOK, generated.Profile{
-		Name:  user.Name,
-		Phone: user.Phone,
-	})
+	return s.writeProfile(ctx, user)
 }
 
 // [PUT] /profile
-// update the current logged-in user's name or phone number if the provided information is valid.
-func (s Server) UpdateProfile(ctx echo.Context) (err error) {
-	user, err := verifyToken(ctx, s.rsaPrivateKey)
+// update the current logged-in user's name, phone number or email if the provided information is valid.
+func (s Server) UpdateProfile(ctx echo.Context, params generated.UpdateProfileParams) (err error) {
+	user, err := s.verifyUser(ctx)
 	if err != nil {
-		return echo.ErrForbidden
+		return err
+	}
+
+	if params.IfMatch == nil || *params.IfMatch == "" {
+		return errPreconditionReq
 	}
 
 	var req generated.Profile
 	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	// the empty fields are considered as not provided
+	var changes profileChanges
+	if req.Name != "" {
+		changes.Name = &req.Name
+	}
+	if req.Phone != "" {
+		changes.Phone = &req.Phone
+	}
+	if req.Email != nil && *req.Email != "" {
+		changes.Email = req.Email
+	}
+
+	return s.updateProfile(ctx, user.ID, *params.IfMatch, changes, nil)
+}
+
+// [PATCH] /profile
+// partially update the current logged-in user's profile with JSON merge patch (RFC 7386),
+// only the provided fields are validated and updated
+func (s Server) PatchProfile(ctx echo.Context, params generated.PatchProfileParams) error {
+	user, err := s.verifyUser(ctx)
 	if err != nil {
 		return err
 	}
 
-	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), user.ID)
+	if params.IfMatch == nil || *params.IfMatch == "" {
+		return errPreconditionReq
+	}
+
+	if !isMergePatch(ctx) {
+		return errUnsupportedMedia.withDetail("detail.expected-content-type", map[string]interface{}{
+			"content_type": MIMEApplicationMergePatchJSON,
+		})
+	}
+
+	changes, invalid, err := decodeProfilePatch(ctx.Request().Body)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	return s.updateProfile(ctx, user.ID, *params.IfMatch, changes, invalid)
+}
+
+// apply the changes into the user profile when the If-Match matches the current profile version,
+// the invalid field errors found while decoding the request are reported along with the validation errors of the changed fields
+func (s Server) updateProfile(ctx echo.Context, userID int64, ifMatch string, changes profileChanges, invalid ValidationErrors) error {
+	user, err := s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), userID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = checkIfMatch(ifMatch, user)
 	if err != nil {
 		return err
 	}
+	before := map[string]interface{}{"name": user.Name, "phone": user.Phone, "email": user.Email}
+	previousEmail := user.Email
+
+	// only the provided fields are updated and validated,
+	// the phone number can only be changed by confirming the OTP sent to the new phone number
+	var (
+		fields   []string
+		phoneErr *FieldError
+	)
+	if changes.Name != nil {
+		user.Name = *changes.Name
+		fields = append(fields, "Name")
+	}
+	if changes.Email != nil {
+		user.Email = normalizeEmail(*changes.Email)
+		fields = append(fields, "Email")
+	}
+	if changes.Phone != nil {
+		var phone string
+		phone, phoneErr = s.normalizePhone("phone", *changes.Phone)
+		if phoneErr == nil && phone != user.Phone {
+			phoneErr = newFieldError("phone", "verification_required", nil)
+		}
+	}
 
-	hasValidName := isValidName(req.Name)
-	if hasValidName {
-		user.Name = req.Name
+	if len(fields) == 0 && len(invalid) == 0 && phoneErr == nil {
+		return s.writeProfile(ctx, user)
 	}
 
-	hasValidPhone := isValidPhone(req.Phone)
-	if hasValidPhone {
-		user.Phone = req.Phone
+	if len(fields) > 0 {
+		err = ValidatePartial(user, fields...)
+	}
+	err = withFieldError(err, phoneErr)
+	for i := range invalid {
+		err = withFieldError(err, &invalid[i])
+	}
+	if err != nil {
+		return validationError(err)
 	}
 
-	if !hasValidName && !hasValidPhone {
-		return ctx.JSON(http.StatusOK, generated.Profile{
-			Name:  user.Name,
-			Phone: user.Phone,
-		})
+	user, err = s.Repository.UpdateUserByID(ctx.Request().Context(), tenantID(ctx), user, actorID(ctx, user.ID))
+	if err == repository.ErrDuplicate {
+		return errPhoneConflict
+	}
+	if err == repository.ErrDuplicateEmail {
+		return errEmailConflict
+	}
+	if err == repository.ErrVersionMismatch {
+		return errPreconditionFailed
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionProfileUpdate,
+		Before:   before,
+		After:    map[string]interface{}{"name": user.Name, "phone": user.Phone, "email": user.Email},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the update is kept when the verification link fails to be sent since the user can request a new one
+	if user.Email != "" && user.Email != previousEmail {
+		_, err = s.sendEmailVerification(ctx, user)
+		if err != nil {
+			ctx.Logger().Error(err)
+		}
+	}
+
+	return s.writeProfile(ctx, user)
+}
+
+// [DELETE] /profile
+// schedule the deletion of the current logged-in user's account once the password is confirmed,
+// the account can not be used to sign in and is purged by the purge job once the grace period has passed
+func (s Server) DeleteProfile(ctx echo.Context) error {
+	user, err := s.verifyAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.ProfileDeletionRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	if err != nil {
+		return errInvalidCredentials
+	}
+
+	// the organizations would be left without anyone able to manage them
+	owned, err := s.Repository.GetSoleOwnerMemberships(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	if len(owned) > 0 {
+		names := make([]string, 0, len(owned))
+		for _, m := range owned {
+			names = append(names, m.OrganizationName)
+		}
+		return errLastOwner.withDetail("detail.sole-owner", map[string]interface{}{"organizations": strings.Join(names, ", ")})
+	}
+
+	purgeAt := time.Now().UTC().Add(s.deletionGrace).Truncate(time.Second)
+	scheduledAt, err := s.Repository.ScheduleProfileDeletion(ctx.Request().Context(), tenantID(ctx), user.ID, purgeAt)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionDeletion,
+		After:    map[string]interface{}{"purge_at": scheduledAt.UTC().Format(time.RFC3339)},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, generated.ProfileDeletionResponse{
+		PurgeAt: scheduledAt.UTC(),
+	})
+}
+
+// [POST] /profile/deletion/cancel
+// cancel the scheduled deletion of the account within the grace period, the credentials are required
+// instead of the token since the account can not be used to sign in while it is scheduled for deletion
+func (s Server) CancelProfileDeletion(ctx echo.Context) error {
+	var req generated.AuthenticateRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	user, err := s.checkCredentials(ctx, req)
+	if err != nil {
+		return err
+	}
+	if !user.DeletionScheduledAt.Valid {
+		return errNotFound.withDetail("detail.deletion-not-found", nil)
+	}
+
+	err = s.Repository.CancelProfileDeletion(ctx.Request().Context(), tenantID(ctx), user.ID, time.Now().UTC())
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.deletion-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionDeletionAbort,
+		Before:   map[string]interface{}{"purge_at": user.DeletionScheduledAt.Time.UTC().Format(time.RFC3339)},
+	})
+	if err != nil {
+		return err
+	}
+
+	user.DeletionScheduledAt = sql.NullTime{}
+	return s.writeProfile(ctx, user)
+}
+
+// [POST] /profile/phone-change
+// send an OTP to the new phone number, the phone number is only changed once the OTP is confirmed
+func (s Server) RequestPhoneChange(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.PhoneChangeRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	phone, phoneErr := s.normalizePhone("phone", req.Phone)
+	err = withFieldError(ValidatePartial(repository.User{Phone: phone}, "Phone"), phoneErr)
+	if err != nil {
+		return validationError(err)
+	}
+
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	if phone == user.Phone {
+		return validationError(ValidationErrors{*newFieldError("phone", "unchanged", nil)})
+	}
+
+	// the phone number is checked again when the change is confirmed as it may be registered in the meantime
+	_, err = s.Repository.GetProfileByPhone(ctx.Request().Context(), tenantID(ctx), phone)
+	if err == nil {
+		return errPhoneConflict
+	}
+	if err != sql.ErrNoRows {
+		return errInternal.wrap(err)
+	}
+
+	// the pending change limits how often an OTP is sent, and its failed attempts are kept
+	// when a new OTP is requested for the same phone number so they can not be reset by requesting again
+	var attempts int
+	pending, err := s.Repository.GetPhoneChange(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return errInternal.wrap(err)
+	}
+	if err == nil && time.Now().Before(pending.ExpiresAt) {
+		if pending.Phone == phone && pending.Attempts >= otpMaxAttempts {
+			return otpLockedError(pending.ExpiresAt)
+		}
+		if wait := time.Until(pending.ExpiresAt.Add(otpResendCooldown - otpTTL)); wait > 0 {
+			return otpCooldownError(wait)
+		}
+		if pending.Phone == phone {
+			attempts = pending.Attempts
+		}
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	change := repository.PhoneChange{
+		ProfileID: user.ID,
+		Phone:     phone,
+		CodeHash:  string(codeHash),
+		Attempts:  attempts,
+		ExpiresAt: time.Now().UTC().Add(otpTTL),
+	}
+	err = s.Repository.SavePhoneChange(ctx.Request().Context(), tenantID(ctx), change)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.otpSender.SendOTP(ctx.Request().Context(), phone, code)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionPhoneRequest,
+		After:    map[string]interface{}{"phone": phone},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, generated.PhoneChangeResponse{
+		Phone:     change.Phone,
+		ExpiresAt: change.ExpiresAt,
+	})
+}
+
+// [POST] /profile/phone-change/confirm
+// change the phone number once the OTP sent to the new phone number is confirmed,
+// the pending change is locked until it expires after too many failed attempts
+func (s Server) ConfirmPhoneChange(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.PhoneChangeConfirmRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	change, err := s.Repository.GetPhoneChange(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.phone-change-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	if time.Now().After(change.ExpiresAt) {
+		err = s.Repository.DeletePhoneChange(ctx.Request().Context(), tenantID(ctx), user.ID)
+		if err != nil {
+			return errInternal.wrap(err)
+		}
+		return errNotFound.withDetail("detail.phone-change-not-found", nil)
+	}
+
+	if change.Attempts >= otpMaxAttempts {
+		return otpLockedError(change.ExpiresAt)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(change.CodeHash), []byte(req.Code))
+	if err != nil {
+		attempts, err := s.Repository.IncrementPhoneChangeAttempts(ctx.Request().Context(), tenantID(ctx), user.ID)
+		if err != nil {
+			return errInternal.wrap(err)
+		}
+		if attempts < otpMaxAttempts {
+			return validationError(ValidationErrors{*newFieldError("code", "otp", nil)})
+		}
+		return otpLockedError(change.ExpiresAt)
+	}
+
+	// the OTP can only be used once
+	err = s.Repository.DeletePhoneChange(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
 	}
 
-	err = s.Repository.UpdateUserByID(ctx.Request().Context(), user)
+	before := map[string]interface{}{"phone": user.Phone}
+	user.Phone = change.Phone
+	user, err = s.Repository.UpdateUserByID(ctx.Request().Context(), tenantID(ctx), user, actorID(ctx, user.ID))
+	if err == repository.ErrDuplicate {
+		return errPhoneConflict
+	}
+	if err == repository.ErrVersionMismatch {
+		return errPreconditionFailed
+	}
 	if err != nil {
-		return echo.ErrConflict
+		return errInternal.wrap(err)
 	}
 
-	return ctx.JSON(http.StatusOK, generated.Profile{
-		Name:  user.Name,
-		Phone: user.Phone,
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionPhoneChange,
+		Before:   before,
+		After:    map[string]interface{}{"phone": user.Phone},
 	})
+	if err != nil {
+		return err
+	}
+
+	return s.writeProfile(ctx, user)
+}
+
+// [PUT] /profile/avatar
+// replace the current logged-in user's avatar with the uploaded image resized into the avatar and the thumbnail,
+// the previous avatar images are removed once the new avatar is saved
+func (s Server) UpdateAvatar(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the multipart overhead is allowed on top of the image size, the image size itself is checked while decoding
+	ctx.Request().Body = http.MaxBytesReader(ctx.Response(), ctx.Request().Body, avatarMaxSize+avatarMultipartOverhead)
+	file, err := ctx.FormFile(avatarField)
+	if err == http.ErrMissingFile {
+		return validationError(ValidationErrors{*newFieldError(avatarField, "required", nil)})
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return validationError(ValidationErrors{*newFieldError(avatarField, "file_size", map[string]interface{}{"max": avatarMaxSize >> 20})})
+	}
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+	defer src.Close()
+
+	img, fieldErr, err := decodeAvatar(src)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+	if fieldErr != nil {
+		return validationError(ValidationErrors{*fieldErr})
+	}
+
+	// every upload is saved under a new key so the cached images of the previous avatar are never served
+	id, err := generateRandomID()
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	prefix := fmt.Sprintf("avatars/%d/%s", user.ID, id)
+	err = s.saveAvatar(ctx, prefix, img)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	previous, err := s.Repository.UpdateProfileAvatar(ctx.Request().Context(), tenantID(ctx), user.ID, prefix)
+	if err != nil {
+		s.deleteAvatar(ctx, prefix)
+		if err == sql.ErrNoRows {
+			return errNotFound.withDetail("detail.profile-not-found", nil)
+		}
+		return errInternal.wrap(err)
+	}
+	if previous != "" {
+		s.deleteAvatar(ctx, previous)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionAvatarUpdate,
+		Before:   map[string]interface{}{"avatar": previous},
+		After:    map[string]interface{}{"avatar": prefix},
+	})
+	if err != nil {
+		return err
+	}
+
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return s.writeProfile(ctx, user)
+}
+
+// [GET] /profile/preferences
+// retrieve the preferences of the currently logged-in user, the preferences which have never been set have their default value
+func (s Server) Preferences(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	saved, err := s.Repository.GetPreferences(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return ctx.JSON(http.StatusOK, s.withDefaultPreferences(saved))
+}
+
+// [PUT] /profile/preferences
+// set the given preferences of the currently logged-in user when all of them match the schema of their key,
+// the null value resets the preference to its default value while the omitted preferences are kept as is
+func (s Server) UpdatePreferences(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	changes, err := decodePreferences(ctx.Request().Body)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+	invalid := s.validatePreferences(changes)
+	if len(invalid) > 0 {
+		return validationError(invalid)
+	}
+
+	saved, err := s.Repository.GetPreferences(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	if len(changes) == 0 {
+		return ctx.JSON(http.StatusOK, s.withDefaultPreferences(saved))
+	}
+
+	err = s.Repository.SavePreferences(ctx.Request().Context(), tenantID(ctx), user.ID, changes)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	updated := repository.Preferences{}
+	for key, value := range saved {
+		updated[key] = value
+	}
+	for key, value := range changes {
+		delete(updated, key)
+		if !bytes.Equal(bytes.TrimSpace(value), jsonNull) {
+			updated[key] = value
+		}
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionPreferences,
+		Before:   auditPreferences(saved, changes),
+		After:    auditPreferences(updated, changes),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, s.withDefaultPreferences(updated))
+}
+
+// [POST] /profile/email/verification
+// send a new verification link to the current logged-in user's email which has not been verified
+func (s Server) RequestEmailVerification(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	if user.Email == "" {
+		return validationError(ValidationErrors{*newFieldError("email", "required", nil)})
+	}
+	if user.EmailVerifiedAt.Valid {
+		return validationError(ValidationErrors{*newFieldError("email", "already_verified", nil)})
+	}
+
+	verification, err := s.sendEmailVerification(ctx, user)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionEmailRequest,
+		After:    map[string]interface{}{"email": user.Email},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusAccepted, generated.EmailVerificationResponse{
+		Email:     verification.Email,
+		ExpiresAt: verification.ExpiresAt,
+	})
+}
+
+// [GET] /email/verify
+// verify the profile email with the single-use link sent to the email, no token is required
+// as the link is opened from the email client
+func (s Server) VerifyEmail(ctx echo.Context, params generated.VerifyEmailParams) error {
+	verification, err := parseEmailVerificationToken(s.rsaPrivateKey, params.Token)
+	if err != nil {
+		return errInvalidRequest.withDetail("detail.invalid-verification-link", nil).wrap(err)
+	}
+
+	err = s.Repository.VerifyEmail(ctx.Request().Context(), tenantID(ctx), verification)
+	if err == sql.ErrNoRows {
+		return errInvalidRequest.withDetail("detail.invalid-verification-link", nil)
+	}
+	if err == repository.ErrDuplicateEmail {
+		return errEmailConflict
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  verification.ProfileID,
+		TargetID: verification.ProfileID,
+		Action:   auditActionEmailVerify,
+		After:    map[string]interface{}{"email": verification.Email},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// [POST] /profile/export
+// request an archive of all personal data of the current logged-in user, the archive is assembled by the export job
+// and can be downloaded from the link returned by the export status once completed
+func (s Server) RequestDataExport(ctx echo.Context) error {
+	user, err := s.verifyAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := generateRandomID()
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	export, err := s.Repository.SaveDataExport(ctx.Request().Context(), tenantID(ctx), repository.DataExport{ID: id, ProfileID: user.ID})
+	if err == sql.ErrNoRows {
+		return errExportInProgress
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	s.notifyExportJob()
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionExport,
+		After:    map[string]interface{}{"export_id": export.ID},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := s.toDataExportResponse(tenantOf(ctx), export)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	ctx.Response().Header().Set(echo.HeaderLocation, dataExportPath(export.ID))
+	return ctx.JSON(http.StatusAccepted, res)
+}
+
+// [GET] /profile/export/{id}
+// retrieve the status of the data export of the current logged-in user together with a new download link once completed
+func (s Server) DataExport(ctx echo.Context, id string) error {
+	user, err := s.verifyAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	export, err := s.Repository.GetDataExport(ctx.Request().Context(), tenantID(ctx), user.ID, id)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.export-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	res, err := s.toDataExportResponse(tenantOf(ctx), export)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// [GET] /profile/export/{id}/download
+// download the archive of the completed data export with the signed link, no token is required
+// as the link may be opened from the browser
+func (s Server) DownloadDataExport(ctx echo.Context, id string, params generated.DownloadDataExportParams) error {
+	profileID, err := parseDataExportToken(s.rsaPrivateKey, params.Token, id)
+	if err != nil {
+		return errInvalidRequest.withDetail("detail.invalid-download-link", nil).wrap(err)
+	}
+
+	export, err := s.Repository.GetDataExport(ctx.Request().Context(), tenantID(ctx), profileID, id)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.export-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	if export.Status != repository.DataExportCompleted || !time.Now().Before(export.ExpiresAt.Time) {
+		return errNotFound.withDetail("detail.export-not-found", nil)
+	}
+
+	archive, err := s.exports.Get(ctx.Request().Context(), export.ArchiveKey)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  profileID,
+		TargetID: profileID,
+		Action:   auditActionExportGet,
+		After:    map[string]interface{}{"export_id": export.ID},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "data-export-"+export.ID+".zip"))
+	return ctx.Blob(http.StatusOK, exportContentType, archive)
+}
+
+// [GET] /terms
+// retrieve the current version of the terms of service
+func (s Server) CurrentTerms(ctx echo.Context) error {
+	terms, err := s.Repository.GetCurrentTerms(ctx.Request().Context(), tenantID(ctx), time.Now().UTC())
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.terms-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return ctx.JSON(http.StatusOK, toTermsResponse(terms))
+}
+
+// [POST] /profile/consent
+// accept the current version of the terms of service, the acceptance is not required by this endpoint
+// as it is the one used to accept the new version
+func (s Server) AcceptTerms(ctx echo.Context) error {
+	user, err := s.verifyAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.AcceptTermsRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	terms, termsErr, err := s.checkTermsVersion(ctx, "terms_version", &req.TermsVersion)
+	if err != nil {
+		return err
+	}
+	if terms.Version == "" {
+		return errNotFound.withDetail("detail.terms-not-found", nil)
+	}
+	if termsErr != nil {
+		return validationError(ValidationErrors{*termsErr})
+	}
+
+	consent, err := s.saveConsent(ctx, user.ID, terms.Version)
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionConsent,
+		After:    map[string]interface{}{"terms_version": terms.Version},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, generated.Consent{
+		Id:           consent.ID,
+		TermsVersion: consent.TermsVersion,
+		AcceptedAt:   consent.AcceptedAt,
+	})
+}
+
+// [GET] /profile/history
+// list the previous name and phone of the currently logged-in user from the latest change
+func (s Server) ProfileHistory(ctx echo.Context, params generated.ProfileHistoryParams) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var beforeID int64
+	if params.Cursor != nil {
+		beforeID = *params.Cursor
+	}
+	limit := profileHistoryDefaultLimit
+	if params.Limit != nil {
+		if *params.Limit < 1 || *params.Limit > profileHistoryMaxLimit {
+			return errInvalidRequest.withDetail("detail.invalid-limit", map[string]interface{}{"max": profileHistoryMaxLimit})
+		}
+		limit = *params.Limit
+	}
+
+	history, err := s.Repository.GetProfileHistory(ctx.Request().Context(), tenantID(ctx), user.ID, beforeID, limit)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	res := generated.ProfileHistoryList{History: make([]generated.ProfileHistoryEntry, 0, len(history))}
+	for _, h := range history {
+		res.History = append(res.History, toProfileHistoryResponse(h))
+	}
+	if len(history) == limit {
+		res.NextCursor = &history[len(history)-1].ID
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// [GET] /organizations
+// list the organizations of the currently logged-in user together with the role of the user
+func (s Server) ListOrganizations(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	memberships, err := s.Repository.GetProfileMemberships(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return ctx.JSON(http.StatusOK, toOrganizationListResponse(memberships))
+}
+
+// [POST] /organizations
+// create a new organization owned by the currently logged-in user
+func (s Server) CreateOrganization(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.OrganizationRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	organization := repository.Organization{
+		Name:      strings.TrimSpace(req.Name),
+		CreatedBy: user.ID,
+	}
+	err = Validate(organization)
+	if err != nil {
+		return validationError(err)
+	}
+
+	organization, err = s.Repository.CreateOrganization(ctx.Request().Context(), tenantID(ctx), organization)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: user.ID,
+		Action:  auditActionOrgCreate,
+		After:   map[string]interface{}{"organization_id": organization.ID, "name": organization.Name},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, toOrganizationResponse(repository.Membership{
+		OrganizationID:   organization.ID,
+		OrganizationName: organization.Name,
+		ProfileID:        user.ID,
+		Role:             repository.OrganizationRoleOwner,
+		CreatedAt:        organization.CreatedAt,
+	}))
+}
+
+// [GET] /organizations/:id
+// retrieve the organization of the currently logged-in user together with the role of the user
+func (s Server) Organization(ctx echo.Context, id int64) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	membership, err := s.organizationMember(ctx, id, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, toOrganizationResponse(membership))
+}
+
+// [GET] /organizations/:id/members
+// list the members of the organization, only available for its members
+func (s Server) ListOrganizationMembers(ctx echo.Context, id int64) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.organizationMember(ctx, id, user.ID)
+	if err != nil {
+		return err
+	}
+
+	members, err := s.Repository.GetMembers(ctx.Request().Context(), tenantID(ctx), id)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return ctx.JSON(http.StatusOK, toOrganizationMemberListResponse(members))
+}
+
+// [PUT] /organizations/:id/members/:profile_id
+// change the organization role of the member, the admin can only manage the admins and the members
+// while the owner can manage every member
+func (s Server) UpdateOrganizationMember(ctx echo.Context, id int64, profileID int64) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.OrganizationMemberRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	if fe := organizationRoleError("role", req.Role); fe != nil {
+		return validationError(ValidationErrors{*fe})
+	}
+
+	actor, err := s.organizationMember(ctx, id, user.ID)
+	if err != nil {
+		return err
+	}
+
+	member, err := s.Repository.GetMembership(ctx.Request().Context(), tenantID(ctx), id, profileID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.member-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = requireOrganizationRole(actor, member.Role, req.Role)
+	if err != nil {
+		return err
+	}
+
+	// the member has just been read, so the role is only kept when the member is the last owner being demoted
+	err = s.Repository.UpdateMemberRole(ctx.Request().Context(), tenantID(ctx), id, profileID, req.Role)
+	if err == sql.ErrNoRows {
+		return errLastOwner
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: profileID,
+		Action:   auditActionOrgRole,
+		Before:   map[string]interface{}{"role": member.Role},
+		After:    map[string]interface{}{"role": req.Role, "organization_id": id},
+	})
+	if err != nil {
+		return err
+	}
+
+	member.Role = req.Role
+	return ctx.JSON(http.StatusOK, toOrganizationMemberResponse(member))
+}
+
+// [DELETE] /organizations/:id/members/:profile_id
+// remove the member from the organization, every member can leave the organization unless it is the last owner
+func (s Server) RemoveOrganizationMember(ctx echo.Context, id int64, profileID int64) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	actor, err := s.organizationMember(ctx, id, user.ID)
+	if err != nil {
+		return err
+	}
+
+	member := actor
+	if profileID != user.ID {
+		member, err = s.Repository.GetMembership(ctx.Request().Context(), tenantID(ctx), id, profileID)
+		if err == sql.ErrNoRows {
+			return errNotFound.withDetail("detail.member-not-found", nil)
+		}
+		if err != nil {
+			return errInternal.wrap(err)
+		}
+
+		err = requireOrganizationRole(actor, member.Role)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the member has just been read, so it is only kept when it is the last owner
+	err = s.Repository.DeleteMember(ctx.Request().Context(), tenantID(ctx), id, profileID)
+	if err == sql.ErrNoRows {
+		return errLastOwner
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: profileID,
+		Action:   auditActionOrgRemove,
+		Before:   map[string]interface{}{"organization_id": id, "role": member.Role},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// [POST] /organizations/:id/invitations
+// send the invitation token to the phone number, the organization is only joined once the invitation is accepted
+// by the profile of the phone number, which may register after being invited
+func (s Server) InviteOrganizationMember(ctx echo.Context, id int64) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.InvitationRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	role := repository.OrganizationRoleMember
+	if req.Role != nil {
+		role = *req.Role
+	}
+	phone, phoneErr := s.normalizePhone("phone", req.Phone)
+	err = withFieldError(withFieldError(ValidatePartial(repository.User{Phone: phone}, "Phone"), phoneErr), organizationRoleError("role", role))
+	if err != nil {
+		return validationError(err)
+	}
+
+	actor, err := s.organizationMember(ctx, id, user.ID)
+	if err != nil {
+		return err
+	}
+	err = requireOrganizationRole(actor, role)
+	if err != nil {
+		return err
+	}
+
+	// the phone number which has not been registered can not be a member yet
+	invitee, err := s.Repository.GetProfileByPhone(ctx.Request().Context(), tenantID(ctx), phone)
+	if err != nil && err != sql.ErrNoRows {
+		return errInternal.wrap(err)
+	}
+	if err == nil {
+		_, err = s.Repository.GetMembership(ctx.Request().Context(), tenantID(ctx), id, invitee.ID)
+		if err == nil {
+			return errMemberConflict
+		}
+		if err != sql.ErrNoRows {
+			return errInternal.wrap(err)
+		}
+	}
+
+	invitationID, err := generateRandomID()
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	invitation, err := s.Repository.SaveInvitation(ctx.Request().Context(), tenantID(ctx), repository.Invitation{
+		ID:             invitationID,
+		OrganizationID: id,
+		Phone:          phone,
+		Role:           role,
+		InvitedBy:      user.ID,
+		ExpiresAt:      time.Now().UTC().Add(invitationTTL).Truncate(time.Second),
+	})
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	token, err := generateInvitationToken(s.rsaPrivateKey, invitation)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.invitations.SendInvitation(ctx.Request().Context(), InvitationMessage{
+		Phone:            invitation.Phone,
+		OrganizationName: actor.OrganizationName,
+		InviterName:      actor.ProfileName,
+		Role:             invitation.Role,
+		Token:            token,
+		ExpiresAt:        invitation.ExpiresAt,
+	})
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: user.ID,
+		Action:  auditActionOrgInvite,
+		After: map[string]interface{}{
+			"organization_id": id,
+			"invitation_id":   invitation.ID,
+			"phone":           invitation.Phone,
+			"role":            invitation.Role,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, generated.Invitation{
+		Id:             invitation.ID,
+		OrganizationId: invitation.OrganizationID,
+		Phone:          invitation.Phone,
+		Role:           invitation.Role,
+		ExpiresAt:      invitation.ExpiresAt,
+	})
+}
+
+// [POST] /invitations/accept
+// join the organization with the invitation sent to the phone number of the currently logged-in user,
+// the organization is in the orgs claim of the tokens issued from now on
+func (s Server) AcceptInvitation(ctx echo.Context) error {
+	user, err := s.verifyUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.InvitationTokenRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	invitation, err := parseInvitationToken(s.rsaPrivateKey, req.Token)
+	if err != nil {
+		return errInvalidRequest.withDetail("detail.invalid-invitation", nil).wrap(err)
+	}
+
+	// the phone of the token may have been changed since it was issued
+	user, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	if user.Phone != invitation.Phone {
+		return errForbidden.withDetail("detail.invitation-phone-mismatch", nil)
+	}
+
+	_, err = s.Repository.GetMembership(ctx.Request().Context(), tenantID(ctx), invitation.OrganizationID, user.ID)
+	if err == nil {
+		return errMemberConflict
+	}
+	if err != sql.ErrNoRows {
+		return errInternal.wrap(err)
+	}
+
+	err = s.Repository.AcceptInvitation(ctx.Request().Context(), tenantID(ctx), invitation, user.ID)
+	if err == sql.ErrNoRows {
+		return errInvalidRequest.withDetail("detail.invalid-invitation", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	membership, err := s.organizationMember(ctx, invitation.OrganizationID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Action:   auditActionOrgAccept,
+		After: map[string]interface{}{
+			"organization_id": invitation.OrganizationID,
+			"invitation_id":   invitation.ID,
+			"role":            membership.Role,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, toOrganizationResponse(membership))
+}
+
+// [POST] /invitations/decline
+// decline the invitation, no token is required as the invitation token proves the ownership of the phone number
+func (s Server) DeclineInvitation(ctx echo.Context) error {
+	var req generated.InvitationTokenRequest
+	err := ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	invitation, err := parseInvitationToken(s.rsaPrivateKey, req.Token)
+	if err != nil {
+		return errInvalidRequest.withDetail("detail.invalid-invitation", nil).wrap(err)
+	}
+
+	err = s.Repository.DeclineInvitation(ctx.Request().Context(), tenantID(ctx), invitation)
+	if err == sql.ErrNoRows {
+		return errInvalidRequest.withDetail("detail.invalid-invitation", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		Action: auditActionOrgDecline,
+		After: map[string]interface{}{
+			"organization_id": invitation.OrganizationID,
+			"invitation_id":   invitation.ID,
+			"phone":           invitation.Phone,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// [GET] /admin/audit-events
+// list the security audit events from the newest one, only available for admin
+func (s Server) ListAuditEvents(ctx echo.Context, params generated.ListAuditEventsParams) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter := repository.AuditEventFilter{Limit: auditEventDefaultLimit}
+	if params.ActorId != nil {
+		filter.ActorID = *params.ActorId
+	}
+	if params.TargetId != nil {
+		filter.TargetID = *params.TargetId
+	}
+	if params.Action != nil {
+		filter.Action = *params.Action
+	}
+	if params.From != nil {
+		filter.From = sql.NullTime{Time: *params.From, Valid: true}
+	}
+	if params.To != nil {
+		filter.To = sql.NullTime{Time: *params.To, Valid: true}
+	}
+	if params.Cursor != nil {
+		filter.BeforeID = *params.Cursor
+	}
+	if params.Limit != nil {
+		if *params.Limit < 1 || *params.Limit > auditEventMaxLimit {
+			return errInvalidRequest.withDetail("detail.invalid-limit", map[string]interface{}{"max": auditEventMaxLimit})
+		}
+		filter.Limit = *params.Limit
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionAuditList,
+	})
+	if err != nil {
+		return err
+	}
+
+	events, err := s.Repository.GetAuditEvents(ctx.Request().Context(), tenantID(ctx), filter)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	res := generated.AuditEventList{Events: make([]generated.AuditEvent, 0, len(events))}
+	for _, event := range events {
+		res.Events = append(res.Events, toAuditEventResponse(event))
+	}
+	if len(events) == filter.Limit {
+		res.NextCursor = &events[len(events)-1].ID
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// [GET] /admin/users
+// list the users matching the filters, only available for admin
+func (s Server) ListUsers(ctx echo.Context, params generated.ListUsersParams) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort := userDefaultSort
+	if params.Sort != nil {
+		sort = *params.Sort
+	}
+	field, desc, ok := parseUserSort(sort)
+	if !ok {
+		return errInvalidRequest.withDetail("detail.invalid-sort", map[string]interface{}{"fields": strings.Join(userSortFields, ", ")})
+	}
+
+	filter, err := toProfileFilter(userFilterParams{
+		Phone:         params.Phone,
+		Name:          params.Name,
+		CreatedFrom:   params.CreatedFrom,
+		CreatedTo:     params.CreatedTo,
+		Status:        params.Status,
+		MinLoginCount: params.MinLoginCount,
+		MaxLoginCount: params.MaxLoginCount,
+	})
+	if err != nil {
+		return err
+	}
+	filter.Sort, filter.Desc, filter.Limit = field, desc, userDefaultLimit
+
+	if params.Cursor != nil {
+		filter.After, err = decodeUserCursor(*params.Cursor, sort)
+		if err != nil {
+			return errInvalidRequest.withDetail("detail.invalid-cursor", nil).wrap(err)
+		}
+	}
+	if params.Limit != nil {
+		if *params.Limit < 1 || *params.Limit > userMaxLimit {
+			return errInvalidRequest.withDetail("detail.invalid-limit", map[string]interface{}{"max": userMaxLimit})
+		}
+		filter.Limit = *params.Limit
+	}
+
+	// the search is recorded with its filters as the result contains the personal data of the users
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionUserList,
+		After:   map[string]interface{}{"query": ctx.QueryString()},
+	})
+	if err != nil {
+		return err
+	}
+
+	users, err := s.Repository.SearchProfiles(ctx.Request().Context(), tenantID(ctx), filter)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	res := generated.AdminUserList{Users: make([]generated.AdminUser, 0, len(users))}
+	for _, user := range users {
+		res.Users = append(res.Users, toAdminUserResponse(user))
+	}
+	if len(users) == filter.Limit {
+		cursor := encodeUserCursor(sort, field, users[len(users)-1])
+		res.NextCursor = &cursor
+	}
+
+	return ctx.JSON(http.StatusOK, res)
+}
+
+// [POST] /admin/terms
+// publish a new version of the terms of service, every user has to accept it once it is in effect
+func (s Server) PublishTerms(ctx echo.Context) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.PublishTermsRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	terms := repository.TermsVersion{
+		Version:     req.Version,
+		URL:         req.Url,
+		PublishedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if req.PublishedAt != nil {
+		terms.PublishedAt = req.PublishedAt.UTC()
+	}
+	err = Validate(terms)
+	if err != nil {
+		return validationError(err)
+	}
+
+	err = s.Repository.SaveTermsVersion(ctx.Request().Context(), tenantID(ctx), terms)
+	if err == repository.ErrDuplicate {
+		return errTermsConflict
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionTermsPublish,
+		After: map[string]interface{}{
+			"version":      terms.Version,
+			"url":          terms.URL,
+			"published_at": terms.PublishedAt.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, toTermsResponse(terms))
+}
+
+// [GET] /admin/permissions
+// list every permission declared by the API operations which can be granted to the roles
+func (s Server) ListPermissions(ctx echo.Context) error {
+	_, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, generated.PermissionList{Permissions: s.permissions.Permissions()})
+}
+
+// [GET] /admin/roles
+// list the roles and their permissions
+func (s Server) ListRoles(ctx echo.Context) error {
+	_, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	roles, err := s.Repository.GetRoles(ctx.Request().Context(), tenantID(ctx))
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return ctx.JSON(http.StatusOK, toRoleListResponse(roles))
+}
+
+// [POST] /admin/roles
+// create a new role granting the permissions
+func (s Server) CreateRole(ctx echo.Context) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.RoleRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	role := toRole(0, req)
+	err = s.validateRole(role)
+	if err != nil {
+		return err
+	}
+
+	role.Permissions = uniqueSorted(role.Permissions)
+	role, err = s.Repository.CreateRole(ctx.Request().Context(), tenantID(ctx), role)
+	if err == repository.ErrDuplicate {
+		return errRoleConflict
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionRoleCreate,
+		After:   auditRole(role),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, toRoleResponse(role))
+}
+
+// [PUT] /admin/roles/:id
+// replace the name, the description and the permissions of the role
+func (s Server) UpdateRole(ctx echo.Context, id int64) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.RoleRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	role := toRole(id, req)
+	err = s.validateRole(role)
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.Repository.GetRole(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	role.Permissions = uniqueSorted(role.Permissions)
+	role, err = s.Repository.UpdateRole(ctx.Request().Context(), tenantID(ctx), role)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err == repository.ErrDuplicate {
+		return errRoleConflict
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionRoleUpdate,
+		Before:  auditRole(previous),
+		After:   auditRole(role),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, toRoleResponse(role))
+}
+
+// [DELETE] /admin/roles/:id
+// delete the role and remove it from its users
+func (s Server) DeleteRole(ctx echo.Context, id int64) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.Repository.GetRole(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.Repository.DeleteRole(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionRoleDelete,
+		Before:  auditRole(role),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// [GET] /admin/users/:id/roles
+// list the roles assigned to the user
+func (s Server) ListUserRoles(ctx echo.Context, id int64) error {
+	_, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	roles, err := s.Repository.GetProfileRoles(ctx.Request().Context(), tenantID(ctx), id)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	return ctx.JSON(http.StatusOK, toRoleListResponse(roles))
+}
+
+// [PUT] /admin/users/:id/roles/:role_id
+// assign the role to the user, the user gets its permissions on the next request
+func (s Server) AssignRole(ctx echo.Context, id int64, roleID int64) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	role, err := s.Repository.GetRole(ctx.Request().Context(), tenantID(ctx), roleID)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.Repository.AssignRole(ctx.Request().Context(), tenantID(ctx), id, roleID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  admin.ID,
+		TargetID: id,
+		Action:   auditActionRoleAssign,
+		After:    map[string]interface{}{"role": role.Name},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// [DELETE] /admin/users/:id/roles/:role_id
+// remove the role from the user, the user loses its permissions on the next request
+func (s Server) RevokeRole(ctx echo.Context, id int64, roleID int64) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.Repository.GetRole(ctx.Request().Context(), tenantID(ctx), roleID)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.Repository.RevokeRole(ctx.Request().Context(), tenantID(ctx), id, roleID)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  admin.ID,
+		TargetID: id,
+		Action:   auditActionRoleRevoke,
+		Before:   map[string]interface{}{"role": role.Name},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// [PUT] /admin/users/:id/status
+// suspend, disable or reactivate the user, the suspended or disabled user can not sign in and the existing tokens stop working
+func (s Server) UpdateUserStatus(ctx echo.Context, id int64) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.UserStatusRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	err = validateUserStatus(req)
+	if err != nil {
+		return err
+	}
+
+	// the admin could lock out themselves and, being the last admin, everyone else
+	if id == admin.ID {
+		return errInvalidRequest.withDetail("detail.own-status", nil)
+	}
+
+	var reason string
+	if req.Status != repository.ProfileStatusActive && req.Reason != nil {
+		reason = strings.TrimSpace(*req.Reason)
+	}
+
+	previous, err := s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	user, err := s.Repository.UpdateProfileStatus(ctx.Request().Context(), tenantID(ctx), id, req.Status, reason, admin.ID)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  admin.ID,
+		TargetID: id,
+		Action:   auditActionUserStatus,
+		Before:   map[string]interface{}{"status": previous.Status, "reason": previous.StatusReason},
+		After:    map[string]interface{}{"status": user.Status, "reason": user.StatusReason},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, toAdminUserResponse(user))
+}
+
+// [POST] /admin/users/:id/impersonate
+// issue a short-lived token of the admin acting as the user, the impersonation session is recorded in the audit trail
+func (s Server) ImpersonateUser(ctx echo.Context, id int64) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req generated.ImpersonationRequest
+	err = ctx.Bind(&req)
+	if err != nil {
+		return errInvalidRequest.wrap(err)
+	}
+
+	err = validateImpersonation(req)
+	if err != nil {
+		return err
+	}
+
+	if id == admin.ID {
+		return errInvalidRequest.withDetail("detail.own-impersonation", nil)
+	}
+
+	user, err := s.Repository.GetProfileByID(ctx.Request().Context(), tenantID(ctx), id)
+	if err == sql.ErrNoRows {
+		return errNotFound.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	// the token of the suspended or disabled user would be rejected anyway
+	err = accountStatusError(user.Status)
+	if err != nil {
+		return err
+	}
+
+	roles, permissions, err := s.userAccess(ctx, user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	orgs, err := s.userOrganizations(ctx, user.ID)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	sessionID, err := generateRandomID()
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	expiresAt := time.Now().Add(s.impersonation).UTC().Truncate(time.Second)
+	token, err := generateImpersonationToken(s.rsaPrivateKey, tenantID(ctx), user, roles, permissions, orgs, admin.ID, sessionID, expiresAt)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+
+	err = s.audit(ctx, auditRecord{
+		ActorID:  admin.ID,
+		TargetID: user.ID,
+		Action:   auditActionImpersonate,
+		After: map[string]interface{}{
+			"session_id": sessionID,
+			"reason":     strings.TrimSpace(req.Reason),
+			"expires_at": expiresAt.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, generated.ImpersonationResponse{
+		Token:     token,
+		SessionId: sessionID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// [POST] /admin/users/import
+// import the users from the CSV or NDJSON request body, the dry run only validates the rows and checks the duplicates
+func (s Server) ImportUsers(ctx echo.Context, params generated.ImportUsersParams) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the content type parameters such as charset are ignored
+	mediaType, _, _ := mime.ParseMediaType(ctx.Request().Header.Get(echo.HeaderContentType))
+	format, ok := importMediaTypes[mediaType]
+	if !ok {
+		return errUnsupportedMedia.withDetail("detail.expected-content-type", map[string]interface{}{
+			"content_type": MIMETextCSV + " or " + MIMEApplicationNDJSON,
+		})
+	}
+
+	dryRun := params.DryRun != nil && *params.DryRun
+	report, err := s.importUsers(ctx.Request().Context(), tenantID(ctx), ctx.Request().Body, format, dryRun)
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		err = s.audit(ctx, auditRecord{
+			ActorID: admin.ID,
+			Action:  auditActionUserImport,
+			After:   importSummary(report),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	lang := catalog.Match(ctx.Request().Header.Get(HeaderAcceptLanguage))
+	ctx.Response().Header().Set(HeaderContentLanguage, lang)
+	return ctx.JSON(http.StatusOK, toImportReportResponse(report, lang))
+}
+
+// [GET] /admin/users/export
+// stream the users matching the filters of the users list as CSV or NDJSON
+func (s Server) ExportUsers(ctx echo.Context, params generated.ExportUsersParams) error {
+	admin, err := s.authorizedUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	filter, err := toProfileFilter(userFilterParams{
+		Phone:         params.Phone,
+		Name:          params.Name,
+		CreatedFrom:   params.CreatedFrom,
+		CreatedTo:     params.CreatedTo,
+		Status:        params.Status,
+		MinLoginCount: params.MinLoginCount,
+		MaxLoginCount: params.MaxLoginCount,
+	})
+	if err != nil {
+		return err
+	}
+
+	var format, fields string
+	if params.Format != nil {
+		format = *params.Format
+	}
+	if params.Fields != nil {
+		fields = *params.Fields
+	}
+	export, err := newUserExport(format, fields)
+	if err != nil {
+		return err
+	}
+
+	// the export is recorded before it starts as the response contains the personal data of the users
+	err = s.audit(ctx, auditRecord{
+		ActorID: admin.ID,
+		Action:  auditActionUserExport,
+		After:   exportSummary(export, filter),
+	})
+	if err != nil {
+		return err
+	}
+
+	w := &exportResponseWriter{
+		ctx:      ctx,
+		format:   export.format,
+		filename: fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102"), export.format),
+	}
+	_, err = s.exportUsers(ctx.Request().Context(), tenantID(ctx), w, export, filter)
+	if err != nil {
+		// the problem details can not be rendered once the users have been sent, the response just ends early
+		if ctx.Response().Committed {
+			ctx.Logger().Error(err)
+		}
+		return err
+	}
+
+	w.commit()
+	return nil
 }
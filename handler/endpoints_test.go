@@ -1,17 +1,26 @@
 package handler
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/basriyasin/sp-user/generated"
 	"github.com/basriyasin/sp-user/repository"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestRegister(t *testing.T) {
@@ -21,12 +30,14 @@ func TestRegister(t *testing.T) {
 		mockRepo = repository.NewMockRepositoryInterface(ctrl)
 
 		// request and response mock
-		any     = gomock.Any()
-		mockErr = errors.New("an error")
-		mockReq = `{"name": "narto", "phone": "+6281122334455", "password": "Aa123!@#"}`
+		any          = gomock.Any()
+		mockErr      = errors.New("an error")
+		mockReq      = `{"name": "narto", "phone": "+6281122334455", "password": "Aa123!@#"}`
+		mockTerms    = repository.TermsVersion{Version: "2024-01", URL: "https://example.com/terms", PublishedAt: time.Now()}
+		mockTermsReq = `{"name": "narto", "phone": "+6281122334455", "password": "Aa123!@#", "terms_version": "2024-01"}`
 
 		// echo server mock
-		server = NewServer(NewServerOptions{mockRepo, getDummyRSAKey()})
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
 		e      = echo.New()
 	)
 
@@ -45,13 +56,59 @@ func TestRegister(t *testing.T) {
 			name:      "err invalid request",
 			req:       `{"name": "a", "phone":"+62", "passsword":"x123"}`,
 			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err phone country not allowed",
+			req:       `{"name": "narto", "phone": "+60123456789", "password": "Aa123!@#"}`,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "success normalize national phone",
+			req:       `{"name": "narto", "phone": "0811-2233-4455", "password": "Aa123!@#"}`,
+			expectErr: false,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveProfile(any, any, gomock.AssignableToTypeOf(repository.User{})).DoAndReturn(
+					func(_ interface{}, _ int64, user repository.User) (repository.User, error) {
+						assert.Equal(t, "+6281122334455", user.Phone)
+						user.ID = 1
+						return user, nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
 		},
 		{
 			name:      "err save profile",
 			req:       mockReq,
 			expectErr: true,
 			mock: func() {
-				mockRepo.EXPECT().SaveProfile(any, any).Return(int64(0), mockErr)
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveProfile(any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err phone already registered",
+			req:       mockReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveProfile(any, any, any).Return(repository.User{}, repository.ErrDuplicate)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveProfile(any, any, any).Return(repository.User{ID: 1}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
 			},
 		},
 		{
@@ -59,7 +116,61 @@ func TestRegister(t *testing.T) {
 			req:       mockReq,
 			expectErr: false,
 			mock: func() {
-				mockRepo.EXPECT().SaveProfile(any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveProfile(any, any, any).Return(repository.User{ID: 1}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:      "err get current terms",
+			req:       mockReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, mockErr)
+			},
+		},
+		{
+			name:      "err terms version required",
+			req:       mockReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+		{
+			name:      "err terms version not current",
+			req:       `{"name": "narto", "phone": "+6281122334455", "password": "Aa123!@#", "terms_version": "2023-01"}`,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+		{
+			name:      "err save profile with consent",
+			req:       mockTermsReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+				mockRepo.EXPECT().SaveProfileWithConsent(any, any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "success accept terms",
+			req:       mockTermsReq,
+			expectErr: false,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+				mockRepo.EXPECT().SaveProfileWithConsent(any, any, gomock.AssignableToTypeOf(repository.User{}), gomock.AssignableToTypeOf(repository.Consent{})).DoAndReturn(
+					func(_ interface{}, _ int64, user repository.User, consent repository.Consent) (repository.User, error) {
+						assert.Equal(t, mockTerms.Version, consent.TermsVersion)
+						user.ID = 1
+						return user, nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, gomock.AssignableToTypeOf(repository.AuditEvent{})).DoAndReturn(
+					func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+						assert.Contains(t, string(event.After), `"terms_version":"2024-01"`)
+						return 1, nil
+					})
 			},
 		},
 	}
@@ -97,33 +208,68 @@ func TestAuthenticate(t *testing.T) {
 		// echo server mock
 		e       = echo.New()
 		reqPath = "/authenticate"
-		server  = NewServer(NewServerOptions{mockRepo, getDummyRSAKey()})
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
 	)
 
 	test := []struct {
-		name      string
-		req       string
-		expectErr bool
-		mock      func()
+		name              string
+		req               string
+		expectErr         bool
+		expectRoles       []string
+		expectPermissions []string
+		mock              func()
 	}{
 		{
 			name:      "err bind request",
 			req:       "asd",
 			expectErr: true,
 		},
+		{
+			name:      "err missing phone and email",
+			req:       `{"password": "Aa123!@#"}`,
+			expectErr: true,
+		},
+		{
+			name:      "err no row get profile by email",
+			req:       `{"email": "narto@example.com", "password": "Aa123!@#"}`,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByEmail(any, any, "narto@example.com").Return(mockUser, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
 		{
 			name:      "err no row get profile by phone",
 			req:       mockReq,
 			expectErr: true,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByPhone(any, any).Return(mockUser, sql.ErrNoRows)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:      "err no row save audit event",
+			req:       mockReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:      "err no row get profile by national phone",
+			req:       `{"phone": "6281122334455", "password": "Aa123!@#"}`,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, "+6281122334455").Return(mockUser, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
 			},
 		},
 		{
 			name: "err get profile by phone",
 			req:  mockReq,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByPhone(any, any).Return(mockUser, mockErr)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, mockErr)
 			},
 			expectErr: true,
 		},
@@ -131,7 +277,80 @@ func TestAuthenticate(t *testing.T) {
 			name: "err mismatch password",
 			req:  mockReq,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByPhone(any, any).Return(repository.User{Password: "123"}, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(repository.User{Password: "123"}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err mismatch password save audit event",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(repository.User{Password: "123"}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err pending deletion",
+			req:  mockReq,
+			mock: func() {
+				pending := mockUser
+				pending.DeletionScheduledAt = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pending, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err pending deletion save audit event",
+			req:  mockReq,
+			mock: func() {
+				pending := mockUser
+				pending.DeletionScheduledAt = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pending, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err suspended",
+			req:  mockReq,
+			mock: func() {
+				suspended := mockUser
+				suspended.Status = repository.ProfileStatusSuspended
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(suspended, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err disabled save audit event",
+			req:  mockReq,
+			mock: func() {
+				disabled := mockUser
+				disabled.Status = repository.ProfileStatusDisabled
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(disabled, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err get profile roles",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return(nil, mockErr)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err get profile memberships",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, any).Return(nil, mockErr)
 			},
 			expectErr: true,
 		},
@@ -139,17 +358,70 @@ func TestAuthenticate(t *testing.T) {
 			name: "err update login count",
 			req:  mockReq,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByPhone(any, any).Return(mockUser, nil)
-				mockRepo.EXPECT().UpdateLoginCount(any, any, any).Return(mockErr)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().UpdateLoginCount(any, any, any, any).Return(mockErr)
 			},
 			expectErr: true,
 		},
 		{
-			name: "success",
+			name: "err track device",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().UpdateLoginCount(any, any, any, any).Return(nil)
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{}, mockErr)
+			},
+			expectErr: true,
+		},
+		{
+			name: "err save login audit event",
 			req:  mockReq,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByPhone(any, any).Return(mockUser, nil)
-				mockRepo.EXPECT().UpdateLoginCount(any, any, any).Return(nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, any).Return(nil, nil)
+				// nothing is changed when the sign in can not be recorded
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+			expectErr: true,
+		},
+		{
+			name:              "success",
+			req:               `{"phone": "+6281122334455", "password": "Aa123!@#", "device_id": "device-1"}`,
+			expectRoles:       []string{"auditor", "support"},
+			expectPermissions: []string{"audit:read", "users:read"},
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return([]repository.Role{
+					{Name: "auditor", Permissions: []string{"audit:read", "users:read"}},
+					{Name: "support", Permissions: []string{"users:read"}},
+				}, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, any).Return([]repository.Membership{
+					{OrganizationID: 3, Role: repository.OrganizationRoleAdmin},
+				}, nil)
+				mockRepo.EXPECT().UpdateLoginCount(any, any, any, any).Return(nil)
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{ID: 1}, nil)
+				mockRepo.EXPECT().UpdateDeviceLastSeen(any, any, any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name: "success by email",
+			req:  `{"email": " Narto@Example.com ", "phone": "+6281122334455", "password": "Aa123!@#"}`,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByEmail(any, any, "narto@example.com").Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().UpdateLoginCount(any, any, any, any).Return(nil)
+				mockRepo.EXPECT().GetDeviceByFingerprint(any, any, any, any).Return(repository.Device{ID: 1}, nil)
+				mockRepo.EXPECT().UpdateDeviceLastSeen(any, any, any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
 			},
 		},
 	}
@@ -168,6 +440,15 @@ func TestAuthenticate(t *testing.T) {
 
 			if tt.expectErr {
 				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got generated.AuthenticateResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			if tt.expectRoles != nil {
+				assert.Equal(t, tt.expectRoles, got.Roles)
+				assert.Equal(t, tt.expectPermissions, got.Permissions)
 			}
 		})
 	}
@@ -188,6 +469,8 @@ func TestProfile(t *testing.T) {
 		e       = echo.New()
 		reqPath = "/profile"
 	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
 
 	test := []struct {
 		name      string
@@ -215,14 +498,22 @@ func TestProfile(t *testing.T) {
 			token:     dummyValidToken,
 			expectErr: true,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByID(any, any).Return(mockUser, mockErr)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, mockErr)
+			},
+		},
+		{
+			name:      "err get user profile by id no rows",
+			token:     dummyValidToken,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, sql.ErrNoRows)
 			},
 		},
 		{
 			name:  "success",
 			token: dummyValidToken,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByID(any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
 			},
 		},
 	}
@@ -233,7 +524,7 @@ func TestProfile(t *testing.T) {
 				tt.mock()
 			}
 
-			server := NewServer(NewServerOptions{mockRepo, getDummyRSAKey()})
+			server := NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
 			req := httptest.NewRequest(http.MethodPost, reqPath, nil)
 			req.Header.Set(echo.HeaderAuthorization, tt.token)
 			rec := httptest.NewRecorder()
@@ -256,17 +547,26 @@ func TestUpdateProfile(t *testing.T) {
 		// request and response mock
 		any          = gomock.Any()
 		mockErr      = errors.New("an error")
-		mockUser     = repository.User{Password: "$2a$10$OAN2DNAF79q/njdQAlnYF./iKq.5XYq/txWdlJnA1czE4IiAnZ86K", UpdatedAt: sql.NullTime{Valid: true}}
+		mockUser     = repository.User{Phone: "+6281122334455", Password: "$2a$10$OAN2DNAF79q/njdQAlnYF./iKq.5XYq/txWdlJnA1czE4IiAnZ86K", UpdatedAt: sql.NullTime{Valid: true}, Version: 1}
 		mockValidReq = `{"name": "narto", "phone": "+6281122334455"}`
+		mockETag     = `"1"`
+
 		// echo server mock
 		e       = echo.New()
 		reqPath = "/profile"
-		server  = NewServer(NewServerOptions{mockRepo, getDummyRSAKey()})
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
 	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	// the admin 9 impersonating the user 1
+	impersonationToken, err := generateImpersonationToken(getDummyRSAKey(), 0, repository.User{ID: 1}, nil, nil, nil, 9, "abc", time.Now().Add(time.Minute))
+	assert.NoError(t, err)
 
 	test := []struct {
 		name      string
 		token     string
+		ifMatch   string
 		req       string
 		expectErr bool
 		mock      func()
@@ -279,43 +579,135 @@ func TestUpdateProfile(t *testing.T) {
 		{
 			name:      "err invalid payload",
 			token:     dummyValidToken,
+			ifMatch:   mockETag,
 			req:       "asd",
 			expectErr: true,
 		},
+		{
+			name:      "err missing if match",
+			token:     dummyValidToken,
+			req:       mockValidReq,
+			expectErr: true,
+		},
+		{
+			name:      "err stale if match",
+			token:     dummyValidToken,
+			ifMatch:   `"0"`,
+			req:       mockValidReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err update user version mismatch",
+			token:     dummyValidToken,
+			ifMatch:   "*",
+			req:       mockValidReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, repository.ErrVersionMismatch)
+			},
+		},
 		{
 			name:      "err get user profile by id",
 			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, mockErr)
+			},
+		},
+		{
+			name:      "err get user profile by id no rows",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err update user duplicate phone",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
 			req:       mockValidReq,
 			expectErr: true,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByID(any, any).Return(mockUser, mockErr)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, repository.ErrDuplicate)
 			},
 		},
 		{
 			name:      "err update user",
 			token:     dummyValidToken,
+			ifMatch:   mockETag,
 			req:       mockValidReq,
 			expectErr: true,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByID(any, any).Return(mockUser, nil)
-				mockRepo.EXPECT().UpdateUserByID(any, any).Return(mockErr)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, mockErr)
 			},
 		},
 		{
-			name:  "has invalid name && invalid phone",
-			token: dummyValidToken,
-			req:   `{"name": "123", "phone": "+12233"}`,
+			name:      "err invalid name && invalid phone",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       `{"name": "123", "phone": "+12233"}`,
+			expectErr: true,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByID(any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
 			},
 		},
 		{
-			name:  "success",
-			token: dummyValidToken,
-			req:   mockValidReq,
+			name:    "nothing to update",
+			token:   dummyValidToken,
+			ifMatch: mockETag,
+			req:     `{}`,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:    "success",
+			token:   dummyValidToken,
+			ifMatch: mockETag,
+			req:     mockValidReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:    "success impersonated",
+			token:   "Bearer " + impersonationToken,
+			ifMatch: mockETag,
+			req:     mockValidReq,
 			mock: func() {
-				mockRepo.EXPECT().GetProfileByID(any, any).Return(mockUser, nil)
-				mockRepo.EXPECT().UpdateUserByID(any, any).Return(nil)
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(9)).Return([]string{permissionImpersonate}, nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				// the history is recorded with the impersonator as the actor, the same as the audit trail
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, int64(9)).Return(repository.User{}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, int64(9), event.ActorID.Int64)
+					return 1, nil
+				})
 			},
 		},
 	}
@@ -331,11 +723,5132 @@ func TestUpdateProfile(t *testing.T) {
 			req.Header.Set(echo.HeaderAuthorization, tt.token)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			err := server.UpdateProfile(c)
+			err := server.UpdateProfile(c, generated.UpdateProfileParams{IfMatch: &tt.ifMatch})
 
 			if tt.expectErr {
 				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDeleteProfile(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockReq  = `{"password": "Aa123!@#"}`
+		mockUser = repository.User{ID: 1, Password: "$2a$10$OAN2DNAF79q/njdQAlnYF./iKq.5XYq/txWdlJnA1czE4IiAnZ86K"}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), DeletionGracePeriod: time.Hour})
+	)
+
+	expectActive(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		req       string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			req:       mockReq,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err bind request",
+			token:     dummyValidToken,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err get profile no rows",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get profile",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err mismatch password",
+			token:     dummyValidToken,
+			req:       `{"password": "wrong"}`,
+			expectErr: errInvalidCredentials,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err get sole owner memberships",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetSoleOwnerMemberships(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err last owner of an organization",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errLastOwner,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetSoleOwnerMemberships(any, any, int64(1)).Return([]repository.Membership{
+					{OrganizationID: 2, OrganizationName: "acme", ProfileID: 1, Role: repository.OrganizationRoleOwner},
+				}, nil)
+			},
+		},
+		{
+			name:      "err schedule deletion no rows",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetSoleOwnerMemberships(any, any, int64(1)).Return(nil, nil)
+				mockRepo.EXPECT().ScheduleProfileDeletion(any, any, int64(1), any).Return(time.Time{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err schedule deletion",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetSoleOwnerMemberships(any, any, int64(1)).Return(nil, nil)
+				mockRepo.EXPECT().ScheduleProfileDeletion(any, any, int64(1), any).Return(time.Time{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetSoleOwnerMemberships(any, any, int64(1)).Return(nil, nil)
+				mockRepo.EXPECT().ScheduleProfileDeletion(any, any, int64(1), any).Return(time.Now(), nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetSoleOwnerMemberships(any, any, int64(1)).Return(nil, nil)
+				mockRepo.EXPECT().ScheduleProfileDeletion(any, any, int64(1), gomock.AssignableToTypeOf(time.Time{})).
+					DoAndReturn(func(_ interface{}, _, _ int64, purgeAt time.Time) (time.Time, error) {
+						assert.WithinDuration(t, time.Now().Add(time.Hour), purgeAt, time.Minute)
+						return purgeAt, nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.DeleteProfile(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+		})
+	}
+}
+
+func TestCancelProfileDeletion(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any         = gomock.Any()
+		mockErr     = errors.New("an error")
+		mockReq     = `{"phone": "+6281122334455", "password": "Aa123!@#"}`
+		mockUser    = repository.User{ID: 1, Password: "$2a$10$OAN2DNAF79q/njdQAlnYF./iKq.5XYq/txWdlJnA1czE4IiAnZ86K"}
+		pendingUser = repository.User{
+			ID:                  1,
+			Password:            mockUser.Password,
+			DeletionScheduledAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/deletion/cancel"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name      string
+		req       string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err missing phone and email",
+			req:       `{"password": "Aa123!@#"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err mismatch password",
+			req:       `{"phone": "+6281122334455", "password": "wrong"}`,
+			expectErr: errInvalidCredentials,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pendingUser, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:      "err not scheduled",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err cancel deletion no rows",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pendingUser, nil)
+				mockRepo.EXPECT().CancelProfileDeletion(any, any, int64(1), any).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err cancel deletion",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pendingUser, nil)
+				mockRepo.EXPECT().CancelProfileDeletion(any, any, int64(1), any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pendingUser, nil)
+				mockRepo.EXPECT().CancelProfileDeletion(any, any, int64(1), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByPhone(any, any, any).Return(pendingUser, nil)
+				mockRepo.EXPECT().CancelProfileDeletion(any, any, int64(1), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.CancelProfileDeletion(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
+}
+
+func TestRequestPhoneChange(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockUser = repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Version: 1}
+		mockReq  = `{"phone": "081122334466"}`
+		mockNew  = "+6281122334466"
+
+		// the pending change sent two minutes ago, which is past the resend cooldown
+		mockPending = repository.PhoneChange{ProfileID: 1, Phone: mockNew, Attempts: 3, ExpiresAt: time.Now().Add(otpTTL - 2*time.Minute)}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/phone-change"
+		sender  = &stubOTPSender{}
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), OTPSender: sender})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name        string
+		token       string
+		req         string
+		senderErr   error
+		expectErr   error
+		expectRetry bool
+		mock        func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err invalid payload",
+			token:     dummyValidToken,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invalid phone",
+			token:     dummyValidToken,
+			req:       `{"phone": "+12233"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err get profile by id",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err same phone",
+			token:     dummyValidToken,
+			req:       `{"phone": "081122334455"}`,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err phone already registered",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errPhoneConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{ID: 2}, nil)
+			},
+		},
+		{
+			name:      "err get profile by phone",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err get phone change",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{}, mockErr)
+			},
+		},
+		{
+			name:        "err resend cooldown",
+			token:       dummyValidToken,
+			req:         mockReq,
+			expectErr:   errTooManyRequests,
+			expectRetry: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{
+					ProfileID: 1,
+					Phone:     "+6281122334477",
+					ExpiresAt: time.Now().Add(otpTTL - 10*time.Second),
+				}, nil)
+			},
+		},
+		{
+			name:        "err locked after too many attempts",
+			token:       dummyValidToken,
+			req:         mockReq,
+			expectErr:   errTooManyAttempts,
+			expectRetry: true,
+			mock: func() {
+				locked := mockPending
+				locked.Attempts = otpMaxAttempts
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(locked, nil)
+			},
+		},
+		{
+			name:      "err save phone change",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SavePhoneChange(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err send otp",
+			token:     dummyValidToken,
+			req:       mockReq,
+			senderErr: mockErr,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SavePhoneChange(any, any, any).Return(nil)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SavePhoneChange(any, any, gomock.AssignableToTypeOf(repository.PhoneChange{})).DoAndReturn(
+					func(_ interface{}, _ int64, change repository.PhoneChange) error {
+						assert.Equal(t, int64(1), change.ProfileID)
+						assert.Equal(t, mockNew, change.Phone)
+						assert.NotEmpty(t, change.CodeHash)
+						assert.True(t, change.ExpiresAt.After(time.Now()))
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:  "success resend keeps the attempts",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockPending, nil)
+				mockRepo.EXPECT().SavePhoneChange(any, any, gomock.AssignableToTypeOf(repository.PhoneChange{})).DoAndReturn(
+					func(_ interface{}, _ int64, change repository.PhoneChange) error {
+						assert.Equal(t, mockPending.Attempts, change.Attempts)
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:  "success another phone resets the attempts",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				other := mockPending
+				other.Phone = "+6281122334477"
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(other, nil)
+				mockRepo.EXPECT().SavePhoneChange(any, any, gomock.AssignableToTypeOf(repository.PhoneChange{})).DoAndReturn(
+					func(_ interface{}, _ int64, change repository.PhoneChange) error {
+						assert.Zero(t, change.Attempts)
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:  "success expired lock",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				expired := mockPending
+				expired.Attempts = otpMaxAttempts
+				expired.ExpiresAt = time.Now().Add(-time.Minute)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockNew).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(expired, nil)
+				mockRepo.EXPECT().SavePhoneChange(any, any, gomock.AssignableToTypeOf(repository.PhoneChange{})).DoAndReturn(
+					func(_ interface{}, _ int64, change repository.PhoneChange) error {
+						assert.Zero(t, change.Attempts)
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+			sender.err = tt.senderErr
+			sender.codes = nil
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.RequestPhoneChange(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				var problem *Error
+				assert.True(t, errors.As(err, &problem))
+				assert.Equal(t, tt.expectRetry, problem.RetryAfter > 0)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Len(t, sender.codes[mockNew], otpLength)
+		})
+	}
+}
+
+func TestConfirmPhoneChange(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any         = gomock.Any()
+		mockErr     = errors.New("an error")
+		mockUser    = repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Version: 1}
+		mockHash, _ = bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+		mockChange  = repository.PhoneChange{ProfileID: 1, Phone: "+6281122334466", CodeHash: string(mockHash), ExpiresAt: time.Now().Add(otpTTL)}
+		mockExpired = repository.PhoneChange{ProfileID: 1, Phone: "+6281122334466", CodeHash: string(mockHash), ExpiresAt: time.Now().Add(-time.Second)}
+		mockReq     = `{"code": "123456"}`
+		mockWrong   = `{"code": "654321"}`
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/phone-change/confirm"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		req       string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err invalid payload",
+			token:     dummyValidToken,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err no pending change",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get phone change",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(repository.PhoneChange{}, mockErr)
+			},
+		},
+		{
+			name:      "err expired",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockExpired, nil)
+				mockRepo.EXPECT().DeletePhoneChange(any, any, int64(1)).Return(nil)
+			},
+		},
+		{
+			name:      "err wrong code",
+			token:     dummyValidToken,
+			req:       mockWrong,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockChange, nil)
+				mockRepo.EXPECT().IncrementPhoneChangeAttempts(any, any, int64(1)).Return(1, nil)
+			},
+		},
+		{
+			name:      "err increment attempts",
+			token:     dummyValidToken,
+			req:       mockWrong,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockChange, nil)
+				mockRepo.EXPECT().IncrementPhoneChangeAttempts(any, any, int64(1)).Return(0, mockErr)
+			},
+		},
+		{
+			name:      "err too many attempts",
+			token:     dummyValidToken,
+			req:       mockWrong,
+			expectErr: errTooManyAttempts,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockChange, nil)
+				mockRepo.EXPECT().IncrementPhoneChangeAttempts(any, any, int64(1)).Return(otpMaxAttempts, nil)
+			},
+		},
+		{
+			name:      "err locked",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errTooManyAttempts,
+			mock: func() {
+				locked := mockChange
+				locked.Attempts = otpMaxAttempts
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(locked, nil)
+			},
+		},
+		{
+			name:      "err delete phone change",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockChange, nil)
+				mockRepo.EXPECT().DeletePhoneChange(any, any, int64(1)).Return(mockErr)
+			},
+		},
+		{
+			name:      "err phone already registered",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errPhoneConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockChange, nil)
+				mockRepo.EXPECT().DeletePhoneChange(any, any, int64(1)).Return(nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, repository.ErrDuplicate)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetPhoneChange(any, any, int64(1)).Return(mockChange, nil)
+				mockRepo.EXPECT().DeletePhoneChange(any, any, int64(1)).Return(nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, repository.User{ID: 1, Name: "narto", Phone: "+6281122334466", Version: 1}, int64(1)).
+					Return(repository.User{ID: 1, Name: "narto", Phone: "+6281122334466", Version: 2}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.ConfirmPhoneChange(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, `"2"`, rec.Header().Get(HeaderETag))
+			assert.Contains(t, rec.Body.String(), `"phone":"+6281122334466"`)
+		})
+	}
+}
+
+func TestProfileHistory(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any         = gomock.Any()
+		mockErr     = errors.New("an error")
+		mockLimit   = 1
+		mockCursor  = int64(3)
+		mockHistory = []repository.ProfileHistory{{ID: 2, ProfileID: 1, ActorID: 1, Name: "narto", Phone: "+6281122334455"}}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/history"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		params    generated.ProfileHistoryParams
+		expectErr bool
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: true,
+		},
+		{
+			name:      "err invalid limit",
+			token:     dummyValidToken,
+			params:    generated.ProfileHistoryParams{Limit: new(int)},
+			expectErr: true,
+		},
+		{
+			name:      "err get profile history",
+			token:     dummyValidToken,
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileHistory(any, any, int64(1), int64(0), profileHistoryDefaultLimit).Return(nil, mockErr)
+			},
+		},
+		{
+			name:   "success",
+			token:  dummyValidToken,
+			params: generated.ProfileHistoryParams{Cursor: &mockCursor, Limit: &mockLimit},
+			mock: func() {
+				mockRepo.EXPECT().GetProfileHistory(any, any, int64(1), mockCursor, mockLimit).Return(mockHistory, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.ProfileHistory(c, tt.params)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Contains(t, rec.Body.String(), `"next_cursor":2`)
+			}
+		})
+	}
+}
+
+func TestListOrganizations(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/organizations"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err get profile memberships",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileMemberships(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetProfileMemberships(any, any, int64(1)).Return([]repository.Membership{
+					{OrganizationID: 2, OrganizationName: "acme", ProfileID: 1, Role: repository.OrganizationRoleAdmin},
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.ListOrganizations(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"name":"acme","role":"admin"`)
+		})
+	}
+}
+
+func TestCreateOrganization(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockReq  = `{"name": " acme "}`
+		mockOrg  = repository.Organization{Name: "acme", CreatedBy: 1}
+		mockTime = time.Now().UTC().Truncate(time.Second)
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/organizations"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		req          string
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err name too short",
+			req:       `{"name": " a "}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err create organization",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().CreateOrganization(any, any, mockOrg).Return(repository.Organization{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().CreateOrganization(any, any, mockOrg).Return(repository.Organization{ID: 2, Name: "acme"}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				saved := mockOrg
+				saved.ID = 2
+				saved.CreatedAt = mockTime
+				mockRepo.EXPECT().CreateOrganization(any, any, mockOrg).Return(saved, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionOrgCreate, event.Action)
+					assert.Contains(t, string(event.After), `"organization_id":2`)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.CreateOrganization(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var got generated.Organization
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, int64(2), got.Id)
+			assert.Equal(t, repository.OrganizationRoleOwner, got.Role)
+			assert.True(t, mockTime.Equal(got.JoinedAt))
+		})
+	}
+}
+
+func TestOrganization(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/organizations/2"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err not a member",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get membership",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{
+					OrganizationID: 2, OrganizationName: "acme", ProfileID: 1, Role: repository.OrganizationRoleMember,
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.Organization(c, 2)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"name":"acme","role":"member"`)
+		})
+	}
+}
+
+func TestListOrganizationMembers(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockMember = repository.Membership{OrganizationID: 2, ProfileID: 1, ProfileName: "narto", Role: repository.OrganizationRoleMember}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/organizations/2/members"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err not a member",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get members",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockMember, nil)
+				mockRepo.EXPECT().GetMembers(any, any, int64(2)).Return(nil, mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockMember, nil)
+				mockRepo.EXPECT().GetMembers(any, any, int64(2)).Return([]repository.Membership{
+					{OrganizationID: 2, ProfileID: 3, ProfileName: "sasuke", Role: repository.OrganizationRoleOwner},
+					mockMember,
+				}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.ListOrganizationMembers(c, 2)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got generated.OrganizationMemberList
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			if assert.Len(t, got.Members, 2) {
+				assert.Equal(t, int64(3), got.Members[0].ProfileId)
+				assert.Equal(t, "sasuke", got.Members[0].Name)
+				assert.Equal(t, repository.OrganizationRoleOwner, got.Members[0].Role)
+			}
+		})
+	}
+}
+
+func TestUpdateOrganizationMember(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockReq    = `{"role": "admin"}`
+		mockOwner  = repository.Membership{OrganizationID: 2, ProfileID: 1, Role: repository.OrganizationRoleOwner}
+		mockAdmin  = repository.Membership{OrganizationID: 2, ProfileID: 1, Role: repository.OrganizationRoleAdmin}
+		mockMember = repository.Membership{OrganizationID: 2, ProfileID: 3, ProfileName: "sasuke", Role: repository.OrganizationRoleMember}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/organizations/2/members/3"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+
+		// the admin impersonating the owner can not manage the members on behalf of the owner
+		impersonationToken, _ = generateImpersonationToken(getDummyRSAKey(), 0, repository.User{ID: 1}, nil, nil, nil, 9, "abc", time.Now().Add(time.Minute))
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		token        string
+		req          string
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err impersonation token",
+			token:     "Bearer " + impersonationToken,
+			req:       mockReq,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err unknown role",
+			req:       `{"role": "guest"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err not a member",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err member not found",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockOwner, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get member",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockOwner, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{}, mockErr)
+			},
+		},
+		{
+			name:      "err admin grant owner",
+			req:       `{"role": "owner"}`,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+			},
+		},
+		{
+			name:      "err last owner",
+			req:       mockReq,
+			expectErr: errLastOwner,
+			mock: func() {
+				owner := mockMember
+				owner.Role = repository.OrganizationRoleOwner
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockOwner, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(owner, nil)
+				mockRepo.EXPECT().UpdateMemberRole(any, any, int64(2), int64(3), repository.OrganizationRoleAdmin).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err update member role",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+				mockRepo.EXPECT().UpdateMemberRole(any, any, int64(2), int64(3), repository.OrganizationRoleAdmin).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+				mockRepo.EXPECT().UpdateMemberRole(any, any, int64(2), int64(3), repository.OrganizationRoleAdmin).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+				mockRepo.EXPECT().UpdateMemberRole(any, any, int64(2), int64(3), repository.OrganizationRoleAdmin).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionOrgRole, event.Action)
+					assert.Equal(t, int64(3), event.TargetID.Int64)
+					assert.Contains(t, string(event.Before), `"role":"member"`)
+					assert.Contains(t, string(event.After), `"role":"admin"`)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			token := tt.token
+			if token == "" {
+				token = dummyValidToken
+			}
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, token)
+			}
+			c := e.NewContext(req, rec)
+			c.SetPath("/organizations/:id/members/:profile_id")
+			err := server.UpdateOrganizationMember(c, 2, 3)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"name":"sasuke","profile_id":3,"role":"admin"`)
+		})
+	}
+}
+
+func TestRemoveOrganizationMember(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockOwner  = repository.Membership{OrganizationID: 2, ProfileID: 1, Role: repository.OrganizationRoleOwner}
+		mockAdmin  = repository.Membership{OrganizationID: 2, ProfileID: 1, Role: repository.OrganizationRoleAdmin}
+		mockMember = repository.Membership{OrganizationID: 2, ProfileID: 3, Role: repository.OrganizationRoleMember}
+
+		// echo server mock
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		profileID    int64
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			profileID:    3,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err not a member",
+			profileID: 3,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err member not found",
+			profileID: 3,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockOwner, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get member",
+			profileID: 3,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockOwner, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{}, mockErr)
+			},
+		},
+		{
+			name:      "err member remove another member",
+			profileID: 3,
+			expectErr: errForbidden,
+			mock: func() {
+				actor := mockMember
+				actor.ProfileID = 1
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(actor, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+			},
+		},
+		{
+			name:      "err admin remove owner",
+			profileID: 3,
+			expectErr: errForbidden,
+			mock: func() {
+				owner := mockMember
+				owner.Role = repository.OrganizationRoleOwner
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(owner, nil)
+			},
+		},
+		{
+			name:      "err last owner leave",
+			profileID: 1,
+			expectErr: errLastOwner,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockOwner, nil)
+				mockRepo.EXPECT().DeleteMember(any, any, int64(2), int64(1)).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err delete member",
+			profileID: 3,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+				mockRepo.EXPECT().DeleteMember(any, any, int64(2), int64(3)).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			profileID: 3,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+				mockRepo.EXPECT().DeleteMember(any, any, int64(2), int64(3)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:      "success leave",
+			profileID: 1,
+			mock: func() {
+				actor := mockMember
+				actor.ProfileID = 1
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(actor, nil)
+				mockRepo.EXPECT().DeleteMember(any, any, int64(2), int64(1)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:      "success remove member",
+			profileID: 3,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(mockMember, nil)
+				mockRepo.EXPECT().DeleteMember(any, any, int64(2), int64(3)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionOrgRemove, event.Action)
+					assert.Equal(t, int64(3), event.TargetID.Int64)
+					assert.Contains(t, string(event.Before), `"organization_id":2`)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/organizations/2/members", nil)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.RemoveOrganizationMember(c, 2, tt.profileID)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		})
+	}
+}
+
+func TestInviteOrganizationMember(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+		sender   = &stubInvitationSender{}
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		mockPhone = "+6281122334455"
+		mockReq   = `{"phone": "081122334455"}`
+		mockAdmin = repository.Membership{OrganizationID: 2, OrganizationName: "acme", ProfileID: 1, ProfileName: "narto", Role: repository.OrganizationRoleAdmin}
+
+		// echo server mock
+		e       = echo.New()
+		key     = getDummyRSAKey()
+		reqPath = "/organizations/2/invitations"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key, InvitationSender: sender})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	// save the invitation as it is
+	saveInvitation := func(_ interface{}, _ int64, invitation repository.Invitation) (repository.Invitation, error) {
+		invitation.Status = repository.InvitationPending
+		return invitation, nil
+	}
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		req          string
+		sendErr      error
+		expectErr    error
+		expectRole   string
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invalid phone",
+			req:       `{"phone": "12"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err unknown role",
+			req:       `{"phone": "081122334455", "role": "guest"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err not a member",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err admin invite owner",
+			req:       `{"phone": "081122334455", "role": "owner"}`,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+			},
+		},
+		{
+			name:      "err get profile by phone",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err already a member",
+			req:       mockReq,
+			expectErr: errMemberConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{ID: 3}, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{ProfileID: 3}, nil)
+			},
+		},
+		{
+			name:      "err get invitee membership",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{ID: 3}, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{}, mockErr)
+			},
+		},
+		{
+			name:      "err save invitation",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveInvitation(any, any, any).Return(repository.Invitation{}, mockErr)
+			},
+		},
+		{
+			name:      "err send invitation",
+			req:       mockReq,
+			sendErr:   mockErr,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveInvitation(any, any, any).DoAndReturn(saveInvitation)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveInvitation(any, any, any).DoAndReturn(saveInvitation)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:       "success unregistered phone",
+			req:        mockReq,
+			expectRole: repository.OrganizationRoleMember,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveInvitation(any, any, any).DoAndReturn(saveInvitation)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionOrgInvite, event.Action)
+					assert.Contains(t, string(event.After), `"phone":"+6281122334455"`)
+					return 1, nil
+				})
+			},
+		},
+		{
+			name:       "success registered phone",
+			req:        `{"phone": "+6281122334455", "role": "admin"}`,
+			expectRole: repository.OrganizationRoleAdmin,
+			mock: func() {
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockAdmin, nil)
+				mockRepo.EXPECT().GetProfileByPhone(any, any, mockPhone).Return(repository.User{ID: 3}, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(3)).Return(repository.Membership{}, sql.ErrNoRows)
+				mockRepo.EXPECT().SaveInvitation(any, any, any).DoAndReturn(saveInvitation)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+			sender.err = tt.sendErr
+			sender.invitations = nil
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.InviteOrganizationMember(c, 2)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var got generated.Invitation
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, mockPhone, got.Phone)
+			assert.Equal(t, tt.expectRole, got.Role)
+			assert.WithinDuration(t, time.Now().Add(invitationTTL), got.ExpiresAt, 2*time.Second)
+
+			// the token sent to the phone number is the saved invitation
+			if assert.Len(t, sender.invitations, 1) {
+				assert.Equal(t, "acme", sender.invitations[0].OrganizationName)
+				assert.Equal(t, "narto", sender.invitations[0].InviterName)
+
+				invitation, err := parseInvitationToken(key, sender.invitations[0].Token)
+				assert.NoError(t, err)
+				assert.Equal(t, got.Id, invitation.ID)
+				assert.Equal(t, int64(2), invitation.OrganizationID)
+				assert.Equal(t, mockPhone, invitation.Phone)
+			}
+		})
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any            = gomock.Any()
+		mockErr        = errors.New("an error")
+		mockUser       = repository.User{ID: 1, Phone: "+6281122334455"}
+		mockInvitation = repository.Invitation{ID: "abc", OrganizationID: 2, Phone: mockUser.Phone, ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second)}
+		mockMember     = repository.Membership{OrganizationID: 2, OrganizationName: "acme", ProfileID: 1, Role: repository.OrganizationRoleAdmin}
+
+		// echo server mock
+		e       = echo.New()
+		key     = getDummyRSAKey()
+		reqPath = "/invitations/accept"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	token, err := generateInvitationToken(key, mockInvitation)
+	assert.NoError(t, err)
+	mockReq := `{"token": "` + token + `"}`
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		req          string
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invalid token",
+			req:       `{"token": "asd"}`,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err profile not found",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get profile",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err invitation of another phone",
+			req:       mockReq,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{ID: 1, Phone: "+6281122334466"}, nil)
+			},
+		},
+		{
+			name:      "err already a member",
+			req:       mockReq,
+			expectErr: errMemberConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockMember, nil)
+			},
+		},
+		{
+			name:      "err get membership",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, mockErr)
+			},
+		},
+		{
+			name:      "err invitation answered",
+			req:       mockReq,
+			expectErr: errInvalidRequest,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+				mockRepo.EXPECT().AcceptInvitation(any, any, any, int64(1)).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err accept invitation",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+				mockRepo.EXPECT().AcceptInvitation(any, any, any, int64(1)).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+				mockRepo.EXPECT().AcceptInvitation(any, any, any, int64(1)).Return(nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockMember, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(repository.Membership{}, sql.ErrNoRows)
+				mockRepo.EXPECT().AcceptInvitation(any, any, any, int64(1)).DoAndReturn(func(_ interface{}, _ int64, invitation repository.Invitation, _ int64) error {
+					assert.Equal(t, mockInvitation.ID, invitation.ID)
+					assert.Equal(t, mockInvitation.Phone, invitation.Phone)
+					return nil
+				})
+				mockRepo.EXPECT().GetMembership(any, any, int64(2), int64(1)).Return(mockMember, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionOrgAccept, event.Action)
+					assert.Contains(t, string(event.After), `"invitation_id":"abc"`)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			if !tt.unauthorized {
+				req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+			}
+			c := e.NewContext(req, rec)
+			err := server.AcceptInvitation(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"name":"acme","role":"admin"`)
+		})
+	}
+}
+
+func TestDeclineInvitation(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any            = gomock.Any()
+		mockErr        = errors.New("an error")
+		mockInvitation = repository.Invitation{ID: "abc", OrganizationID: 2, Phone: "+6281122334455", ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second)}
+
+		// echo server mock
+		e       = echo.New()
+		key     = getDummyRSAKey()
+		reqPath = "/invitations/decline"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key})
+	)
+
+	token, err := generateInvitationToken(key, mockInvitation)
+	assert.NoError(t, err)
+	mockReq := `{"token": "` + token + `"}`
+
+	test := []struct {
+		name      string
+		req       string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invalid token",
+			req:       `{"token": "asd"}`,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invitation answered",
+			req:       mockReq,
+			expectErr: errInvalidRequest,
+			mock: func() {
+				mockRepo.EXPECT().DeclineInvitation(any, any, any).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err decline invitation",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().DeclineInvitation(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().DeclineInvitation(any, any, any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().DeclineInvitation(any, any, any).DoAndReturn(func(_ interface{}, _ int64, invitation repository.Invitation) error {
+					assert.Equal(t, mockInvitation.ID, invitation.ID)
+					assert.Equal(t, mockInvitation.Phone, invitation.Phone)
+					return nil
+				})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionOrgDecline, event.Action)
+					assert.False(t, event.ActorID.Valid)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.DeclineInvitation(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		})
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockLimit  = 1
+		mockEvents = []repository.AuditEvent{{ID: 2, Action: auditActionLogin}}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/audit-events"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name       string
+		authorized bool
+		server     *Server
+		params     generated.ListAuditEventsParams
+		expectErr  bool
+		mock       func()
+	}{
+		{
+			name:      "err not authorized",
+			server:    server,
+			expectErr: true,
+		},
+		{
+			name:       "err invalid limit",
+			authorized: true,
+			server:     server,
+			params:     generated.ListAuditEventsParams{Limit: new(int)},
+			expectErr:  true,
+		},
+		{
+			name:       "err save audit event",
+			authorized: true,
+			server:     server,
+			expectErr:  true,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:       "err get audit events",
+			authorized: true,
+			server:     server,
+			expectErr:  true,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetAuditEvents(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:       "success",
+			authorized: true,
+			server:     server,
+			params: generated.ListAuditEventsParams{
+				ActorId:  &mockEvents[0].ID,
+				TargetId: &mockEvents[0].ID,
+				Action:   &mockEvents[0].Action,
+				From:     &mockEvents[0].CreatedAt,
+				To:       &mockEvents[0].CreatedAt,
+				Cursor:   &mockEvents[0].ID,
+				Limit:    &mockLimit,
+			},
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetAuditEvents(any, any, repository.AuditEventFilter{
+					ActorID:  2,
+					TargetID: 2,
+					Action:   auditActionLogin,
+					From:     sql.NullTime{Valid: true},
+					To:       sql.NullTime{Valid: true},
+					BeforeID: 2,
+					Limit:    1,
+				}).Return(mockEvents, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if tt.authorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := tt.server.ListAuditEvents(c, tt.params)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Contains(t, rec.Body.String(), `"next_cursor":2`)
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any           = gomock.Any()
+		mockErr       = errors.New("an error")
+		mockLimit     = 1
+		mockZero      = 0
+		mockTooLarge  = userMaxLimit + 1
+		mockSort      = "name"
+		mockBadSort   = "-password"
+		mockStatus    = repository.ProfileStatusPendingDeletion
+		mockBadStatus = "banned"
+		mockPhone     = "+62811"
+		mockName      = "nar"
+		mockTime      = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		mockUsers     = []repository.User{{ID: 2, Name: "narto", Phone: "+6281122334455", Email: "narto@example.com"}}
+		mockCursor    = encodeUserCursor(mockSort, repository.ProfileSortName, repository.User{ID: 3, Name: "naruto"})
+		mockBadCursor = encodeUserCursor(userDefaultSort, repository.ProfileSortCreatedAt, repository.User{ID: 3})
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		authorized   bool
+		server       *Server
+		params       generated.ListUsersParams
+		expectErr    error
+		expectCursor bool
+		mock         func()
+	}{
+		{
+			name:      "err not authorized",
+			server:    server,
+			expectErr: errForbidden,
+		},
+		{
+			name:       "err invalid sort",
+			authorized: true,
+			server:     server,
+			params:     generated.ListUsersParams{Sort: &mockBadSort},
+			expectErr:  errInvalidRequest,
+		},
+		{
+			name:       "err invalid status",
+			authorized: true,
+			server:     server,
+			params:     generated.ListUsersParams{Status: &mockBadStatus},
+			expectErr:  errInvalidRequest,
+		},
+		{
+			name:       "err cursor of another sort",
+			authorized: true,
+			server:     server,
+			params:     generated.ListUsersParams{Sort: &mockSort, Cursor: &mockBadCursor},
+			expectErr:  errInvalidRequest,
+		},
+		{
+			name:       "err zero limit",
+			authorized: true,
+			server:     server,
+			params:     generated.ListUsersParams{Limit: &mockZero},
+			expectErr:  errInvalidRequest,
+		},
+		{
+			name:       "err too large limit",
+			authorized: true,
+			server:     server,
+			params:     generated.ListUsersParams{Limit: &mockTooLarge},
+			expectErr:  errInvalidRequest,
+		},
+		{
+			name:       "err save audit event",
+			authorized: true,
+			server:     server,
+			expectErr:  mockErr,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:       "err search profiles",
+			authorized: true,
+			server:     server,
+			expectErr:  errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().SearchProfiles(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:       "success default filter",
+			authorized: true,
+			server:     server,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().SearchProfiles(any, any, repository.ProfileFilter{
+					Sort:  repository.ProfileSortCreatedAt,
+					Desc:  true,
+					Limit: userDefaultLimit,
+				}).Return(mockUsers, nil)
+			},
+		},
+		{
+			name:       "success all filters",
+			authorized: true,
+			server:     server,
+			params: generated.ListUsersParams{
+				Phone:         &mockPhone,
+				Name:          &mockName,
+				CreatedFrom:   &mockTime,
+				CreatedTo:     &mockTime,
+				Status:        &mockStatus,
+				MinLoginCount: &mockLimit,
+				MaxLoginCount: &mockLimit,
+				Sort:          &mockSort,
+				Cursor:        &mockCursor,
+				Limit:         &mockLimit,
+			},
+			expectCursor: true,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().SearchProfiles(any, any, repository.ProfileFilter{
+					PhonePrefix:   mockPhone,
+					Name:          mockName,
+					CreatedFrom:   sql.NullTime{Time: mockTime, Valid: true},
+					CreatedTo:     sql.NullTime{Time: mockTime, Valid: true},
+					Status:        mockStatus,
+					MinLoginCount: sql.NullInt64{Int64: 1, Valid: true},
+					MaxLoginCount: sql.NullInt64{Int64: 1, Valid: true},
+					Sort:          repository.ProfileSortName,
+					After:         &repository.ProfileCursor{Value: "naruto", ID: 3},
+					Limit:         1,
+				}).Return(mockUsers, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if tt.authorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := tt.server.ListUsers(c, tt.params)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"status":"active"`)
+			assert.NotContains(t, rec.Body.String(), "password")
+			if tt.expectCursor {
+				assert.Contains(t, rec.Body.String(), `"next_cursor":"`+encodeUserCursor(mockSort, repository.ProfileSortName, mockUsers[0])+`"`)
+			} else {
+				assert.NotContains(t, rec.Body.String(), "next_cursor")
+			}
+		})
+	}
+}
+
+func TestPatchProfile(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any          = gomock.Any()
+		mockErr      = errors.New("an error")
+		mockUser     = repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Version: 1}
+		mockValidReq = `{"name": "sasuke", "phone": "081122334455"}`
+		mockEmailReq = `{"email": " Narto@Example.com"}`
+		mockETag     = `"1"`
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile"
+		mailer  = &MemoryMailer{}
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), Mailer: mailer})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name        string
+		token       string
+		ifMatch     string
+		contentType string
+		req         string
+		expectErr   error
+		expectMails int
+		mock        func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err missing if match",
+			token:     dummyValidToken,
+			req:       mockValidReq,
+			expectErr: errPreconditionReq,
+		},
+		{
+			name:      "err stale if match",
+			token:     dummyValidToken,
+			ifMatch:   `"0", W/"1"`,
+			req:       mockValidReq,
+			expectErr: errPreconditionFailed,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err update user version mismatch",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: errPreconditionFailed,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, repository.ErrVersionMismatch)
+			},
+		},
+		{
+			name:        "err unsupported content type",
+			token:       dummyValidToken,
+			ifMatch:     mockETag,
+			contentType: echo.MIMEApplicationJSON,
+			req:         mockValidReq,
+			expectErr:   errUnsupportedMedia,
+		},
+		{
+			name:      "err invalid payload",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       `["name"]`,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err null payload",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       `null`,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err get user profile by id no rows",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err invalid fields",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       `{"name": null, "phone": 62, "id": 2}`,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err invalid name",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       `{"name": ""}`,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err update user duplicate phone",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: errPhoneConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, repository.ErrDuplicate)
+			},
+		},
+		{
+			name:      "err invalid email",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       `{"email": "narto"}`,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:      "err update user duplicate email",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockEmailReq,
+			expectErr: errEmailConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, repository.ErrDuplicateEmail)
+			},
+		},
+		{
+			name:      "err update user",
+			token:     dummyValidToken,
+			ifMatch:   mockETag,
+			req:       mockValidReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:    "nothing to update",
+			token:   dummyValidToken,
+			ifMatch: mockETag,
+			req:     `{}`,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+			},
+		},
+		{
+			name:        "success",
+			token:       dummyValidToken,
+			ifMatch:     mockETag,
+			contentType: MIMEApplicationMergePatchJSON + "; charset=utf-8",
+			req:         mockValidReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, repository.User{ID: 1, Name: "sasuke", Phone: "+6281122334455", Version: 1}, int64(1)).Return(repository.User{ID: 1, Version: 2}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:        "success change email",
+			token:       dummyValidToken,
+			ifMatch:     mockETag,
+			req:         mockEmailReq,
+			expectMails: 1,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Email: "narto@example.com", Version: 1}, int64(1)).Return(repository.User{ID: 1, Email: "narto@example.com", Version: 2}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().SaveEmailVerification(any, any, any).Return(nil)
+			},
+		},
+		{
+			name:    "success change email without verification link",
+			token:   dummyValidToken,
+			ifMatch: mockETag,
+			req:     mockEmailReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, any, any).Return(repository.User{ID: 1, Email: "narto@example.com", Version: 2}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().SaveEmailVerification(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:    "success remove email",
+			token:   dummyValidToken,
+			ifMatch: mockETag,
+			req:     `{"email": null}`,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Email: "narto@example.com", Version: 1}, nil)
+				mockRepo.EXPECT().UpdateUserByID(any, any, repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Version: 1}, int64(1)).Return(repository.User{ID: 1, Version: 2}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+			sent := len(mailer.Mails())
+
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = MIMEApplicationMergePatchJSON
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, contentType)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.PatchProfile(c, generated.PatchProfileParams{IfMatch: &tt.ifMatch})
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get(HeaderETag))
+			assert.Len(t, mailer.Mails(), sent+tt.expectMails)
+		})
+	}
+}
+
+func TestRequestEmailVerification(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockUser = repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Email: "narto@example.com", Version: 1}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/email/verification"
+		mailer  = &MemoryMailer{}
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), Mailer: mailer})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err get profile no rows",
+			token:     dummyValidToken,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get profile",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err no email",
+			token:     dummyValidToken,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{ID: 1}, nil)
+			},
+		},
+		{
+			name:      "err already verified",
+			token:     dummyValidToken,
+			expectErr: errValidation,
+			mock: func() {
+				verified := mockUser
+				verified.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(verified, nil)
+			},
+		},
+		{
+			name:      "err save email verification",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().SaveEmailVerification(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().SaveEmailVerification(any, any, any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(mockUser, nil)
+				mockRepo.EXPECT().SaveEmailVerification(any, any, any).
+					DoAndReturn(func(_ interface{}, _ int64, verification repository.EmailVerification) error {
+						assert.Equal(t, mockUser.ID, verification.ProfileID)
+						assert.Equal(t, mockUser.Email, verification.Email)
+						assert.True(t, verification.ExpiresAt.After(time.Now()))
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+			sent := len(mailer.Mails())
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.RequestEmailVerification(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Len(t, mailer.Mails(), sent+1)
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any          = gomock.Any()
+		mockErr      = errors.New("an error")
+		key          = getDummyRSAKey()
+		verification = repository.EmailVerification{
+			ID:        "abc",
+			ProfileID: 1,
+			Email:     "narto@example.com",
+			ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+		}
+		mockToken, _ = generateEmailVerificationToken(key, verification)
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/email/verify"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key})
+	)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     dummyValidToken,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err used or expired",
+			token:     mockToken,
+			expectErr: errInvalidRequest,
+			mock: func() {
+				mockRepo.EXPECT().VerifyEmail(any, any, any).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err verified by another profile",
+			token:     mockToken,
+			expectErr: errEmailConflict,
+			mock: func() {
+				mockRepo.EXPECT().VerifyEmail(any, any, any).Return(repository.ErrDuplicateEmail)
+			},
+		},
+		{
+			name:      "err verify email",
+			token:     mockToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().VerifyEmail(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     mockToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().VerifyEmail(any, any, any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: mockToken,
+			mock: func() {
+				mockRepo.EXPECT().VerifyEmail(any, any, gomock.AssignableToTypeOf(repository.EmailVerification{})).
+					DoAndReturn(func(_ interface{}, _ int64, got repository.EmailVerification) error {
+						assert.Equal(t, verification.ID, got.ID)
+						assert.Equal(t, verification.ProfileID, got.ProfileID)
+						assert.Equal(t, verification.Email, got.Email)
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.VerifyEmail(c, generated.VerifyEmailParams{Token: tt.token})
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		})
+	}
+}
+
+func TestUpdateAvatar(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockUser = repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Version: 2}
+		mockPNG  = encodeTestImage(t, 600, 400, color.RGBA{R: 0xff, A: 0xff}, png.Encode)
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/avatar"
+		blobs   = &stubBlobStore{}
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), BlobStore: blobs})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	// build the multipart request body containing the file in the given field
+	multipartBody := func(field string, data []byte) (string, io.Reader) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, _ := w.CreateFormFile(field, "avatar.png")
+		part.Write(data)
+		w.Close()
+		return w.FormDataContentType(), &buf
+	}
+
+	test := []struct {
+		name         string
+		token        string
+		field        string
+		data         []byte
+		contentType  string
+		blobErr      error
+		expectErr    error
+		expectBlobs  int
+		previousBlob string
+		mock         func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:        "err not multipart",
+			token:       dummyValidToken,
+			contentType: echo.MIMEApplicationJSON,
+			expectErr:   errInvalidRequest,
+		},
+		{
+			name:      "err missing avatar",
+			token:     dummyValidToken,
+			field:     "picture",
+			data:      mockPNG,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err request too large",
+			token:     dummyValidToken,
+			data:      make([]byte, avatarMaxSize+avatarMultipartOverhead),
+			expectErr: errValidation,
+		},
+		{
+			name:      "err not an image",
+			token:     dummyValidToken,
+			data:      []byte("hello world"),
+			expectErr: errValidation,
+		},
+		{
+			name:      "err save avatar",
+			token:     dummyValidToken,
+			data:      mockPNG,
+			blobErr:   mockErr,
+			expectErr: errInternal,
+		},
+		{
+			name:      "err update avatar no rows",
+			token:     dummyValidToken,
+			data:      mockPNG,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().UpdateProfileAvatar(any, any, int64(1), any).Return("", sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err update avatar",
+			token:     dummyValidToken,
+			data:      mockPNG,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().UpdateProfileAvatar(any, any, int64(1), any).Return("", mockErr)
+			},
+		},
+		{
+			name:        "err save audit event",
+			token:       dummyValidToken,
+			data:        mockPNG,
+			expectErr:   errInternal,
+			expectBlobs: 2,
+			mock: func() {
+				mockRepo.EXPECT().UpdateProfileAvatar(any, any, int64(1), any).Return("", nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:        "err get profile",
+			token:       dummyValidToken,
+			data:        mockPNG,
+			expectErr:   errInternal,
+			expectBlobs: 2,
+			mock: func() {
+				mockRepo.EXPECT().UpdateProfileAvatar(any, any, int64(1), any).Return("", nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:         "success",
+			token:        dummyValidToken,
+			data:         mockPNG,
+			previousBlob: "avatars/1/old",
+			expectBlobs:  2,
+			mock: func() {
+				mockRepo.EXPECT().UpdateProfileAvatar(any, any, int64(1), any).Return("avatars/1/old", nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, any).DoAndReturn(func(_ interface{}, _, _ int64) (repository.User, error) {
+					user := mockUser
+					for key := range blobs.blobs {
+						user.AvatarKey = key[:strings.LastIndex(key, "/")]
+					}
+					return user, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+			blobs.err = tt.blobErr
+			blobs.blobs = map[string][]byte{}
+			if tt.previousBlob != "" {
+				for _, size := range avatarSizes {
+					blobs.blobs[avatarBlobKey(tt.previousBlob, size)] = []byte("old")
+				}
+			}
+
+			field := tt.field
+			if field == "" {
+				field = avatarField
+			}
+			contentType, body := multipartBody(field, tt.data)
+			if tt.contentType != "" {
+				contentType = tt.contentType
+			}
+
+			req := httptest.NewRequest(http.MethodPut, reqPath, body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.UpdateAvatar(c)
+
+			// the previous avatar is removed and the new one is kept only once it is saved into the profile
+			assert.Len(t, blobs.blobs, tt.expectBlobs)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var profile generated.Profile
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &profile))
+			if assert.NotNil(t, profile.AvatarUrl) && assert.NotNil(t, profile.AvatarThumbnailUrl) {
+				assert.Contains(t, blobs.blobs, strings.TrimPrefix(*profile.AvatarUrl, "https://example.com/"))
+				assert.Contains(t, blobs.blobs, strings.TrimPrefix(*profile.AvatarThumbnailUrl, "https://example.com/"))
+			}
+		})
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/preferences"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		expect    map[string]interface{}
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err get preferences",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			expect: map[string]interface{}{
+				"language":      "id",
+				"timezone":      "UTC",
+				"notifications": map[string]interface{}{"email": true, "sms": true, "push": true, "new_device_login": true},
+				"attributes":    map[string]interface{}{},
+			},
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).
+					Return(repository.Preferences{"language": json.RawMessage(`"id"`)}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.Preferences(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var got map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func TestUpdatePreferences(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		saved   = repository.Preferences{
+			"language": json.RawMessage(`"id"`),
+			"timezone": json.RawMessage(`"Asia/Jakarta"`),
+		}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/preferences"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		body      string
+		expect    map[string]interface{}
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			body:      `{}`,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err invalid body",
+			token:     dummyValidToken,
+			body:      `["language"]`,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err unknown key",
+			token:     dummyValidToken,
+			body:      `{"color": "red"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err schema",
+			token:     dummyValidToken,
+			body:      `{"timezone": "Mars/Olympus"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err get preferences",
+			token:     dummyValidToken,
+			body:      `{"language": "en"}`,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err save preferences",
+			token:     dummyValidToken,
+			body:      `{"language": "en"}`,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(saved, nil)
+				mockRepo.EXPECT().SavePreferences(any, any, int64(1), any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     dummyValidToken,
+			body:      `{"language": "en"}`,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(saved, nil)
+				mockRepo.EXPECT().SavePreferences(any, any, int64(1), any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:   "success without changes",
+			token:  dummyValidToken,
+			body:   `{}`,
+			expect: map[string]interface{}{"language": "id", "timezone": "Asia/Jakarta"},
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(saved, nil)
+			},
+		},
+		{
+			name:   "success",
+			token:  dummyValidToken,
+			body:   `{"timezone": null, "notifications": {"sms": false}}`,
+			expect: map[string]interface{}{"language": "id", "timezone": "UTC", "notifications": map[string]interface{}{"sms": false}},
+			mock: func() {
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(saved, nil)
+				mockRepo.EXPECT().SavePreferences(any, any, int64(1), gomock.AssignableToTypeOf(repository.Preferences{})).
+					DoAndReturn(func(_ interface{}, _, _ int64, changes repository.Preferences) error {
+						assert.Len(t, changes, 2)
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, gomock.AssignableToTypeOf(repository.AuditEvent{})).
+					DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+						assert.Equal(t, auditActionPreferences, event.Action)
+						return 1, nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, reqPath, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.UpdatePreferences(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var got map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			for key, value := range tt.expect {
+				assert.Equal(t, value, got[key], key)
+			}
+		})
+	}
+}
+
+func TestRequestDataExport(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockExport = repository.DataExport{ID: "abc", ProfileID: 1, Status: repository.DataExportPending, CreatedAt: time.Now()}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/export"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	expectActive(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err export in progress",
+			token:     dummyValidToken,
+			expectErr: errExportInProgress,
+			mock: func() {
+				mockRepo.EXPECT().SaveDataExport(any, any, any).Return(repository.DataExport{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err save data export",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveDataExport(any, any, any).Return(repository.DataExport{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveDataExport(any, any, any).Return(mockExport, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			mock: func() {
+				mockRepo.EXPECT().SaveDataExport(any, any, gomock.AssignableToTypeOf(repository.DataExport{})).
+					DoAndReturn(func(_ interface{}, _ int64, export repository.DataExport) (repository.DataExport, error) {
+						assert.Equal(t, int64(1), export.ProfileID)
+						assert.NotEmpty(t, export.ID)
+						return mockExport, nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.RequestDataExport(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Equal(t, "/profile/export/abc", rec.Header().Get(echo.HeaderLocation))
+
+			var got generated.DataExport
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, generated.Pending, got.Status)
+			assert.Nil(t, got.DownloadUrl)
+		})
+	}
+}
+
+func TestDataExport(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockExport = repository.DataExport{
+			ID:         "abc",
+			ProfileID:  1,
+			Status:     repository.DataExportCompleted,
+			CreatedAt:  time.Now(),
+			FinishedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			ExpiresAt:  sql.NullTime{Time: time.Now().Add(exportTTL), Valid: true},
+		}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/export/abc"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	expectActive(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err get data export no rows",
+			token:     dummyValidToken,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(repository.DataExport{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get data export",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(repository.DataExport{}, mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(mockExport, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.DataExport(c, "abc")
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var got generated.DataExport
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, generated.Completed, got.Status)
+			assert.NotNil(t, got.DownloadUrl)
+		})
+	}
+}
+
+func TestDownloadDataExport(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+		exports  = &stubBlobStore{}
+		key      = getDummyRSAKey()
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockExport = repository.DataExport{
+			ID:         "abc",
+			ProfileID:  1,
+			Status:     repository.DataExportCompleted,
+			ArchiveKey: "exports/1/abc.zip",
+			ExpiresAt:  sql.NullTime{Time: time.Now().Add(exportTTL), Valid: true},
+		}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/export/abc/download"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key, ExportStore: exports})
+	)
+
+	validToken, err := generateDataExportToken(key, mockExport, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	expiredExport := mockExport
+	expiredExport.ExpiresAt.Time = time.Now().Add(-time.Minute)
+	failedExport := mockExport
+	failedExport.Status = repository.DataExportFailed
+
+	test := []struct {
+		name      string
+		token     string
+		blobErr   error
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid download link",
+			token:     dummyValidToken,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err get data export no rows",
+			token:     validToken,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(repository.DataExport{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get data export",
+			token:     validToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(repository.DataExport{}, mockErr)
+			},
+		},
+		{
+			name:      "err failed export",
+			token:     validToken,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(failedExport, nil)
+			},
+		},
+		{
+			name:      "err expired export",
+			token:     validToken,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(expiredExport, nil)
+			},
+		},
+		{
+			name:      "err get archive",
+			token:     validToken,
+			blobErr:   mockErr,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(mockExport, nil)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     validToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(mockExport, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: validToken,
+			mock: func() {
+				mockRepo.EXPECT().GetDataExport(any, any, int64(1), "abc").Return(mockExport, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			exports.err = tt.blobErr
+			exports.blobs = map[string][]byte{mockExport.ArchiveKey: []byte("archive")}
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.DownloadDataExport(c, "abc", generated.DownloadDataExportParams{Token: tt.token})
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, exportContentType, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, `attachment; filename="data-export-abc.zip"`, rec.Header().Get(echo.HeaderContentDisposition))
+			assert.Equal(t, "archive", rec.Body.String())
+		})
+	}
+}
+
+func TestCurrentTerms(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		mockTerms = repository.TermsVersion{Version: "2024-01", URL: "https://example.com/terms", PublishedAt: time.Now().UTC().Truncate(time.Second)}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/terms"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name      string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err no terms published",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get current terms",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.CurrentTerms(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var got generated.Terms
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, toTermsResponse(mockTerms), got)
+		})
+	}
+}
+
+func TestAcceptTerms(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		mockReq   = `{"terms_version": "2024-01"}`
+		mockTerms = repository.TermsVersion{Version: "2024-01", URL: "https://example.com/terms", PublishedAt: time.Now()}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/profile/consent"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	expectActive(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		req       string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			req:       mockReq,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err bind request",
+			token:     dummyValidToken,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err get current terms",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, mockErr)
+			},
+		},
+		{
+			name:      "err no terms published",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err version not current",
+			token:     dummyValidToken,
+			req:       `{"terms_version": "2023-01"}`,
+			expectErr: errValidation,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+		{
+			name:      "err save consent",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+				mockRepo.EXPECT().SaveConsent(any, any, any).Return(repository.Consent{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			token:     dummyValidToken,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+				mockRepo.EXPECT().SaveConsent(any, any, any).Return(repository.Consent{ID: 1}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			req:   mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+				mockRepo.EXPECT().SaveConsent(any, any, gomock.AssignableToTypeOf(repository.Consent{})).DoAndReturn(
+					func(_ interface{}, _ int64, consent repository.Consent) (repository.Consent, error) {
+						assert.Equal(t, int64(1), consent.ProfileID)
+						assert.Equal(t, "2024-01", consent.TermsVersion)
+						assert.Equal(t, "curl/8.0", consent.UserAgent)
+						consent.ID = 1
+						consent.AcceptedAt = time.Now()
+						return consent, nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("User-Agent", "curl/8.0")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			err := server.AcceptTerms(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var got generated.Consent
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, int64(1), got.Id)
+			assert.Equal(t, "2024-01", got.TermsVersion)
+		})
+	}
+}
+
+func TestPublishTerms(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		mockReq = `{"version": "2024-01", "url": "https://example.com/terms", "published_at": "2030-01-02T15:04:05+07:00"}`
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/terms"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name          string
+		server        *Server
+		unauthorized  bool
+		req           string
+		expectErr     error
+		expectPublish time.Time
+		mock          func()
+	}{
+		{
+			name:         "err not authorized",
+			server:       server,
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			server:    server,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invalid url",
+			server:    server,
+			req:       `{"version": "2024-01", "url": "terms"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err missing version",
+			server:    server,
+			req:       `{"url": "https://example.com/terms"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err version already exists",
+			server:    server,
+			req:       mockReq,
+			expectErr: errTermsConflict,
+			mock: func() {
+				mockRepo.EXPECT().SaveTermsVersion(any, any, any).Return(repository.ErrDuplicate)
+			},
+		},
+		{
+			name:      "err save terms version",
+			server:    server,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveTermsVersion(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			server:    server,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveTermsVersion(any, any, any).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:          "success scheduled",
+			server:        server,
+			req:           mockReq,
+			expectPublish: time.Date(2030, 1, 2, 8, 4, 5, 0, time.UTC),
+			mock: func() {
+				mockRepo.EXPECT().SaveTermsVersion(any, any, repository.TermsVersion{
+					Version:     "2024-01",
+					URL:         "https://example.com/terms",
+					PublishedAt: time.Date(2030, 1, 2, 8, 4, 5, 0, time.UTC),
+				}).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:   "success now",
+			server: server,
+			req:    `{"version": "2024-01", "url": "https://example.com/terms"}`,
+			mock: func() {
+				mockRepo.EXPECT().SaveTermsVersion(any, any, gomock.AssignableToTypeOf(repository.TermsVersion{})).DoAndReturn(
+					func(_ interface{}, _ int64, terms repository.TermsVersion) error {
+						assert.WithinDuration(t, time.Now(), terms.PublishedAt, time.Minute)
+						return nil
+					})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := tt.server.PublishTerms(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var got generated.Terms
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, "2024-01", got.Version)
+			if !tt.expectPublish.IsZero() {
+				assert.True(t, tt.expectPublish.Equal(got.PublishedAt))
+			}
+		})
+	}
+}
+
+func TestListPermissions(t *testing.T) {
+	var (
+		e      = echo.New()
+		server = NewServer(NewServerOptions{RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/permissions", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	assert.ErrorIs(t, server.ListPermissions(c), errForbidden)
+
+	c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+	assert.NoError(t, server.ListPermissions(c))
+	assert.Contains(t, rec.Body.String(), `"roles:write"`)
+}
+
+func TestListRoles(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/roles"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		expectBody   string
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err get roles",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRoles(any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:       "success empty",
+			expectBody: `{"roles":[]}`,
+			mock: func() {
+				mockRepo.EXPECT().GetRoles(any, any).Return(nil, nil)
+			},
+		},
+		{
+			name:       "success",
+			expectBody: `"permissions":["users:read"]`,
+			mock: func() {
+				mockRepo.EXPECT().GetRoles(any, any).Return([]repository.Role{{ID: 1, Name: "support", Permissions: []string{"users:read"}}}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.ListRoles(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), tt.expectBody)
+		})
+	}
+}
+
+func TestCreateRole(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockReq  = `{"name": "support", "description": "customer support", "permissions": ["users:read", "roles:read", "users:read"]}`
+		mockRole = repository.Role{Name: "support", Description: "customer support", Permissions: []string{"roles:read", "users:read"}}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/roles"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		req          string
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err unknown permission",
+			req:       `{"name": "support", "permissions": ["users:delete"]}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err name already exists",
+			req:       mockReq,
+			expectErr: errRoleConflict,
+			mock: func() {
+				mockRepo.EXPECT().CreateRole(any, any, mockRole).Return(repository.Role{}, repository.ErrDuplicate)
+			},
+		},
+		{
+			name:      "err create role",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().CreateRole(any, any, mockRole).Return(repository.Role{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().CreateRole(any, any, mockRole).Return(mockRole, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				saved := mockRole
+				saved.ID = 1
+				mockRepo.EXPECT().CreateRole(any, any, mockRole).Return(saved, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.CreateRole(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var got generated.Role
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, int64(1), got.Id)
+			assert.Equal(t, []string{"roles:read", "users:read"}, got.Permissions)
+		})
+	}
+}
+
+func TestUpdateRole(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockReq  = `{"name": "support", "permissions": ["users:read"]}`
+		mockRole = repository.Role{ID: 1, Name: "support", Permissions: []string{"users:read"}}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/roles/1"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		req          string
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err invalid name",
+			req:       `{"name": "Support", "permissions": []}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err role not found",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(repository.Role{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get role",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(repository.Role{}, mockErr)
+			},
+		},
+		{
+			name:      "err role deleted in the meantime",
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().UpdateRole(any, any, mockRole).Return(repository.Role{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err name already exists",
+			req:       mockReq,
+			expectErr: errRoleConflict,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().UpdateRole(any, any, mockRole).Return(repository.Role{}, repository.ErrDuplicate)
+			},
+		},
+		{
+			name:      "err update role",
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().UpdateRole(any, any, mockRole).Return(repository.Role{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().UpdateRole(any, any, mockRole).Return(mockRole, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			req:  mockReq,
+			mock: func() {
+				previous := repository.Role{ID: 1, Name: "helpdesk", Permissions: []string{"audit:read"}}
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(previous, nil)
+				mockRepo.EXPECT().UpdateRole(any, any, mockRole).Return(mockRole, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.UpdateRole(c, 1)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"name":"support"`)
+		})
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockRole = repository.Role{ID: 1, Name: "support"}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/roles/1"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err role not found",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(repository.Role{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get role",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(repository.Role{}, mockErr)
+			},
+		},
+		{
+			name:      "err role deleted in the meantime",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().DeleteRole(any, any, int64(1)).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err delete role",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().DeleteRole(any, any, int64(1)).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().DeleteRole(any, any, int64(1)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(1)).Return(mockRole, nil)
+				mockRepo.EXPECT().DeleteRole(any, any, int64(1)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.DeleteRole(c, 1)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		})
+	}
+}
+
+func TestListUserRoles(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/2/roles"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err user not found",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get user",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err get roles",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, int64(2)).Return(nil, mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, int64(2)).Return([]repository.Role{{ID: 1, Name: "support"}}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.ListUserRoles(c, 2)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, rec.Body.String(), `"name":"support","permissions":[]`)
+		})
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockRole = repository.Role{ID: 3, Name: "support"}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/2/roles/3"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err user not found",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get user",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err role not found",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(repository.Role{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get role",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(repository.Role{}, mockErr)
+			},
+		},
+		{
+			name:      "err assign role",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().AssignRole(any, any, int64(2), int64(3)).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().AssignRole(any, any, int64(2), int64(3)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{ID: 2}, nil)
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().AssignRole(any, any, int64(2), int64(3)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.AssignRole(c, 2, 3)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		})
+	}
+}
+
+func TestRevokeRole(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockRole = repository.Role{ID: 3, Name: "support"}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/2/roles/3"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err role not found",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(repository.Role{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get role",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(repository.Role{}, mockErr)
+			},
+		},
+		{
+			name:      "err role not assigned",
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().RevokeRole(any, any, int64(2), int64(3)).Return(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err revoke role",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().RevokeRole(any, any, int64(2), int64(3)).Return(mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().RevokeRole(any, any, int64(2), int64(3)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetRole(any, any, int64(3)).Return(mockRole, nil)
+				mockRepo.EXPECT().RevokeRole(any, any, int64(2), int64(3)).Return(nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, reqPath, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.RevokeRole(c, 2, 3)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+		})
+	}
+}
+
+func TestUpdateUserStatus(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockReq  = `{"status": "suspended", "reason": " spam "}`
+		mockUser = repository.User{ID: 2, Name: "narto", Status: repository.ProfileStatusActive}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/2/status"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		id           int64
+		req          string
+		expectErr    error
+		expectStatus string
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			id:           2,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			id:        2,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err missing reason",
+			id:        2,
+			req:       `{"status": "disabled"}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err own status",
+			id:        1,
+			req:       mockReq,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err user not found",
+			id:        2,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get user",
+			id:        2,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err user purged in the meantime",
+			id:        2,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateProfileStatus(any, any, int64(2), repository.ProfileStatusSuspended, "spam", int64(1)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err update status",
+			id:        2,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateProfileStatus(any, any, int64(2), repository.ProfileStatusSuspended, "spam", int64(1)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			id:        2,
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				suspended := mockUser
+				suspended.Status, suspended.StatusReason = repository.ProfileStatusSuspended, "spam"
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateProfileStatus(any, any, int64(2), repository.ProfileStatusSuspended, "spam", int64(1)).Return(suspended, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:         "success suspend",
+			id:           2,
+			req:          mockReq,
+			expectStatus: repository.ProfileStatusSuspended,
+			mock: func() {
+				suspended := mockUser
+				suspended.Status, suspended.StatusReason = repository.ProfileStatusSuspended, "spam"
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().UpdateProfileStatus(any, any, int64(2), repository.ProfileStatusSuspended, "spam", int64(1)).Return(suspended, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+		{
+			name:         "success reactivate clears the reason",
+			id:           2,
+			req:          `{"status": "active", "reason": "appeal accepted"}`,
+			expectStatus: repository.ProfileStatusActive,
+			mock: func() {
+				suspended := mockUser
+				suspended.Status, suspended.StatusReason = repository.ProfileStatusSuspended, "spam"
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(suspended, nil)
+				mockRepo.EXPECT().UpdateProfileStatus(any, any, int64(2), repository.ProfileStatusActive, "", int64(1)).Return(mockUser, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.UpdateUserStatus(c, tt.id)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			var got generated.AdminUser
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, tt.expectStatus, got.Status)
+		})
+	}
+}
+
+func TestImpersonateUser(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		mockReq  = `{"reason": "ticket #42"}`
+		mockUser = repository.User{ID: 2, Name: "narto", Status: repository.ProfileStatusActive}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/2/impersonate"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), ImpersonationTTL: time.Minute})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		id           int64
+		req          string
+		expectErr    error
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			id:           2,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err bind request",
+			id:        2,
+			req:       "asd",
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err missing reason",
+			id:        2,
+			req:       `{}`,
+			expectErr: errValidation,
+		},
+		{
+			name:      "err impersonate self",
+			id:        1,
+			req:       mockReq,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err user not found",
+			id:        2,
+			req:       mockReq,
+			expectErr: errNotFound,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get user",
+			id:        2,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err user disabled",
+			id:        2,
+			req:       mockReq,
+			expectErr: errAccountDisabled,
+			mock: func() {
+				disabled := mockUser
+				disabled.Status = repository.ProfileStatusDisabled
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(disabled, nil)
+			},
+		},
+		{
+			name:      "err get user roles",
+			id:        2,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, int64(2)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get user memberships",
+			id:        2,
+			req:       mockReq,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, int64(2)).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, int64(2)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err save audit event",
+			id:        2,
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, int64(2)).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, int64(2)).Return(nil, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name: "success",
+			id:   2,
+			req:  mockReq,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(2)).Return(mockUser, nil)
+				mockRepo.EXPECT().GetProfileRoles(any, any, int64(2)).Return([]repository.Role{{Name: "support", Permissions: []string{"users:read"}}}, nil)
+				mockRepo.EXPECT().GetProfileMemberships(any, any, int64(2)).Return([]repository.Membership{{OrganizationID: 3, Role: repository.OrganizationRoleMember}}, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionImpersonate, event.Action)
+					assert.Equal(t, int64(1), event.ActorID.Int64)
+					assert.Equal(t, int64(2), event.TargetID.Int64)
+					assert.Contains(t, string(event.After), `"reason":"ticket #42"`)
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.ImpersonateUser(c, tt.id)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var got generated.ImpersonationResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.WithinDuration(t, time.Now().Add(time.Minute), got.ExpiresAt, 2*time.Second)
+
+			// the token acts as the user on behalf of the admin
+			tokenReq := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			tokenReq.Header.Set(echo.HeaderAuthorization, "Bearer "+got.Token)
+			claim, err := parseToken(e.NewContext(tokenReq, httptest.NewRecorder()), getDummyRSAKey())
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), claim.ID)
+			assert.Equal(t, &tokenActor{Subject: "1"}, claim.Act)
+			assert.Equal(t, []tokenOrganization{{ID: 3, Role: repository.OrganizationRoleMember}}, claim.Orgs)
+			assert.Equal(t, got.SessionId, claim.SessionID)
+			assert.Equal(t, []string{"support"}, claim.Roles)
+		})
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		mockReq = "name,phone,email,password\n" +
+			"narto,081234567890,Narto@Konoha.id,Passw0rd!\n" +
+			"sasuke,+6281234567891,,weak\n"
+		dryRun = true
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/import"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		unauthorized bool
+		contentType  string
+		params       generated.ImportUsersParams
+		req          string
+		expectErr    error
+		expectReport generated.ImportReport
+		mock         func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			contentType:  MIMETextCSV,
+			req:          mockReq,
+			expectErr:    errForbidden,
+		},
+		{
+			name:        "err unsupported content type",
+			contentType: echo.MIMEApplicationJSON,
+			req:         mockReq,
+			expectErr:   errUnsupportedMedia,
+		},
+		{
+			name:        "err invalid header",
+			contentType: MIMETextCSV,
+			req:         "name,phone,age\n",
+			expectErr:   errInvalidRequest,
+		},
+		{
+			name:        "err get registered identifiers",
+			contentType: MIMETextCSV,
+			req:         mockReq,
+			expectErr:   errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:        "err import profiles",
+			contentType: MIMETextCSV,
+			req:         mockReq,
+			expectErr:   errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().ImportProfiles(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:        "err audit",
+			contentType: MIMETextCSV,
+			req:         mockReq,
+			expectErr:   errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().ImportProfiles(any, any, any).DoAndReturn(func(_ interface{}, _ int64, users []repository.User) ([]repository.User, error) {
+					return []repository.User{{ID: 3, Phone: users[0].Phone}}, nil
+				})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:        "success dry run",
+			contentType: MIMETextCSV + "; charset=utf-8",
+			params:      generated.ImportUsersParams{DryRun: &dryRun},
+			req:         mockReq,
+			expectReport: generated.ImportReport{
+				DryRun: true, Total: 2, Valid: 1, Invalid: 1,
+				Rows: []generated.ImportRowResult{
+					{Line: 2, Status: ImportStatusValid},
+					{Line: 3, Status: ImportStatusInvalid},
+				},
+			},
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, []string{"+6281234567890"}, []string{"narto@konoha.id"}).Return(nil, nil)
+			},
+		},
+		{
+			name:        "success",
+			contentType: MIMEApplicationNDJSON,
+			req: `{"name": "narto", "phone": "081234567890", "password": "Passw0rd!"}` + "\n" +
+				`{"name": "sasuke", "phone": "+6281234567891", "password": "Passw0rd!"}` + "\n",
+			expectReport: generated.ImportReport{
+				Total: 2, Imported: 1, Duplicate: 1,
+				Rows: []generated.ImportRowResult{
+					{Line: 1, Status: ImportStatusImported},
+					{Line: 2, Status: ImportStatusDuplicate},
+				},
+			},
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, any, any).Return([]string{"+6281234567891"}, nil)
+				mockRepo.EXPECT().ImportProfiles(any, any, any).DoAndReturn(func(_ interface{}, _ int64, users []repository.User) ([]repository.User, error) {
+					assert.Len(t, users, 1)
+					assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(users[0].Password), []byte("Passw0rd!")))
+					users[0].ID = 3
+					return users, nil
+				})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionUserImport, event.Action)
+					assert.Equal(t, int64(1), event.ActorID.Int64)
+					assert.False(t, event.TargetID.Valid)
+					assert.JSONEq(t, `{"total":2,"imported":1,"invalid":0,"duplicate":1}`, string(event.After))
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, reqPath, strings.NewReader(tt.req))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.ImportUsers(c, tt.params)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var got generated.ImportReport
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Len(t, got.Rows, len(tt.expectReport.Rows))
+			for i := range got.Rows {
+				// the phone, the id and the errors are covered by the import tests
+				got.Rows[i].Phone, got.Rows[i].Id, got.Rows[i].Errors = nil, nil, nil
+			}
+			assert.Equal(t, tt.expectReport, got)
+		})
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		status  = "deleted"
+		ndjson  = FormatNDJSON
+		fields  = "id,phone"
+		narto   = repository.User{ID: 1, Name: "narto", Phone: "+6281234567890"}
+
+		// echo server mock
+		e       = echo.New()
+		reqPath = "/admin/users/export"
+		server  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name              string
+		unauthorized      bool
+		params            generated.ExportUsersParams
+		expectErr         error
+		expectContentType string
+		expectBody        string
+		mock              func()
+	}{
+		{
+			name:         "err not authorized",
+			unauthorized: true,
+			expectErr:    errForbidden,
+		},
+		{
+			name:      "err unknown status",
+			params:    generated.ExportUsersParams{Status: &status},
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err unknown format",
+			params:    generated.ExportUsersParams{Format: &status},
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err audit",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:      "err export profiles",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().ExportProfiles(any, any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:              "success csv",
+			params:            generated.ExportUsersParams{Fields: &fields},
+			expectContentType: MIMETextCSV,
+			expectBody:        "id,phone\n1,+6281234567890\n",
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionUserExport, event.Action)
+					assert.Equal(t, int64(1), event.ActorID.Int64)
+					return 1, nil
+				})
+				mockRepo.EXPECT().ExportProfiles(any, any, any, any).DoAndReturn(exportUsersOf(narto))
+			},
+		},
+		{
+			name:              "success empty ndjson",
+			params:            generated.ExportUsersParams{Format: &ndjson},
+			expectContentType: MIMEApplicationNDJSON,
+			mock: func() {
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(1), nil)
+				mockRepo.EXPECT().ExportProfiles(any, any, any, any).DoAndReturn(exportUsersOf())
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, reqPath, nil), rec)
+			if !tt.unauthorized {
+				c.Set(contextKeyAuthorizedUser, repository.User{ID: 1})
+			}
+			err := server.ExportUsers(c, tt.params)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+
+				// the error found before anything is exported is rendered as the problem details
+				assert.False(t, c.Response().Committed)
+				return
 			}
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectContentType, rec.Header().Get(echo.HeaderContentType))
+			assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "attachment; filename=\"users-")
+			assert.Equal(t, tt.expectBody, rec.Body.String())
 		})
 	}
 }
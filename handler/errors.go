@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/i18n"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// content type of the RFC 7807 problem details
+	MIMEApplicationProblemJSON = "application/problem+json"
+
+	// prefix of the problem type, the suffix is a stable code that can be used by the client
+	problemTypePrefix = "/problems/"
+
+	HeaderAcceptLanguage  = "Accept-Language"
+	HeaderContentLanguage = "Content-Language"
+	HeaderRetryAfter      = "Retry-After"
+)
+
+// Error is a domain error rendered by ErrorHandler as RFC 7807 problem details.
+// Type is a stable code, the title is the "title.<type>" message of the i18n catalog
+// and Title is only used when the catalog has no such message.
+// Detail is a message key of the catalog (or a literal text) rendered with the DetailParams.
+// Detail and Errors are safe to be shown to the client while the wrapped error is only written into the application log.
+// RetryAfter is sent as the Retry-After header in seconds when it is set.
+type Error struct {
+	Status       int
+	Type         string
+	Title        string
+	Detail       string
+	DetailParams map[string]interface{}
+	Errors       ValidationErrors
+	RetryAfter   time.Duration
+
+	err error
+}
+
+var (
+	errInvalidRequest     = &Error{Status: http.StatusBadRequest, Type: "invalid-request"}
+	errValidation         = &Error{Status: http.StatusUnprocessableEntity, Type: "validation-failed"}
+	errInvalidCredentials = &Error{Status: http.StatusUnauthorized, Type: "invalid-credentials"}
+	errForbidden          = &Error{Status: http.StatusForbidden, Type: "forbidden"}
+	errPendingDeletion    = &Error{Status: http.StatusForbidden, Type: "account-pending-deletion"}
+	errAccountSuspended   = &Error{Status: http.StatusForbidden, Type: "account-suspended"}
+	errAccountDisabled    = &Error{Status: http.StatusForbidden, Type: "account-disabled"}
+	errTermsRequired      = &Error{Status: http.StatusForbidden, Type: "terms-acceptance-required"}
+	errNotFound           = &Error{Status: http.StatusNotFound, Type: "not-found"}
+	errPhoneConflict      = &Error{Status: http.StatusConflict, Type: "phone-already-registered"}
+	errEmailConflict      = &Error{Status: http.StatusConflict, Type: "email-already-registered"}
+	errExportInProgress   = &Error{Status: http.StatusConflict, Type: "export-in-progress"}
+	errTermsConflict      = &Error{Status: http.StatusConflict, Type: "terms-version-exists"}
+	errRoleConflict       = &Error{Status: http.StatusConflict, Type: "role-name-exists"}
+	errMemberConflict     = &Error{Status: http.StatusConflict, Type: "organization-member-exists"}
+	errLastOwner          = &Error{Status: http.StatusConflict, Type: "organization-last-owner"}
+	errPreconditionFailed = &Error{Status: http.StatusPreconditionFailed, Type: "precondition-failed"}
+	errPreconditionReq    = &Error{Status: http.StatusPreconditionRequired, Type: "precondition-required"}
+	errUnsupportedMedia   = &Error{Status: http.StatusUnsupportedMediaType, Type: "unsupported-media-type"}
+	errTooManyAttempts    = &Error{Status: http.StatusTooManyRequests, Type: "too-many-attempts"}
+	errTooManyRequests    = &Error{Status: http.StatusTooManyRequests, Type: "too-many-requests"}
+	errInternal           = &Error{Status: http.StatusInternalServerError, Type: "internal-error"}
+)
+
+func (e *Error) Error() string {
+	msg := e.Type
+	if e.Detail != "" {
+		msg += ": " + catalog.Message(i18n.DefaultLanguage, e.Detail, e.DetailParams)
+	}
+	if e.err != nil {
+		msg += ": " + e.err.Error()
+	}
+	return msg
+}
+
+// return the wrapped internal error
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// errors with the same type are considered equal, so errors.Is(err, errForbidden) works on the derived errors
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Type == e.Type
+}
+
+// return a copy of the error with the given detail message key and its params shown to the client
+func (e *Error) withDetail(key string, params map[string]interface{}) *Error {
+	c := *e
+	c.Detail = key
+	c.DetailParams = params
+	return &c
+}
+
+// return a copy of the error telling the client to wait for the given duration before retrying
+func (e *Error) retryAfter(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+// return a copy of the error wrapping the internal cause, the cause is never shown to the client
+func (e *Error) wrap(err error) *Error {
+	c := *e
+	c.err = err
+	return &c
+}
+
+// ErrorHandler is the echo HTTPErrorHandler which renders every error as RFC 7807 problem details,
+// errors unknown to the handler package are hidden behind the internal error so the driver messages are never leaked.
+func ErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+
+	problem := toProblem(err)
+	if problem.Status >= http.StatusInternalServerError {
+		ctx.Logger().Error(err)
+	}
+
+	lang := catalog.Match(ctx.Request().Header.Get(HeaderAcceptLanguage))
+	ctx.Response().Header().Set(HeaderContentLanguage, lang)
+	ctx.Response().Header().Add(echo.HeaderVary, HeaderAcceptLanguage)
+	if problem.RetryAfter > 0 {
+		ctx.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(int(math.Ceil(problem.RetryAfter.Seconds()))))
+	}
+
+	if ctx.Request().Method == http.MethodHead {
+		err = ctx.NoContent(problem.Status)
+	} else {
+		err = writeProblem(ctx, problem, lang)
+	}
+	if err != nil {
+		ctx.Logger().Error(err)
+	}
+}
+
+// convert the error returned by Validate into the validation domain error containing the field errors,
+// other errors are considered as internal error
+func validationError(err error) *Error {
+	verr, ok := err.(ValidationErrors)
+	if !ok {
+		return errInternal.wrap(err)
+	}
+
+	c := *errValidation
+	c.Errors = verr
+	return &c
+}
+
+// convert any error into the domain error
+func toProblem(err error) *Error {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromHTTPError(httpErr)
+	}
+
+	return errInternal.wrap(err)
+}
+
+// convert the echo HTTP error, e.g. unknown route or invalid parameter, into the domain error
+func fromHTTPError(httpErr *echo.HTTPError) *Error {
+	var problem *Error
+	switch httpErr.Code {
+	case http.StatusBadRequest:
+		problem = errInvalidRequest
+	case http.StatusUnauthorized, http.StatusForbidden:
+		problem = errForbidden
+	case http.StatusNotFound:
+		problem = errNotFound
+	case http.StatusInternalServerError:
+		return errInternal.wrap(httpErr)
+	default:
+		problem = &Error{
+			Status: httpErr.Code,
+			Type:   "http-" + fmt.Sprint(httpErr.Code),
+			Title:  http.StatusText(httpErr.Code),
+		}
+	}
+
+	problem = problem.wrap(httpErr)
+	if msg, ok := httpErr.Message.(string); ok && msg != http.StatusText(httpErr.Code) {
+		problem.Detail = msg
+	}
+	return problem
+}
+
+// get the problem title in the given language
+func (e *Error) localizedTitle(lang string) string {
+	key := "title." + e.Type
+	switch {
+	case catalog.Has(key):
+		return catalog.Message(lang, key, nil)
+	case e.Title != "":
+		return e.Title
+	default:
+		return http.StatusText(e.Status)
+	}
+}
+
+// write the problem details response in the given language
+func writeProblem(ctx echo.Context, problem *Error, lang string) error {
+	res := generated.ErrorResponse{
+		Type:   problemTypePrefix + problem.Type,
+		Title:  problem.localizedTitle(lang),
+		Status: problem.Status,
+	}
+	if problem.Detail != "" {
+		detail := catalog.Message(lang, problem.Detail, problem.DetailParams)
+		res.Detail = &detail
+	}
+	if instance := ctx.Request().URL.Path; instance != "" {
+		res.Instance = &instance
+	}
+	if id := requestID(ctx); id != "" {
+		res.RequestId = &id
+	}
+	if len(problem.Errors) > 0 {
+		errs := toValidationErrorsResponse(problem.Errors, lang)
+		res.Errors = &errs
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(problem.Status, MIMEApplicationProblemJSON, body)
+}
+
+// convert the field errors into the API response with the messages in the given language
+func toValidationErrorsResponse(errs ValidationErrors, lang string) []generated.ValidationError {
+	res := make([]generated.ValidationError, 0, len(errs))
+	for _, e := range errs {
+		fe := generated.ValidationError{
+			Field:   e.Field,
+			Rule:    e.Rule,
+			Message: e.localize(lang),
+		}
+		if len(e.Params) > 0 {
+			params := e.Params
+			fe.Params = &params
+		}
+		res = append(res, fe)
+	}
+	return res
+}
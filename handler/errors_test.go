@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	mockErr := errors.New("an error")
+
+	err := errValidation.withDetail("validation.required", map[string]interface{}{"field": "name"}).wrap(mockErr)
+	assert.Equal(t, "validation-failed: 'name' is required: an error", err.Error())
+	assert.True(t, errors.Is(err, errValidation))
+	assert.True(t, errors.Is(err, mockErr))
+	assert.False(t, errors.Is(err, errInternal))
+
+	// the shared error must not be modified
+	assert.Empty(t, errValidation.Detail)
+	assert.Nil(t, errValidation.DetailParams)
+	assert.Nil(t, errValidation.Unwrap())
+}
+
+func TestToProblem(t *testing.T) {
+	test := []struct {
+		name         string
+		err          error
+		expectStatus int
+		expectType   string
+		expectDetail string
+	}{
+		{
+			name:         "domain error",
+			err:          errPhoneConflict,
+			expectStatus: http.StatusConflict,
+			expectType:   errPhoneConflict.Type,
+		},
+		{
+			name:         "bad request http error",
+			err:          echo.NewHTTPError(http.StatusBadRequest, "Invalid format for parameter limit"),
+			expectStatus: http.StatusBadRequest,
+			expectType:   errInvalidRequest.Type,
+			expectDetail: "Invalid format for parameter limit",
+		},
+		{
+			name:         "forbidden http error",
+			err:          echo.ErrForbidden,
+			expectStatus: http.StatusForbidden,
+			expectType:   errForbidden.Type,
+		},
+		{
+			name:         "not found http error",
+			err:          echo.ErrNotFound,
+			expectStatus: http.StatusNotFound,
+			expectType:   errNotFound.Type,
+		},
+		{
+			name:         "internal http error",
+			err:          echo.ErrInternalServerError,
+			expectStatus: http.StatusInternalServerError,
+			expectType:   errInternal.Type,
+		},
+		{
+			name:         "other http error",
+			err:          echo.ErrMethodNotAllowed,
+			expectStatus: http.StatusMethodNotAllowed,
+			expectType:   "http-405",
+		},
+		{
+			name:         "unknown error is hidden",
+			err:          errors.New(`pq: duplicate key value violates unique constraint "profile_phone_key"`),
+			expectStatus: http.StatusInternalServerError,
+			expectType:   errInternal.Type,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toProblem(tt.err)
+			assert.Equal(t, tt.expectStatus, got.Status)
+			assert.Equal(t, tt.expectType, got.Type)
+			assert.Equal(t, tt.expectDetail, got.Detail)
+		})
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	e := echo.New()
+
+	test := []struct {
+		name             string
+		method           string
+		acceptLanguage   string
+		err              error
+		committed        bool
+		expectStatus     int
+		expectLang       string
+		expectBody       string
+		expectRetryAfter string
+	}{
+		{
+			name:         "problem details",
+			method:       http.MethodGet,
+			err:          errNotFound.withDetail("detail.profile-not-found", nil),
+			expectStatus: http.StatusNotFound,
+			expectLang:   "en",
+			expectBody:   `{"detail":"The profile no longer exists","instance":"/profile","status":404,"title":"The resource could not be found","type":"/problems/not-found"}`,
+		},
+		{
+			name:           "localized problem details",
+			method:         http.MethodGet,
+			acceptLanguage: "id-ID,id;q=0.9,en;q=0.8",
+			err:            errNotFound.withDetail("detail.profile-not-found", nil),
+			expectStatus:   http.StatusNotFound,
+			expectLang:     "id",
+			expectBody:     `{"detail":"Profil sudah tidak ada","instance":"/profile","status":404,"title":"Sumber daya tidak ditemukan","type":"/problems/not-found"}`,
+		},
+		{
+			name:           "unsupported language uses the default language",
+			method:         http.MethodGet,
+			acceptLanguage: "ja",
+			err:            echo.ErrMethodNotAllowed,
+			expectStatus:   http.StatusMethodNotAllowed,
+			expectLang:     "en",
+			expectBody:     `{"instance":"/profile","status":405,"title":"Method Not Allowed","type":"/problems/http-405"}`,
+		},
+		{
+			name:         "validation errors",
+			method:       http.MethodPost,
+			err:          validationError(ValidationErrors{{Field: "name", Rule: "min", Message: "'name' should be minimum 3", Params: map[string]interface{}{"min": "3"}}}),
+			expectStatus: http.StatusUnprocessableEntity,
+			expectBody:   `{"errors":[{"field":"name","message":"'name' should be at least 3 characters","params":{"min":"3"},"rule":"min"}],"instance":"/profile","status":422,"title":"The request contains invalid values","type":"/problems/validation-failed"}`,
+		},
+		{
+			name:           "localized validation errors",
+			method:         http.MethodPost,
+			acceptLanguage: "id",
+			err:            validationError(ValidationErrors{{Field: "name", Rule: "min", Message: "'name' should be minimum 3", Params: map[string]interface{}{"min": "3"}}}),
+			expectStatus:   http.StatusUnprocessableEntity,
+			expectLang:     "id",
+			expectBody:     `{"errors":[{"field":"name","message":"'name' minimal 3 karakter","params":{"min":"3"},"rule":"min"}],"instance":"/profile","status":422,"title":"Permintaan berisi nilai yang tidak valid","type":"/problems/validation-failed"}`,
+		},
+		{
+			name:         "non validation error passed as validation error",
+			method:       http.MethodPost,
+			err:          validationError(errors.New("an error")),
+			expectStatus: http.StatusInternalServerError,
+			expectBody:   `{"instance":"/profile","status":500,"title":"Something went wrong, please try again later","type":"/problems/internal-error"}`,
+		},
+		{
+			name:         "internal error does not leak the cause",
+			method:       http.MethodGet,
+			err:          errors.New("pq: connection refused"),
+			expectStatus: http.StatusInternalServerError,
+			expectBody:   `{"instance":"/profile","status":500,"title":"Something went wrong, please try again later","type":"/problems/internal-error"}`,
+		},
+		{
+			name:             "retry after",
+			method:           http.MethodPost,
+			err:              errTooManyRequests.withDetail("detail.otp-cooldown", map[string]interface{}{"seconds": 30}).retryAfter(29*time.Second + time.Millisecond),
+			expectStatus:     http.StatusTooManyRequests,
+			expectRetryAfter: "30",
+			expectBody:       `{"detail":"Please wait 30 seconds before requesting a new OTP","instance":"/profile","status":429,"title":"Too many requests, please try again later","type":"/problems/too-many-requests"}`,
+		},
+		{
+			name:         "head request has no body",
+			method:       http.MethodHead,
+			err:          errForbidden,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "committed response",
+			method:       http.MethodGet,
+			err:          errForbidden,
+			committed:    true,
+			expectStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/profile", nil)
+			req.Header.Set(HeaderAcceptLanguage, tt.acceptLanguage)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if tt.committed {
+				c.NoContent(http.StatusOK)
+			}
+
+			ErrorHandler(tt.err, c)
+
+			assert.Equal(t, tt.expectStatus, rec.Code)
+			assert.Equal(t, tt.expectRetryAfter, rec.Header().Get(HeaderRetryAfter))
+			if tt.expectLang != "" {
+				assert.Equal(t, tt.expectLang, rec.Header().Get(HeaderContentLanguage))
+			}
+			if tt.expectBody != "" {
+				assert.Equal(t, MIMEApplicationProblemJSON, rec.Header().Get(echo.HeaderContentType))
+				assert.JSONEq(t, tt.expectBody, rec.Body.String())
+			} else {
+				assert.Empty(t, rec.Body.String())
+			}
+		})
+	}
+}
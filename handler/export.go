@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// DefaultExportDir is the directory of the default export store, it is not served by the HTTP server
+	// as the archives are only downloaded through the signed links
+	DefaultExportDir = "exports"
+
+	// DefaultExportInterval is how often the export job looks for the pending exports,
+	// the job is woken up right away when a new export is requested on the same instance
+	DefaultExportInterval = time.Minute
+
+	// the archive is kept for a week while its download link is only valid for an hour
+	exportTTL             = 7 * 24 * time.Hour
+	exportDownloadTTL     = time.Hour
+	exportDownloadPurpose = "data-export-download"
+	exportContentType     = "application/zip"
+
+	// the export in progress for longer than this is claimed again, e.g. when its worker has been stopped
+	exportStaleAfter = 30 * time.Minute
+
+	// the size of the pages read while assembling the archive and of the expired exports removed at once
+	exportPageSize = 100
+)
+
+// the files of the data export archive, every file is a JSON document
+const (
+	exportFileProfile        = "profile.json"
+	exportFileDevices        = "devices.json"
+	exportFileLoginHistory   = "login_history.json"
+	exportFilePreferences    = "preferences.json"
+	exportFileConsents       = "consents.json"
+	exportFileProfileHistory = "profile_history.json"
+	exportFileAuditEvents    = "audit_events.json"
+)
+
+// the path of the export status and the download link
+func dataExportPath(id string) string {
+	return "/profile/export/" + url.PathEscape(id)
+}
+
+// sign the token of the download link, the id is the data export and the subject is the profile id
+func generateDataExportToken(key *rsa.PrivateKey, export repository.DataExport, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Id:        export.ID,
+		Subject:   strconv.FormatInt(export.ProfileID, 10),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	return token.SignedString(purposeKey(key, exportDownloadPurpose))
+}
+
+// verify the signature and the expiry of the download link token and return the profile id of the data export,
+// the token is only valid for the data export it has been signed for
+func parseDataExportToken(key *rsa.PrivateKey, token, exportID string) (profileID int64, err error) {
+	var claim jwt.StandardClaims
+	_, err = jwt.ParseWithClaims(token, &claim, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return purposeKey(key, exportDownloadPurpose), nil
+	})
+	if err != nil {
+		return
+	}
+	if claim.Id == "" || claim.Id != exportID {
+		err = errors.New("the token is signed for another data export")
+		return
+	}
+	return strconv.ParseInt(claim.Subject, 10, 64)
+}
+
+// convert the data export into the API response, the completed export which has not expired gets a new download link
+// of the tenant
+func (s Server) toDataExportResponse(tenant repository.Tenant, export repository.DataExport) (res generated.DataExport, err error) {
+	res = generated.DataExport{
+		Id:        export.ID,
+		Status:    generated.DataExportStatus(export.Status),
+		CreatedAt: export.CreatedAt,
+	}
+	if export.FinishedAt.Valid {
+		res.FinishedAt = &export.FinishedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		res.ExpiresAt = &export.ExpiresAt.Time
+	}
+
+	now := time.Now()
+	if export.Status != repository.DataExportCompleted || !export.ExpiresAt.Valid || !now.Before(export.ExpiresAt.Time) {
+		return
+	}
+
+	// the link never outlives the archive
+	linkExpiresAt := now.Add(exportDownloadTTL).Truncate(time.Second)
+	if linkExpiresAt.After(export.ExpiresAt.Time) {
+		linkExpiresAt = export.ExpiresAt.Time
+	}
+	token, err := generateDataExportToken(s.rsaPrivateKey, export, linkExpiresAt)
+	if err != nil {
+		return
+	}
+	link := s.tenantLink(tenant, dataExportPath(export.ID)+"/download", url.Values{"token": {token}})
+	res.DownloadUrl = &link
+	res.DownloadUrlExpiresAt = &linkExpiresAt
+	return
+}
+
+// wake up the export job of this instance without waiting for its next interval
+func (s Server) notifyExportJob() {
+	select {
+	case s.exportQueue <- struct{}{}:
+	default:
+	}
+}
+
+// ProcessDataExports removes the expired data exports and assembles the archives of the pending ones of every tenant,
+// it returns the number of processed exports. The export which fails to be assembled is marked as failed
+// so the user can request a new one.
+func (s Server) ProcessDataExports(ctx context.Context) (processed int, err error) {
+	tenants, err := s.Repository.GetTenants(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, tenant := range tenants {
+		var n int
+		n, err = s.processTenantDataExports(ctx, tenant.ID)
+		processed += n
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// remove the expired data exports and assemble the archives of the pending ones of the tenant
+func (s Server) processTenantDataExports(ctx context.Context, tenantID int64) (processed int, err error) {
+	err = s.deleteExpiredDataExports(ctx, tenantID)
+	if err != nil {
+		return
+	}
+
+	for {
+		var export repository.DataExport
+		export, err = s.Repository.ClaimDataExport(ctx, tenantID, time.Now().UTC().Add(-exportStaleAfter))
+		if err == sql.ErrNoRows {
+			return processed, nil
+		}
+		if err != nil {
+			return
+		}
+
+		err = s.processDataExport(ctx, tenantID, export)
+		if err != nil {
+			return
+		}
+		processed++
+	}
+}
+
+// RunExportJob processes the data exports every interval and whenever a new export is requested
+// until the context is done, the failures are written into the application log and retried on the next run
+func (s Server) RunExportJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := s.ProcessDataExports(ctx)
+		if err != nil {
+			log.Printf("export: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.exportQueue:
+		}
+	}
+}
+
+// assemble and save the archive of the claimed data export and record its final status
+func (s Server) processDataExport(ctx context.Context, tenantID int64, export repository.DataExport) error {
+	export.Status = repository.DataExportCompleted
+	export.ArchiveKey = fmt.Sprintf("exports/%d/%s.zip", export.ProfileID, export.ID)
+	export.ExpiresAt = sql.NullTime{Time: time.Now().UTC().Add(exportTTL).Truncate(time.Second), Valid: true}
+
+	archive, err := s.buildDataExport(ctx, tenantID, export.ProfileID)
+	if err == nil {
+		err = s.exports.Put(ctx, export.ArchiveKey, exportContentType, archive)
+	}
+	if err != nil {
+		log.Printf("export: id=%s profile=%d failed: %v", export.ID, export.ProfileID, err)
+		export.Status = repository.DataExportFailed
+		export.ArchiveKey = ""
+	}
+
+	return s.Repository.FinishDataExport(ctx, tenantID, export)
+}
+
+// remove the archives and the rows of the expired data exports
+func (s Server) deleteExpiredDataExports(ctx context.Context, tenantID int64) error {
+	for {
+		exports, err := s.Repository.GetExpiredDataExports(ctx, tenantID, time.Now().UTC(), exportPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, export := range exports {
+			if export.ArchiveKey != "" {
+				err = s.exports.Delete(ctx, export.ArchiveKey)
+				if err != nil {
+					return err
+				}
+			}
+			err = s.Repository.DeleteDataExport(ctx, tenantID, export.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(exports) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// assemble the ZIP archive of all personal data of the profile
+func (s Server) buildDataExport(ctx context.Context, tenantID, profileID int64) ([]byte, error) {
+	user, err := s.Repository.GetProfileByID(ctx, tenantID, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.Repository.GetDevices(ctx, tenantID, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences, err := s.Repository.GetPreferences(ctx, tenantID, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	consents, err := s.Repository.GetConsents(ctx, tenantID, profileID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []generated.ProfileHistoryEntry{}
+	for beforeID := int64(0); ; {
+		page, err := s.Repository.GetProfileHistory(ctx, tenantID, profileID, beforeID, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range page {
+			history = append(history, toProfileHistoryResponse(h))
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+		beforeID = page[len(page)-1].ID
+	}
+
+	// the sign in attempts are the authentication events of the audit trail
+	events, logins := []generated.AuditEvent{}, []generated.AuditEvent{}
+	filter := repository.AuditEventFilter{TargetID: profileID, Limit: exportPageSize}
+	for {
+		page, err := s.Repository.GetAuditEvents(ctx, tenantID, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range page {
+			res := toAuditEventResponse(event)
+			events = append(events, res)
+			if strings.HasPrefix(event.Action, "auth.") {
+				logins = append(logins, res)
+			}
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+		filter.BeforeID = page[len(page)-1].ID
+	}
+
+	if devices == nil {
+		devices = []repository.Device{}
+	}
+	if consents == nil {
+		consents = []repository.Consent{}
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name  string
+		value interface{}
+	}{
+		{exportFileProfile, s.toProfileResponse(user)},
+		{exportFileDevices, devices},
+		{exportFileLoginHistory, logins},
+		{exportFilePreferences, s.withDefaultPreferences(preferences)},
+		{exportFileConsents, consents},
+		{exportFileProfileHistory, history},
+		{exportFileAuditEvents, events},
+	}
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(file.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,478 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataExportToken(t *testing.T) {
+	var (
+		key    = getDummyRSAKey()
+		export = repository.DataExport{ID: "abc", ProfileID: 1}
+	)
+
+	valid, err := generateDataExportToken(key, export, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	expired, err := generateDataExportToken(key, export, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+
+	// the bearer token is signed by another key so it can not be used to download the archive
+	bearer, err := generateToken(key, 0, repository.User{ID: 1}, nil, nil, nil)
+	assert.NoError(t, err)
+
+	test := []struct {
+		name      string
+		token     string
+		exportID  string
+		expectErr bool
+	}{
+		{name: "err malformed", token: "asd", exportID: "abc", expectErr: true},
+		{name: "err bearer token", token: bearer, exportID: "abc", expectErr: true},
+		{name: "err expired", token: expired, exportID: "abc", expectErr: true},
+		{name: "err another export", token: valid, exportID: "def", expectErr: true},
+		{name: "success", token: valid, exportID: "abc"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			profileID, err := parseDataExportToken(key, tt.token, tt.exportID)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, export.ProfileID, profileID)
+		})
+	}
+}
+
+func TestToDataExportResponse(t *testing.T) {
+	var (
+		server = NewServer(NewServerOptions{RSAPrivateKey: getDummyRSAKey(), PublicURL: "https://example.com"})
+		now    = time.Now()
+	)
+
+	test := []struct {
+		name         string
+		export       repository.DataExport
+		expectLink   bool
+		expectExpiry time.Time
+	}{
+		{
+			name:   "pending",
+			export: repository.DataExport{ID: "abc", ProfileID: 1, Status: repository.DataExportPending, CreatedAt: now},
+		},
+		{
+			name: "expired",
+			export: repository.DataExport{
+				ID:         "abc",
+				ProfileID:  1,
+				Status:     repository.DataExportCompleted,
+				CreatedAt:  now,
+				FinishedAt: sql.NullTime{Time: now, Valid: true},
+				ExpiresAt:  sql.NullTime{Time: now.Add(-time.Minute), Valid: true},
+			},
+		},
+		{
+			name: "link expires with the archive",
+			export: repository.DataExport{
+				ID:         "abc",
+				ProfileID:  1,
+				Status:     repository.DataExportCompleted,
+				CreatedAt:  now,
+				FinishedAt: sql.NullTime{Time: now, Valid: true},
+				ExpiresAt:  sql.NullTime{Time: now.Add(time.Minute), Valid: true},
+			},
+			expectLink:   true,
+			expectExpiry: now.Add(time.Minute),
+		},
+		{
+			name: "completed",
+			export: repository.DataExport{
+				ID:         "abc",
+				ProfileID:  1,
+				Status:     repository.DataExportCompleted,
+				CreatedAt:  now,
+				FinishedAt: sql.NullTime{Time: now, Valid: true},
+				ExpiresAt:  sql.NullTime{Time: now.Add(exportTTL), Valid: true},
+			},
+			expectLink:   true,
+			expectExpiry: now.Add(exportDownloadTTL),
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := server.toDataExportResponse(repository.Tenant{}, tt.export)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.export.ID, res.Id)
+			assert.Equal(t, tt.export.Status, string(res.Status))
+
+			if !tt.expectLink {
+				assert.Nil(t, res.DownloadUrl)
+				return
+			}
+			if assert.NotNil(t, res.DownloadUrl) && assert.NotNil(t, res.DownloadUrlExpiresAt) {
+				assert.True(t, strings.HasPrefix(*res.DownloadUrl, "https://example.com/profile/export/abc/download?token="))
+				assert.WithinDuration(t, tt.expectExpiry, *res.DownloadUrlExpiresAt, time.Second)
+			}
+		})
+	}
+}
+
+func TestProcessDataExports(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+		exports  = &stubBlobStore{}
+
+		// request and response mock
+		any        = gomock.Any()
+		mockErr    = errors.New("an error")
+		mockExport = repository.DataExport{ID: "abc", ProfileID: 1, Status: repository.DataExportProcessing}
+		expired    = repository.DataExport{ID: "old", ProfileID: 1, ArchiveKey: "exports/1/old.zip"}
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), ExportStore: exports})
+	)
+
+	// mock the data of the archive
+	mockArchiveData := func() {
+		mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{ID: 1, Name: "narto"}, nil)
+		mockRepo.EXPECT().GetDevices(any, any, int64(1)).Return(nil, nil)
+		mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(repository.Preferences{}, nil)
+		mockRepo.EXPECT().GetConsents(any, any, int64(1)).Return(nil, nil)
+		mockRepo.EXPECT().GetProfileHistory(any, any, int64(1), int64(0), exportPageSize).Return(nil, nil)
+		mockRepo.EXPECT().GetAuditEvents(any, any, any).Return(nil, nil)
+	}
+
+	test := []struct {
+		name            string
+		expectErr       error
+		expectProcessed int
+		expectStatus    string
+		mock            func()
+	}{
+		{
+			name:      "err get tenants",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get expired exports",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil)
+				mockRepo.EXPECT().GetExpiredDataExports(any, any, any, exportPageSize).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err delete expired export",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil)
+				mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).Return([]repository.DataExport{expired}, nil)
+				mockRepo.EXPECT().DeleteDataExport(any, any, "old").Return(mockErr)
+			},
+		},
+		{
+			name:      "err claim export",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil)
+				mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(repository.DataExport{}, mockErr)
+			},
+		},
+		{
+			name:      "err finish export",
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil)
+				mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(mockExport, nil)
+				mockArchiveData()
+				mockRepo.EXPECT().FinishDataExport(any, any, any).Return(mockErr)
+			},
+		},
+		{
+			name:            "success failed export",
+			expectProcessed: 1,
+			expectStatus:    repository.DataExportFailed,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil)
+				mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(mockExport, nil)
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(repository.User{}, sql.ErrNoRows)
+				mockRepo.EXPECT().FinishDataExport(any, any, gomock.AssignableToTypeOf(repository.DataExport{})).
+					DoAndReturn(func(_ interface{}, _ int64, export repository.DataExport) error {
+						assert.Equal(t, repository.DataExportFailed, export.Status)
+						assert.Empty(t, export.ArchiveKey)
+						assert.True(t, export.ExpiresAt.Valid)
+						return nil
+					})
+				mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(repository.DataExport{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:            "success",
+			expectProcessed: 1,
+			expectStatus:    repository.DataExportCompleted,
+			mock: func() {
+				mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil)
+				mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).Return([]repository.DataExport{expired}, nil)
+				mockRepo.EXPECT().DeleteDataExport(any, any, "old").Return(nil)
+				mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(mockExport, nil)
+				mockArchiveData()
+				mockRepo.EXPECT().FinishDataExport(any, any, gomock.AssignableToTypeOf(repository.DataExport{})).
+					DoAndReturn(func(_ interface{}, _ int64, export repository.DataExport) error {
+						assert.Equal(t, repository.DataExportCompleted, export.Status)
+						assert.Equal(t, "exports/1/abc.zip", export.ArchiveKey)
+						assert.Contains(t, exports.blobs, export.ArchiveKey)
+						return nil
+					})
+				mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(repository.DataExport{}, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			exports.blobs = map[string][]byte{expired.ArchiveKey: []byte("archive")}
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			processed, err := server.ProcessDataExports(context.Background())
+			assert.Equal(t, tt.expectProcessed, processed)
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestBuildDataExport(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		user    = repository.User{ID: 1, Name: "narto", Phone: "+6281122334455", Password: "hash"}
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	// a full page of history and audit events is followed by another page
+	historyPage := make([]repository.ProfileHistory, exportPageSize)
+	for i := range historyPage {
+		historyPage[i] = repository.ProfileHistory{ID: int64(exportPageSize + 1 - i), ProfileID: 1}
+	}
+	eventPage := make([]repository.AuditEvent, exportPageSize)
+	for i := range eventPage {
+		eventPage[i] = repository.AuditEvent{ID: int64(exportPageSize + 2 - i), Action: auditActionProfileUpdate}
+	}
+	eventPage[0].Action = auditActionLogin
+
+	test := []struct {
+		name      string
+		expectErr bool
+		mock      func()
+	}{
+		{
+			name:      "err get profile",
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(repository.User{}, mockErr)
+			},
+		},
+		{
+			name:      "err get devices",
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(user, nil)
+				mockRepo.EXPECT().GetDevices(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get preferences",
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(user, nil)
+				mockRepo.EXPECT().GetDevices(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetPreferences(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get consents",
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(user, nil)
+				mockRepo.EXPECT().GetDevices(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetPreferences(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetConsents(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get profile history",
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(user, nil)
+				mockRepo.EXPECT().GetDevices(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetPreferences(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetConsents(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileHistory(any, any, any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err get audit events",
+			expectErr: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, any).Return(user, nil)
+				mockRepo.EXPECT().GetDevices(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetPreferences(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetConsents(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetProfileHistory(any, any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().GetAuditEvents(any, any, any).Return(nil, mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mockRepo.EXPECT().GetProfileByID(any, any, int64(1)).Return(user, nil)
+				mockRepo.EXPECT().GetDevices(any, any, int64(1)).Return([]repository.Device{{ID: 1, ProfileID: 1}}, nil)
+				mockRepo.EXPECT().GetPreferences(any, any, int64(1)).Return(repository.Preferences{}, nil)
+				mockRepo.EXPECT().GetConsents(any, any, int64(1)).Return([]repository.Consent{{ID: 1, ProfileID: 1, TermsVersion: "2024-01"}}, nil)
+				mockRepo.EXPECT().GetProfileHistory(any, any, int64(1), int64(0), exportPageSize).Return(historyPage, nil)
+				mockRepo.EXPECT().GetProfileHistory(any, any, int64(1), int64(2), exportPageSize).Return(nil, nil)
+				mockRepo.EXPECT().GetAuditEvents(any, any, repository.AuditEventFilter{TargetID: 1, Limit: exportPageSize}).Return(eventPage, nil)
+				mockRepo.EXPECT().GetAuditEvents(any, any, repository.AuditEventFilter{TargetID: 1, Limit: exportPageSize, BeforeID: 3}).
+					Return([]repository.AuditEvent{{ID: 1, Action: auditActionLoginFailed}}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			archive, err := server.buildDataExport(context.Background(), 1, 1)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			files := readTestArchive(t, archive)
+			assert.ElementsMatch(t, []string{
+				exportFileProfile,
+				exportFileDevices,
+				exportFileLoginHistory,
+				exportFilePreferences,
+				exportFileConsents,
+				exportFileProfileHistory,
+				exportFileAuditEvents,
+			}, keysOf(files))
+
+			// the password hash is never exported
+			assert.NotContains(t, string(files[exportFileProfile]), "hash")
+
+			var history, events, logins []interface{}
+			assert.NoError(t, json.Unmarshal(files[exportFileProfileHistory], &history))
+			assert.NoError(t, json.Unmarshal(files[exportFileAuditEvents], &events))
+			assert.NoError(t, json.Unmarshal(files[exportFileLoginHistory], &logins))
+			assert.Len(t, history, exportPageSize)
+			assert.Len(t, events, exportPageSize+1)
+			assert.Len(t, logins, 2)
+		})
+	}
+}
+
+func TestRunExportJob(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		any = gomock.Any()
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockRepo.EXPECT().GetTenants(any).Return([]repository.Tenant{{ID: 1}}, nil).Times(2)
+	mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).Return(nil, errors.New("an error"))
+	mockRepo.EXPECT().GetExpiredDataExports(any, any, any, any).DoAndReturn(func(_, _, _, _ interface{}) ([]repository.DataExport, error) {
+		// stop the job once it has been woken up by the new export
+		cancel()
+		return nil, nil
+	})
+	mockRepo.EXPECT().ClaimDataExport(any, any, any).Return(repository.DataExport{}, sql.ErrNoRows).AnyTimes()
+
+	// the interval is long enough that only the notification wakes the job up
+	server.notifyExportJob()
+	server.notifyExportJob()
+
+	done := make(chan struct{})
+	go func() {
+		server.RunExportJob(ctx, time.Hour)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the export job has not stopped")
+	}
+}
+
+// read the files of the ZIP archive by their name
+func readTestArchive(t *testing.T, archive []byte) map[string][]byte {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	files := map[string][]byte{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		assert.NoError(t, err)
+		files[f.Name] = data
+	}
+	return files
+}
+
+func keysOf(files map[string][]byte) []string {
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/permission"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultImpersonationTTL is how long the impersonation token can be used
+	DefaultImpersonationTTL = 15 * time.Minute
+
+	// the permission required to impersonate the users, it is checked again on every request made with the impersonation token
+	permissionImpersonate = "users:impersonate"
+
+	// the echo context key of the impersonation of the request made with the impersonation token
+	contextKeyImpersonation = "impersonation"
+
+	// the maximum length of the reason of the impersonation
+	impersonationReasonMaxLength = 256
+)
+
+// impersonation is the admin acting as the user of the request and the session of the impersonation token
+type impersonation struct {
+	ActorID   int64
+	SessionID string
+}
+
+// verify the actor of the impersonation token, the token can only be used for the operations allowing the impersonation
+// and while the impersonator is still active and granted the users:impersonate permission
+func (s Server) verifyImpersonation(ctx echo.Context, claim jwtClaim) (imp impersonation, err error) {
+	actorID, err := strconv.ParseInt(claim.Act.Subject, 10, 64)
+	if err != nil || actorID == 0 || claim.SessionID == "" {
+		return imp, errForbidden.wrap(fmt.Errorf("invalid impersonation claim, act %q jti %q", claim.Act.Subject, claim.SessionID))
+	}
+
+	if !s.permissions.AllowsImpersonation(ctx.Request().Method, ctx.Path()) {
+		return imp, errForbidden.withDetail("detail.impersonation-restricted", nil)
+	}
+
+	status, deletionScheduledAt, err := s.Repository.GetProfileStatus(ctx.Request().Context(), tenantID(ctx), actorID)
+	if err == sql.ErrNoRows {
+		return imp, errForbidden.wrap(err)
+	}
+	if err != nil {
+		return imp, errInternal.wrap(err)
+	}
+	if statusErr := accountStatusError(status); statusErr != nil {
+		return imp, errForbidden.wrap(statusErr)
+	}
+	if deletionScheduledAt.Valid {
+		return imp, errForbidden.wrap(pendingDeletionError(deletionScheduledAt.Time))
+	}
+
+	granted, err := s.grantedPermissions(ctx, actorID)
+	if err != nil {
+		return imp, errInternal.wrap(err)
+	}
+	if missing := permission.Missing(granted, []string{permissionImpersonate}); missing != "" {
+		return imp, errForbidden.withDetail("detail.permission-required", map[string]interface{}{"permission": missing})
+	}
+
+	return impersonation{ActorID: actorID, SessionID: claim.SessionID}, nil
+}
+
+// the profile acting on the request, which is the impersonator for the request made with the impersonation token
+// and the user itself otherwise
+func actorID(ctx echo.Context, userID int64) int64 {
+	if imp, ok := ctx.Get(contextKeyImpersonation).(impersonation); ok {
+		return imp.ActorID
+	}
+	return userID
+}
+
+// validate the reason of the impersonation requested by the admin
+func validateImpersonation(req generated.ImpersonationRequest) error {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return validationError(ValidationErrors{*newFieldError("reason", "required", nil)})
+	}
+	if len(reason) > impersonationReasonMaxLength {
+		return validationError(ValidationErrors{*newFieldError("reason", "max", map[string]interface{}{"max": impersonationReasonMaxLength})})
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyImpersonation(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any      = gomock.Any()
+		mockErr  = errors.New("an error")
+		key      = getDummyRSAKey()
+		user     = repository.User{ID: 2, Name: "narto"}
+		token, _ = generateImpersonationToken(key, 0, user, nil, nil, nil, 1, "abc", time.Now().Add(time.Minute))
+
+		// echo server mock
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key})
+	)
+
+	invalidActor, _ := signToken(key, jwtClaim{ID: user.ID, Name: user.Name, Act: &tokenActor{Subject: "admin"}, SessionID: "abc", Exp: time.Now().Add(time.Minute).Unix()})
+	expired, _ := generateImpersonationToken(key, 0, user, nil, nil, nil, 1, "abc", time.Now().Add(-time.Minute))
+
+	test := []struct {
+		name      string
+		token     string
+		method    string
+		path      string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err expired token",
+			token:     expired,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err invalid actor",
+			token:     invalidActor,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err restricted operation",
+			token:     token,
+			method:    http.MethodPut,
+			path:      "/profile",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err admin operation",
+			token:     token,
+			method:    http.MethodGet,
+			path:      "/admin/users",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err impersonator purged",
+			token:     token,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return("", sql.NullTime{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get impersonator status",
+			token:     token,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return("", sql.NullTime{}, mockErr)
+			},
+		},
+		{
+			name:      "err impersonator suspended",
+			token:     token,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusSuspended, sql.NullTime{}, nil)
+			},
+		},
+		{
+			name:      "err impersonator pending deletion",
+			token:     token,
+			expectErr: errPendingDeletion,
+			mock: func() {
+				scheduled := sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, scheduled, nil)
+			},
+		},
+		{
+			name:      "err get impersonator permissions",
+			token:     token,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, sql.NullTime{}, nil)
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err impersonate permission revoked",
+			token:     token,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, sql.NullTime{}, nil)
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return([]string{"users:read"}, nil)
+			},
+		},
+		{
+			name:      "err impersonated user suspended",
+			token:     token,
+			expectErr: errAccountSuspended,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, sql.NullTime{}, nil)
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return([]string{permissionImpersonate}, nil)
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(2)).Return(repository.ProfileStatusSuspended, sql.NullTime{}, nil)
+			},
+		},
+		{
+			name:   "success",
+			token:  token,
+			method: http.MethodGet,
+			path:   "/profile",
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, sql.NullTime{}, nil)
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return([]string{permissionImpersonate}, nil)
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(2)).Return(repository.ProfileStatusActive, sql.NullTime{}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetPath(tt.path)
+			got, err := server.verifyAccount(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				assert.Nil(t, c.Get(contextKeyImpersonation))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), got.ID)
+			assert.Equal(t, impersonation{ActorID: 1, SessionID: "abc"}, c.Get(contextKeyImpersonation))
+		})
+	}
+}
+
+func TestValidateImpersonation(t *testing.T) {
+	assert.ErrorIs(t, validateImpersonation(generated.ImpersonationRequest{}), errValidation)
+	assert.ErrorIs(t, validateImpersonation(generated.ImpersonationRequest{Reason: "  "}), errValidation)
+	assert.ErrorIs(t, validateImpersonation(generated.ImpersonationRequest{Reason: strings.Repeat("a", impersonationReasonMaxLength+1)}), errValidation)
+	assert.NoError(t, validateImpersonation(generated.ImpersonationRequest{Reason: "ticket #42"}))
+}
+
+func TestAuditImpersonation(t *testing.T) {
+	var (
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+		e        = echo.New()
+		server   = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+		after    = map[string]interface{}{"name": "sasuke"}
+	)
+
+	mockRepo.EXPECT().SaveAuditEvent(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+		assert.Equal(t, sql.NullInt64{Int64: 1, Valid: true}, event.ActorID)
+		assert.Equal(t, sql.NullInt64{Int64: 2, Valid: true}, event.TargetID)
+		assert.JSONEq(t, `{"name":"sasuke","impersonation_session":"abc"}`, string(event.After))
+		return 1, nil
+	})
+
+	c := e.NewContext(httptest.NewRequest(http.MethodPut, "/profile/preferences", nil), httptest.NewRecorder())
+	c.Set(contextKeyImpersonation, impersonation{ActorID: 1, SessionID: "abc"})
+	err := server.audit(c, auditRecord{ActorID: 2, TargetID: 2, Action: auditActionPreferences, After: after})
+	assert.NoError(t, err)
+
+	// the record of the handler is left untouched
+	assert.Equal(t, map[string]interface{}{"name": "sasuke"}, after)
+}
+
+func TestActorID(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Equal(t, int64(1), actorID(c, 1))
+
+	c.Set(contextKeyImpersonation, impersonation{ActorID: 9, SessionID: "abc"})
+	assert.Equal(t, int64(9), actorID(c, 1))
+}
@@ -0,0 +1,525 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// the file formats of the bulk import and export
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	MIMETextCSV           = "text/csv"
+	MIMEApplicationNDJSON = "application/x-ndjson"
+
+	// the status of the imported row, the valid row is only reported by the dry run as it is not imported
+	ImportStatusImported  = "imported"
+	ImportStatusValid     = "valid"
+	ImportStatusInvalid   = "invalid"
+	ImportStatusDuplicate = "duplicate"
+
+	// the number of the rows checked and inserted at once
+	importBatchSize = 500
+
+	// the maximum length of the NDJSON line
+	importMaxLineSize = 1 << 20
+)
+
+var (
+	// the columns of the CSV header and the members of the NDJSON object, the other columns are rejected
+	importColumns = []string{"name", "phone", "email", "email_verified_at", "password", "password_hash"}
+
+	// the format of the request content type
+	importMediaTypes = map[string]string{
+		MIMETextCSV:           FormatCSV,
+		MIMEApplicationNDJSON: FormatNDJSON,
+	}
+)
+
+type (
+	// ImportReport is the result of every imported row in the order of the file
+	ImportReport struct {
+		DryRun    bool              `json:"dry_run"`
+		Total     int               `json:"total"`
+		Imported  int               `json:"imported"`
+		Valid     int               `json:"valid"`
+		Invalid   int               `json:"invalid"`
+		Duplicate int               `json:"duplicate"`
+		Rows      []ImportRowResult `json:"rows"`
+	}
+
+	// ImportRowResult is the result of a single row, the line is the line number in the file where the row starts
+	// and the id is only set once the row has been imported
+	ImportRowResult struct {
+		Line   int              `json:"line"`
+		Phone  string           `json:"phone,omitempty"`
+		Status string           `json:"status"`
+		ID     int64            `json:"id,omitempty"`
+		Errors ValidationErrors `json:"errors,omitempty"`
+	}
+
+	// the columns of the imported row, the password is hashed before it is saved
+	// while the password hash is saved as is
+	importRow struct {
+		Name            string
+		Phone           string
+		Email           string
+		EmailVerifiedAt string
+		Password        string
+		PasswordHash    string
+	}
+
+	// the valid row waiting for its batch to be checked and inserted, index is the position of its result in the report
+	importCandidate struct {
+		index     int
+		user      repository.User
+		plaintext bool
+	}
+
+	// importReader reads the rows of the file one by one. The row which can not be read is returned along with its
+	// field errors, while the error is only returned when the rest of the file can not be read, io.EOF at the end of the file
+	importReader interface {
+		next() (row importRow, line int, invalid ValidationErrors, err error)
+	}
+
+	csvImportReader struct {
+		reader  *csv.Reader
+		columns []string
+	}
+
+	ndjsonImportReader struct {
+		scanner *bufio.Scanner
+		line    int
+	}
+)
+
+// BulkImport validates the users of the CSV or NDJSON file and inserts the valid ones into the tenant in batches, the rows
+// whose phone or email has been registered in the tenant are reported as duplicate so the same file can be imported again. The dry run only
+// validates the rows and checks the duplicates without saving anything. Unlike the admin endpoint, the import is
+// recorded in the audit trail without an actor.
+func (s Server) BulkImport(ctx context.Context, tenantID int64, r io.Reader, format string, dryRun bool) (report ImportReport, err error) {
+	report, err = s.importUsers(ctx, tenantID, r, format, dryRun)
+	if err != nil || dryRun {
+		return
+	}
+
+	after, _ := json.Marshal(importSummary(report))
+	_, err = s.Repository.SaveAuditEvent(ctx, tenantID, repository.AuditEvent{
+		Action: auditActionUserImport,
+		After:  after,
+	})
+	return
+}
+
+// validate and insert the users read from the file into the tenant, the input errors are returned as the invalid request error
+// and the rows imported before the error are kept
+func (s Server) importUsers(ctx context.Context, tenantID int64, r io.Reader, format string, dryRun bool) (report ImportReport, err error) {
+	rows, err := newImportReader(r, format)
+	if err != nil {
+		return report, errInvalidRequest.withDetail("detail.invalid-import", map[string]interface{}{"reason": err.Error()})
+	}
+
+	report = ImportReport{DryRun: dryRun, Rows: []ImportRowResult{}}
+	seen := make(map[string]bool)
+	batch := make([]importCandidate, 0, importBatchSize)
+	for {
+		row, line, invalid, readErr := rows.next()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return report, errInvalidRequest.withDetail("detail.invalid-import", map[string]interface{}{"reason": readErr.Error()})
+		}
+
+		result := ImportRowResult{Line: line, Phone: row.Phone}
+		var (
+			user      repository.User
+			plaintext bool
+		)
+		if len(invalid) == 0 {
+			user, plaintext, invalid = s.toImportUser(row)
+			result.Phone = user.Phone
+		}
+
+		switch {
+		case len(invalid) > 0:
+			result.Status, result.Errors = ImportStatusInvalid, invalid
+		case seen[user.Phone]:
+			result.Status, result.Errors = ImportStatusDuplicate, ValidationErrors{*newFieldError("phone", "unique", nil)}
+		case user.Email != "" && seen[user.Email]:
+			result.Status, result.Errors = ImportStatusDuplicate, ValidationErrors{*newFieldError("email", "unique", nil)}
+		default:
+			// the phone and the email can not be confused as the phone always starts with +
+			seen[user.Phone] = true
+			if user.Email != "" {
+				seen[user.Email] = true
+			}
+			batch = append(batch, importCandidate{index: len(report.Rows), user: user, plaintext: plaintext})
+		}
+		report.Rows = append(report.Rows, result)
+
+		if len(batch) == importBatchSize {
+			err = s.importBatch(ctx, tenantID, report.Rows, batch, dryRun)
+			if err != nil {
+				return
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		err = s.importBatch(ctx, tenantID, report.Rows, batch, dryRun)
+		if err != nil {
+			return
+		}
+	}
+
+	report.count()
+	return
+}
+
+// check the registered phones and emails of the batch and insert the rest unless it is the dry run,
+// the result of every row of the batch is updated in place
+func (s Server) importBatch(ctx context.Context, tenantID int64, results []ImportRowResult, batch []importCandidate, dryRun bool) error {
+	phones := make([]string, 0, len(batch))
+	emails := make([]string, 0, len(batch))
+	for _, c := range batch {
+		phones = append(phones, c.user.Phone)
+		if c.user.Email != "" {
+			emails = append(emails, c.user.Email)
+		}
+	}
+
+	registered, err := s.Repository.GetRegisteredIdentifiers(ctx, tenantID, phones, emails)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	isRegistered := make(map[string]bool, len(registered))
+	for _, identifier := range registered {
+		isRegistered[identifier] = true
+	}
+
+	users := make([]repository.User, 0, len(batch))
+	indexes := make(map[string]int, len(batch))
+	for _, c := range batch {
+		result := &results[c.index]
+		if isRegistered[c.user.Phone] {
+			result.Errors = append(result.Errors, *newFieldError("phone", "unique", nil))
+		}
+		if c.user.Email != "" && isRegistered[c.user.Email] {
+			result.Errors = append(result.Errors, *newFieldError("email", "unique", nil))
+		}
+		if len(result.Errors) > 0 {
+			result.Status = ImportStatusDuplicate
+			continue
+		}
+
+		result.Status = ImportStatusValid
+		if dryRun {
+			continue
+		}
+
+		user := c.user
+		if c.plaintext {
+			hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return errInternal.wrap(err)
+			}
+			user.Password = string(hash)
+		}
+		users = append(users, user)
+		indexes[user.Phone] = c.index
+
+		// the row is registered by someone else in the meantime unless it is returned as imported
+		result.Status = ImportStatusDuplicate
+	}
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	imported, err := s.Repository.ImportProfiles(ctx, tenantID, users)
+	if err != nil {
+		return errInternal.wrap(err)
+	}
+	for _, user := range imported {
+		result := &results[indexes[user.Phone]]
+		result.Status, result.ID = ImportStatusImported, user.ID
+	}
+	return nil
+}
+
+// convert the row into the user to be imported, the password hash is saved as is so only the other fields are validated.
+// plaintext tells whether the password has to be hashed before it is saved
+func (s Server) toImportUser(row importRow) (user repository.User, plaintext bool, invalid ValidationErrors) {
+	phone, phoneErr := s.normalizePhone("phone", row.Phone)
+	user = repository.User{
+		Name:     row.Name,
+		Phone:    phone,
+		Email:    normalizeEmail(row.Email),
+		Password: row.Password,
+	}
+
+	var (
+		err     error
+		hashErr *FieldError
+		timeErr *FieldError
+	)
+	if row.PasswordHash == "" {
+		plaintext = true
+		err = Validate(user)
+	} else {
+		err = ValidatePartial(user, "Name", "Phone", "Email")
+		if row.Password != "" {
+			hashErr = newFieldError("password_hash", "excluded_with", map[string]interface{}{"other": "password"})
+		} else if _, costErr := bcrypt.Cost([]byte(row.PasswordHash)); costErr != nil {
+			hashErr = newFieldError("password_hash", "bcrypt", nil)
+		}
+		user.Password = row.PasswordHash
+	}
+
+	if row.EmailVerifiedAt != "" {
+		verifiedAt, parseErr := time.Parse(time.RFC3339, row.EmailVerifiedAt)
+		switch {
+		case parseErr != nil:
+			timeErr = newFieldError("email_verified_at", "datetime", nil)
+		case user.Email == "":
+			timeErr = newFieldError("email", "required", nil)
+		default:
+			user.EmailVerifiedAt = sql.NullTime{Time: verifiedAt, Valid: true}
+		}
+	}
+
+	err = withFieldError(withFieldError(withFieldError(err, phoneErr), hashErr), timeErr)
+	if err != nil {
+		invalid, _ = err.(ValidationErrors)
+	}
+	return
+}
+
+// count the rows of every status
+func (r *ImportReport) count() {
+	r.Total = len(r.Rows)
+	for _, row := range r.Rows {
+		switch row.Status {
+		case ImportStatusImported:
+			r.Imported++
+		case ImportStatusValid:
+			r.Valid++
+		case ImportStatusInvalid:
+			r.Invalid++
+		case ImportStatusDuplicate:
+			r.Duplicate++
+		}
+	}
+}
+
+// the counts of the import recorded in the audit trail, the rows are left out as the file can be large
+func importSummary(report ImportReport) map[string]interface{} {
+	return map[string]interface{}{
+		"total":     report.Total,
+		"imported":  report.Imported,
+		"invalid":   report.Invalid,
+		"duplicate": report.Duplicate,
+	}
+}
+
+// convert the import report into the API response with the messages in the given language
+func toImportReportResponse(report ImportReport, lang string) generated.ImportReport {
+	res := generated.ImportReport{
+		DryRun:    report.DryRun,
+		Total:     report.Total,
+		Imported:  report.Imported,
+		Valid:     report.Valid,
+		Invalid:   report.Invalid,
+		Duplicate: report.Duplicate,
+		Rows:      make([]generated.ImportRowResult, 0, len(report.Rows)),
+	}
+	for _, row := range report.Rows {
+		r := generated.ImportRowResult{Line: row.Line, Status: row.Status}
+		if row.Phone != "" {
+			phone := row.Phone
+			r.Phone = &phone
+		}
+		if row.ID != 0 {
+			id := row.ID
+			r.Id = &id
+		}
+		if len(row.Errors) > 0 {
+			errs := toValidationErrorsResponse(row.Errors, lang)
+			r.Errors = &errs
+		}
+		res.Rows = append(res.Rows, r)
+	}
+	return res
+}
+
+// create the reader of the given format
+func newImportReader(r io.Reader, format string) (importReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVImportReader(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineSize)
+		return &ndjsonImportReader{scanner: scanner}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, it should be %s or %s", format, FormatCSV, FormatNDJSON)
+}
+
+// read the header of the CSV file, the name, the phone and either the password or the password hash columns are required
+func newCSVImportReader(r io.Reader) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the header is missing")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	present := make(map[string]bool, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if i == 0 {
+			// the byte order mark written by the spreadsheet applications
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		if !isImportColumn(column) {
+			return nil, fmt.Errorf("unknown column %q, the columns should be %s", column, strings.Join(importColumns, ", "))
+		}
+		if present[column] {
+			return nil, fmt.Errorf("duplicate column %q", column)
+		}
+		columns[i], present[column] = column, true
+	}
+
+	for _, column := range []string{"name", "phone"} {
+		if !present[column] {
+			return nil, fmt.Errorf("the %s column is missing", column)
+		}
+	}
+	if !present["password"] && !present["password_hash"] {
+		return nil, errors.New("either the password or the password_hash column is required")
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvImportReader) next() (row importRow, line int, invalid ValidationErrors, err error) {
+	record, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		invalid = ValidationErrors{*newFieldError("row", "format", map[string]interface{}{"reason": parseErr.Err.Error()})}
+		return row, parseErr.StartLine, invalid, nil
+	}
+	if err != nil {
+		return
+	}
+
+	line, _ = c.reader.FieldPos(0)
+	for i, value := range record {
+		row.set(c.columns[i], value)
+	}
+	return
+}
+
+func (n *ndjsonImportReader) next() (row importRow, line int, invalid ValidationErrors, err error) {
+	for n.scanner.Scan() {
+		n.line++
+		raw := bytes.TrimSpace(n.scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		row, invalid = decodeImportRow(raw)
+		return row, n.line, invalid, nil
+	}
+
+	err = n.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// decode the NDJSON line, the members should be strings and the null member is left empty
+func decodeImportRow(raw []byte) (row importRow, invalid ValidationErrors) {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(raw, &members) != nil || members == nil {
+		return row, ValidationErrors{*newFieldError("row", "format", map[string]interface{}{"reason": "the row should be a JSON object"})}
+	}
+
+	// sort the members so the field errors order is stable
+	fields := make([]string, 0, len(members))
+	for field := range members {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if !isImportColumn(field) {
+			invalid = append(invalid, *newFieldError(field, "unknown_field", nil))
+			continue
+		}
+
+		value := members[field]
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			continue
+		}
+
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			invalid = append(invalid, *newFieldError(field, "type", map[string]interface{}{"type": "string"}))
+			continue
+		}
+		row.set(field, s)
+	}
+	return
+}
+
+// set the value of the column, the column has been checked by isImportColumn
+func (row *importRow) set(column, value string) {
+	switch column {
+	case "name":
+		row.Name = value
+	case "phone":
+		row.Phone = value
+	case "email":
+		row.Email = value
+	case "email_verified_at":
+		row.EmailVerifiedAt = value
+	case "password":
+		row.Password = value
+	case "password_hash":
+		row.PasswordHash = value
+	}
+}
+
+// check whether the column is one of the columns the users can be imported with
+func isImportColumn(column string) bool {
+	for _, c := range importColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
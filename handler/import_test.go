@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBulkImport(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		mockReq = "name,phone,email,password\n" +
+			"narto,081234567890,narto@konoha.id,Passw0rd!\n" +
+			"narto,+6281234567890,,Passw0rd!\n" +
+			"sasuke,+6281234567891,NARTO@konoha.id,Passw0rd!\n" +
+			"sakura,+6281234567892,,Passw0rd!,extra\n" +
+			"hinata,+6281234567893,hinata@konoha.id,Passw0rd!\n"
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name         string
+		format       string
+		dryRun       bool
+		req          string
+		expectErr    error
+		expectStatus []string
+		mock         func()
+	}{
+		{
+			name:      "err unknown format",
+			format:    "xml",
+			req:       mockReq,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err line too long",
+			format:    FormatNDJSON,
+			req:       `{"name": "` + strings.Repeat("a", importMaxLineSize) + `"}`,
+			expectErr: errInvalidRequest,
+		},
+		{
+			name:      "err audit",
+			format:    FormatCSV,
+			req:       mockReq,
+			expectErr: mockErr,
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().ImportProfiles(any, any, any).Return(nil, nil)
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).Return(int64(0), mockErr)
+			},
+		},
+		{
+			name:         "success dry run",
+			format:       FormatCSV,
+			dryRun:       true,
+			req:          mockReq,
+			expectStatus: []string{ImportStatusValid, ImportStatusDuplicate, ImportStatusDuplicate, ImportStatusInvalid, ImportStatusDuplicate},
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, []string{"+6281234567890", "+6281234567893"}, []string{"narto@konoha.id", "hinata@konoha.id"}).
+					Return([]string{"hinata@konoha.id"}, nil)
+			},
+		},
+		{
+			name:         "success",
+			format:       FormatCSV,
+			req:          mockReq,
+			expectStatus: []string{ImportStatusImported, ImportStatusDuplicate, ImportStatusDuplicate, ImportStatusInvalid, ImportStatusDuplicate},
+			mock: func() {
+				mockRepo.EXPECT().GetRegisteredIdentifiers(any, any, any, any).Return(nil, nil)
+
+				// the hinata row is registered by someone else in the meantime
+				mockRepo.EXPECT().ImportProfiles(any, any, any).DoAndReturn(func(_ interface{}, _ int64, users []repository.User) ([]repository.User, error) {
+					assert.Len(t, users, 2)
+					users[0].ID = 3
+					return users[:1], nil
+				})
+				mockRepo.EXPECT().SaveAuditEvent(any, any, any).DoAndReturn(func(_ interface{}, _ int64, event repository.AuditEvent) (int64, error) {
+					assert.Equal(t, auditActionUserImport, event.Action)
+					assert.False(t, event.ActorID.Valid)
+					assert.JSONEq(t, `{"total":5,"imported":1,"invalid":1,"duplicate":3}`, string(event.After))
+					return 1, nil
+				})
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			report, err := server.BulkImport(context.Background(), 1, strings.NewReader(tt.req), tt.format, tt.dryRun)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.dryRun, report.DryRun)
+
+			var status []string
+			for _, row := range report.Rows {
+				status = append(status, row.Status)
+			}
+			assert.Equal(t, tt.expectStatus, status)
+			assert.Equal(t, []int{2, 3, 4, 5, 6}, []int{report.Rows[0].Line, report.Rows[1].Line, report.Rows[2].Line, report.Rows[3].Line, report.Rows[4].Line})
+			assert.Equal(t, "+6281234567890", report.Rows[0].Phone)
+			assert.Equal(t, "phone", report.Rows[1].Errors[0].Field)
+			assert.Equal(t, "email", report.Rows[2].Errors[0].Field)
+			assert.Equal(t, "format", report.Rows[3].Errors[0].Rule)
+			assert.Equal(t, len(report.Rows), report.Total)
+		})
+	}
+}
+
+func TestToImportUser(t *testing.T) {
+	var (
+		server  = NewServer(NewServerOptions{RSAPrivateKey: getDummyRSAKey()})
+		hash, _ = bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+	)
+
+	test := []struct {
+		name            string
+		row             importRow
+		expectFields    []string
+		expectPlaintext bool
+		expectUser      repository.User
+	}{
+		{
+			name:         "err invalid fields",
+			row:          importRow{Name: "na", Phone: "123", Email: "narto", Password: "weak"},
+			expectFields: []string{"phone", "email", "name", "password"},
+		},
+		{
+			name:         "err password and password hash",
+			row:          importRow{Name: "narto", Phone: "081234567890", Password: "Passw0rd!", PasswordHash: string(hash)},
+			expectFields: []string{"password_hash"},
+		},
+		{
+			name:         "err invalid password hash",
+			row:          importRow{Name: "narto", Phone: "081234567890", PasswordHash: "Passw0rd!"},
+			expectFields: []string{"password_hash"},
+		},
+		{
+			name:         "err invalid email verification time",
+			row:          importRow{Name: "narto", Phone: "081234567890", Email: "narto@konoha.id", EmailVerifiedAt: "yesterday", Password: "Passw0rd!"},
+			expectFields: []string{"email_verified_at"},
+		},
+		{
+			name:         "err email verification time without email",
+			row:          importRow{Name: "narto", Phone: "081234567890", EmailVerifiedAt: "2023-01-02T03:04:05Z", Password: "Passw0rd!"},
+			expectFields: []string{"email"},
+		},
+		{
+			name:            "success plaintext password",
+			row:             importRow{Name: "narto", Phone: "081234567890", Email: " Narto@Konoha.id", Password: "Passw0rd!"},
+			expectPlaintext: true,
+			expectUser:      repository.User{Name: "narto", Phone: "+6281234567890", Email: "narto@konoha.id", Password: "Passw0rd!"},
+		},
+		{
+			name: "success password hash",
+			row:  importRow{Name: "narto", Phone: "+6281234567890", Email: "narto@konoha.id", EmailVerifiedAt: "2023-01-02T10:04:05+07:00", PasswordHash: string(hash)},
+			expectUser: repository.User{
+				Name:            "narto",
+				Phone:           "+6281234567890",
+				Email:           "narto@konoha.id",
+				EmailVerifiedAt: sql.NullTime{Time: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true},
+				Password:        string(hash),
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			user, plaintext, invalid := server.toImportUser(tt.row)
+
+			if tt.expectFields != nil {
+				var fields []string
+				for _, fe := range invalid {
+					fields = append(fields, fe.Field)
+				}
+				assert.ElementsMatch(t, tt.expectFields, fields)
+				return
+			}
+			assert.Empty(t, invalid)
+			assert.Equal(t, tt.expectPlaintext, plaintext)
+			assert.True(t, tt.expectUser.EmailVerifiedAt.Time.Equal(user.EmailVerifiedAt.Time))
+			user.EmailVerifiedAt.Time = tt.expectUser.EmailVerifiedAt.Time
+			assert.Equal(t, tt.expectUser, user)
+		})
+	}
+}
+
+func TestNewCSVImportReader(t *testing.T) {
+	test := []struct {
+		name      string
+		header    string
+		expectErr bool
+	}{
+		{name: "err empty file", header: "", expectErr: true},
+		{name: "err unknown column", header: "name,phone,password,age", expectErr: true},
+		{name: "err duplicate column", header: "name,phone,password,phone", expectErr: true},
+		{name: "err missing phone", header: "name,password", expectErr: true},
+		{name: "err missing password", header: "name,phone,email", expectErr: true},
+		{name: "success byte order mark", header: "\ufeffName, Phone ,password_hash"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := newCSVImportReader(strings.NewReader(tt.header))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"name", "phone", "password_hash"}, reader.columns)
+		})
+	}
+}
+
+func TestDecodeImportRow(t *testing.T) {
+	test := []struct {
+		name         string
+		raw          string
+		expectRow    importRow
+		expectFields []string
+	}{
+		{name: "err not an object", raw: `["narto"]`, expectFields: []string{"row"}},
+		{name: "err null", raw: `null`, expectFields: []string{"row"}},
+		{name: "err unknown and invalid members", raw: `{"phone": 62, "age": 17, "name": "narto"}`, expectRow: importRow{Name: "narto"}, expectFields: []string{"age", "phone"}},
+		{name: "success", raw: `{"name": "narto", "phone": "+62", "email": null, "password_hash": "hash"}`, expectRow: importRow{Name: "narto", Phone: "+62", PasswordHash: "hash"}},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			row, invalid := decodeImportRow([]byte(tt.raw))
+
+			var fields []string
+			for _, fe := range invalid {
+				fields = append(fields, fe.Field)
+			}
+			assert.Equal(t, tt.expectFields, fields)
+			assert.Equal(t, tt.expectRow, row)
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"crypto/hmac"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,26 +26,97 @@ const (
 	HeaderAuthorization = "Authorization"
 )
 
-type jwtClaim struct {
-	repository.User
-	Exp int64 `json:"exp"`
+type (
+	// the roles claim is the names of the roles of the user and the scope claim is the granted permissions separated by space,
+	// they only tell the client what the user is allowed to do as the permissions are checked again on every request.
+	// The tid claim is the tenant of the user, the token can only be used for the requests of the tenant.
+	// The orgs claim is the organizations of the user and their role so the other services can authorize per organization,
+	// the organization endpoints of this service read the membership again on every request.
+	// The impersonation token has the act claim and its session id as the jti claim.
+	// Only the identity of the user is in the token, the rest of the profile (e.g. the password hash) is never signed into it
+	jwtClaim struct {
+		ID        int64               `json:"id"`
+		Name      string              `json:"name"`
+		Phone     string              `json:"phone"`
+		Email     string              `json:"email,omitempty"`
+		TenantID  int64               `json:"tid"`
+		Roles     []string            `json:"roles"`
+		Scope     string              `json:"scope"`
+		Orgs      []tokenOrganization `json:"orgs"`
+		Act       *tokenActor         `json:"act,omitempty"`
+		SessionID string              `json:"jti,omitempty"`
+		Exp       int64               `json:"exp"`
+	}
+
+	// tokenOrganization is the organization of the user in the orgs claim together with the organization role of the user
+	tokenOrganization struct {
+		ID   int64  `json:"id"`
+		Role string `json:"role"`
+	}
+
+	// tokenActor is the actor claim of RFC 8693, the subject is the id of the admin acting as the user of the token
+	tokenActor struct {
+		Subject string `json:"sub"`
+	}
+)
+
+// generate signed JWT token with RSA key and include the tenant, the user profile, the roles, the permissions
+// and the organizations in the jwt claim
+func generateToken(key *rsa.PrivateKey, tenantID int64, user repository.User, roles, permissions []string, orgs []tokenOrganization) (token string, err error) {
+	return signToken(key, jwtClaim{
+		ID:       user.ID,
+		Name:     user.Name,
+		Phone:    user.Phone,
+		Email:    user.Email,
+		TenantID: tenantID,
+		Roles:    roles,
+		Scope:    strings.Join(permissions, " "),
+		Orgs:     orgs,
+		Exp:      time.Now().Add(tokenExpireTime).Unix(),
+	})
 }
 
-// generate signed JWT token with RSA key and include the user profile in the jwt claim
-func generateToken(key *rsa.PrivateKey, user repository.User) (token string, err error) {
-	var claim jwt.MapClaims
-	c, _ := json.Marshal(jwtClaim{
-		User: user,
-		Exp:  time.Now().Add(tokenExpireTime).Unix(),
+// generate signed JWT token of the admin acting as the user of the tenant, the token expires at the given time
+func generateImpersonationToken(key *rsa.PrivateKey, tenantID int64, user repository.User, roles, permissions []string, orgs []tokenOrganization, actorID int64, sessionID string, expiresAt time.Time) (token string, err error) {
+	return signToken(key, jwtClaim{
+		ID:        user.ID,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		Email:     user.Email,
+		TenantID:  tenantID,
+		Roles:     roles,
+		Scope:     strings.Join(permissions, " "),
+		Orgs:      orgs,
+		Act:       &tokenActor{Subject: strconv.FormatInt(actorID, 10)},
+		SessionID: sessionID,
+		Exp:       expiresAt.Unix(),
 	})
-	json.Unmarshal(c, &claim)
+}
+
+// return the user identified by the claim
+func (c jwtClaim) user() repository.User {
+	return repository.User{ID: c.ID, Name: c.Name, Phone: c.Phone, Email: c.Email}
+}
+
+func signToken(key *rsa.PrivateKey, c jwtClaim) (token string, err error) {
+	var claim jwt.MapClaims
+	b, _ := json.Marshal(c)
+	json.Unmarshal(b, &claim)
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
 	return jwtToken.SignedString(x509.MarshalPKCS1PrivateKey(key))
 }
 
-// verify JWT token and return the user information inside jwt claim
-func verifyToken(ctx echo.Context, key *rsa.PrivateKey) (user repository.User, err error) {
+// derive the key used to sign the tokens of the given purpose from the RSA key, e.g. the email verification link,
+// so the token of a purpose can never be accepted as the bearer token or the token of another purpose
+func purposeKey(key *rsa.PrivateKey, purpose string) []byte {
+	mac := hmac.New(sha256.New, x509.MarshalPKCS1PrivateKey(key))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// verify JWT token of the request and return its claim, the expired token is rejected
+func parseToken(ctx echo.Context, key *rsa.PrivateKey) (claim jwtClaim, err error) {
 	auth := strings.Split(ctx.Request().Header.Get(HeaderAuthorization), " ")
 	if len(auth) != 2 {
 		err = fmt.Errorf("invalid token")
@@ -56,9 +130,7 @@ func verifyToken(ctx echo.Context, key *rsa.PrivateKey) (user repository.User, e
 		return
 	}
 
-	var claim jwtClaim
 	c, _ := json.Marshal(jwtToken.Claims)
 	json.Unmarshal(c, &claim)
-	user = claim.User
 	return
 }
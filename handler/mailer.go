@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Mailer deliver the email to the user, e.g. through SMTP or a transactional email provider.
+	Mailer interface {
+		SendMail(ctx context.Context, mail Mail) error
+	}
+
+	// Mail is a plain text email
+	Mail struct {
+		To      string
+		Subject string
+		Body    string
+	}
+
+	// FileMailer write every email into a file inside Dir, it should only be used for development
+	FileMailer struct {
+		Dir string
+	}
+
+	// MemoryMailer keep every email in memory so it can be read by the tests or the development tools
+	MemoryMailer struct {
+		mu    sync.Mutex
+		mails []Mail
+	}
+
+	// default mailer which only write the email into the application log, it should only be used for development
+	logMailer struct{}
+)
+
+// write the email into the application log
+func (logMailer) SendMail(ctx context.Context, mail Mail) error {
+	log.Printf("mail: to=%s subject=%q body=%q", mail.To, mail.Subject, mail.Body)
+	return nil
+}
+
+// write the email into a new file named by the sending time and the recipient
+func (m FileMailer) SendMail(ctx context.Context, mail Mail) error {
+	err := os.MkdirAll(m.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(mail.To, string(filepath.Separator), "_"))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", mail.To, mail.Subject, mail.Body)
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0600)
+}
+
+// keep the email in memory
+func (m *MemoryMailer) SendMail(ctx context.Context, mail Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+// return the sent emails from the oldest one
+func (m *MemoryMailer) Mails() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mail(nil), m.mails...)
+}
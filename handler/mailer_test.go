@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMailer(t *testing.T) {
+	assert.NoError(t, logMailer{}.SendMail(context.Background(), Mail{To: "narto@example.com"}))
+}
+
+func TestFileMailer(t *testing.T) {
+	var (
+		dir  = filepath.Join(t.TempDir(), "mails")
+		mail = Mail{To: "narto@example.com", Subject: "hello", Body: "world"}
+	)
+
+	err := FileMailer{Dir: dir}.SendMail(context.Background(), mail)
+	assert.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "To: narto@example.com\r\nSubject: hello\r\n")
+		assert.Contains(t, string(content), "\r\n\r\nworld")
+	}
+
+	// the directory can not be created inside a file
+	err = FileMailer{Dir: filepath.Join(dir, files[0].Name(), "mails")}.SendMail(context.Background(), mail)
+	assert.Error(t, err)
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := &MemoryMailer{}
+	assert.Empty(t, m.Mails())
+
+	assert.NoError(t, m.SendMail(context.Background(), Mail{To: "a@example.com"}))
+	assert.NoError(t, m.SendMail(context.Background(), Mail{To: "b@example.com"}))
+	assert.Equal(t, []Mail{{To: "a@example.com"}, {To: "b@example.com"}}, m.Mails())
+}
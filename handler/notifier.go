@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type (
+	// Notifier deliver security related events to the user, e.g. push notification, SMS or email.
+	Notifier interface {
+		NotifyNewDeviceLogin(ctx context.Context, event NewDeviceLoginEvent) error
+	}
+
+	// NewDeviceLoginEvent is emitted when the user signs in from a device which has never been used before.
+	NewDeviceLoginEvent struct {
+		ProfileID int64
+		Name      string
+		Phone     string
+		DeviceID  string
+		UserAgent string
+		IPAddress string
+		LoginAt   time.Time
+	}
+
+	// default notifier which only write the event into the application log
+	logNotifier struct{}
+)
+
+// write the new device login event into the application log
+func (logNotifier) NotifyNewDeviceLogin(ctx context.Context, event NewDeviceLoginEvent) error {
+	log.Printf("new device login: profile=%d device=%q user_agent=%q ip=%s at=%s",
+		event.ProfileID,
+		event.DeviceID,
+		event.UserAgent,
+		event.IPAddress,
+		event.LoginAt.Format(time.RFC3339),
+	)
+	return nil
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// the single-use invitation token sent to the invited phone number
+	invitationTTL     = 7 * 24 * time.Hour
+	invitationPurpose = "organization-invitation"
+)
+
+var (
+	// the organization roles from the lowest one, the member can only grant the roles up to its own
+	organizationRoles = []string{
+		repository.OrganizationRoleMember,
+		repository.OrganizationRoleAdmin,
+		repository.OrganizationRoleOwner,
+	}
+)
+
+type (
+	// InvitationSender deliver the organization invitation token to the invited phone number, e.g. through SMS or WhatsApp gateway.
+	InvitationSender interface {
+		SendInvitation(ctx context.Context, invitation InvitationMessage) error
+	}
+
+	// InvitationMessage is the invitation to join the organization with the role, the token is accepted
+	// by POST /invitations/accept or declined by POST /invitations/decline until ExpiresAt
+	InvitationMessage struct {
+		Phone            string
+		OrganizationName string
+		InviterName      string
+		Role             string
+		Token            string
+		ExpiresAt        time.Time
+	}
+
+	// default sender which only write the invitation into the application log, it should only be used for development
+	logInvitationSender struct{}
+
+	// the claim of the invitation token, the id is the organization_invitation row and the subject is the invited phone
+	invitationClaim struct {
+		jwt.StandardClaims
+		OrganizationID int64 `json:"org"`
+	}
+)
+
+// write the invitation into the application log
+func (logInvitationSender) SendInvitation(ctx context.Context, invitation InvitationMessage) error {
+	log.Printf("invitation: phone=%s organization=%q role=%s token=%s", invitation.Phone, invitation.OrganizationName, invitation.Role, invitation.Token)
+	return nil
+}
+
+// sign the invitation token
+func generateInvitationToken(key *rsa.PrivateKey, invitation repository.Invitation) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, invitationClaim{
+		StandardClaims: jwt.StandardClaims{
+			Id:        invitation.ID,
+			Subject:   invitation.Phone,
+			ExpiresAt: invitation.ExpiresAt.Unix(),
+		},
+		OrganizationID: invitation.OrganizationID,
+	})
+	return token.SignedString(purposeKey(key, invitationPurpose))
+}
+
+// verify the signature and the expiry of the invitation token and return the invitation inside its claim,
+// whether the invitation has been answered is checked by the repository
+func parseInvitationToken(key *rsa.PrivateKey, token string) (invitation repository.Invitation, err error) {
+	var claim invitationClaim
+	_, err = jwt.ParseWithClaims(token, &claim, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return purposeKey(key, invitationPurpose), nil
+	})
+	if err != nil {
+		return
+	}
+	if claim.Id == "" || claim.Subject == "" || claim.OrganizationID == 0 {
+		err = errors.New("incomplete invitation token")
+		return
+	}
+
+	invitation = repository.Invitation{
+		ID:             claim.Id,
+		OrganizationID: claim.OrganizationID,
+		Phone:          claim.Subject,
+		ExpiresAt:      time.Unix(claim.ExpiresAt, 0),
+	}
+	return
+}
+
+// get the organization role of the user, the organization of which the user is not a member is not found
+// so the other organizations are never disclosed
+func (s Server) organizationMember(ctx echo.Context, organizationID, userID int64) (membership repository.Membership, err error) {
+	membership, err = s.Repository.GetMembership(ctx.Request().Context(), tenantID(ctx), organizationID, userID)
+	if err == sql.ErrNoRows {
+		return membership, errNotFound.withDetail("detail.organization-not-found", nil)
+	}
+	if err != nil {
+		return membership, errInternal.wrap(err)
+	}
+	return membership, nil
+}
+
+// get the organizations of the user put into the orgs claim of the issued token
+func (s Server) userOrganizations(ctx echo.Context, userID int64) ([]tokenOrganization, error) {
+	memberships, err := s.Repository.GetProfileMemberships(ctx.Request().Context(), tenantID(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]tokenOrganization, 0, len(memberships))
+	for _, m := range memberships {
+		orgs = append(orgs, tokenOrganization{ID: m.OrganizationID, Role: m.Role})
+	}
+	return orgs, nil
+}
+
+// make sure the member can manage the members of the given roles, which requires at least the admin role
+// and a role as high as every given role, e.g. only the owner can invite or remove an owner
+func requireOrganizationRole(member repository.Membership, roles ...string) error {
+	required := repository.OrganizationRoleAdmin
+	for _, role := range roles {
+		if organizationRoleRank(role) > organizationRoleRank(required) {
+			required = role
+		}
+	}
+	if organizationRoleRank(member.Role) < organizationRoleRank(required) {
+		return errForbidden.withDetail("detail.organization-role-required", map[string]interface{}{"role": required})
+	}
+	return nil
+}
+
+// the rank of the organization role, the unknown role has the lowest rank
+func organizationRoleRank(role string) int {
+	for i, r := range organizationRoles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// the field error of the unknown organization role, nil for the known one
+func organizationRoleError(field, role string) *FieldError {
+	if role == "" {
+		return newFieldError(field, "required", nil)
+	}
+	if organizationRoleRank(role) == 0 {
+		return newFieldError(field, "organization_role", map[string]interface{}{"roles": strings.Join(organizationRoles, ", ")})
+	}
+	return nil
+}
+
+// convert the membership of the current user into the organization API response
+func toOrganizationResponse(membership repository.Membership) generated.Organization {
+	return generated.Organization{
+		Id:       membership.OrganizationID,
+		Name:     membership.OrganizationName,
+		Role:     membership.Role,
+		JoinedAt: membership.CreatedAt,
+	}
+}
+
+// convert the memberships of the current user into the API response
+func toOrganizationListResponse(memberships []repository.Membership) generated.OrganizationList {
+	res := generated.OrganizationList{Organizations: make([]generated.Organization, 0, len(memberships))}
+	for _, m := range memberships {
+		res.Organizations = append(res.Organizations, toOrganizationResponse(m))
+	}
+	return res
+}
+
+// convert the membership into the organization member API response
+func toOrganizationMemberResponse(membership repository.Membership) generated.OrganizationMember {
+	return generated.OrganizationMember{
+		ProfileId: membership.ProfileID,
+		Name:      membership.ProfileName,
+		Role:      membership.Role,
+		JoinedAt:  membership.CreatedAt,
+	}
+}
+
+// convert the members of the organization into the API response
+func toOrganizationMemberListResponse(members []repository.Membership) generated.OrganizationMemberList {
+	res := generated.OrganizationMemberList{Members: make([]generated.OrganizationMember, 0, len(members))}
+	for _, m := range members {
+		res.Members = append(res.Members, toOrganizationMemberResponse(m))
+	}
+	return res
+}
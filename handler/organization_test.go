@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// invitation sender stub which records the delivered invitations
+type stubInvitationSender struct {
+	err         error
+	invitations []InvitationMessage
+}
+
+func (s *stubInvitationSender) SendInvitation(ctx context.Context, invitation InvitationMessage) error {
+	s.invitations = append(s.invitations, invitation)
+	return s.err
+}
+
+func TestLogInvitationSender(t *testing.T) {
+	assert.NoError(t, logInvitationSender{}.SendInvitation(context.Background(), InvitationMessage{Phone: "+6281122334455", Token: "abc"}))
+}
+
+func TestInvitationToken(t *testing.T) {
+	var (
+		key        = getDummyRSAKey()
+		invitation = repository.Invitation{
+			ID:             "abc",
+			OrganizationID: 1,
+			Phone:          "+6281122334455",
+			ExpiresAt:      time.Now().Add(time.Hour).Truncate(time.Second),
+		}
+	)
+
+	valid, err := generateInvitationToken(key, invitation)
+	assert.NoError(t, err)
+
+	expired := invitation
+	expired.ExpiresAt = time.Now().Add(-time.Hour)
+	expiredToken, err := generateInvitationToken(key, expired)
+	assert.NoError(t, err)
+
+	incomplete := invitation
+	incomplete.OrganizationID = 0
+	incompleteToken, err := generateInvitationToken(key, incomplete)
+	assert.NoError(t, err)
+
+	// the email verification token is signed for another purpose so it can not be used as an invitation
+	verification, err := generateEmailVerificationToken(key, repository.EmailVerification{
+		ID:        "abc",
+		ProfileID: 1,
+		Email:     "narto@example.com",
+		ExpiresAt: invitation.ExpiresAt,
+	})
+	assert.NoError(t, err)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr bool
+	}{
+		{name: "err malformed", token: "asd", expectErr: true},
+		{name: "err email verification token", token: verification, expectErr: true},
+		{name: "err expired", token: expiredToken, expectErr: true},
+		{name: "err incomplete claim", token: incompleteToken, expectErr: true},
+		{name: "success", token: valid},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseInvitationToken(key, tt.token)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, invitation.ID, got.ID)
+			assert.Equal(t, invitation.OrganizationID, got.OrganizationID)
+			assert.Equal(t, invitation.Phone, got.Phone)
+			assert.True(t, invitation.ExpiresAt.Equal(got.ExpiresAt))
+		})
+	}
+}
+
+func TestRequireOrganizationRole(t *testing.T) {
+	var (
+		owner  = repository.Membership{Role: repository.OrganizationRoleOwner}
+		admin  = repository.Membership{Role: repository.OrganizationRoleAdmin}
+		member = repository.Membership{Role: repository.OrganizationRoleMember}
+	)
+
+	test := []struct {
+		name      string
+		member    repository.Membership
+		roles     []string
+		expectErr bool
+	}{
+		{name: "err member", member: member, roles: []string{repository.OrganizationRoleMember}, expectErr: true},
+		{name: "err member without role", member: member, expectErr: true},
+		{name: "err admin manage owner", member: admin, roles: []string{repository.OrganizationRoleMember, repository.OrganizationRoleOwner}, expectErr: true},
+		{name: "success admin manage admin", member: admin, roles: []string{repository.OrganizationRoleAdmin, repository.OrganizationRoleMember}},
+		{name: "success admin without role", member: admin},
+		{name: "success owner manage owner", member: owner, roles: []string{repository.OrganizationRoleOwner}},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			err := requireOrganizationRole(tt.member, tt.roles...)
+			if tt.expectErr {
+				assert.ErrorIs(t, err, errForbidden)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestOrganizationRoleError(t *testing.T) {
+	assert.Equal(t, "required", organizationRoleError("role", "").Rule)
+	assert.Equal(t, "organization_role", organizationRoleError("role", "guest").Rule)
+	assert.Equal(t, "member, admin, owner", organizationRoleError("role", "Owner").Params["roles"])
+	assert.Nil(t, organizationRoleError("role", repository.OrganizationRoleOwner))
+}
+
+func TestUserOrganizations(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		e      = echo.New()
+		c      = e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	mockRepo.EXPECT().GetProfileMemberships(any, any, int64(1)).Return(nil, mockErr)
+	_, err := server.userOrganizations(c, 1)
+	assert.ErrorIs(t, err, mockErr)
+
+	mockRepo.EXPECT().GetProfileMemberships(any, any, int64(1)).Return(nil, nil)
+	orgs, err := server.userOrganizations(c, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, orgs)
+	assert.NotNil(t, orgs)
+
+	mockRepo.EXPECT().GetProfileMemberships(any, any, int64(1)).Return([]repository.Membership{
+		{OrganizationID: 2, OrganizationName: "acme", Role: repository.OrganizationRoleOwner},
+		{OrganizationID: 3, OrganizationName: "brand", Role: repository.OrganizationRoleMember},
+	}, nil)
+	orgs, err = server.userOrganizations(c, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []tokenOrganization{
+		{ID: 2, Role: repository.OrganizationRoleOwner},
+		{ID: 3, Role: repository.OrganizationRoleMember},
+	}, orgs)
+}
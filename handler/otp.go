@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"time"
+)
+
+const (
+	// the one-time password sent to verify the ownership of a phone number
+	otpLength      = 6
+	otpTTL         = 10 * time.Minute
+	otpMaxAttempts = 5
+
+	// the minimum time between two OTPs sent for the pending phone change of a profile
+	otpResendCooldown = time.Minute
+)
+
+type (
+	// OTPSender deliver the one-time password to the phone number, e.g. through SMS or WhatsApp gateway.
+	OTPSender interface {
+		SendOTP(ctx context.Context, phone, code string) error
+	}
+
+	// default sender which only write the OTP into the application log, it should only be used for development
+	logOTPSender struct{}
+)
+
+// write the OTP into the application log
+func (logOTPSender) SendOTP(ctx context.Context, phone, code string) error {
+	log.Printf("otp: phone=%s code=%s", phone, code)
+	return nil
+}
+
+// generate a random numeric one-time password
+func generateOTP() (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(otpLength), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpLength, n), nil
+}
+
+// the error of the pending phone change locked after too many wrong OTPs, the lock is lifted once the change expires
+func otpLockedError(expiresAt time.Time) error {
+	return errTooManyAttempts.withDetail("detail.otp-locked", map[string]interface{}{
+		"retry_at": expiresAt.UTC().Format(time.RFC3339),
+	}).retryAfter(time.Until(expiresAt))
+}
+
+// the error of an OTP requested again before the cooldown of the previous one has passed
+func otpCooldownError(wait time.Duration) error {
+	return errTooManyRequests.withDetail("detail.otp-cooldown", map[string]interface{}{
+		"seconds": int(math.Ceil(wait.Seconds())),
+	}).retryAfter(wait)
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// OTP sender stub which records the delivered codes
+type stubOTPSender struct {
+	err   error
+	codes map[string]string
+}
+
+func (s *stubOTPSender) SendOTP(ctx context.Context, phone, code string) error {
+	if s.codes == nil {
+		s.codes = map[string]string{}
+	}
+	s.codes[phone] = code
+	return s.err
+}
+
+func TestGenerateOTP(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		code, err := generateOTP()
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9]{6}$`), code)
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestLogOTPSender(t *testing.T) {
+	assert.NoError(t, logOTPSender{}.SendOTP(context.Background(), "+6281122334455", "123456"))
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/basriyasin/sp-user/i18n"
+	"github.com/basriyasin/sp-user/phone"
+)
+
+// used by the server created without NewServer
+var defaultPhoneNumbering, _ = phone.NewNumbering()
+
+// normalize the phone number into E.164 format so the same number written in different formats is stored and looked up once,
+// the raw phone number is returned along with the field error when it is invalid or its country is not allowed
+func (s Server) normalizePhone(field, raw string) (string, *FieldError) {
+	numbering := s.phones
+	if numbering == nil {
+		numbering = defaultPhoneNumbering
+	}
+
+	normalized, err := numbering.Normalize(raw)
+	switch err {
+	case nil:
+		return normalized, nil
+	case phone.ErrCountryNotAllowed:
+		return raw, newFieldError(field, "phone_country", map[string]interface{}{
+			"countries": strings.Join(numbering.Countries(), ", "),
+		})
+	default:
+		return raw, newFieldError(field, "phone", nil)
+	}
+}
+
+// create the field error with the message in the default language
+func newFieldError(field, rule string, params map[string]interface{}) *FieldError {
+	fe := FieldError{
+		Field:  field,
+		Rule:   rule,
+		Params: params,
+	}
+	fe.Message = fe.localize(i18n.DefaultLanguage)
+	return &fe
+}
+
+// add the field error into the ValidationErrors returned by Validate,
+// the field error is ignored when the same field already fails another rule
+func withFieldError(err error, fe *FieldError) error {
+	if fe == nil {
+		return err
+	}
+	if err == nil {
+		return ValidationErrors{*fe}
+	}
+
+	verr, ok := err.(ValidationErrors)
+	if !ok {
+		return err
+	}
+	for _, e := range verr {
+		if e.Field == fe.Field {
+			return err
+		}
+	}
+	return append(verr, *fe)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	server := NewServer(NewServerOptions{PhoneCountries: []string{"ID", "SG"}})
+
+	test := []struct {
+		name      string
+		raw       string
+		expect    string
+		expectErr *FieldError
+	}{
+		{
+			name:   "international format",
+			raw:    "+6281122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "national format",
+			raw:    "081122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "other allowed country",
+			raw:    "+65 8123 4567",
+			expect: "+6581234567",
+		},
+		{
+			name:      "invalid phone",
+			raw:       "+62811",
+			expect:    "+62811",
+			expectErr: newFieldError("phone", "phone", nil),
+		},
+		{
+			name:      "country not allowed",
+			raw:       "+60123456789",
+			expect:    "+60123456789",
+			expectErr: newFieldError("phone", "phone_country", map[string]interface{}{"countries": "ID, SG"}),
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := server.normalizePhone("phone", tt.raw)
+			assert.Equal(t, tt.expect, got)
+			assert.Equal(t, tt.expectErr, err)
+		})
+	}
+}
+
+func TestNormalizePhoneDefaultNumbering(t *testing.T) {
+	got, err := Server{}.normalizePhone("phone", "081122334455")
+	assert.Nil(t, err)
+	assert.Equal(t, "+6281122334455", got)
+}
+
+func TestWithFieldError(t *testing.T) {
+	var (
+		phoneErr = newFieldError("phone", "phone", nil)
+		nameErr  = FieldError{Field: "name", Rule: "name"}
+		mockErr  = errors.New("an error")
+	)
+
+	test := []struct {
+		name   string
+		err    error
+		fe     *FieldError
+		expect error
+	}{
+		{
+			name:   "no field error",
+			err:    ValidationErrors{nameErr},
+			expect: ValidationErrors{nameErr},
+		},
+		{
+			name:   "no validation error",
+			fe:     phoneErr,
+			expect: ValidationErrors{*phoneErr},
+		},
+		{
+			name:   "other error",
+			err:    mockErr,
+			fe:     phoneErr,
+			expect: mockErr,
+		},
+		{
+			name:   "field already failed",
+			err:    ValidationErrors{{Field: "phone", Rule: "required"}},
+			fe:     phoneErr,
+			expect: ValidationErrors{{Field: "phone", Rule: "required"}},
+		},
+		{
+			name:   "append field error",
+			err:    ValidationErrors{nameErr},
+			fe:     phoneErr,
+			expect: ValidationErrors{nameErr, *phoneErr},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, withFieldError(tt.err, tt.fe))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/basriyasin/sp-user/preference"
+	"github.com/basriyasin/sp-user/repository"
+)
+
+// the JSON null which resets the preference to its default value
+var jsonNull = []byte("null")
+
+// DefaultPreferences creates the registry of the built-in preference keys whose "language" format
+// only accepts the languages of the translated messages
+func DefaultPreferences() *preference.Registry {
+	r := preference.Default()
+	r.RegisterFormat("language", isCatalogLanguage)
+	return r
+}
+
+// check whether the language has the translated messages
+func isCatalogLanguage(lang string) bool {
+	for _, l := range catalog.Languages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// decode the preferences request, the error is returned when the body is not a JSON object
+func decodePreferences(body io.Reader) (values repository.Preferences, err error) {
+	err = json.NewDecoder(body).Decode(&values)
+	if err == nil && values == nil {
+		err = errors.New("the preferences should be a JSON object")
+	}
+	return
+}
+
+// validate every preference against the schema of its key, the null value is always valid as it resets the preference
+func (s Server) validatePreferences(values repository.Preferences) (invalid ValidationErrors) {
+	// sort the keys so the field errors order is stable
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+		if _, ok := s.preferences.Schema(key); ok && bytes.Equal(bytes.TrimSpace(value), jsonNull) {
+			continue
+		}
+
+		err := s.preferences.Validate(key, value)
+		if errors.Is(err, preference.ErrUnknownKey) {
+			invalid = append(invalid, *newFieldError(key, "unknown_field", nil))
+			continue
+		}
+		var verr *preference.ValidationError
+		if errors.As(err, &verr) {
+			invalid = append(invalid, *newFieldError(verr.Path, "schema", map[string]interface{}{"reason": verr.Reason}))
+		}
+	}
+	return
+}
+
+// merge the saved preferences into the default values, the saved preferences of the unregistered keys are ignored
+func (s Server) withDefaultPreferences(saved repository.Preferences) repository.Preferences {
+	values := repository.Preferences{}
+	for key, value := range s.preferences.Defaults() {
+		values[key] = value
+	}
+	for key, value := range saved {
+		if _, ok := s.preferences.Schema(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// decode the preference values of the changed keys for the audit trail, the missing preference is nil
+func auditPreferences(values, changes repository.Preferences) map[string]interface{} {
+	decoded := make(map[string]interface{}, len(changes))
+	for key := range changes {
+		var v interface{}
+		if value, ok := values[key]; ok {
+			json.Unmarshal(value, &v)
+		}
+		decoded[key] = v
+	}
+	return decoded
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/basriyasin/sp-user/preference"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCatalogLanguage(t *testing.T) {
+	assert.True(t, isCatalogLanguage("en"))
+	assert.True(t, isCatalogLanguage("id"))
+	assert.False(t, isCatalogLanguage("fr"))
+}
+
+func TestDefaultPreferences(t *testing.T) {
+	r := DefaultPreferences()
+	assert.NoError(t, r.Validate("language", json.RawMessage(`"id"`)))
+	assert.Error(t, r.Validate("language", json.RawMessage(`"fr"`)))
+
+	// the registry of the caller is used as it is
+	custom := preference.Default()
+	server := NewServer(NewServerOptions{Preferences: custom})
+	assert.Same(t, custom, server.preferences)
+	assert.NoError(t, custom.Validate("language", json.RawMessage(`"fr"`)))
+}
+
+func TestDecodePreferences(t *testing.T) {
+	test := []struct {
+		name      string
+		body      string
+		expect    repository.Preferences
+		expectErr bool
+	}{
+		{name: "err malformed", body: `{`, expectErr: true},
+		{name: "err array", body: `["language"]`, expectErr: true},
+		{name: "err null", body: `null`, expectErr: true},
+		{name: "empty", body: `{}`, expect: repository.Preferences{}},
+		{
+			name:   "success",
+			body:   `{"language": "id", "timezone": null}`,
+			expect: repository.Preferences{"language": json.RawMessage(`"id"`), "timezone": json.RawMessage(`null`)},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := decodePreferences(strings.NewReader(tt.body))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, values)
+		})
+	}
+}
+
+func TestValidatePreferences(t *testing.T) {
+	server := NewServer(NewServerOptions{})
+
+	test := []struct {
+		name   string
+		values repository.Preferences
+		expect []string
+	}{
+		{
+			name: "valid",
+			values: repository.Preferences{
+				"language":      json.RawMessage(`"id"`),
+				"timezone":      json.RawMessage(`null`),
+				"notifications": json.RawMessage(`{"sms": false}`),
+			},
+		},
+		{
+			name: "invalid",
+			values: repository.Preferences{
+				"color":         json.RawMessage(`"red"`),
+				"language":      json.RawMessage(`"fr"`),
+				"notifications": json.RawMessage(`{"fax": true}`),
+				"theme":         json.RawMessage(`null`),
+			},
+			expect: []string{"color:unknown_field", "language:schema", "notifications.fax:schema", "theme:unknown_field"},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, fe := range server.validatePreferences(tt.values) {
+				got = append(got, fe.Field+":"+fe.Rule)
+			}
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func TestWithDefaultPreferences(t *testing.T) {
+	server := NewServer(NewServerOptions{})
+
+	values := server.withDefaultPreferences(repository.Preferences{
+		"language": json.RawMessage(`"id"`),
+		"removed":  json.RawMessage(`true`),
+	})
+	assert.Equal(t, json.RawMessage(`"id"`), values["language"])
+	assert.Equal(t, json.RawMessage(`"UTC"`), values["timezone"])
+	assert.NotContains(t, values, "removed")
+	assert.Len(t, values, 4)
+}
+
+func TestAuditPreferences(t *testing.T) {
+	changes := repository.Preferences{"language": json.RawMessage(`"id"`), "timezone": json.RawMessage(`null`)}
+	assert.Equal(t, map[string]interface{}{"language": "id", "timezone": nil}, auditPreferences(changes, changes))
+	assert.Equal(t, map[string]interface{}{"language": nil, "timezone": nil}, auditPreferences(nil, changes))
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// content type of the JSON merge patch (RFC 7386)
+	MIMEApplicationMergePatchJSON = "application/merge-patch+json"
+
+	HeaderETag = "ETag"
+
+	// profile history pagination
+	profileHistoryDefaultLimit = 20
+	profileHistoryMaxLimit     = 100
+)
+
+// the profile fields which can be read but never be changed by the client
+var profileReadOnlyFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"update_at":  true,
+}
+
+// the optional profile fields which are removed by the null value of the merge patch
+var profileOptionalFields = map[string]bool{
+	"email": true,
+}
+
+// profileChanges contains the profile fields requested to be changed, nil means the field is kept as is
+// while the empty email means the email is removed
+type profileChanges struct {
+	Name  *string
+	Phone *string
+	Email *string
+}
+
+// convert the user into the profile response, the password and the login count are never exposed.
+// update_at is the deprecated alias of updated_at which is kept until the next major version.
+func (s Server) toProfileResponse(user repository.User) generated.Profile {
+	profile := generated.Profile{
+		Id:        user.ID,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		CreatedAt: user.CreatedAt,
+	}
+	if user.Email != "" {
+		email := user.Email
+		profile.Email = &email
+	}
+	if user.EmailVerifiedAt.Valid {
+		verifiedAt := user.EmailVerifiedAt.Time
+		profile.EmailVerifiedAt = &verifiedAt
+	}
+	if user.AvatarKey != "" {
+		avatarURL := s.blobs.URL(avatarBlobKey(user.AvatarKey, avatarSize))
+		thumbnailURL := s.blobs.URL(avatarBlobKey(user.AvatarKey, avatarThumbnailSize))
+		profile.AvatarUrl = &avatarURL
+		profile.AvatarThumbnailUrl = &thumbnailURL
+	}
+	if user.UpdatedAt.Valid {
+		updatedAt := user.UpdatedAt.Time
+		profile.UpdatedAt = &updatedAt
+		profile.UpdateAt = &updatedAt
+	}
+	return profile
+}
+
+// convert the profile history into the response entry
+func toProfileHistoryResponse(h repository.ProfileHistory) generated.ProfileHistoryEntry {
+	return generated.ProfileHistoryEntry{
+		Id:        h.ID,
+		Name:      h.Name,
+		Phone:     h.Phone,
+		ActorId:   h.ActorID,
+		ChangedAt: h.ChangedAt,
+	}
+}
+
+// the strong ETag of the profile, it changes every time the profile is updated
+func profileETag(user repository.User) string {
+	return fmt.Sprintf(`"%d"`, user.Version)
+}
+
+// write the profile response along with its ETag so the client can send it back as If-Match when updating the profile
+func (s Server) writeProfile(ctx echo.Context, user repository.User) error {
+	ctx.Response().Header().Set(HeaderETag, profileETag(user))
+	return ctx.JSON(http.StatusOK, s.toProfileResponse(user))
+}
+
+// check the If-Match header, which may contain a list of ETags, against the current profile version.
+// "*" matches any version and the weak ETags never match as If-Match requires the strong comparison.
+func checkIfMatch(ifMatch string, user repository.User) error {
+	etag := profileETag(user)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return nil
+		}
+	}
+	return errPreconditionFailed
+}
+
+// check whether the request body is a JSON merge patch, the content type parameters such as charset are ignored
+func isMergePatch(ctx echo.Context) bool {
+	mediaType, _, err := mime.ParseMediaType(ctx.Request().Header.Get(echo.HeaderContentType))
+	return err == nil && mediaType == MIMEApplicationMergePatchJSON
+}
+
+// decode the JSON merge patch of the profile. The error is returned when the body is not a JSON object,
+// while the invalid members are returned as the field errors so the client gets all of them at once.
+func decodeProfilePatch(body io.Reader) (changes profileChanges, invalid ValidationErrors, err error) {
+	var members map[string]json.RawMessage
+	err = json.NewDecoder(body).Decode(&members)
+	if err != nil {
+		return
+	}
+	if members == nil {
+		err = errors.New("the merge patch should be a JSON object")
+		return
+	}
+
+	// sort the members so the field errors order is stable
+	fields := make([]string, 0, len(members))
+	for field := range members {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		var target **string
+		switch field {
+		case "name":
+			target = &changes.Name
+		case "phone":
+			target = &changes.Phone
+		case "email":
+			target = &changes.Email
+		default:
+			rule := "unknown_field"
+			if profileReadOnlyFields[field] {
+				rule = "read_only"
+			}
+			invalid = append(invalid, *newFieldError(field, rule, nil))
+			continue
+		}
+
+		// the required fields can not be removed by the null value
+		raw := members[field]
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if profileOptionalFields[field] {
+				removed := ""
+				*target = &removed
+				continue
+			}
+			invalid = append(invalid, *newFieldError(field, "required", nil))
+			continue
+		}
+
+		var value string
+		if json.Unmarshal(raw, &value) != nil {
+			invalid = append(invalid, *newFieldError(field, "type", map[string]interface{}{"type": "string"}))
+			continue
+		}
+		*target = &value
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToProfileResponse(t *testing.T) {
+	var (
+		createdAt = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+		updatedAt = createdAt.Add(time.Hour)
+		email     = "narto@example.com"
+		avatar    = "https://example.com/blobs/avatars/1/abc/512.jpg"
+		thumbnail = "https://example.com/blobs/avatars/1/abc/128.jpg"
+		server    = NewServer(NewServerOptions{BlobStore: FileBlobStore{BaseURL: "https://example.com/blobs"}})
+		user      = repository.User{
+			ID:         1,
+			Name:       "narto",
+			Phone:      "+6281122334455",
+			Password:   "secret",
+			LoginCount: 2,
+			CreatedAt:  createdAt,
+		}
+	)
+
+	test := []struct {
+		name       string
+		updatedAt  sql.NullTime
+		email      string
+		verifiedAt sql.NullTime
+		avatarKey  string
+		expect     generated.Profile
+		expectJSON string
+	}{
+		{
+			name:       "never updated",
+			expect:     generated.Profile{Id: 1, Name: "narto", Phone: "+6281122334455", CreatedAt: createdAt},
+			expectJSON: `{"created_at":"2024-01-02T15:04:05Z","id":1,"name":"narto","phone":"+6281122334455"}`,
+		},
+		{
+			name:       "updated",
+			updatedAt:  sql.NullTime{Time: updatedAt, Valid: true},
+			expect:     generated.Profile{Id: 1, Name: "narto", Phone: "+6281122334455", CreatedAt: createdAt, UpdatedAt: &updatedAt, UpdateAt: &updatedAt},
+			expectJSON: `{"created_at":"2024-01-02T15:04:05Z","id":1,"name":"narto","phone":"+6281122334455","update_at":"2024-01-02T16:04:05Z","updated_at":"2024-01-02T16:04:05Z"}`,
+		},
+		{
+			name:       "verified email",
+			email:      "narto@example.com",
+			verifiedAt: sql.NullTime{Time: updatedAt, Valid: true},
+			expect:     generated.Profile{Id: 1, Name: "narto", Phone: "+6281122334455", Email: &email, EmailVerifiedAt: &updatedAt, CreatedAt: createdAt},
+			expectJSON: `{"created_at":"2024-01-02T15:04:05Z","email":"narto@example.com","email_verified_at":"2024-01-02T16:04:05Z","id":1,"name":"narto","phone":"+6281122334455"}`,
+		},
+		{
+			name:       "avatar",
+			avatarKey:  "avatars/1/abc",
+			expect:     generated.Profile{Id: 1, Name: "narto", Phone: "+6281122334455", AvatarUrl: &avatar, AvatarThumbnailUrl: &thumbnail, CreatedAt: createdAt},
+			expectJSON: `{"avatar_thumbnail_url":"https://example.com/blobs/avatars/1/abc/128.jpg","avatar_url":"https://example.com/blobs/avatars/1/abc/512.jpg","created_at":"2024-01-02T15:04:05Z","id":1,"name":"narto","phone":"+6281122334455"}`,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			u := user
+			u.UpdatedAt = tt.updatedAt
+			u.Email = tt.email
+			u.EmailVerifiedAt = tt.verifiedAt
+			u.AvatarKey = tt.avatarKey
+
+			got := server.toProfileResponse(u)
+			assert.Equal(t, tt.expect, got)
+
+			body, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expectJSON, string(body))
+		})
+	}
+}
+
+func TestDecodeProfilePatch(t *testing.T) {
+	var (
+		name    = "narto"
+		phone   = "081122334455"
+		email   = "Narto@Example.com"
+		removed = ""
+	)
+
+	test := []struct {
+		name          string
+		body          string
+		expect        profileChanges
+		expectInvalid ValidationErrors
+		expectErr     bool
+	}{
+		{
+			name:      "err not json",
+			body:      "asd",
+			expectErr: true,
+		},
+		{
+			name:      "err not object",
+			body:      `"name"`,
+			expectErr: true,
+		},
+		{
+			name:      "err null",
+			body:      `null`,
+			expectErr: true,
+		},
+		{
+			name: "empty patch",
+			body: `{}`,
+		},
+		{
+			name:   "name and phone",
+			body:   `{"name": "narto", "phone": "081122334455"}`,
+			expect: profileChanges{Name: &name, Phone: &phone},
+		},
+		{
+			name:   "email",
+			body:   `{"email": "Narto@Example.com"}`,
+			expect: profileChanges{Email: &email},
+		},
+		{
+			name:   "remove email",
+			body:   `{"email": null}`,
+			expect: profileChanges{Email: &removed},
+		},
+		{
+			name:   "invalid members",
+			body:   `{"name": null, "phone": 62, "id": 2, "password": "secret"}`,
+			expect: profileChanges{},
+			expectInvalid: ValidationErrors{
+				*newFieldError("id", "read_only", nil),
+				*newFieldError("name", "required", nil),
+				*newFieldError("password", "unknown_field", nil),
+				*newFieldError("phone", "type", map[string]interface{}{"type": "string"}),
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, invalid, err := decodeProfilePatch(strings.NewReader(tt.body))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, changes)
+			assert.Equal(t, tt.expectInvalid, invalid)
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	user := repository.User{Version: 2}
+
+	test := []struct {
+		name      string
+		ifMatch   string
+		expectErr error
+	}{
+		{
+			name:    "same version",
+			ifMatch: `"2"`,
+		},
+		{
+			name:    "any version",
+			ifMatch: "*",
+		},
+		{
+			name:    "one of the list",
+			ifMatch: `"1", "2"`,
+		},
+		{
+			name:      "stale version",
+			ifMatch:   `"1"`,
+			expectErr: errPreconditionFailed,
+		},
+		{
+			name:      "weak etag",
+			ifMatch:   `W/"2"`,
+			expectErr: errPreconditionFailed,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectErr, checkIfMatch(tt.ifMatch, user))
+		})
+	}
+}
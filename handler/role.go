@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/permission"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// the echo context key of the user authorized by the Authorize middleware
+	contextKeyAuthorizedUser = "authorized_user"
+)
+
+var (
+	// the role name is used in the token claim, so it is limited to the lower case letters, digits, "-" and "_"
+	roleNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// Authorize is the echo middleware enforcing the permissions declared by the x-permissions extension of the operation
+// in api.yml. The request of the operation declaring the permissions needs a token of the user who has accepted the
+// current terms of service and has been granted every permission. The permissions are read from the roles of the user
+// on every request, so the revoked role takes effect right away even though the token still carries it.
+// The middleware should be registered with echo.Use so it runs after the route has been matched.
+func (s Server) Authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		required := s.permissions.Required(ctx.Request().Method, ctx.Path())
+		if len(required) == 0 {
+			return next(ctx)
+		}
+
+		user, err := s.verifyUser(ctx)
+		if err != nil {
+			return err
+		}
+
+		granted, err := s.grantedPermissions(ctx, user.ID)
+		if err != nil {
+			return errInternal.wrap(err)
+		}
+		if missing := permission.Missing(granted, required); missing != "" {
+			return errForbidden.withDetail("detail.permission-required", map[string]interface{}{"permission": missing})
+		}
+
+		ctx.Set(contextKeyAuthorizedUser, user)
+		return next(ctx)
+	}
+}
+
+// get the user authorized by the Authorize middleware, the request which has not been authorized is forbidden
+// so the operation is never exposed when the middleware is missing
+func (s Server) authorizedUser(ctx echo.Context) (user repository.User, err error) {
+	user, ok := ctx.Get(contextKeyAuthorizedUser).(repository.User)
+	if !ok {
+		return user, errForbidden
+	}
+	return user, nil
+}
+
+// get the permissions granted to the user by the roles, the profiles of AdminIDs are granted every permission
+func (s Server) grantedPermissions(ctx echo.Context, userID int64) ([]string, error) {
+	if s.adminIDs[userID] {
+		return s.permissions.Permissions(), nil
+	}
+	return s.Repository.GetProfilePermissions(ctx.Request().Context(), tenantID(ctx), userID)
+}
+
+// get the names of the roles assigned to the user and the permissions granted to the user,
+// they are put into the issued token so the client knows what the user is allowed to do
+func (s Server) userAccess(ctx echo.Context, userID int64) (roles, permissions []string, err error) {
+	assigned, err := s.Repository.GetProfileRoles(ctx.Request().Context(), tenantID(ctx), userID)
+	if err != nil {
+		return
+	}
+
+	roles = make([]string, 0, len(assigned))
+	for _, role := range assigned {
+		roles = append(roles, role.Name)
+		permissions = append(permissions, role.Permissions...)
+	}
+	if s.adminIDs[userID] {
+		permissions = s.permissions.Permissions()
+	}
+	return roles, uniqueSorted(permissions), nil
+}
+
+// validate the role and make sure every permission is declared by the API operations,
+// the field of the unknown permission is its index in the request, e.g. "permissions[1]"
+func (s Server) validateRole(role repository.Role) error {
+	err := Validate(role)
+	for i, p := range role.Permissions {
+		if !s.permissions.Has(p) {
+			err = withFieldError(err, newFieldError(fmt.Sprintf("permissions[%d]", i), "permission", nil))
+		}
+	}
+	if err != nil {
+		return validationError(err)
+	}
+	return nil
+}
+
+// convert the role request into the role of the id
+func toRole(id int64, req generated.RoleRequest) repository.Role {
+	role := repository.Role{
+		ID:          id,
+		Name:        req.Name,
+		Permissions: req.Permissions,
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	return role
+}
+
+// convert the role into the API response
+func toRoleResponse(role repository.Role) generated.Role {
+	permissions := role.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+	return generated.Role{
+		Id:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt,
+	}
+}
+
+// convert the roles into the API response
+func toRoleListResponse(roles []repository.Role) generated.RoleList {
+	res := generated.RoleList{Roles: make([]generated.Role, 0, len(roles))}
+	for _, role := range roles {
+		res.Roles = append(res.Roles, toRoleResponse(role))
+	}
+	return res
+}
+
+// the role fields recorded in the audit trail
+func auditRole(role repository.Role) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        role.Name,
+		"description": role.Description,
+		"permissions": role.Permissions,
+	}
+}
+
+// sort the values and remove the duplicates, the empty list is returned for no value
+func uniqueSorted(values []string) []string {
+	res := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/permission"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+		admin  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), AdminIDs: []int64{1}})
+	)
+	expectActive(mockRepo)
+	expectTermsAccepted(mockRepo)
+
+	test := []struct {
+		name       string
+		server     *Server
+		method     string
+		path       string
+		token      string
+		expectErr  error
+		expectUser bool
+		mock       func()
+	}{
+		{
+			name:   "success operation without permission",
+			server: server,
+			method: http.MethodGet,
+			path:   "/profile",
+		},
+		{
+			name:      "err invalid token",
+			server:    server,
+			method:    http.MethodGet,
+			path:      "/admin/users",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err get permissions",
+			server:    server,
+			method:    http.MethodGet,
+			path:      "/admin/users",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return(nil, mockErr)
+			},
+		},
+		{
+			name:      "err missing permission",
+			server:    server,
+			method:    http.MethodPut,
+			path:      "/admin/users/:id/roles/:role_id",
+			token:     dummyValidToken,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return([]string{"roles:read", "users:read"}, nil)
+			},
+		},
+		{
+			name:       "success granted by role",
+			server:     server,
+			method:     http.MethodGet,
+			path:       "/admin/users",
+			token:      dummyValidToken,
+			expectUser: true,
+			mock: func() {
+				mockRepo.EXPECT().GetProfilePermissions(any, any, int64(1)).Return([]string{"users:read"}, nil)
+			},
+		},
+		{
+			name:       "success admin",
+			server:     admin,
+			method:     http.MethodDelete,
+			path:       "/admin/roles/:id",
+			token:      dummyValidToken,
+			expectUser: true,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.SetPath(tt.path)
+
+			called := false
+			err := tt.server.Authorize(func(c echo.Context) error {
+				called = true
+				user, err := tt.server.authorizedUser(c)
+				if tt.expectUser {
+					assert.NoError(t, err)
+					assert.Equal(t, int64(1), user.ID)
+				} else {
+					assert.ErrorIs(t, err, errForbidden)
+				}
+				return nil
+			})(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				assert.False(t, called)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, called)
+		})
+	}
+}
+
+func TestAuthorizeRoutes(t *testing.T) {
+	var (
+		e      = echo.New()
+		policy = permission.Default()
+		server = NewServer(NewServerOptions{RSAPrivateKey: getDummyRSAKey(), Permissions: policy})
+	)
+	e.HTTPErrorHandler = ErrorHandler
+	e.Use(server.Authorize)
+	generated.RegisterHandlers(e, server)
+
+	// every admin operation declares its permissions with the route path registered by the generated code
+	var protected int
+	for _, route := range e.Routes() {
+		if !strings.HasPrefix(route.Path, "/admin/") {
+			continue
+		}
+		assert.NotEmpty(t, policy.Required(route.Method, route.Path), route.Method+" "+route.Path)
+		protected++
+	}
+	assert.Equal(t, 15, protected)
+
+	// the request without the token never reaches the handler
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/users", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestUserAccess(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		mockRoles = []repository.Role{
+			{Name: "auditor", Permissions: []string{"users:read", "audit:read"}},
+			{Name: "support", Permissions: []string{"users:read"}},
+		}
+
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+		admin  = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey(), AdminIDs: []int64{1}})
+		c      = echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	)
+	c.Set(contextKeyTenant, repository.Tenant{ID: 2})
+
+	mockRepo.EXPECT().GetProfileRoles(any, int64(2), int64(1)).Return(nil, mockErr)
+	_, _, err := server.userAccess(c, 1)
+	assert.ErrorIs(t, err, mockErr)
+
+	mockRepo.EXPECT().GetProfileRoles(any, int64(2), int64(1)).Return(nil, nil)
+	roles, permissions, err := server.userAccess(c, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, roles)
+	assert.Equal(t, []string{}, permissions)
+
+	mockRepo.EXPECT().GetProfileRoles(any, int64(2), int64(1)).Return(mockRoles, nil)
+	roles, permissions, err = server.userAccess(c, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"auditor", "support"}, roles)
+	assert.Equal(t, []string{"audit:read", "users:read"}, permissions)
+
+	// the admin profile is granted every permission
+	mockRepo.EXPECT().GetProfileRoles(any, int64(2), int64(1)).Return(mockRoles, nil)
+	roles, permissions, err = admin.userAccess(c, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"auditor", "support"}, roles)
+	assert.Equal(t, permission.Default().Permissions(), permissions)
+}
+
+func TestValidateRole(t *testing.T) {
+	server := NewServer(NewServerOptions{RSAPrivateKey: getDummyRSAKey()})
+
+	test := []struct {
+		name         string
+		role         repository.Role
+		expectFields []string
+	}{
+		{name: "err missing name", role: repository.Role{}, expectFields: []string{"name"}},
+		{name: "err invalid name", role: repository.Role{Name: "Support Team"}, expectFields: []string{"name"}},
+		{
+			name:         "err unknown permission",
+			role:         repository.Role{Name: "support", Permissions: []string{"users:read", "users:delete"}},
+			expectFields: []string{"permissions[1]"},
+		},
+		{name: "success without permission", role: repository.Role{Name: "guest"}},
+		{name: "success", role: repository.Role{Name: "support_2", Permissions: []string{"users:read"}}},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.validateRole(tt.role)
+			if tt.expectFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var fields []string
+			var verr *Error
+			if assert.ErrorAs(t, err, &verr) {
+				for _, fe := range verr.Errors {
+					fields = append(fields, fe.Field)
+				}
+			}
+			assert.Equal(t, tt.expectFields, fields)
+		})
+	}
+}
+
+func TestUniqueSorted(t *testing.T) {
+	assert.Equal(t, []string{}, uniqueSorted(nil))
+	assert.Equal(t, []string{"a:b", "c:d"}, uniqueSorted([]string{"c:d", "a:b", "c:d"}))
+}
@@ -2,24 +2,177 @@ package handler
 
 import (
 	"crypto/rsa"
+	"strings"
+	"time"
 
+	"github.com/basriyasin/sp-user/permission"
+	"github.com/basriyasin/sp-user/phone"
+	"github.com/basriyasin/sp-user/preference"
 	"github.com/basriyasin/sp-user/repository"
 )
 
 type Server struct {
 	Repository    repository.RepositoryInterface
 	rsaPrivateKey *rsa.PrivateKey
+	notifier      Notifier
+	otpSender     OTPSender
+	invitations   InvitationSender
+	mailer        Mailer
+	blobs         BlobStore
+	exports       BlobStore
+	exportQueue   chan struct{}
+	publicURL     string
+	defaultTenant string
+	adminIDs      map[int64]bool
+	permissions   *permission.Policy
+	phones        *phone.Numbering
+	preferences   *preference.Registry
+	deletionGrace time.Duration
+	impersonation time.Duration
 }
 
 type NewServerOptions struct {
 	Repository    repository.RepositoryInterface
 	RSAPrivateKey *rsa.PrivateKey
+
+	// Notifier is optional, the events will be written into the application log when it is not provided
+	Notifier Notifier
+
+	// OTPSender is optional, the OTP will be written into the application log when it is not provided
+	OTPSender OTPSender
+
+	// InvitationSender is optional, the organization invitations will be written into the application log when it is not provided
+	InvitationSender InvitationSender
+
+	// Mailer is optional, the emails will be written into the application log when it is not provided
+	Mailer Mailer
+
+	// BlobStore is optional, the uploaded files are written into DefaultBlobDir served under BlobURLPath when it is not provided
+	BlobStore BlobStore
+
+	// ExportStore is optional, the data export archives are written into DefaultExportDir when it is not provided.
+	// The archives are only downloaded through the signed links, so the store should not be publicly served.
+	ExportStore BlobStore
+
+	// Preferences is optional, DefaultPreferences is used when it is not provided. The registry is used as it is,
+	// so it should register the "language" format to only accept the languages of the translated messages.
+	Preferences *preference.Registry
+
+	// DeletionGracePeriod is how long the account deletion can be cancelled before the account is purged,
+	// default is DefaultDeletionGracePeriod
+	DeletionGracePeriod time.Duration
+
+	// ImpersonationTTL is how long the impersonation token issued to the admin can be used, default is DefaultImpersonationTTL
+	ImpersonationTTL time.Duration
+
+	// PublicURL is the base URL of the service used in the links sent to the user, default is "http://localhost:1323"
+	PublicURL string
+
+	// DefaultTenant is the slug of the tenant of the requests which are not resolved to any other tenant by their token,
+	// their X-Tenant header or their host, default is DefaultTenant
+	DefaultTenant string
+
+	// AdminIDs is the list of profile id granted every permission regardless of their roles,
+	// e.g. to assign the first roles
+	AdminIDs []int64
+
+	// Permissions is optional, the permissions declared by the x-permissions extension of api.yml are used when it is not provided
+	Permissions *permission.Policy
+
+	// PhoneCountries is the list of ISO 3166-1 alpha-2 country codes allowed to register, e.g. ["ID", "MY", "SG"].
+	// The first country is used for the phone numbers written in the national format, default is ["ID"].
+	PhoneCountries []string
 }
 
-// create new serer repository and parse the RSA key, it will panic when invalid RSA key provided
+// create new serer repository and parse the RSA key, it will panic when invalid RSA key or unsupported phone country provided
 func NewServer(opts NewServerOptions) *Server {
+	notifier := opts.Notifier
+	if notifier == nil {
+		notifier = logNotifier{}
+	}
+
+	otpSender := opts.OTPSender
+	if otpSender == nil {
+		otpSender = logOTPSender{}
+	}
+
+	invitations := opts.InvitationSender
+	if invitations == nil {
+		invitations = logInvitationSender{}
+	}
+
+	mailer := opts.Mailer
+	if mailer == nil {
+		mailer = logMailer{}
+	}
+
+	publicURL := strings.TrimSuffix(opts.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = defaultPublicURL
+	}
+
+	defaultTenant := opts.DefaultTenant
+	if defaultTenant == "" {
+		defaultTenant = DefaultTenant
+	}
+
+	blobs := opts.BlobStore
+	if blobs == nil {
+		blobs = FileBlobStore{Dir: DefaultBlobDir, BaseURL: publicURL + BlobURLPath}
+	}
+
+	exports := opts.ExportStore
+	if exports == nil {
+		exports = FileBlobStore{Dir: DefaultExportDir}
+	}
+
+	preferences := opts.Preferences
+	if preferences == nil {
+		preferences = DefaultPreferences()
+	}
+
+	deletionGrace := opts.DeletionGracePeriod
+	if deletionGrace <= 0 {
+		deletionGrace = DefaultDeletionGracePeriod
+	}
+
+	impersonationTTL := opts.ImpersonationTTL
+	if impersonationTTL <= 0 {
+		impersonationTTL = DefaultImpersonationTTL
+	}
+
+	permissions := opts.Permissions
+	if permissions == nil {
+		permissions = permission.Default()
+	}
+
+	adminIDs := make(map[int64]bool, len(opts.AdminIDs))
+	for _, id := range opts.AdminIDs {
+		adminIDs[id] = true
+	}
+
+	phones, err := phone.NewNumbering(opts.PhoneCountries...)
+	if err != nil {
+		panic(err)
+	}
+
 	return &Server{
 		Repository:    opts.Repository,
 		rsaPrivateKey: opts.RSAPrivateKey,
+		notifier:      notifier,
+		otpSender:     otpSender,
+		invitations:   invitations,
+		mailer:        mailer,
+		blobs:         blobs,
+		exports:       exports,
+		exportQueue:   make(chan struct{}, 1),
+		publicURL:     publicURL,
+		defaultTenant: defaultTenant,
+		adminIDs:      adminIDs,
+		permissions:   permissions,
+		phones:        phones,
+		preferences:   preferences,
+		deletionGrace: deletionGrace,
+		impersonation: impersonationTTL,
 	}
 }
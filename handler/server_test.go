@@ -34,12 +34,12 @@ func TestNewServer(t *testing.T) {
 	}{
 		{
 			name:      "invalid rsa key",
-			args:      NewServerOptions{mockRepo, nil},
+			args:      NewServerOptions{Repository: mockRepo},
 			expectErr: false,
 		},
 		{
 			name: "success",
-			args: NewServerOptions{mockRepo, nil},
+			args: NewServerOptions{Repository: mockRepo},
 		},
 	}
 
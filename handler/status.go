@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// the maximum length of the reason of the suspended or disabled account
+	statusReasonMaxLength = 256
+)
+
+var (
+	// the statuses the admin can set, the pending deletion is only set by the user deleting the account
+	accountStatuses = []string{
+		repository.ProfileStatusActive,
+		repository.ProfileStatusSuspended,
+		repository.ProfileStatusDisabled,
+	}
+)
+
+// verify the JWT token of the resolved tenant and make sure the account has not been suspended, disabled, scheduled for
+// deletion or purged since the token was issued, so the existing tokens stop working as soon as the account is blocked.
+// The account scheduled for deletion can only be restored by signing in again with POST /profile/deletion/cancel.
+// The impersonation of the impersonation token is kept in the echo context so the actions are recorded with the
+// impersonator as the actor
+func (s Server) verifyAccount(ctx echo.Context) (user repository.User, err error) {
+	claim, err := parseToken(ctx, s.rsaPrivateKey)
+	if err != nil {
+		return user, errForbidden.wrap(err)
+	}
+	user = claim.user()
+
+	// the token of another tenant, or issued before the tenants, never reaches the data of the resolved tenant
+	if claim.TenantID != tenantID(ctx) {
+		return user, errForbidden.withDetail("detail.tenant-mismatch", nil)
+	}
+
+	var imp impersonation
+	if claim.Act != nil {
+		imp, err = s.verifyImpersonation(ctx, claim)
+		if err != nil {
+			return user, err
+		}
+	}
+
+	status, deletionScheduledAt, err := s.Repository.GetProfileStatus(ctx.Request().Context(), tenantID(ctx), user.ID)
+	if err == sql.ErrNoRows {
+		return user, errForbidden.withDetail("detail.profile-not-found", nil)
+	}
+	if err != nil {
+		return user, errInternal.wrap(err)
+	}
+	err = accountStatusError(status)
+	if err != nil {
+		return user, err
+	}
+	if deletionScheduledAt.Valid {
+		return user, pendingDeletionError(deletionScheduledAt.Time)
+	}
+
+	if claim.Act != nil {
+		ctx.Set(contextKeyImpersonation, imp)
+	}
+	return user, nil
+}
+
+// the error of the account which can not sign in or use its tokens because of its status, nil for the active account
+func accountStatusError(status string) error {
+	switch status {
+	case repository.ProfileStatusSuspended:
+		return errAccountSuspended
+	case repository.ProfileStatusDisabled:
+		return errAccountDisabled
+	}
+	return nil
+}
+
+// validate the status requested by the admin, the reason is required unless the account is reactivated
+func validateUserStatus(req generated.UserStatusRequest) error {
+	var invalid ValidationErrors
+	switch req.Status {
+	case "":
+		invalid = append(invalid, *newFieldError("status", "required", nil))
+	case repository.ProfileStatusActive:
+	case repository.ProfileStatusSuspended, repository.ProfileStatusDisabled:
+		if req.Reason == nil || strings.TrimSpace(*req.Reason) == "" {
+			invalid = append(invalid, *newFieldError("reason", "required", nil))
+		}
+	default:
+		invalid = append(invalid, *newFieldError("status", "status", map[string]interface{}{"statuses": strings.Join(accountStatuses, ", ")}))
+	}
+	if req.Reason != nil && len(*req.Reason) > statusReasonMaxLength {
+		invalid = append(invalid, *newFieldError("reason", "max", map[string]interface{}{"max": statusReasonMaxLength}))
+	}
+
+	if len(invalid) > 0 {
+		return validationError(invalid)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// expect the account of every protected endpoint of the test to be active
+func expectActive(mockRepo *repository.MockRepositoryInterface) {
+	mockRepo.EXPECT().GetProfileStatus(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(repository.ProfileStatusActive, sql.NullTime{}, nil).
+		AnyTimes()
+}
+
+func TestVerifyAccount(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+
+		// echo server mock
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name      string
+		token     string
+		tenantID  int64
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err token of another tenant",
+			token:     dummyValidToken,
+			tenantID:  2,
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err profile purged",
+			token:     dummyValidToken,
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return("", sql.NullTime{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get profile status",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return("", sql.NullTime{}, mockErr)
+			},
+		},
+		{
+			name:      "err suspended",
+			token:     dummyValidToken,
+			expectErr: errAccountSuspended,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusSuspended, sql.NullTime{}, nil)
+			},
+		},
+		{
+			name:      "err disabled",
+			token:     dummyValidToken,
+			expectErr: errAccountDisabled,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusDisabled, sql.NullTime{}, nil)
+			},
+		},
+		{
+			name:      "err pending deletion",
+			token:     dummyValidToken,
+			expectErr: errPendingDeletion,
+			mock: func() {
+				scheduled := sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, scheduled, nil)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			mock: func() {
+				mockRepo.EXPECT().GetProfileStatus(any, any, int64(1)).Return(repository.ProfileStatusActive, sql.NullTime{}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			c := e.NewContext(req, httptest.NewRecorder())
+			c.Set(contextKeyTenant, repository.Tenant{ID: tt.tenantID})
+			user, err := server.verifyAccount(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), user.ID)
+		})
+	}
+}
+
+func TestValidateUserStatus(t *testing.T) {
+	reason := func(r string) *string { return &r }
+
+	test := []struct {
+		name         string
+		req          generated.UserStatusRequest
+		expectFields []string
+	}{
+		{name: "err missing status", req: generated.UserStatusRequest{}, expectFields: []string{"status"}},
+		{name: "err unknown status", req: generated.UserStatusRequest{Status: repository.ProfileStatusPendingDeletion}, expectFields: []string{"status"}},
+		{name: "err missing reason", req: generated.UserStatusRequest{Status: repository.ProfileStatusSuspended}, expectFields: []string{"reason"}},
+		{name: "err blank reason", req: generated.UserStatusRequest{Status: repository.ProfileStatusDisabled, Reason: reason(" ")}, expectFields: []string{"reason"}},
+		{
+			name:         "err reason too long",
+			req:          generated.UserStatusRequest{Status: repository.ProfileStatusSuspended, Reason: reason(strings.Repeat("a", statusReasonMaxLength+1))},
+			expectFields: []string{"reason"},
+		},
+		{name: "success reactivate", req: generated.UserStatusRequest{Status: repository.ProfileStatusActive}},
+		{name: "success", req: generated.UserStatusRequest{Status: repository.ProfileStatusSuspended, Reason: reason("spam")}},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUserStatus(tt.req)
+			if tt.expectFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verr *Error
+			if assert.True(t, errors.As(err, &verr)) {
+				var fields []string
+				for _, fe := range verr.Errors {
+					fields = append(fields, fe.Field)
+				}
+				assert.Equal(t, tt.expectFields, fields)
+			}
+		})
+	}
+}
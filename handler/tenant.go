@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"database/sql"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// DefaultTenant is the slug of the tenant of the requests which are not resolved to any other tenant
+	DefaultTenant = "default"
+
+	// HeaderTenant is the slug of the tenant of the request which is not sent to the host of the tenant
+	HeaderTenant = "X-Tenant"
+
+	// the query parameter of the tenant slug in the links sent to the user, as the links can not have the header
+	queryTenant = "tenant"
+
+	// the echo context key of the tenant resolved by the ResolveTenant middleware
+	contextKeyTenant = "tenant"
+)
+
+// ResolveTenant is the echo middleware resolving the tenant of the request, every data read or changed by the request
+// belongs to the resolved tenant. The tenant is resolved from the tenant id of the bearer token, the slug of the
+// X-Tenant header (or the tenant query parameter of the links) and the host of the request, the request whose token,
+// slug and host belong to different tenants is forbidden. The request resolved to none of them belongs to the
+// default tenant. The middleware should be registered with echo.Use before the Authorize middleware.
+func (s Server) ResolveTenant(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		tenant, err := s.resolveTenant(ctx)
+		if err != nil {
+			return err
+		}
+
+		ctx.Set(contextKeyTenant, tenant)
+		return next(ctx)
+	}
+}
+
+// resolve the tenant of the request from its token, its slug and its host
+func (s Server) resolveTenant(ctx echo.Context) (tenant repository.Tenant, err error) {
+	c := ctx.Request().Context()
+
+	slug := ctx.Request().Header.Get(HeaderTenant)
+	if slug == "" {
+		slug = ctx.QueryParam(queryTenant)
+	}
+	if slug != "" {
+		tenant, err = s.Repository.GetTenantBySlug(c, slug)
+		if err == sql.ErrNoRows {
+			return tenant, errInvalidRequest.withDetail("detail.tenant-not-found", map[string]interface{}{"tenant": slug})
+		}
+		if err != nil {
+			return tenant, errInternal.wrap(err)
+		}
+	}
+
+	if host := requestHost(ctx); host != "" {
+		served, err := s.Repository.GetTenantByHost(c, host)
+		if err != nil && err != sql.ErrNoRows {
+			return tenant, errInternal.wrap(err)
+		}
+		if err == nil {
+			if tenant.ID != 0 && tenant.ID != served.ID {
+				return tenant, errForbidden.withDetail("detail.tenant-mismatch", nil)
+			}
+			tenant = served
+		}
+	}
+
+	// the tenant of the token is only checked here, the invalid token is rejected by the operations requiring it
+	if claim, parseErr := parseToken(ctx, s.rsaPrivateKey); parseErr == nil && claim.TenantID != 0 {
+		if tenant.ID != 0 && tenant.ID != claim.TenantID {
+			return tenant, errForbidden.withDetail("detail.tenant-mismatch", nil)
+		}
+		if tenant.ID == 0 {
+			tenant, err = s.Repository.GetTenant(c, claim.TenantID)
+			if err == sql.ErrNoRows {
+				return tenant, errForbidden.withDetail("detail.tenant-mismatch", nil)
+			}
+			if err != nil {
+				return tenant, errInternal.wrap(err)
+			}
+		}
+	}
+
+	if tenant.ID != 0 {
+		return tenant, nil
+	}
+	tenant, err = s.Repository.GetTenantBySlug(c, s.defaultTenant)
+	if err == sql.ErrNoRows {
+		return tenant, errInvalidRequest.withDetail("detail.tenant-required", map[string]interface{}{"header": HeaderTenant})
+	}
+	if err != nil {
+		return tenant, errInternal.wrap(err)
+	}
+	return tenant, nil
+}
+
+// the lower cased host of the request without the port
+func requestHost(ctx echo.Context) string {
+	host := ctx.Request().Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// get the tenant resolved by the ResolveTenant middleware, the zero tenant owning no data is returned when the
+// middleware is missing so the request never reads or changes the data of any tenant
+func tenantOf(ctx echo.Context) repository.Tenant {
+	tenant, _ := ctx.Get(contextKeyTenant).(repository.Tenant)
+	return tenant
+}
+
+// get the id of the tenant resolved by the ResolveTenant middleware
+func tenantID(ctx echo.Context) int64 {
+	return tenantOf(ctx).ID
+}
+
+// the link of the path sent to the user of the tenant, the link is on the host of the tenant when it has one,
+// otherwise it is on PublicURL with the tenant slug in the query
+func (s Server) tenantLink(tenant repository.Tenant, path string, query url.Values) string {
+	base := s.publicURL
+	if tenant.Host != "" {
+		scheme := "https"
+		if u, err := url.Parse(s.publicURL); err == nil && u.Scheme != "" {
+			scheme = u.Scheme
+		}
+		base = scheme + "://" + tenant.Host
+	} else if tenant.Slug != "" {
+		query.Set(queryTenant, tenant.Slug)
+	}
+	return base + path + "?" + query.Encode()
+}
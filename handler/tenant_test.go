@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveTenant(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any     = gomock.Any()
+		mockErr = errors.New("an error")
+		acme    = repository.Tenant{ID: 2, Slug: "acme"}
+		brand   = repository.Tenant{ID: 3, Slug: "brand", Host: "brand.example.com"}
+
+		// echo server mock
+		e      = echo.New()
+		key    = getDummyRSAKey()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: key})
+	)
+
+	// the bearer token of the user of the tenant
+	tokenOf := func(tenantID int64) string {
+		token, err := generateToken(key, tenantID, repository.User{ID: 1}, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	test := []struct {
+		name         string
+		target       string
+		header       string
+		token        string
+		expectErr    error
+		expectTenant int64
+		mock         func()
+	}{
+		{
+			name:      "err tenant not found",
+			target:    "http://example.com/profile",
+			header:    "unknown",
+			expectErr: errInvalidRequest,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "unknown").Return(repository.Tenant{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get tenant by slug",
+			target:    "http://example.com/profile",
+			header:    "acme",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "acme").Return(repository.Tenant{}, mockErr)
+			},
+		},
+		{
+			name:      "err get tenant by host",
+			target:    "http://example.com/profile",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, mockErr)
+			},
+		},
+		{
+			name:      "err slug of another tenant than the host",
+			target:    "http://brand.example.com/profile",
+			header:    "acme",
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "acme").Return(acme, nil)
+				mockRepo.EXPECT().GetTenantByHost(any, "brand.example.com").Return(brand, nil)
+			},
+		},
+		{
+			name:      "err token of another tenant than the host",
+			target:    "http://brand.example.com/profile",
+			token:     tokenOf(acme.ID),
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "brand.example.com").Return(brand, nil)
+			},
+		},
+		{
+			name:      "err token of another tenant than the slug",
+			target:    "http://example.com/profile",
+			header:    "brand",
+			token:     tokenOf(acme.ID),
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "brand").Return(brand, nil)
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err token of a deleted tenant",
+			target:    "http://example.com/profile",
+			token:     tokenOf(4),
+			expectErr: errForbidden,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetTenant(any, int64(4)).Return(repository.Tenant{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get tenant of the token",
+			target:    "http://example.com/profile",
+			token:     tokenOf(acme.ID),
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetTenant(any, acme.ID).Return(repository.Tenant{}, mockErr)
+			},
+		},
+		{
+			name:      "err tenant required",
+			target:    "http://example.com/profile",
+			expectErr: errInvalidRequest,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetTenantBySlug(any, DefaultTenant).Return(repository.Tenant{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "err get default tenant",
+			target:    "http://example.com/profile",
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetTenantBySlug(any, DefaultTenant).Return(repository.Tenant{}, mockErr)
+			},
+		},
+		{
+			name:         "success header",
+			target:       "http://example.com/profile",
+			header:       "acme",
+			token:        tokenOf(acme.ID),
+			expectTenant: acme.ID,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "acme").Return(acme, nil)
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:         "success query",
+			target:       "http://example.com/email/verify?tenant=acme",
+			expectTenant: acme.ID,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "acme").Return(acme, nil)
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:         "success host",
+			target:       "http://Brand.Example.com:8080/profile",
+			header:       "brand",
+			token:        tokenOf(brand.ID),
+			expectTenant: brand.ID,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantBySlug(any, "brand").Return(brand, nil)
+				mockRepo.EXPECT().GetTenantByHost(any, "brand.example.com").Return(brand, nil)
+			},
+		},
+		{
+			name:         "success token",
+			target:       "http://example.com/profile",
+			token:        tokenOf(acme.ID),
+			expectTenant: acme.ID,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetTenant(any, acme.ID).Return(acme, nil)
+			},
+		},
+		{
+			name:         "success default tenant",
+			target:       "http://example.com/profile",
+			token:        dummyValidToken,
+			expectTenant: 1,
+			mock: func() {
+				mockRepo.EXPECT().GetTenantByHost(any, "example.com").Return(repository.Tenant{}, sql.ErrNoRows)
+				mockRepo.EXPECT().GetTenantBySlug(any, DefaultTenant).Return(repository.Tenant{ID: 1, Slug: DefaultTenant}, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set(HeaderTenant, tt.header)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			var resolved int64
+			err := server.ResolveTenant(func(ctx echo.Context) error {
+				resolved = tenantID(ctx)
+				return nil
+			})(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				assert.Zero(t, resolved)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectTenant, resolved)
+		})
+	}
+}
+
+func TestTenantLink(t *testing.T) {
+	test := []struct {
+		name      string
+		publicURL string
+		tenant    repository.Tenant
+		expect    string
+	}{
+		{
+			name:      "tenant host",
+			publicURL: "https://user.example.com",
+			tenant:    repository.Tenant{ID: 2, Slug: "brand", Host: "brand.example.com"},
+			expect:    "https://brand.example.com/email/verify?token=abc",
+		},
+		{
+			name:      "tenant slug",
+			publicURL: "http://localhost:1323",
+			tenant:    repository.Tenant{ID: 2, Slug: "acme"},
+			expect:    "http://localhost:1323/email/verify?tenant=acme&token=abc",
+		},
+		{
+			name:      "no tenant",
+			publicURL: "http://localhost:1323",
+			expect:    "http://localhost:1323/email/verify?token=abc",
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			server := Server{publicURL: tt.publicURL}
+			link := server.tenantLink(tt.tenant, "/email/verify", url.Values{"token": {"abc"}})
+			assert.Equal(t, tt.expect, link)
+		})
+	}
+}
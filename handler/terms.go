@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/basriyasin/sp-user/generated"
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// verify the JWT token of the active account and make sure the user has accepted the current version of the terms of service,
+// every endpoint of the signed in user uses it except the ones which have to work without the acceptance,
+// e.g. accepting the terms of service or deleting the account
+func (s Server) verifyUser(ctx echo.Context) (user repository.User, err error) {
+	user, err = s.verifyAccount(ctx)
+	if err != nil {
+		return user, err
+	}
+
+	terms, accepted, err := s.Repository.GetTermsAcceptance(ctx.Request().Context(), tenantID(ctx), user.ID, time.Now().UTC())
+	if err == sql.ErrNoRows {
+		// no terms of service have been published yet
+		return user, nil
+	}
+	if err != nil {
+		return user, errInternal.wrap(err)
+	}
+	if !accepted {
+		return user, errTermsRequired.withDetail("detail.terms-acceptance-required", map[string]interface{}{
+			"version": terms.Version,
+			"url":     terms.URL,
+		})
+	}
+
+	return user, nil
+}
+
+// get the current terms of service and check the accepted version of the request against it,
+// the field error is returned when the version is missing or is not the current one.
+// The empty terms is returned without the field error when no version has been published yet.
+func (s Server) checkTermsVersion(ctx echo.Context, field string, version *string) (terms repository.TermsVersion, fe *FieldError, err error) {
+	terms, err = s.Repository.GetCurrentTerms(ctx.Request().Context(), tenantID(ctx), time.Now().UTC())
+	if err == sql.ErrNoRows {
+		return terms, nil, nil
+	}
+	if err != nil {
+		return terms, nil, errInternal.wrap(err)
+	}
+
+	if version == nil || *version == "" {
+		return terms, newFieldError(field, "required", nil), nil
+	}
+	if *version != terms.Version {
+		return terms, newFieldError(field, "current_terms", map[string]interface{}{"version": terms.Version}), nil
+	}
+	return terms, nil, nil
+}
+
+// record the acceptance of the terms of service version by the user together with the client it was accepted from
+func (s Server) saveConsent(ctx echo.Context, profileID int64, version string) (consent repository.Consent, err error) {
+	consent, err = s.Repository.SaveConsent(ctx.Request().Context(), tenantID(ctx), newConsent(ctx, profileID, version))
+	if err != nil {
+		return consent, errInternal.wrap(err)
+	}
+	return consent, nil
+}
+
+// the acceptance of the terms of service version by the user from the client of the request
+func newConsent(ctx echo.Context, profileID int64, version string) repository.Consent {
+	return repository.Consent{
+		ProfileID:    profileID,
+		TermsVersion: version,
+		IPAddress:    ctx.RealIP(),
+		UserAgent:    ctx.Request().UserAgent(),
+	}
+}
+
+// convert the terms of service version into the API response
+func toTermsResponse(terms repository.TermsVersion) generated.Terms {
+	return generated.Terms{
+		Version:     terms.Version,
+		Url:         terms.URL,
+		PublishedAt: terms.PublishedAt,
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/basriyasin/sp-user/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// expect the current terms of service to have been accepted by the user of every protected endpoint of the test
+func expectTermsAccepted(mockRepo *repository.MockRepositoryInterface) {
+	mockRepo.EXPECT().GetTermsAcceptance(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(repository.TermsVersion{Version: "2024-01"}, true, nil).
+		AnyTimes()
+}
+
+func TestVerifyUser(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		mockTerms = repository.TermsVersion{Version: "2024-01", URL: "https://example.com/terms", PublishedAt: time.Now()}
+
+		// echo server mock
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	expectActive(mockRepo)
+
+	test := []struct {
+		name      string
+		token     string
+		expectErr error
+		mock      func()
+	}{
+		{
+			name:      "err invalid token",
+			token:     "Invalid",
+			expectErr: errForbidden,
+		},
+		{
+			name:      "err get terms acceptance",
+			token:     dummyValidToken,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetTermsAcceptance(any, any, int64(1), any).Return(repository.TermsVersion{}, false, mockErr)
+			},
+		},
+		{
+			name:      "err terms not accepted",
+			token:     dummyValidToken,
+			expectErr: errTermsRequired,
+			mock: func() {
+				mockRepo.EXPECT().GetTermsAcceptance(any, any, int64(1), any).Return(mockTerms, false, nil)
+			},
+		},
+		{
+			name:  "success no terms published",
+			token: dummyValidToken,
+			mock: func() {
+				mockRepo.EXPECT().GetTermsAcceptance(any, any, int64(1), any).Return(repository.TermsVersion{}, false, sql.ErrNoRows)
+			},
+		},
+		{
+			name:  "success",
+			token: dummyValidToken,
+			mock: func() {
+				mockRepo.EXPECT().GetTermsAcceptance(any, any, int64(1), any).Return(mockTerms, true, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.token)
+			c := e.NewContext(req, httptest.NewRecorder())
+			user, err := server.verifyUser(c)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), user.ID)
+		})
+	}
+
+	// the client is told which version to accept
+	mockRepo.EXPECT().GetTermsAcceptance(any, any, any, any).Return(mockTerms, false, nil)
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req.Header.Set(echo.HeaderAuthorization, dummyValidToken)
+	_, err := server.verifyUser(e.NewContext(req, httptest.NewRecorder()))
+
+	var terr *Error
+	if assert.True(t, errors.As(err, &terr)) {
+		assert.Equal(t, http.StatusForbidden, terr.Status)
+		assert.Equal(t, map[string]interface{}{"version": mockTerms.Version, "url": mockTerms.URL}, terr.DetailParams)
+	}
+}
+
+func TestCheckTermsVersion(t *testing.T) {
+	var (
+		// dependencies mock
+		ctrl     = gomock.NewController(t)
+		mockRepo = repository.NewMockRepositoryInterface(ctrl)
+
+		// request and response mock
+		any       = gomock.Any()
+		mockErr   = errors.New("an error")
+		mockTerms = repository.TermsVersion{Version: "2024-01", URL: "https://example.com/terms", PublishedAt: time.Now()}
+		current   = "2024-01"
+		previous  = "2023-01"
+
+		// echo server mock
+		e      = echo.New()
+		server = NewServer(NewServerOptions{Repository: mockRepo, RSAPrivateKey: getDummyRSAKey()})
+	)
+
+	test := []struct {
+		name          string
+		version       *string
+		expectErr     error
+		expectRule    string
+		expectVersion string
+		mock          func()
+	}{
+		{
+			name:      "err get current terms",
+			version:   &current,
+			expectErr: errInternal,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, mockErr)
+			},
+		},
+		{
+			name: "no terms published",
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(repository.TermsVersion{}, sql.ErrNoRows)
+			},
+		},
+		{
+			name:          "missing version",
+			expectRule:    "required",
+			expectVersion: current,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+		{
+			name:          "previous version",
+			version:       &previous,
+			expectRule:    "current_terms",
+			expectVersion: current,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+		{
+			name:          "current version",
+			version:       &current,
+			expectVersion: current,
+			mock: func() {
+				mockRepo.EXPECT().GetCurrentTerms(any, any, any).Return(mockTerms, nil)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			c := e.NewContext(httptest.NewRequest(http.MethodPost, "/register", nil), httptest.NewRecorder())
+			terms, fe, err := server.checkTermsVersion(c, "terms_version", tt.version)
+
+			if tt.expectErr != nil {
+				assert.ErrorIs(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectVersion, terms.Version)
+			if tt.expectRule == "" {
+				assert.Nil(t, fe)
+				return
+			}
+			if assert.NotNil(t, fe) {
+				assert.Equal(t, "terms_version", fe.Field)
+				assert.Equal(t, tt.expectRule, fe.Rule)
+			}
+		})
+	}
+}
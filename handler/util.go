@@ -1,14 +1,15 @@
 package handler
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"regexp"
-	"strings"
 	"unicode"
+
+	"github.com/basriyasin/sp-user/phone"
 )
 
 const (
-	phonePrefix = "+62"
-
 	// name length
 	nameMinLength = 3
 	nameMaxLength = 60
@@ -16,13 +17,6 @@ const (
 	// password length
 	passwordMinLength = 6
 	passwordMaxLenght = 64
-
-	// phone length
-	phoneMinLength = 10
-	phoneMaxLength = 13
-
-	// default date format
-	DateTimeFormat string = "2015-09-02 08:04:00"
 )
 const ()
 
@@ -41,22 +35,9 @@ func isValidName(name string) bool {
 	return nameRegex.MatchString(name)
 }
 
-// Validate the user's phone number and return true if the phone number passes validation.
-func isValidPhone(phone string) bool {
-	length := len(phone)
-	if length < phoneMinLength+1 || length > phoneMaxLength+1 {
-		return false
-	}
-	for _, char := range phone {
-		switch {
-		case unicode.IsNumber(char), char == '+':
-			continue
-		default:
-			return false
-		}
-	}
-
-	return strings.HasPrefix(phone, phonePrefix)
+// Validate the user's phone number and return true if the phone number is in E.164 format of a supported country.
+func isValidPhone(number string) bool {
+	return phone.IsValid(number)
 }
 
 // Validate the user's password and return true if the password passes validation.
@@ -84,3 +65,13 @@ func isValidPassword(pass string) bool {
 
 	return hasUpper && hasLower && hasNumber && hasSpecial
 }
+
+// generate a random hex id which can not be guessed, e.g. the id of the email verification or the avatar
+func generateRandomID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
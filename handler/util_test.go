@@ -79,8 +79,8 @@ func TestIsValidPhone(t *testing.T) {
 			isValid: false,
 		},
 		{
-			name:    "14 character",
-			args:    "+62811223344556",
+			name:    "15 digits",
+			args:    "+628112233445566",
 			isValid: false,
 		},
 		{
@@ -93,11 +93,26 @@ func TestIsValidPhone(t *testing.T) {
 			args:    "+61811223344",
 			isValid: false,
 		},
+		{
+			name:    "national format",
+			args:    "0811223344",
+			isValid: false,
+		},
 		{
 			name:    "correct phone",
 			args:    "+62811223344",
 			isValid: true,
 		},
+		{
+			name:    "correct malaysia phone",
+			args:    "+60123456789",
+			isValid: true,
+		},
+		{
+			name:    "correct singapore phone",
+			args:    "+6581234567",
+			isValid: true,
+		},
 	}
 
 	for _, tt := range test {
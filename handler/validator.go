@@ -1,52 +1,124 @@
 package handler
 
 import (
-	"errors"
-	"fmt"
+	"reflect"
 	"strings"
 
+	"github.com/basriyasin/sp-user/i18n"
 	"gopkg.in/go-playground/validator.v9"
 )
 
-var validate *validator.Validate
+var (
+	validate *validator.Validate
+
+	// the localized client messages
+	catalog = i18n.Default()
+)
+
+type (
+	// FieldError describe a single field which fails the validation rule,
+	// the field is the JSON field name so the client can map it to the request payload.
+	FieldError struct {
+		Field   string                 `json:"field"`
+		Rule    string                 `json:"rule"`
+		Message string                 `json:"message"`
+		Params  map[string]interface{} `json:"params,omitempty"`
+	}
+
+	// ValidationErrors is returned by Validate when one or more fields are invalid
+	ValidationErrors []FieldError
+)
 
 func init() {
 	validate = validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
 	validate.RegisterValidation("name", validateName)
 	validate.RegisterValidation("phone", validatePhone)
 	validate.RegisterValidation("password", validatePassword)
+	validate.RegisterValidation("role_name", validateRoleName)
 }
 
-// Validate the struct with the given tags on its fields and return an error for each field.
+// join all the field error messages
+func (v ValidationErrors) Error() string {
+	msg := make([]string, 0, len(v))
+	for _, e := range v {
+		msg = append(msg, e.Message)
+	}
+	return strings.Join(msg, " | ")
+}
+
+// Validate the struct with the given tags on its fields and return ValidationErrors containing an error for each field.
 func Validate(s interface{}) (err error) {
-	err = validate.Struct(s)
+	return toValidationErrors(validate.Struct(s))
+}
+
+// ValidatePartial validate only the given struct fields, the fields are the Go struct field names.
+func ValidatePartial(s interface{}, fields ...string) (err error) {
+	return toValidationErrors(validate.StructPartial(s, fields...))
+}
+
+// replace the validator error with the field errors containing custom error message
+func toValidationErrors(err error) error {
 	if err == nil {
 		return nil
 	}
 
-	//replace error message with custom error message
-	verr, _ := err.(validator.ValidationErrors)
-	var msg []string
+	verr, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	res := make(ValidationErrors, 0, len(verr))
 	for _, e := range verr {
-		switch e.Tag() {
-		case "required":
-			msg = append(msg, fmt.Sprintf("'%s' is required", e.Field()))
-		case "min":
-			msg = append(msg, fmt.Sprintf("'%s' should be minimum %s", e.Field(), e.Param()))
-		case "max":
-			msg = append(msg, fmt.Sprintf("'%s' should be maximum %s", e.Field(), e.Param()))
-		case "name":
-			msg = append(msg, fmt.Sprintf("'%s' should have at lease have %d and max %d alpha character", e.Field(), nameMinLength, nameMaxLength))
-		case "phone":
-			msg = append(msg, fmt.Sprintf("'%s' should have start with %s, have min %d and max %d character ", e.Field(), phonePrefix, phoneMinLength, phoneMaxLength))
-		case "password":
-			msg = append(msg, fmt.Sprintf("'%s' should contain at lease 1 lower case, 1 upper case and 1 special character", e.Field()))
-		default:
-			msg = append(msg, fmt.Sprintf("'%s' error", e.Field()))
-		}
+		res = append(res, toFieldError(e))
+	}
+	return res
+}
+
+// convert the validator field error into field error with the message in the default language
+func toFieldError(e validator.FieldError) FieldError {
+	fe := FieldError{
+		Field: e.Field(),
+		Rule:  e.Tag(),
+	}
+
+	switch e.Tag() {
+	case "min":
+		fe.Params = map[string]interface{}{"min": e.Param()}
+	case "max":
+		fe.Params = map[string]interface{}{"max": e.Param()}
+	case "name":
+		fe.Params = map[string]interface{}{"min": nameMinLength, "max": nameMaxLength}
+	case "password":
+		fe.Params = map[string]interface{}{"min": passwordMinLength, "max": passwordMaxLenght}
 	}
 
-	return errors.New(strings.Join(msg, " | "))
+	fe.Message = fe.localize(i18n.DefaultLanguage)
+	return fe
+}
+
+// render the field error message in the given language, unknown rule uses the default validation message
+func (fe FieldError) localize(lang string) string {
+	key := "validation." + fe.Rule
+	if !catalog.Has(key) {
+		key = "validation.default"
+	}
+
+	params := make(map[string]interface{}, len(fe.Params)+1)
+	for k, v := range fe.Params {
+		params[k] = v
+	}
+	params["field"] = fe.Field
+	return catalog.Message(lang, key, params)
+}
+
+// use the JSON field name in the validation errors, fallback to the struct field name
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
 }
 
 // custom validator for 'name' tag
@@ -59,6 +131,11 @@ func validatePhone(fl validator.FieldLevel) bool {
 	return isValidPhone(fl.Field().String())
 }
 
+// custom validator for 'role_name' tag
+func validateRoleName(fl validator.FieldLevel) bool {
+	return roleNameRegex.MatchString(fl.Field().String())
+}
+
 // custom validator for 'passowrd' tag
 func validatePassword(fl validator.FieldLevel) bool {
 	return isValidPassword(fl.Field().String())
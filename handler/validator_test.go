@@ -29,6 +29,10 @@ func TestValidate(t *testing.T) {
 	type exampleUnexpected struct {
 		Val string `validate:"unknown"`
 	}
+	type exampleJSON struct {
+		Name    string `json:"full_name,omitempty" validate:"required"`
+		Ignored string `json:"-" validate:"required"`
+	}
 
 	validate.RegisterAlias("unknown", "password")
 
@@ -40,37 +44,69 @@ func TestValidate(t *testing.T) {
 		{
 			name: "err required",
 			args: exampleRequired{},
-			err:  fmt.Errorf("'Val' is required"),
+			err:  ValidationErrors{{Field: "Val", Rule: "required", Message: "'Val' is required"}},
 		},
 		{
 			name: "err min=3",
 			args: exampleMin{Val: "1"},
-			err:  fmt.Errorf("'Val' should be minimum 3"),
+			err: ValidationErrors{{
+				Field:   "Val",
+				Rule:    "min",
+				Message: "'Val' should be at least 3 characters",
+				Params:  map[string]interface{}{"min": "3"},
+			}},
 		},
 		{
 			name: "err max=5",
 			args: exampleMax{Val: "123456"},
-			err:  fmt.Errorf("'Val' should be maximum 5"),
+			err: ValidationErrors{{
+				Field:   "Val",
+				Rule:    "max",
+				Message: "'Val' should be at most 5 characters",
+				Params:  map[string]interface{}{"max": "5"},
+			}},
 		},
 		{
 			name: "err name",
 			args: exampleName{Val: "123"},
-			err:  fmt.Errorf("'Val' should have at lease have %d and max %d alpha character", nameMinLength, nameMaxLength),
+			err: ValidationErrors{{
+				Field:   "Val",
+				Rule:    "name",
+				Message: fmt.Sprintf("'Val' should have %d to %d characters containing at least %d letters", nameMinLength, nameMaxLength, nameMinLength),
+				Params:  map[string]interface{}{"min": nameMinLength, "max": nameMaxLength},
+			}},
 		},
 		{
 			name: "err phone",
 			args: examplePhone{Val: "+6082211223344"},
-			err:  fmt.Errorf("'Val' should have start with %s, have min %d and max %d character ", phonePrefix, phoneMinLength, phoneMaxLength),
+			err: ValidationErrors{{
+				Field:   "Val",
+				Rule:    "phone",
+				Message: "'Val' should be a valid phone number, e.g. +6281234567890 or 081234567890",
+			}},
 		},
 		{
 			name: "err password",
 			args: examplePassword{Val: "abcd"},
-			err:  fmt.Errorf("'Val' should contain at lease 1 lower case, 1 upper case and 1 special character"),
+			err: ValidationErrors{{
+				Field:   "Val",
+				Rule:    "password",
+				Message: fmt.Sprintf("'Val' should have %d to %d characters containing at least 1 upper case letter, 1 number and 1 special character", passwordMinLength, passwordMaxLenght),
+				Params:  map[string]interface{}{"min": passwordMinLength, "max": passwordMaxLenght},
+			}},
 		},
 		{
 			name: "unexpeced err",
 			args: exampleUnexpected{Val: "unex"},
-			err:  fmt.Errorf("'Val' error"),
+			err:  ValidationErrors{{Field: "Val", Rule: "unknown", Message: "'Val' is invalid"}},
+		},
+		{
+			name: "json field name",
+			args: exampleJSON{},
+			err: ValidationErrors{
+				{Field: "full_name", Rule: "required", Message: "'full_name' is required"},
+				{Field: "Ignored", Rule: "required", Message: "'Ignored' is required"},
+			},
 		},
 		{
 			name: "err password",
@@ -86,3 +122,34 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestValidatePartial(t *testing.T) {
+	type example struct {
+		Name  string `json:"name" validate:"required,name"`
+		Phone string `json:"phone" validate:"required,phone"`
+	}
+
+	err := ValidatePartial(example{Name: "narto"}, "Name")
+	assert.Equal(t, nil, err)
+
+	err = ValidatePartial(example{Name: "narto", Phone: "+12233"}, "Name", "Phone")
+	verr, ok := err.(ValidationErrors)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, len(verr))
+	assert.Equal(t, "phone", verr[0].Field)
+	assert.Equal(t, "phone", verr[0].Rule)
+}
+
+func TestValidationErrorsError(t *testing.T) {
+	err := ValidationErrors{{Message: "'name' is required"}, {Message: "'phone' is required"}}
+	assert.Equal(t, "'name' is required | 'phone' is required", err.Error())
+}
+
+func TestFieldErrorLocalize(t *testing.T) {
+	fe := FieldError{Field: "name", Rule: "min", Params: map[string]interface{}{"min": "3"}}
+	assert.Equal(t, "'name' should be at least 3 characters", fe.localize("en"))
+	assert.Equal(t, "'name' minimal 3 karakter", fe.localize("id"))
+
+	fe = FieldError{Field: "name", Rule: "unknown"}
+	assert.Equal(t, "'name' tidak valid", fe.localize("id"))
+}
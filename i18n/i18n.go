@@ -0,0 +1,139 @@
+// Package i18n contains the localized messages shown to the client.
+// The messages are loaded from the embedded locales directory, one JSON file per language
+// named after the language tag (e.g. "id.json"), so a new language can be added without code changes.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	// DefaultLanguage is used when the client does not accept any supported language
+	DefaultLanguage = "en"
+
+	localesDir = "locales"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Catalog holds the messages of every supported language
+type Catalog struct {
+	fallback  string
+	languages []string
+	messages  map[string]map[string]string
+	matcher   language.Matcher
+}
+
+// Default returns the catalog loaded from the embedded locales, it panics when the embedded files are invalid
+func Default() *Catalog {
+	sub, err := fs.Sub(locales, localesDir)
+	if err != nil {
+		panic(err)
+	}
+
+	catalog, err := Load(sub, DefaultLanguage)
+	if err != nil {
+		panic(err)
+	}
+	return catalog
+}
+
+// Load the catalog from every "<language>.json" file in the root of the given file system,
+// the fallback language is used for the unsupported language and the missing messages.
+func Load(fsys fs.FS, fallback string) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		fallback: fallback,
+		messages: make(map[string]map[string]string, len(files)),
+	}
+	for _, file := range files {
+		lang := strings.TrimSuffix(path.Base(file), ".json")
+		if _, err := language.Parse(lang); err != nil {
+			return nil, fmt.Errorf("i18n: invalid language file %s: %w", file, err)
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: invalid language file %s: %w", file, err)
+		}
+		c.messages[lang] = messages
+		c.languages = append(c.languages, lang)
+	}
+
+	if _, ok := c.messages[fallback]; !ok {
+		return nil, fmt.Errorf("i18n: missing fallback language %s", fallback)
+	}
+
+	// the first tag is used by the matcher when nothing is matched, so the fallback goes first
+	sort.Slice(c.languages, func(i, j int) bool {
+		if c.languages[i] == fallback || c.languages[j] == fallback {
+			return c.languages[i] == fallback
+		}
+		return c.languages[i] < c.languages[j]
+	})
+	tags := make([]language.Tag, 0, len(c.languages))
+	for _, lang := range c.languages {
+		tags = append(tags, language.Make(lang))
+	}
+	c.matcher = language.NewMatcher(tags)
+
+	return c, nil
+}
+
+// Languages returns the supported languages, the fallback language goes first
+func (c *Catalog) Languages() []string {
+	return c.languages
+}
+
+// Match returns the supported language which best matches the Accept-Language header value
+func (c *Catalog) Match(acceptLanguage string) string {
+	_, index := language.MatchStrings(c.matcher, acceptLanguage)
+	return c.languages[index]
+}
+
+// Has returns true when the message of the key exists in the fallback language
+func (c *Catalog) Has(key string) bool {
+	_, ok := c.messages[c.fallback][key]
+	return ok
+}
+
+// Message returns the message of the key in the given language with its "{param}" placeholders replaced.
+// The fallback language is used when the message is not translated, and the key itself is used when
+// the message does not exist at all, so a literal text can be passed as the key.
+func (c *Catalog) Message(lang, key string, params map[string]interface{}) string {
+	msg, ok := c.messages[lang][key]
+	if !ok {
+		msg, ok = c.messages[c.fallback][key]
+	}
+	if !ok {
+		msg = key
+	}
+
+	if len(params) == 0 {
+		return msg
+	}
+
+	replacements := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		replacements = append(replacements, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(replacements...).Replace(msg)
+}
@@ -0,0 +1,117 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	c := Default()
+	assert.Equal(t, DefaultLanguage, c.Languages()[0])
+	assert.Contains(t, c.Languages(), "id")
+
+	// every language should translate all the messages of the default language
+	for _, lang := range c.Languages() {
+		for key := range c.messages[DefaultLanguage] {
+			_, ok := c.messages[lang][key]
+			assert.True(t, ok, "%s is not translated into %s", key, lang)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	test := []struct {
+		name      string
+		fs        fstest.MapFS
+		expectErr bool
+	}{
+		{
+			name: "invalid language file name",
+			fs: fstest.MapFS{
+				"en.json":          {Data: []byte(`{}`)},
+				"not a tag!!.json": {Data: []byte(`{}`)},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid json",
+			fs: fstest.MapFS{
+				"en.json": {Data: []byte(`{`)},
+			},
+			expectErr: true,
+		},
+		{
+			name: "missing fallback language",
+			fs: fstest.MapFS{
+				"id.json": {Data: []byte(`{}`)},
+			},
+			expectErr: true,
+		},
+		{
+			name: "success",
+			fs: fstest.MapFS{
+				"en.json": {Data: []byte(`{}`)},
+				"id.json": {Data: []byte(`{}`)},
+				"ms.json": {Data: []byte(`{}`)},
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Load(tt.fs, "en")
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"en", "id", "ms"}, c.Languages())
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c, err := Load(fstest.MapFS{
+		"en.json": {Data: []byte(`{}`)},
+		"id.json": {Data: []byte(`{}`)},
+	}, "en")
+	assert.NoError(t, err)
+
+	test := []struct {
+		acceptLanguage string
+		expect         string
+	}{
+		{"", "en"},
+		{"id", "id"},
+		{"id-ID", "id"},
+		{"en-US,en;q=0.9", "en"},
+		{"ja,id;q=0.8,en;q=0.5", "id"},
+		{"ja", "en"},
+		{"invalid;;;", "en"},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			assert.Equal(t, tt.expect, c.Match(tt.acceptLanguage))
+		})
+	}
+}
+
+func TestMessage(t *testing.T) {
+	c, err := Load(fstest.MapFS{
+		"en.json": {Data: []byte(`{"greeting": "Hello {name}", "bye": "Bye"}`)},
+		"id.json": {Data: []byte(`{"greeting": "Halo {name}"}`)},
+	}, "en")
+	assert.NoError(t, err)
+
+	params := map[string]interface{}{"name": "Narto"}
+	assert.Equal(t, "Halo Narto", c.Message("id", "greeting", params))
+	assert.Equal(t, "Hello Narto", c.Message("en", "greeting", params))
+	assert.Equal(t, "Bye", c.Message("id", "bye", nil))
+	assert.Equal(t, "literal text", c.Message("id", "literal text", nil))
+	assert.True(t, c.Has("bye"))
+	assert.False(t, c.Has("literal text"))
+}
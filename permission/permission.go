@@ -0,0 +1,172 @@
+// Package permission reads the permissions required by the API operations from the x-permissions extension
+// of the OpenAPI specification, e.g.
+//
+//	/admin/users:
+//	  get:
+//	    operationId: listUsers
+//	    x-permissions: [users:read]
+//
+// The operation requires every listed permission, the operation without the extension is not restricted
+// by the permissions. The permission is written as "resource:action" in lower case, e.g. "roles:write".
+//
+// The operation with the x-impersonation extension set to false, e.g. changing the sign in credentials,
+// can not be used with the impersonation token. The operation requiring permissions is never allowed
+// while impersonating, so the impersonated user's permissions can not be used by the impersonator.
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	spuser "github.com/basriyasin/sp-user"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// the format of the permission name, e.g. "users:read"
+	permissionPattern = regexp.MustCompile(`^[a-z][a-z_]*:[a-z][a-z_]*$`)
+
+	// the path parameter of the OpenAPI path, e.g. "{id}"
+	pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+	// the path item keys which are the operations
+	methods = map[string]string{
+		"get":     http.MethodGet,
+		"put":     http.MethodPut,
+		"post":    http.MethodPost,
+		"delete":  http.MethodDelete,
+		"options": http.MethodOptions,
+		"head":    http.MethodHead,
+		"patch":   http.MethodPatch,
+		"trace":   http.MethodTrace,
+	}
+)
+
+type (
+	// Policy keeps the permissions required by every operation, it is safe for concurrent use
+	Policy struct {
+		// the required permissions by the method and the route path, e.g. "GET /admin/users/:id"
+		operations  map[string][]string
+		permissions []string
+
+		// the operations which can not be used while impersonating by the method and the route path
+		noImpersonation map[string]bool
+	}
+
+	// the part of the specification containing the permissions of the operations
+	spec struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+
+	operation struct {
+		Permissions   []string `yaml:"x-permissions"`
+		Impersonation *bool    `yaml:"x-impersonation"`
+	}
+)
+
+// Parse reads the permissions of the operations from the OpenAPI specification in YAML or JSON
+func Parse(data []byte) (*Policy, error) {
+	var s spec
+	err := yaml.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("permission: invalid specification: %w", err)
+	}
+
+	p := &Policy{operations: map[string][]string{}, noImpersonation: map[string]bool{}}
+	known := map[string]bool{}
+	for path, item := range s.Paths {
+		for key, node := range item {
+			method, ok := methods[key]
+			if !ok {
+				continue
+			}
+
+			var op operation
+			err = node.Decode(&op)
+			if err != nil {
+				return nil, fmt.Errorf("permission: invalid operation %s %s: %w", method, path, err)
+			}
+			for _, permission := range op.Permissions {
+				if !permissionPattern.MatchString(permission) {
+					return nil, fmt.Errorf("permission: invalid permission %q of %s %s", permission, method, path)
+				}
+				known[permission] = true
+			}
+			key := operationKey(method, RoutePath(path))
+			if len(op.Permissions) > 0 {
+				p.operations[key] = op.Permissions
+			}
+			if op.Impersonation != nil && !*op.Impersonation {
+				p.noImpersonation[key] = true
+			}
+		}
+	}
+
+	for permission := range known {
+		p.permissions = append(p.permissions, permission)
+	}
+	sort.Strings(p.permissions)
+	return p, nil
+}
+
+// Default reads the permissions of the service specification, it panics when the specification is invalid
+func Default() *Policy {
+	p, err := Parse(spuser.Spec)
+	if err != nil {
+		panic(err)
+	}
+	if len(p.permissions) == 0 {
+		panic(errors.New("permission: the specification does not declare any permission"))
+	}
+	return p
+}
+
+// RoutePath converts the OpenAPI path into the route path of the HTTP router, e.g. "/users/{id}" into "/users/:id"
+func RoutePath(path string) string {
+	return pathParamPattern.ReplaceAllString(path, ":$1")
+}
+
+// Required returns the permissions required by the operation of the method and the route path, e.g. "/users/:id"
+func (p *Policy) Required(method, path string) []string {
+	return p.operations[operationKey(method, path)]
+}
+
+// AllowsImpersonation checks whether the operation of the method and the route path can be used with the impersonation token,
+// the operation requiring permissions or declaring x-impersonation as false is not allowed
+func (p *Policy) AllowsImpersonation(method, path string) bool {
+	key := operationKey(method, path)
+	return len(p.operations[key]) == 0 && !p.noImpersonation[key]
+}
+
+// Permissions returns every permission declared in the specification in alphabetical order
+func (p *Policy) Permissions() []string {
+	return append([]string(nil), p.permissions...)
+}
+
+// Has checks whether the permission is declared in the specification
+func (p *Policy) Has(permission string) bool {
+	i := sort.SearchStrings(p.permissions, permission)
+	return i < len(p.permissions) && p.permissions[i] == permission
+}
+
+// Missing returns the first required permission which has not been granted, empty when every permission is granted
+func Missing(granted, required []string) string {
+	set := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		set[permission] = true
+	}
+	for _, permission := range required {
+		if !set[permission] {
+			return permission
+		}
+	}
+	return ""
+}
+
+func operationKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
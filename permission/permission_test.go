@@ -0,0 +1,106 @@
+package permission
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	test := []struct {
+		name              string
+		spec              string
+		expectErr         bool
+		expectPermissions []string
+	}{
+		{name: "err invalid yaml", spec: "paths: [", expectErr: true},
+		{name: "err invalid operation", spec: "paths:\n  /a:\n    get: [1]", expectErr: true},
+		{name: "err invalid permission", spec: "paths:\n  /a:\n    get:\n      x-permissions: [Users]", expectErr: true},
+		{name: "err invalid impersonation", spec: "paths:\n  /a:\n    get:\n      x-impersonation: maybe", expectErr: true},
+		{name: "no permission", spec: "paths:\n  /a:\n    get:\n      operationId: a", expectPermissions: nil},
+		{
+			name: "success",
+			spec: `
+paths:
+  /users/{id}/roles/{role_id}:
+    parameters:
+      - name: id
+    put:
+      x-permissions: [roles:write, users:read]
+    delete:
+      x-permissions: [roles:write]
+  /users:
+    get:
+      x-permissions: [users:read]
+`,
+			expectPermissions: []string{"roles:write", "users:read"},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse([]byte(tt.spec))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectPermissions, p.Permissions())
+		})
+	}
+
+	p, err := Parse([]byte("paths:\n  /users/{id}:\n    put:\n      x-permissions: [roles:write, users:read]\n  /users:\n    get:\n      operationId: a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"roles:write", "users:read"}, p.Required(http.MethodPut, "/users/:id"))
+	assert.Equal(t, []string{"roles:write", "users:read"}, p.Required("put", "/users/:id"))
+	assert.Empty(t, p.Required(http.MethodGet, "/users"))
+	assert.Empty(t, p.Required(http.MethodGet, "/users/:id"))
+	assert.True(t, p.Has("users:read"))
+	assert.False(t, p.Has("users:write"))
+
+	// the returned permissions are a copy
+	p.Permissions()[0] = "changed"
+	assert.True(t, p.Has("roles:write"))
+}
+
+func TestAllowsImpersonation(t *testing.T) {
+	p, err := Parse([]byte(`
+paths:
+  /users/{id}:
+    put:
+      x-permissions: [users:write]
+  /profile:
+    get:
+      x-impersonation: true
+    put:
+      x-impersonation: false
+    patch:
+      operationId: patchProfile
+`))
+	assert.NoError(t, err)
+	assert.False(t, p.AllowsImpersonation(http.MethodPut, "/users/:id"))
+	assert.True(t, p.AllowsImpersonation(http.MethodGet, "/profile"))
+	assert.False(t, p.AllowsImpersonation(http.MethodPut, "/profile"))
+	assert.True(t, p.AllowsImpersonation(http.MethodPatch, "/profile"))
+	assert.True(t, p.AllowsImpersonation(http.MethodGet, "/unknown"))
+}
+
+func TestDefault(t *testing.T) {
+	p := Default()
+	assert.Equal(t, []string{"audit:read", "roles:read", "roles:write", "terms:write", "users:export", "users:impersonate", "users:import", "users:read", "users:write"}, p.Permissions())
+	assert.Equal(t, []string{"users:read"}, p.Required(http.MethodGet, "/admin/users"))
+	assert.Equal(t, []string{"roles:write"}, p.Required(http.MethodPut, "/admin/users/:id/roles/:role_id"))
+	assert.Empty(t, p.Required(http.MethodGet, "/profile"))
+}
+
+func TestRoutePath(t *testing.T) {
+	assert.Equal(t, "/admin/users/:id/roles/:role_id", RoutePath("/admin/users/{id}/roles/{role_id}"))
+	assert.Equal(t, "/profile", RoutePath("/profile"))
+}
+
+func TestMissing(t *testing.T) {
+	assert.Equal(t, "", Missing([]string{"a:b", "c:d"}, []string{"c:d"}))
+	assert.Equal(t, "", Missing(nil, nil))
+	assert.Equal(t, "e:f", Missing([]string{"a:b"}, []string{"a:b", "e:f"}))
+}
@@ -0,0 +1,214 @@
+// Package phone normalizes the phone numbers into E.164 format (e.g. +6281234567890)
+// based on the numbering plans embedded in plans.json.
+package phone
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultCountry is used when no allowed country is configured
+	DefaultCountry = "ID"
+
+	internationalPrefix = "00"
+)
+
+var (
+	// ErrInvalid is returned when the phone number does not match any numbering plan
+	ErrInvalid = errors.New("phone: invalid phone number")
+
+	// ErrCountryNotAllowed is returned when the phone number belongs to a country which is not allowed
+	ErrCountryNotAllowed = errors.New("phone: country is not allowed")
+
+	//go:embed plans.json
+	plansJSON []byte
+
+	// numbering plans of every supported country
+	plans []Plan
+)
+
+type (
+	// Plan is the numbering plan of a country, the length is the length of the national significant number,
+	// i.e. the number without the calling code and the trunk prefix.
+	Plan struct {
+		Country     string `json:"country"`
+		CallingCode string `json:"calling_code"`
+		TrunkPrefix string `json:"trunk_prefix"`
+		MinLength   int    `json:"min_length"`
+		MaxLength   int    `json:"max_length"`
+	}
+
+	// Numbering normalizes the phone numbers of the allowed countries,
+	// the first allowed country is used for the phone numbers written in the national format.
+	Numbering struct {
+		allowed []Plan
+	}
+)
+
+func init() {
+	err := json.Unmarshal(plansJSON, &plans)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Plans returns the numbering plans of every supported country
+func Plans() []Plan {
+	return plans
+}
+
+// NewNumbering creates the numbering of the given ISO 3166-1 alpha-2 country codes,
+// DefaultCountry is used when no country is given.
+func NewNumbering(countries ...string) (*Numbering, error) {
+	if len(countries) == 0 {
+		countries = []string{DefaultCountry}
+	}
+
+	n := &Numbering{}
+	for _, country := range countries {
+		plan, ok := planByCountry(strings.ToUpper(strings.TrimSpace(country)))
+		if !ok {
+			return nil, fmt.Errorf("phone: unsupported country %q", country)
+		}
+		n.allowed = append(n.allowed, plan)
+	}
+	return n, nil
+}
+
+// Countries returns the allowed country codes
+func (n *Numbering) Countries() []string {
+	countries := make([]string, 0, len(n.allowed))
+	for _, plan := range n.allowed {
+		countries = append(countries, plan.Country)
+	}
+	return countries
+}
+
+// Normalize converts the phone number written in the international (+6281234567890, 006281234567890, 6281234567890)
+// or the national format (081234567890, 81234567890) into E.164 format.
+// Spaces, dashes, dots and parentheses are ignored.
+func (n *Numbering) Normalize(raw string) (string, error) {
+	digits, international, ok := clean(raw)
+	if !ok {
+		return "", ErrInvalid
+	}
+
+	if international {
+		plan, ok := planByNumber(plans, digits)
+		if !ok {
+			return "", ErrInvalid
+		}
+		if !n.isAllowed(plan) {
+			return "", ErrCountryNotAllowed
+		}
+		return "+" + digits, nil
+	}
+
+	// national format with trunk prefix, e.g. 081234567890
+	national := n.allowed[0]
+	if national.TrunkPrefix != "" && strings.HasPrefix(digits, national.TrunkPrefix) {
+		nsn := strings.TrimPrefix(digits, national.TrunkPrefix)
+		if !national.isValidNSN(nsn) {
+			return "", ErrInvalid
+		}
+		return "+" + national.CallingCode + nsn, nil
+	}
+
+	// international format without the plus sign, e.g. 6281234567890
+	if plan, ok := planByNumber(n.allowed, digits); ok {
+		return "+" + digits, nil
+	} else if plan, ok = planByNumber(plans, digits); ok && !n.isAllowed(plan) {
+		return "", ErrCountryNotAllowed
+	}
+
+	// national format without trunk prefix, e.g. 81234567890
+	if national.isValidNSN(digits) {
+		return "+" + national.CallingCode + digits, nil
+	}
+
+	return "", ErrInvalid
+}
+
+// IsValid returns true when the phone number is in E.164 format and matches one of the supported numbering plans
+func IsValid(e164 string) bool {
+	if !strings.HasPrefix(e164, "+") {
+		return false
+	}
+
+	digits := e164[1:]
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	_, ok := planByNumber(plans, digits)
+	return ok
+}
+
+// remove the formatting characters and the international prefix from the phone number
+func clean(raw string) (digits string, international bool, ok bool) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "+") {
+		international = true
+		raw = raw[1:]
+	}
+
+	var b strings.Builder
+	for _, c := range raw {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == ' ', c == '-', c == '.', c == '(', c == ')':
+			continue
+		default:
+			return "", false, false
+		}
+	}
+
+	digits = b.String()
+	if !international && strings.HasPrefix(digits, internationalPrefix) {
+		international = true
+		digits = strings.TrimPrefix(digits, internationalPrefix)
+	}
+	return digits, international, digits != ""
+}
+
+// check whether the plan belongs to the allowed countries
+func (n *Numbering) isAllowed(plan Plan) bool {
+	for _, allowed := range n.allowed {
+		if allowed.Country == plan.Country {
+			return true
+		}
+	}
+	return false
+}
+
+// check whether the national significant number has a valid length and does not start with zero
+func (p Plan) isValidNSN(nsn string) bool {
+	return len(nsn) >= p.MinLength && len(nsn) <= p.MaxLength && !strings.HasPrefix(nsn, "0")
+}
+
+// find the plan by its country code
+func planByCountry(country string) (Plan, bool) {
+	for _, plan := range plans {
+		if plan.Country == country {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
+
+// find the plan whose calling code prefixes the digits and the rest of the digits is a valid national significant number
+func planByNumber(candidates []Plan, digits string) (Plan, bool) {
+	for _, plan := range candidates {
+		if strings.HasPrefix(digits, plan.CallingCode) && plan.isValidNSN(strings.TrimPrefix(digits, plan.CallingCode)) {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
@@ -0,0 +1,138 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNumbering(t *testing.T) {
+	n, err := NewNumbering()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{DefaultCountry}, n.Countries())
+
+	n, err = NewNumbering("id", " MY ", "SG")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ID", "MY", "SG"}, n.Countries())
+
+	_, err = NewNumbering("ID", "XX")
+	assert.Error(t, err)
+}
+
+func TestNormalize(t *testing.T) {
+	n, err := NewNumbering("ID", "MY", "SG")
+	assert.NoError(t, err)
+
+	test := []struct {
+		name      string
+		raw       string
+		expect    string
+		expectErr error
+	}{
+		{
+			name:      "empty",
+			raw:       "",
+			expectErr: ErrInvalid,
+		},
+		{
+			name:      "contain letter",
+			raw:       "+6281x2233445",
+			expectErr: ErrInvalid,
+		},
+		{
+			name:   "E.164",
+			raw:    "+6281122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "formatted",
+			raw:    " +62 (811) 2233-4455 ",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "international prefix",
+			raw:    "006281122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "calling code without plus",
+			raw:    "6281122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "national with trunk prefix",
+			raw:    "081122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "national without trunk prefix",
+			raw:    "81122334455",
+			expect: "+6281122334455",
+		},
+		{
+			name:   "malaysia",
+			raw:    "+60 12-345 6789",
+			expect: "+60123456789",
+		},
+		{
+			name:   "malaysia without plus",
+			raw:    "60123456789",
+			expect: "+60123456789",
+		},
+		{
+			name:   "singapore",
+			raw:    "+65 8123 4567",
+			expect: "+6581234567",
+		},
+		{
+			name:      "too short",
+			raw:       "+62811223",
+			expectErr: ErrInvalid,
+		},
+		{
+			name:      "too long",
+			raw:       "+628112233445566",
+			expectErr: ErrInvalid,
+		},
+		{
+			name:      "trunk prefix after calling code",
+			raw:       "+62081122334455",
+			expectErr: ErrInvalid,
+		},
+		{
+			name:      "unsupported country",
+			raw:       "+61412345678",
+			expectErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := n.Normalize(tt.raw)
+			assert.Equal(t, tt.expectErr, err)
+			assert.Equal(t, tt.expect, got)
+		})
+	}
+}
+
+func TestNormalizeCountryNotAllowed(t *testing.T) {
+	n, err := NewNumbering("ID")
+	assert.NoError(t, err)
+
+	test := []string{"+60123456789", "0060123456789", "60123456789", "+6581234567"}
+	for _, raw := range test {
+		t.Run(raw, func(t *testing.T) {
+			_, err := n.Normalize(raw)
+			assert.Equal(t, ErrCountryNotAllowed, err)
+		})
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	assert.True(t, IsValid("+6281122334455"))
+	assert.True(t, IsValid("+60123456789"))
+	assert.True(t, IsValid("+6581234567"))
+	assert.False(t, IsValid("081122334455"))
+	assert.False(t, IsValid("+62 81122334455"))
+	assert.False(t, IsValid("+6581234"))
+}
@@ -0,0 +1,418 @@
+// Package preference validates the profile preferences, every preference key has a JSON Schema
+// describing its value. The built-in keys are registered from the schemas embedded in schemas.json.
+//
+// Only the following subset of the JSON Schema keywords is supported: type, enum, format,
+// minLength, maxLength, pattern, minimum, maximum, properties, required, additionalProperties,
+// propertyNames, maxProperties, items, maxItems, default and the description annotation. The boolean
+// schemas true and false are supported as well, e.g. "additionalProperties": false. The schema using any
+// other keyword is rejected when it is decoded, so it never loads without enforcing the keyword.
+package preference
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// the time zones are embedded so the timezone format works without the system time zone database
+	_ "time/tzdata"
+)
+
+var (
+	// ErrUnknownKey is returned when the preference key is not registered
+	ErrUnknownKey = errors.New("preference: unknown key")
+
+	//go:embed schemas.json
+	schemasJSON []byte
+)
+
+type (
+	// Schema is the JSON Schema of a preference value
+	Schema struct {
+		Description          string             `json:"description,omitempty"`
+		Type                 Types              `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Enum                 []interface{}      `json:"enum,omitempty"`
+		MinLength            *int               `json:"minLength,omitempty"`
+		MaxLength            *int               `json:"maxLength,omitempty"`
+		Pattern              string             `json:"pattern,omitempty"`
+		Minimum              *float64           `json:"minimum,omitempty"`
+		Maximum              *float64           `json:"maximum,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+		PropertyNames        *Schema            `json:"propertyNames,omitempty"`
+		MaxProperties        *int               `json:"maxProperties,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		MaxItems             *int               `json:"maxItems,omitempty"`
+		Default              json.RawMessage    `json:"default,omitempty"`
+
+		// the false schema which never matches
+		never   bool
+		pattern *regexp.Regexp
+	}
+
+	// Types is the type keyword which is either a single type or a list of types
+	Types []string
+
+	// FormatFunc check whether the string value matches the format
+	FormatFunc func(value string) bool
+
+	// ValidationError describe the part of the value which does not match the schema,
+	// the path is the preference key followed by the property names and the array indexes, e.g. "notifications.email"
+	ValidationError struct {
+		Path   string
+		Reason string
+	}
+
+	// Registry keeps the schema of every preference key. The keys and the formats should be registered
+	// before the registry is used, the registration is not safe for concurrent use.
+	Registry struct {
+		schemas map[string]*Schema
+		formats map[string]FormatFunc
+	}
+)
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("preference: %s %s", e.Path, e.Reason)
+}
+
+// accept both the single type and the list of types
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*t = Types{single}
+		return nil
+	}
+
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// accept the boolean schemas, true matches any value while false never matches.
+// The unsupported keywords are rejected, including the ones of the sub schemas
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var boolean bool
+	if json.Unmarshal(data, &boolean) == nil {
+		*s = Schema{never: !boolean}
+		return nil
+	}
+
+	type schema Schema
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode((*schema)(s))
+	if err != nil {
+		return fmt.Errorf("preference: unsupported schema: %w", err)
+	}
+	return nil
+}
+
+// NewRegistry creates an empty registry which only knows the built-in "timezone" format
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas: map[string]*Schema{},
+		formats: map[string]FormatFunc{
+			"timezone": isTimezone,
+		},
+	}
+}
+
+// Default creates a new registry containing the built-in preference keys, it panics when the embedded schemas are invalid
+func Default() *Registry {
+	var schemas map[string]*Schema
+	err := json.Unmarshal(schemasJSON, &schemas)
+	if err != nil {
+		panic(err)
+	}
+
+	r := NewRegistry()
+	for key, schema := range schemas {
+		err = r.Register(key, schema)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// RegisterFormat registers the check of the format keyword, the unknown formats always match
+func (r *Registry) RegisterFormat(name string, check FormatFunc) {
+	r.formats[name] = check
+}
+
+// Register adds or replaces the schema of the preference key, the default value should match the schema
+func (r *Registry) Register(key string, schema *Schema) error {
+	if key == "" || schema == nil {
+		return errors.New("preference: the key and the schema are required")
+	}
+
+	err := schema.compile()
+	if err != nil {
+		return fmt.Errorf("preference: invalid schema of %q: %w", key, err)
+	}
+	if len(schema.Default) > 0 {
+		err = r.validate(key, schema, schema.Default)
+		if err != nil {
+			return fmt.Errorf("preference: invalid default of %q: %w", key, err)
+		}
+	}
+
+	r.schemas[key] = schema
+	return nil
+}
+
+// Keys returns the registered preference keys in alphabetical order
+func (r *Registry) Keys() []string {
+	keys := make([]string, 0, len(r.schemas))
+	for key := range r.schemas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Schema returns the schema of the preference key
+func (r *Registry) Schema(key string) (schema *Schema, ok bool) {
+	schema, ok = r.schemas[key]
+	return
+}
+
+// Defaults returns the default value of every preference key which has one
+func (r *Registry) Defaults() map[string]json.RawMessage {
+	defaults := make(map[string]json.RawMessage, len(r.schemas))
+	for key, schema := range r.schemas {
+		if len(schema.Default) > 0 {
+			defaults[key] = schema.Default
+		}
+	}
+	return defaults
+}
+
+// Validate checks the JSON value of the preference key, ErrUnknownKey is returned when the key is not registered
+// and *ValidationError when the value does not match the schema
+func (r *Registry) Validate(key string, value json.RawMessage) error {
+	schema, ok := r.schemas[key]
+	if !ok {
+		return ErrUnknownKey
+	}
+	return r.validate(key, schema, value)
+}
+
+// decode the JSON value and validate it against the schema
+func (r *Registry) validate(path string, schema *Schema, value json.RawMessage) error {
+	var v interface{}
+	err := json.Unmarshal(value, &v)
+	if err != nil {
+		return &ValidationError{Path: path, Reason: "should be a valid JSON value"}
+	}
+	return r.validateValue(path, schema, v)
+}
+
+// validate the decoded JSON value against the schema and its sub schemas
+func (r *Registry) validateValue(path string, s *Schema, v interface{}) error {
+	if s.never {
+		return &ValidationError{Path: path, Reason: "is not allowed"}
+	}
+	if len(s.Type) > 0 && !s.Type.match(v) {
+		return &ValidationError{Path: path, Reason: "should be a " + strings.Join(s.Type, " or ")}
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		enum, _ := json.Marshal(s.Enum)
+		return &ValidationError{Path: path, Reason: "should be one of " + string(enum)}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return r.validateString(path, s, v)
+	case float64:
+		return validateNumber(path, s, v)
+	case map[string]interface{}:
+		return r.validateObject(path, s, v)
+	case []interface{}:
+		return r.validateArray(path, s, v)
+	}
+	return nil
+}
+
+func (r *Registry) validateString(path string, s *Schema, v string) error {
+	length := utf8.RuneCountInString(v)
+	switch {
+	case s.MinLength != nil && length < *s.MinLength:
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("should be at least %d characters", *s.MinLength)}
+	case s.MaxLength != nil && length > *s.MaxLength:
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("should be at most %d characters", *s.MaxLength)}
+	case s.pattern != nil && !s.pattern.MatchString(v):
+		return &ValidationError{Path: path, Reason: "should match the pattern " + s.Pattern}
+	}
+
+	if check, ok := r.formats[s.Format]; ok && !check(v) {
+		return &ValidationError{Path: path, Reason: "should be a valid " + s.Format}
+	}
+	return nil
+}
+
+func validateNumber(path string, s *Schema, v float64) error {
+	switch {
+	case s.Minimum != nil && v < *s.Minimum:
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("should be at least %v", *s.Minimum)}
+	case s.Maximum != nil && v > *s.Maximum:
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("should be at most %v", *s.Maximum)}
+	}
+	return nil
+}
+
+func (r *Registry) validateObject(path string, s *Schema, v map[string]interface{}) error {
+	if s.MaxProperties != nil && len(v) > *s.MaxProperties {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("should have at most %d properties", *s.MaxProperties)}
+	}
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			return &ValidationError{Path: path + "." + name, Reason: "is required"}
+		}
+	}
+
+	// sort the properties so the first invalid property is reported consistently
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if s.PropertyNames != nil {
+			err := r.validateValue(path+"."+name, s.PropertyNames, name)
+			if err != nil {
+				return &ValidationError{Path: path + "." + name, Reason: "is not a valid property name"}
+			}
+		}
+
+		property, ok := s.Properties[name]
+		if !ok {
+			property = s.AdditionalProperties
+		}
+		if property == nil {
+			continue
+		}
+		err := r.validateValue(path+"."+name, property, v[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Registry) validateArray(path string, s *Schema, v []interface{}) error {
+	if s.MaxItems != nil && len(v) > *s.MaxItems {
+		return &ValidationError{Path: path, Reason: fmt.Sprintf("should have at most %d items", *s.MaxItems)}
+	}
+	if s.Items == nil {
+		return nil
+	}
+	for i, item := range v {
+		err := r.validateValue(fmt.Sprintf("%s[%d]", path, i), s.Items, item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compile the patterns of the schema and its sub schemas
+func (s *Schema) compile() (err error) {
+	for _, t := range s.Type {
+		switch t {
+		case "string", "number", "integer", "boolean", "object", "array", "null":
+		default:
+			return fmt.Errorf("unknown type %q", t)
+		}
+	}
+
+	if s.Pattern != "" {
+		s.pattern, err = regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	subs := []*Schema{s.AdditionalProperties, s.PropertyNames, s.Items}
+	for _, property := range s.Properties {
+		subs = append(subs, property)
+	}
+	for _, sub := range subs {
+		if sub == nil {
+			continue
+		}
+		err = sub.compile()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check whether the decoded JSON value is one of the types
+func (t Types) match(v interface{}) bool {
+	for _, name := range t {
+		switch v := v.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check whether the decoded JSON value equals one of the enum values
+func inEnum(enum []interface{}, v interface{}) bool {
+	value, _ := json.Marshal(v)
+	for _, e := range enum {
+		candidate, _ := json.Marshal(e)
+		if string(candidate) == string(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// check whether the value is an IANA time zone name, e.g. "Asia/Jakarta"
+func isTimezone(value string) bool {
+	if value == "" || value == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(value)
+	return err == nil
+}
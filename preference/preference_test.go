@@ -0,0 +1,184 @@
+package preference
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	r := Default()
+	assert.Equal(t, []string{"attributes", "language", "notifications", "timezone"}, r.Keys())
+
+	// every default value is valid
+	for key, value := range r.Defaults() {
+		assert.NoError(t, r.Validate(key, value), key)
+	}
+
+	schema, ok := r.Schema("timezone")
+	assert.True(t, ok)
+	assert.Equal(t, "timezone", schema.Format)
+}
+
+func TestValidate(t *testing.T) {
+	r := Default()
+	r.RegisterFormat("language", func(value string) bool { return value == "en" || value == "id" })
+
+	test := []struct {
+		name       string
+		key        string
+		value      string
+		expectErr  error
+		expectPath string
+	}{
+		{name: "unknown key", key: "color", value: `"red"`, expectErr: ErrUnknownKey},
+		{name: "invalid json", key: "language", value: `{`, expectPath: "language"},
+		{name: "wrong type", key: "language", value: `1`, expectPath: "language"},
+		{name: "unknown language", key: "language", value: `"fr"`, expectPath: "language"},
+		{name: "language", key: "language", value: `"id"`},
+		{name: "unknown timezone", key: "timezone", value: `"Mars/Olympus"`, expectPath: "timezone"},
+		{name: "local timezone", key: "timezone", value: `"Local"`, expectPath: "timezone"},
+		{name: "timezone", key: "timezone", value: `"Asia/Jakarta"`},
+		{name: "unknown notification", key: "notifications", value: `{"fax": true}`, expectPath: "notifications.fax"},
+		{name: "wrong notification type", key: "notifications", value: `{"email": "yes"}`, expectPath: "notifications.email"},
+		{name: "partial notifications", key: "notifications", value: `{"email": false}`},
+		{name: "invalid attribute name", key: "attributes", value: `{"Color": "red"}`, expectPath: "attributes.Color"},
+		{name: "invalid attribute type", key: "attributes", value: `{"tags": ["a"]}`, expectPath: "attributes.tags"},
+		{name: "too long attribute", key: "attributes", value: `{"bio": "` + strings.Repeat("a", 257) + `"}`, expectPath: "attributes.bio"},
+		{name: "too many attributes", key: "attributes", value: `{"a0":1,"a1":1,"a2":1,"a3":1,"a4":1,"a5":1,"a6":1,"a7":1,"a8":1,"a9":1,"b0":1,"b1":1,"b2":1,"b3":1,"b4":1,"b5":1,"b6":1,"b7":1,"b8":1,"b9":1,"c0":1}`, expectPath: "attributes"},
+		{name: "attributes", key: "attributes", value: `{"color": "red", "age": 3, "beta": true}`},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(tt.key, json.RawMessage(tt.value))
+			switch {
+			case tt.expectErr != nil:
+				assert.ErrorIs(t, err, tt.expectErr)
+			case tt.expectPath != "":
+				var verr *ValidationError
+				if assert.True(t, errors.As(err, &verr), err) {
+					assert.Equal(t, tt.expectPath, verr.Path)
+					assert.NotEmpty(t, verr.Reason)
+				}
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	var (
+		r      = NewRegistry()
+		schema = `{
+			"type": "object",
+			"required": ["level"],
+			"properties": {
+				"level": {"type": "integer", "minimum": 1, "maximum": 3},
+				"mode": {"enum": ["dark", "light"]},
+				"code": {"type": "string", "minLength": 2, "pattern": "^[A-Z]+$"},
+				"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+				"note": {"type": ["string", "null"]}
+			}
+		}`
+	)
+
+	var s Schema
+	assert.NoError(t, json.Unmarshal([]byte(schema), &s))
+	assert.NoError(t, r.Register("custom", &s))
+
+	test := []struct {
+		value      string
+		expectPath string
+	}{
+		{value: `{}`, expectPath: "custom.level"},
+		{value: `{"level": 1.5}`, expectPath: "custom.level"},
+		{value: `{"level": 0}`, expectPath: "custom.level"},
+		{value: `{"level": 4}`, expectPath: "custom.level"},
+		{value: `{"level": 1, "mode": "blue"}`, expectPath: "custom.mode"},
+		{value: `{"level": 1, "code": "A"}`, expectPath: "custom.code"},
+		{value: `{"level": 1, "code": "ab"}`, expectPath: "custom.code"},
+		{value: `{"level": 1, "tags": ["a", "b", "c"]}`, expectPath: "custom.tags"},
+		{value: `{"level": 1, "tags": ["a", 1]}`, expectPath: "custom.tags[1]"},
+		{value: `{"level": 1, "note": false}`, expectPath: "custom.note"},
+		{value: `{"level": 2, "mode": "dark", "code": "AB", "tags": ["a"], "note": null, "extra": true}`},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.value, func(t *testing.T) {
+			err := r.Validate("custom", json.RawMessage(tt.value))
+			if tt.expectPath == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verr *ValidationError
+			if assert.True(t, errors.As(err, &verr), err) {
+				assert.Equal(t, tt.expectPath, verr.Path)
+				assert.Contains(t, verr.Error(), tt.expectPath)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	test := []struct {
+		name      string
+		key       string
+		schema    string
+		expectErr bool
+	}{
+		{name: "err empty key", schema: `{}`, expectErr: true},
+		{name: "err unknown type", key: "a", schema: `{"type": "date"}`, expectErr: true},
+		{name: "err invalid pattern", key: "a", schema: `{"properties": {"b": {"pattern": "("}}}`, expectErr: true},
+		{name: "err invalid default", key: "a", schema: `{"type": "string", "default": 1}`, expectErr: true},
+		{name: "false schema", key: "a", schema: `false`},
+		{name: "success", key: "a", schema: `{"type": "string", "default": "b"}`},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Schema
+			assert.NoError(t, json.Unmarshal([]byte(tt.schema), &s))
+
+			err := NewRegistry().Register(tt.key, &s)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// the false schema never matches
+	r := NewRegistry()
+	var never Schema
+	assert.NoError(t, json.Unmarshal([]byte(`false`), &never))
+	assert.NoError(t, r.Register("never", &never))
+	assert.Error(t, r.Validate("never", json.RawMessage(`1`)))
+
+	assert.Error(t, NewRegistry().Register("nil", nil))
+	assert.Error(t, json.Unmarshal([]byte(`{"type": 1}`), &never))
+}
+
+func TestUnsupportedKeywords(t *testing.T) {
+	test := []string{
+		`{"type": "array", "minItems": 1}`,
+		`{"oneOf": [{"type": "string"}, {"type": "number"}]}`,
+		`{"type": "number", "exclusiveMinimum": 0}`,
+		`{"const": "a"}`,
+		`{"properties": {"a": {"type": "string", "const": "b"}}}`,
+		`{"additionalProperties": {"minItems": 1}}`,
+	}
+
+	for _, schema := range test {
+		t.Run(schema, func(t *testing.T) {
+			var s Schema
+			assert.Error(t, json.Unmarshal([]byte(schema), &s))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// This file contains errors returned by the repository layer.
+package repository
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+	pqUniqueViolation = "23505"
+
+	// unique index of the verified profile email
+	profileEmailConstraint = "profile_email_key"
+)
+
+var (
+	// ErrDuplicate is returned when the mutation violates a unique constraint, e.g. the phone number is already registered
+	ErrDuplicate = errors.New("repository: duplicate value")
+
+	// ErrDuplicateEmail is returned when the email has already been verified by another profile
+	ErrDuplicateEmail = errors.New("repository: duplicate email")
+
+	// ErrVersionMismatch is returned by the conditional update when the row has been changed since it was read
+	ErrVersionMismatch = errors.New("repository: version mismatch")
+)
+
+// translate the database driver error into the repository error so the caller does not depend on the driver
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		if pqErr.Constraint == profileEmailConstraint {
+			return ErrDuplicateEmail
+		}
+		return ErrDuplicate
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTranslateError(t *testing.T) {
+	mockErr := errors.New("an error")
+
+	test := []struct {
+		name   string
+		err    error
+		expect error
+	}{
+		{
+			name:   "nil",
+			err:    nil,
+			expect: nil,
+		},
+		{
+			name:   "unique violation",
+			err:    &pq.Error{Code: pqUniqueViolation},
+			expect: ErrDuplicate,
+		},
+		{
+			name:   "wrapped unique violation",
+			err:    fmt.Errorf("wrapped: %w", &pq.Error{Code: pqUniqueViolation}),
+			expect: ErrDuplicate,
+		},
+		{
+			name:   "email unique violation",
+			err:    &pq.Error{Code: pqUniqueViolation, Constraint: profileEmailConstraint},
+			expect: ErrDuplicateEmail,
+		},
+		{
+			name:   "other postgres error",
+			err:    &pq.Error{Code: "23503"},
+			expect: &pq.Error{Code: "23503"},
+		},
+		{
+			name:   "other error",
+			err:    mockErr,
+			expect: mockErr,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+			if fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+				t.Errorf("expected %v, got %v", tt.expect, got)
+			}
+		})
+	}
+}
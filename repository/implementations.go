@@ -2,60 +2,1102 @@ package repository
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
-// save user profile and return the profile id
-func (r Repository) SaveProfile(ctx context.Context, user User) (id int64, err error) {
+// get the tenant by id, sql.ErrNoRows is returned when the tenant does not exist
+func (r Repository) GetTenant(ctx context.Context, tenantID int64) (tenant Tenant, err error) {
+	err = r.scanTenantRow(r.Db.QueryRowContext(ctx, getTenantQuery, tenantID), &tenant)
+	return
+}
+
+// get the tenant by its slug, sql.ErrNoRows is returned when the tenant does not exist
+func (r Repository) GetTenantBySlug(ctx context.Context, slug string) (tenant Tenant, err error) {
+	err = r.scanTenantRow(r.Db.QueryRowContext(ctx, getTenantBySlugQuery, slug), &tenant)
+	return
+}
+
+// get the tenant served on the host, sql.ErrNoRows is returned when no tenant is served on the host
+func (r Repository) GetTenantByHost(ctx context.Context, host string) (tenant Tenant, err error) {
+	err = r.scanTenantRow(r.Db.QueryRowContext(ctx, getTenantByHostQuery, host), &tenant)
+	return
+}
+
+// get every tenant sorted by the id, e.g. to run the background jobs of every tenant
+func (r Repository) GetTenants(ctx context.Context) (tenants []Tenant, err error) {
+	rows, err := r.Db.QueryContext(ctx, getTenantsQuery)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tenant Tenant
+		err = r.scanTenantRow(rows, &tenant)
+		if err != nil {
+			return
+		}
+		tenants = append(tenants, tenant)
+	}
+	err = rows.Err()
+	return
+}
+
+// convert given sql.Row or sql.Rows to tenant struct
+func (r Repository) scanTenantRow(row rowScanner, tenant *Tenant) error {
+	return row.Scan(&tenant.ID, &tenant.Slug, &tenant.Name, &tenant.Host, &tenant.CreatedAt)
+}
+
+// save user profile and return it along with the generated id and creation time
+func (r Repository) SaveProfile(ctx context.Context, tenantID int64, user User) (saved User, err error) {
+	saved = user
 	err = r.Db.QueryRowContext(
 		ctx,
 		saveProfileQuery,
+		tenantID,
 		user.Name,
 		user.Phone,
 		user.Password,
-	).Scan(&id)
+	).Scan(&saved.ID, &saved.CreatedAt)
+	err = translateError(err)
+	return
+}
+
+// save the new profile together with its acceptance of the terms of service version
+// and return the profile along with its id and creation time
+func (r Repository) SaveProfileWithConsent(ctx context.Context, tenantID int64, user User, consent Consent) (saved User, err error) {
+	saved = user
+	err = r.Db.QueryRowContext(
+		ctx,
+		saveProfileWithConsentQuery,
+		tenantID,
+		user.Name,
+		user.Phone,
+		user.Password,
+		consent.TermsVersion,
+		consent.IPAddress,
+		consent.UserAgent,
+	).Scan(&saved.ID, &saved.CreatedAt)
+	err = translateError(err)
 	return
 }
 
-// convert given sql.Row to user profile struct
-func (r Repository) scanProfileRow(row *sql.Row, user *User) error {
+// rowScanner is either *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// convert given sql.Row or sql.Rows to user profile struct
+func (r Repository) scanProfileRow(row rowScanner, user *User) error {
 	return row.Scan(
 		&user.ID,
 		&user.Name,
 		&user.Phone,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.AvatarKey,
+		&user.DeletionScheduledAt,
+		&user.Status,
+		&user.StatusReason,
 		&user.Password,
 		&user.LoginCount,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Version,
 	)
 }
 
 // get the user profile by phone number
-func (r Repository) GetProfileByPhone(ctx context.Context, phone string) (user User, err error) {
+func (r Repository) GetProfileByPhone(ctx context.Context, tenantID int64, phone string) (user User, err error) {
 	err = r.scanProfileRow(
-		r.Db.QueryRowContext(ctx, getProfileByPhoneQuery, phone),
+		r.Db.QueryRowContext(ctx, getProfileByPhoneQuery, tenantID, phone),
+		&user,
+	)
+	return
+}
+
+// get the user profile by its verified email, the unverified email is never returned
+func (r Repository) GetProfileByEmail(ctx context.Context, tenantID int64, email string) (user User, err error) {
+	err = r.scanProfileRow(
+		r.Db.QueryRowContext(ctx, getProfileByEmailQuery, tenantID, email),
 		&user,
 	)
 	return
 }
 
 // get the user profile by the profile id
-func (r Repository) GetProfileByID(ctx context.Context, id int64) (user User, err error) {
+func (r Repository) GetProfileByID(ctx context.Context, tenantID int64, id int64) (user User, err error) {
 	err = r.scanProfileRow(
-		r.Db.QueryRowContext(ctx, getProfileByIDQuery, id),
+		r.Db.QueryRowContext(ctx, getProfileByIDQuery, tenantID, id),
 		&user,
 	)
 	return
 }
 
 // update the user login_count by profile id
-func (r Repository) UpdateLoginCount(ctx context.Context, userID int64, loginCount int) (err error) {
-	_, err = r.Db.ExecContext(ctx, updateLoginCountQuery, loginCount, userID)
+func (r Repository) UpdateLoginCount(ctx context.Context, tenantID int64, userID int64, loginCount int) (err error) {
+	_, err = r.Db.ExecContext(ctx, updateLoginCountQuery, tenantID, loginCount, userID)
+	return
+}
+
+// update the user name, phone and email by profile id when the version is still the same as the given user version,
+// the email verification is reset when the email is changed,
+// the previous name and phone are saved as the profile history changed by the actor and updated_at is set to the current time.
+// ErrVersionMismatch is returned when the profile has been changed since it was read
+func (r Repository) UpdateUserByID(ctx context.Context, tenantID int64, user User, actorID int64) (updated User, err error) {
+	updated = user
+	err = r.Db.QueryRowContext(
+		ctx,
+		updateProfileByIDQuery,
+		tenantID,
+		user.Name,
+		user.Phone,
+		user.ID,
+		user.Version,
+		actorID,
+		user.Email,
+	).Scan(&updated.Version, &updated.UpdatedAt, &updated.EmailVerifiedAt)
+	if err == sql.ErrNoRows {
+		return user, ErrVersionMismatch
+	}
+	err = translateError(err)
+	return
+}
+
+// replace the avatar key of the profile and return the previous one, empty when the profile had no avatar.
+// sql.ErrNoRows is returned when the profile does not exist
+func (r Repository) UpdateProfileAvatar(ctx context.Context, tenantID int64, profileID int64, avatarKey string) (previousKey string, err error) {
+	err = r.Db.QueryRowContext(ctx, updateProfileAvatarQuery, tenantID, avatarKey, profileID).Scan(&previousKey)
+	return
+}
+
+// schedule the deletion of the profile at purgeAt and return the scheduled time, the first schedule is kept
+// when the deletion has been scheduled before. sql.ErrNoRows is returned when the profile does not exist
+func (r Repository) ScheduleProfileDeletion(ctx context.Context, tenantID int64, profileID int64, purgeAt time.Time) (scheduledAt time.Time, err error) {
+	err = r.Db.QueryRowContext(ctx, scheduleProfileDeletionQuery, tenantID, profileID, purgeAt).Scan(&scheduledAt)
+	return
+}
+
+// cancel the scheduled deletion of the profile,
+// sql.ErrNoRows is returned when the deletion has not been scheduled or the schedule has passed the given time
+func (r Repository) CancelProfileDeletion(ctx context.Context, tenantID int64, profileID int64, now time.Time) (err error) {
+	var id int64
+	err = r.Db.QueryRowContext(ctx, cancelProfileDeletionQuery, tenantID, profileID, now).Scan(&id)
+	return
+}
+
+// set the status of the profile and the admin who changed it, the reason is cleared when it is empty.
+// sql.ErrNoRows is returned when the profile does not exist
+func (r Repository) UpdateProfileStatus(ctx context.Context, tenantID int64, profileID int64, status, reason string, actorID int64) (updated User, err error) {
+	err = r.scanProfileRow(
+		r.Db.QueryRowContext(ctx, updateProfileStatusQuery, tenantID, profileID, status, reason, actorID),
+		&updated,
+	)
+	return
+}
+
+// insert the profiles with their hashed passwords in one statement and return the inserted ones along with the generated id
+// and creation time. The profiles whose phone or email has been registered are skipped instead of failing the whole batch
+func (r Repository) ImportProfiles(ctx context.Context, tenantID int64, users []User) (imported []User, err error) {
+	var (
+		names      = make([]string, len(users))
+		phones     = make([]string, len(users))
+		emails     = make([]string, len(users))
+		verifiedAt = make([]string, len(users))
+		passwords  = make([]string, len(users))
+		byPhone    = make(map[string]User, len(users))
+	)
+	for i, user := range users {
+		names[i], phones[i], emails[i], passwords[i] = user.Name, user.Phone, user.Email, user.Password
+		if user.EmailVerifiedAt.Valid {
+			verifiedAt[i] = user.EmailVerifiedAt.Time.UTC().Format(importTimeLayout)
+		}
+		byPhone[user.Phone] = user
+	}
+
+	rows, err := r.Db.QueryContext(ctx, importProfilesQuery, tenantID,
+		pq.Array(names), pq.Array(phones), pq.Array(emails), pq.Array(verifiedAt), pq.Array(passwords),
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Phone, &user.CreatedAt)
+		if err != nil {
+			return
+		}
+		saved := byPhone[user.Phone]
+		saved.ID, saved.CreatedAt = user.ID, user.CreatedAt
+		imported = append(imported, saved)
+	}
+	err = rows.Err()
+	return
+}
+
+// get the status of the profile together with its deletion schedule, sql.ErrNoRows is returned when the profile does not exist
+func (r Repository) GetProfileStatus(ctx context.Context, tenantID int64, profileID int64) (status string, deletionScheduledAt sql.NullTime, err error) {
+	err = r.Db.QueryRowContext(ctx, getProfileStatusQuery, tenantID, profileID).Scan(&status, &deletionScheduledAt)
+	return
+}
+
+// get the given phones and emails which have been registered by any profile of the tenant, verified or not
+func (r Repository) GetRegisteredIdentifiers(ctx context.Context, tenantID int64, phones, emails []string) (registered []string, err error) {
+	rows, err := r.Db.QueryContext(ctx, getRegisteredIdentifiersQuery, tenantID, pq.Array(phones), pq.Array(emails))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var identifier string
+		err = rows.Scan(&identifier)
+		if err != nil {
+			return
+		}
+		registered = append(registered, identifier)
+	}
+	err = rows.Err()
+	return
+}
+
+// get the profiles whose deletion schedule has passed the given time, sorted from the earliest schedule
+func (r Repository) GetProfilesToPurge(ctx context.Context, tenantID int64, now time.Time, limit int) (users []User, err error) {
+	rows, err := r.Db.QueryContext(ctx, getProfilesToPurgeQuery, tenantID, now, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err = r.scanProfileRow(rows, &user)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
 	return
 }
 
-// update the user name and phone by profile id
-func (r Repository) UpdateUserByID(ctx context.Context, user User) (err error) {
-	_, err = r.Db.ExecContext(ctx, updateProfileByIDQuery, user.Name, user.Phone, user.ID)
+// search the profiles matching the filter sorted by the sort field and the id, the profiles after the cursor are returned.
+// The default sort by created_at uses the created_at index of the profile table.
+func (r Repository) SearchProfiles(ctx context.Context, tenantID int64, filter ProfileFilter) (users []User, err error) {
+	column, ok := profileSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("repository: unknown profile sort %q", filter.Sort)
+	}
+	direction, compare := "asc", ">"
+	if filter.Desc {
+		direction, compare = "desc", "<"
+	}
+
+	query := searchProfilesQuery
+	args := profileFilterArgs(tenantID, filter)
+	if filter.After != nil {
+		query += fmt.Sprintf("and (%s, id) %s ($%d, $%d) ", column, compare, len(args)+1, len(args)+2)
+		args = append(args, filter.After.Value, filter.After.ID)
+	}
+	query += fmt.Sprintf("order by %s %s, id %s limit $%d", column, direction, direction, len(args)+1)
+	args = append(args, filter.Limit)
+
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err = r.scanProfileRow(rows, &user)
+		if err != nil {
+			return
+		}
+		users = append(users, user)
+	}
+	err = rows.Err()
+	return
+}
+
+// export the profiles matching the filters in the order of their id, the sort, the cursor and the limit of the filter are ignored.
+// The profiles are fetched from a server-side cursor a batch at a time and passed to fn one by one, the export stops at the first error of fn
+func (r Repository) ExportProfiles(ctx context.Context, tenantID int64, filter ProfileFilter, fn func(user User) error) (err error) {
+	tx, err := r.Db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, declareProfileExportQuery, profileFilterArgs(tenantID, filter)...)
+	if err != nil {
+		return
+	}
+
+	for {
+		var fetched int
+		fetched, err = r.fetchProfileExport(ctx, tx, fn)
+		if err != nil {
+			return
+		}
+		if fetched == 0 {
+			break
+		}
+	}
+
+	// the cursor is closed together with the transaction
+	return tx.Commit()
+}
+
+// fetch the next batch of the profile export cursor and pass the profiles to fn, zero is returned at the end of the cursor
+func (r Repository) fetchProfileExport(ctx context.Context, tx *sql.Tx, fn func(user User) error) (fetched int, err error) {
+	rows, err := tx.QueryContext(ctx, fetchProfileExportQuery)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err = r.scanProfileRow(rows, &user)
+		if err != nil {
+			return
+		}
+		err = fn(user)
+		if err != nil {
+			return
+		}
+		fetched++
+	}
+	err = rows.Err()
+	return
+}
+
+// the arguments of the filter conditions of the admin search, the phone prefix and the name are escaped LIKE patterns
+func profileFilterArgs(tenantID int64, filter ProfileFilter) []interface{} {
+	return []interface{}{
+		tenantID,
+		escapeLike(filter.PhonePrefix),
+		escapeLike(filter.Name),
+		filter.CreatedFrom,
+		filter.CreatedTo,
+		filter.Status,
+		filter.MinLoginCount,
+		filter.MaxLoginCount,
+	}
+}
+
+// escape the wildcards of the LIKE pattern so the value is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// permanently delete the profile together with its devices, history, pending phone change, email verifications,
+// preferences, consents, roles and organization memberships, and expire its data exports, when its deletion schedule
+// has passed the given time. The organizations it is the last owner of are handed over to another member or removed
+// when it is the last member. sql.ErrNoRows is returned when the deletion has been cancelled or the profile has been purged
+func (r Repository) PurgeProfile(ctx context.Context, tenantID int64, profileID int64, now time.Time) (err error) {
+	var id int64
+	err = r.Db.QueryRowContext(ctx, purgeProfileQuery, tenantID, profileID, now).Scan(&id)
+	return
+}
+
+// save the verification link sent to the profile email
+func (r Repository) SaveEmailVerification(ctx context.Context, tenantID int64, verification EmailVerification) (err error) {
+	_, err = r.Db.ExecContext(
+		ctx,
+		saveEmailVerificationQuery,
+		tenantID,
+		verification.ID,
+		verification.ProfileID,
+		verification.Email,
+		verification.ExpiresAt,
+	)
+	return
+}
+
+// mark the profile email as verified and the verification as used,
+// sql.ErrNoRows is returned when the verification has been used, expired or the email has been changed
+func (r Repository) VerifyEmail(ctx context.Context, tenantID int64, verification EmailVerification) (err error) {
+	var profileID int64
+	err = r.Db.QueryRowContext(
+		ctx,
+		verifyEmailQuery,
+		tenantID,
+		verification.ID,
+		verification.ProfileID,
+		verification.Email,
+	).Scan(&profileID)
+	err = translateError(err)
+	return
+}
+
+// save a device which has been used to sign in to the profile and return the device id
+func (r Repository) SaveDevice(ctx context.Context, tenantID int64, device Device) (id int64, err error) {
+	err = r.Db.QueryRowContext(
+		ctx,
+		saveDeviceQuery,
+		tenantID,
+		device.ProfileID,
+		device.Fingerprint,
+		device.UserAgent,
+	).Scan(&id)
+	return
+}
+
+// update the last time the device was used to sign in
+func (r Repository) UpdateDeviceLastSeen(ctx context.Context, tenantID int64, deviceID int64) (err error) {
+	_, err = r.Db.ExecContext(ctx, updateDeviceLastSeenQuery, tenantID, deviceID)
+	return
+}
+
+// get the profile device by its fingerprint
+func (r Repository) GetDeviceByFingerprint(ctx context.Context, tenantID int64, profileID int64, fingerprint string) (device Device, err error) {
+	err = r.Db.QueryRowContext(ctx, getDeviceByFingerprintQuery, tenantID, profileID, fingerprint).Scan(
+		&device.ID,
+		&device.ProfileID,
+		&device.Fingerprint,
+		&device.UserAgent,
+		&device.CreatedAt,
+		&device.LastSeenAt,
+	)
+	return
+}
+
+// check whether any device has been used to sign in to the profile
+func (r Repository) HasDevices(ctx context.Context, tenantID int64, profileID int64) (exists bool, err error) {
+	err = r.Db.QueryRowContext(ctx, hasDevicesQuery, tenantID, profileID).Scan(&exists)
+	return
+}
+
+// get all devices which have been used to sign in to the profile, sorted from the first one
+func (r Repository) GetDevices(ctx context.Context, tenantID int64, profileID int64) (devices []Device, err error) {
+	rows, err := r.Db.QueryContext(ctx, getDevicesQuery, tenantID, profileID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var device Device
+		err = rows.Scan(
+			&device.ID,
+			&device.ProfileID,
+			&device.Fingerprint,
+			&device.UserAgent,
+			&device.CreatedAt,
+			&device.LastSeenAt,
+		)
+		if err != nil {
+			return
+		}
+		devices = append(devices, device)
+	}
+	err = rows.Err()
+	return
+}
+
+// save the pending phone change of the profile with its failed attempts, the previous pending change is replaced
+func (r Repository) SavePhoneChange(ctx context.Context, tenantID int64, change PhoneChange) (err error) {
+	_, err = r.Db.ExecContext(
+		ctx,
+		savePhoneChangeQuery,
+		tenantID,
+		change.ProfileID,
+		change.Phone,
+		change.CodeHash,
+		change.Attempts,
+		change.ExpiresAt,
+	)
+	return
+}
+
+// increment the failed confirmation attempts of the pending phone change and return the incremented attempts
+func (r Repository) IncrementPhoneChangeAttempts(ctx context.Context, tenantID int64, profileID int64) (attempts int, err error) {
+	err = r.Db.QueryRowContext(ctx, incrementPhoneChangeAttemptsQuery, tenantID, profileID).Scan(&attempts)
+	return
+}
+
+// delete the pending phone change of the profile
+func (r Repository) DeletePhoneChange(ctx context.Context, tenantID int64, profileID int64) (err error) {
+	_, err = r.Db.ExecContext(ctx, deletePhoneChangeQuery, tenantID, profileID)
+	return
+}
+
+// get the pending phone change of the profile
+func (r Repository) GetPhoneChange(ctx context.Context, tenantID int64, profileID int64) (change PhoneChange, err error) {
+	err = r.Db.QueryRowContext(ctx, getPhoneChangeQuery, tenantID, profileID).Scan(
+		&change.ProfileID,
+		&change.Phone,
+		&change.CodeHash,
+		&change.Attempts,
+		&change.ExpiresAt,
+		&change.CreatedAt,
+	)
+	return
+}
+
+// save the given profile preferences, the preferences with the JSON null value are removed and the others are kept as is
+func (r Repository) SavePreferences(ctx context.Context, tenantID int64, profileID int64, preferences Preferences) (err error) {
+	values, err := json.Marshal(preferences)
+	if err != nil {
+		return
+	}
+	_, err = r.Db.ExecContext(ctx, savePreferencesQuery, tenantID, profileID, values)
+	return
+}
+
+// get the saved profile preferences, the preferences which have never been saved are not returned
+func (r Repository) GetPreferences(ctx context.Context, tenantID int64, profileID int64) (preferences Preferences, err error) {
+	rows, err := r.Db.QueryContext(ctx, getPreferencesQuery, tenantID, profileID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	preferences = Preferences{}
+	for rows.Next() {
+		var (
+			key   string
+			value []byte
+		)
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return
+		}
+		preferences[key] = value
+	}
+	err = rows.Err()
 	return
 }
+
+// convert given sql.Row or sql.Rows to data export struct
+func (r Repository) scanDataExportRow(row rowScanner, export *DataExport) error {
+	return row.Scan(
+		&export.ID,
+		&export.ProfileID,
+		&export.Status,
+		&export.ArchiveKey,
+		&export.CreatedAt,
+		&export.FinishedAt,
+		&export.ExpiresAt,
+	)
+}
+
+// save a new pending data export and return it along with its status and creation time,
+// sql.ErrNoRows is returned when the profile has another export in progress
+func (r Repository) SaveDataExport(ctx context.Context, tenantID int64, export DataExport) (saved DataExport, err error) {
+	saved = export
+	err = r.Db.QueryRowContext(ctx, saveDataExportQuery, tenantID, export.ID, export.ProfileID).Scan(&saved.Status, &saved.CreatedAt)
+	return
+}
+
+// claim the oldest pending data export, or the export in progress since before staleBefore, to be processed.
+// sql.ErrNoRows is returned when there is no export to be processed
+func (r Repository) ClaimDataExport(ctx context.Context, tenantID int64, staleBefore time.Time) (export DataExport, err error) {
+	err = r.scanDataExportRow(r.Db.QueryRowContext(ctx, claimDataExportQuery, tenantID, staleBefore), &export)
+	return
+}
+
+// save the final status, the archive key and the expiry time of the processed data export
+func (r Repository) FinishDataExport(ctx context.Context, tenantID int64, export DataExport) (err error) {
+	_, err = r.Db.ExecContext(ctx, finishDataExportQuery, tenantID, export.ID, export.Status, export.ArchiveKey, export.ExpiresAt)
+	return
+}
+
+// delete the data export
+func (r Repository) DeleteDataExport(ctx context.Context, tenantID int64, id string) (err error) {
+	_, err = r.Db.ExecContext(ctx, deleteDataExportQuery, tenantID, id)
+	return
+}
+
+// get the data export of the profile
+func (r Repository) GetDataExport(ctx context.Context, tenantID int64, profileID int64, id string) (export DataExport, err error) {
+	err = r.scanDataExportRow(r.Db.QueryRowContext(ctx, getDataExportQuery, tenantID, id, profileID), &export)
+	return
+}
+
+// get the data exports which have expired at the given time, sorted from the earliest expiry
+func (r Repository) GetExpiredDataExports(ctx context.Context, tenantID int64, now time.Time, limit int) (exports []DataExport, err error) {
+	rows, err := r.Db.QueryContext(ctx, getExpiredDataExportsQuery, tenantID, now, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var export DataExport
+		err = r.scanDataExportRow(rows, &export)
+		if err != nil {
+			return
+		}
+		exports = append(exports, export)
+	}
+	err = rows.Err()
+	return
+}
+
+// publish a new version of the terms of service, ErrDuplicate is returned when the version already exists
+func (r Repository) SaveTermsVersion(ctx context.Context, tenantID int64, terms TermsVersion) (err error) {
+	_, err = r.Db.ExecContext(ctx, saveTermsVersionQuery, tenantID, terms.Version, terms.URL, terms.PublishedAt)
+	err = translateError(err)
+	return
+}
+
+// record the acceptance of the terms of service version by the profile and return it along with its id and acceptance time
+func (r Repository) SaveConsent(ctx context.Context, tenantID int64, consent Consent) (saved Consent, err error) {
+	saved = consent
+	err = r.Db.QueryRowContext(
+		ctx,
+		saveConsentQuery,
+		tenantID,
+		consent.ProfileID,
+		consent.TermsVersion,
+		consent.IPAddress,
+		consent.UserAgent,
+	).Scan(&saved.ID, &saved.AcceptedAt)
+	return
+}
+
+// get the terms of service version in effect at the given time, sql.ErrNoRows is returned when no version has been published
+func (r Repository) GetCurrentTerms(ctx context.Context, tenantID int64, now time.Time) (terms TermsVersion, err error) {
+	err = r.Db.QueryRowContext(ctx, getCurrentTermsQuery, tenantID, now).Scan(&terms.Version, &terms.URL, &terms.PublishedAt)
+	return
+}
+
+// get the terms of service version in effect at the given time and whether the profile has accepted it,
+// sql.ErrNoRows is returned when no version has been published
+func (r Repository) GetTermsAcceptance(ctx context.Context, tenantID int64, profileID int64, now time.Time) (terms TermsVersion, accepted bool, err error) {
+	err = r.Db.QueryRowContext(ctx, getTermsAcceptanceQuery, tenantID, profileID, now).Scan(&terms.Version, &terms.URL, &terms.PublishedAt, &accepted)
+	return
+}
+
+// get every terms of service acceptance of the profile, sorted from the earliest one
+func (r Repository) GetConsents(ctx context.Context, tenantID int64, profileID int64) (consents []Consent, err error) {
+	rows, err := r.Db.QueryContext(ctx, getConsentsQuery, tenantID, profileID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Consent
+		err = rows.Scan(
+			&c.ID,
+			&c.ProfileID,
+			&c.TermsVersion,
+			&c.IPAddress,
+			&c.UserAgent,
+			&c.AcceptedAt,
+		)
+		if err != nil {
+			return
+		}
+		consents = append(consents, c)
+	}
+	err = rows.Err()
+	return
+}
+
+// create the role with its permissions and return it along with its id and creation time,
+// ErrDuplicate is returned when the name is already used by another role
+func (r Repository) CreateRole(ctx context.Context, tenantID int64, role Role) (saved Role, err error) {
+	saved = role
+	err = r.Db.QueryRowContext(ctx, createRoleQuery, tenantID, role.Name, role.Description, pq.Array(role.Permissions)).Scan(&saved.ID, &saved.CreatedAt)
+	err = translateError(err)
+	return
+}
+
+// replace the name, the description and the permissions of the role, sql.ErrNoRows is returned when the role does not exist
+// and ErrDuplicate when the name is already used by another role
+func (r Repository) UpdateRole(ctx context.Context, tenantID int64, role Role) (updated Role, err error) {
+	updated = role
+	err = r.Db.QueryRowContext(ctx, updateRoleQuery, tenantID, role.ID, role.Name, role.Description, pq.Array(role.Permissions)).Scan(&updated.CreatedAt)
+	err = translateError(err)
+	return
+}
+
+// delete the role and remove it from its profiles, sql.ErrNoRows is returned when the role does not exist
+func (r Repository) DeleteRole(ctx context.Context, tenantID int64, id int64) (err error) {
+	return r.Db.QueryRowContext(ctx, deleteRoleQuery, tenantID, id).Scan(&id)
+}
+
+// assign the role to the profile, assigning the role the profile already has or the profile or the role of another tenant does nothing
+func (r Repository) AssignRole(ctx context.Context, tenantID int64, profileID, roleID int64) (err error) {
+	_, err = r.Db.ExecContext(ctx, assignRoleQuery, tenantID, profileID, roleID)
+	return
+}
+
+// remove the role from the profile, sql.ErrNoRows is returned when the profile does not have the role
+func (r Repository) RevokeRole(ctx context.Context, tenantID int64, profileID, roleID int64) (err error) {
+	res, err := r.Db.ExecContext(ctx, revokeRoleQuery, tenantID, profileID, roleID)
+	if err != nil {
+		return
+	}
+
+	affected, err := res.RowsAffected()
+	if err == nil && affected == 0 {
+		err = sql.ErrNoRows
+	}
+	return
+}
+
+func (r Repository) scanRoleRow(row rowScanner, role *Role) error {
+	return row.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, pq.Array(&role.Permissions))
+}
+
+// get every role sorted by the name
+func (r Repository) GetRoles(ctx context.Context, tenantID int64) (roles []Role, err error) {
+	return r.queryRoles(ctx, getRolesQuery, tenantID)
+}
+
+// get the role by id, sql.ErrNoRows is returned when the role does not exist
+func (r Repository) GetRole(ctx context.Context, tenantID int64, id int64) (role Role, err error) {
+	err = r.scanRoleRow(r.Db.QueryRowContext(ctx, getRoleQuery, tenantID, id), &role)
+	return
+}
+
+// get the roles assigned to the profile sorted by the name
+func (r Repository) GetProfileRoles(ctx context.Context, tenantID int64, profileID int64) (roles []Role, err error) {
+	return r.queryRoles(ctx, getProfileRolesQuery, tenantID, profileID)
+}
+
+// get the permissions granted by every role of the profile in alphabetical order
+func (r Repository) GetProfilePermissions(ctx context.Context, tenantID int64, profileID int64) (permissions []string, err error) {
+	rows, err := r.Db.QueryContext(ctx, getProfilePermissionsQuery, tenantID, profileID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission string
+		err = rows.Scan(&permission)
+		if err != nil {
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r Repository) queryRoles(ctx context.Context, query string, args ...interface{}) (roles []Role, err error) {
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role Role
+		err = r.scanRoleRow(rows, &role)
+		if err != nil {
+			return
+		}
+		roles = append(roles, role)
+	}
+	err = rows.Err()
+	return
+}
+
+// create the organization with its creator as the owner and return it along with its id and creation time
+func (r Repository) CreateOrganization(ctx context.Context, tenantID int64, organization Organization) (saved Organization, err error) {
+	saved = organization
+	err = r.Db.QueryRowContext(ctx, createOrganizationQuery, tenantID, organization.Name, organization.CreatedBy).Scan(&saved.ID, &saved.CreatedAt)
+	return
+}
+
+// change the organization role of the member, sql.ErrNoRows is returned when the profile is not a member
+// or it is the last owner of the organization being demoted
+func (r Repository) UpdateMemberRole(ctx context.Context, tenantID int64, organizationID, profileID int64, role string) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockOrganizationOwnersQuery, organizationID)
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, updateMemberRoleQuery, tenantID, organizationID, profileID, role).Scan(&profileID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// remove the member from the organization, sql.ErrNoRows is returned when the profile is not a member
+// or it is the last owner of the organization
+func (r Repository) DeleteMember(ctx context.Context, tenantID int64, organizationID, profileID int64) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockOrganizationOwnersQuery, organizationID)
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, deleteMemberQuery, tenantID, organizationID, profileID).Scan(&profileID)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// save the pending invitation sent to the phone and return it along with its status and creation time
+func (r Repository) SaveInvitation(ctx context.Context, tenantID int64, invitation Invitation) (saved Invitation, err error) {
+	saved = invitation
+	err = r.Db.QueryRowContext(
+		ctx,
+		saveInvitationQuery,
+		tenantID,
+		invitation.ID,
+		invitation.OrganizationID,
+		invitation.Phone,
+		invitation.Role,
+		invitation.InvitedBy,
+		invitation.ExpiresAt,
+	).Scan(&saved.Status, &saved.CreatedAt)
+	return
+}
+
+// accept the invitation of the phone and add the profile into the organization with the invited role,
+// sql.ErrNoRows is returned when the invitation has been accepted, declined or has expired, or the profile is already a member
+func (r Repository) AcceptInvitation(ctx context.Context, tenantID int64, invitation Invitation, profileID int64) (err error) {
+	return r.Db.QueryRowContext(ctx, acceptInvitationQuery, tenantID, invitation.ID, profileID, invitation.Phone).Scan(&profileID)
+}
+
+// decline the invitation of the phone, sql.ErrNoRows is returned when the invitation has been accepted, declined or has expired
+func (r Repository) DeclineInvitation(ctx context.Context, tenantID int64, invitation Invitation) (err error) {
+	var id string
+	return r.Db.QueryRowContext(ctx, declineInvitationQuery, tenantID, invitation.ID, invitation.Phone).Scan(&id)
+}
+
+// get the organization by id, sql.ErrNoRows is returned when the organization does not exist
+func (r Repository) GetOrganization(ctx context.Context, tenantID int64, id int64) (organization Organization, err error) {
+	err = r.Db.QueryRowContext(ctx, getOrganizationQuery, tenantID, id).
+		Scan(&organization.ID, &organization.Name, &organization.CreatedBy, &organization.CreatedAt)
+	return
+}
+
+func (r Repository) scanMembershipRow(row rowScanner, membership *Membership) error {
+	return row.Scan(
+		&membership.OrganizationID,
+		&membership.OrganizationName,
+		&membership.ProfileID,
+		&membership.ProfileName,
+		&membership.Role,
+		&membership.CreatedAt,
+	)
+}
+
+// get the organization role of the profile, sql.ErrNoRows is returned when the profile is not a member
+func (r Repository) GetMembership(ctx context.Context, tenantID int64, organizationID, profileID int64) (membership Membership, err error) {
+	err = r.scanMembershipRow(r.Db.QueryRowContext(ctx, getMembershipQuery, tenantID, organizationID, profileID), &membership)
+	return
+}
+
+// get the members of the organization sorted by their name
+func (r Repository) GetMembers(ctx context.Context, tenantID int64, organizationID int64) (members []Membership, err error) {
+	return r.queryMemberships(ctx, getMembersQuery, tenantID, organizationID)
+}
+
+// get the organizations of the profile sorted by their name
+func (r Repository) GetProfileMemberships(ctx context.Context, tenantID int64, profileID int64) (memberships []Membership, err error) {
+	return r.queryMemberships(ctx, getProfileMembershipsQuery, tenantID, profileID)
+}
+
+// get the organizations of which the profile is the only owner sorted by their name
+func (r Repository) GetSoleOwnerMemberships(ctx context.Context, tenantID int64, profileID int64) (memberships []Membership, err error) {
+	return r.queryMemberships(ctx, getSoleOwnerMembershipsQuery, tenantID, profileID)
+}
+
+func (r Repository) queryMemberships(ctx context.Context, query string, args ...interface{}) (memberships []Membership, err error) {
+	rows, err := r.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var membership Membership
+		err = r.scanMembershipRow(rows, &membership)
+		if err != nil {
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+	err = rows.Err()
+	return
+}
+
+// get the previous name and phone of the profile, sorted from the latest change
+func (r Repository) GetProfileHistory(ctx context.Context, tenantID int64, profileID, beforeID int64, limit int) (history []ProfileHistory, err error) {
+	rows, err := r.Db.QueryContext(ctx, getProfileHistoryQuery, tenantID, profileID, beforeID, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h ProfileHistory
+		err = rows.Scan(
+			&h.ID,
+			&h.ProfileID,
+			&h.ActorID,
+			&h.Name,
+			&h.Phone,
+			&h.ChangedAt,
+		)
+		if err != nil {
+			return
+		}
+		history = append(history, h)
+	}
+	err = rows.Err()
+	return
+}
+
+// append the event into the audit trail and chain it with the hash of the latest event.
+// the event time is set here so it has the same precision as the stored one.
+func (r Repository) SaveAuditEvent(ctx context.Context, tenantID int64, event AuditEvent) (id int64, err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, lockAuditLogQuery, tenantID)
+	if err != nil {
+		return
+	}
+
+	err = tx.QueryRowContext(ctx, getLastAuditHashQuery, tenantID).Scan(&event.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.Hash = HashAuditEvent(event)
+	err = tx.QueryRowContext(
+		ctx,
+		saveAuditEventQuery,
+		tenantID,
+		event.ActorID,
+		event.TargetID,
+		event.Action,
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		event.RequestID,
+		event.IPAddress,
+		event.CreatedAt,
+		event.PrevHash,
+		event.Hash,
+	).Scan(&id)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// get the audit events matching the filter, sorted from the newest one
+func (r Repository) GetAuditEvents(ctx context.Context, tenantID int64, filter AuditEventFilter) (events []AuditEvent, err error) {
+	rows, err := r.Db.QueryContext(
+		ctx,
+		getAuditEventsQuery,
+		tenantID,
+		filter.ActorID,
+		filter.TargetID,
+		filter.Action,
+		filter.From,
+		filter.To,
+		filter.BeforeID,
+		filter.Limit,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			event         AuditEvent
+			before, after sql.NullString
+		)
+		err = rows.Scan(
+			&event.ID,
+			&event.ActorID,
+			&event.TargetID,
+			&event.Action,
+			&before,
+			&after,
+			&event.RequestID,
+			&event.IPAddress,
+			&event.CreatedAt,
+			&event.PrevHash,
+			&event.Hash,
+		)
+		if err != nil {
+			return
+		}
+
+		if before.Valid {
+			event.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			event.After = json.RawMessage(after.String)
+		}
+		events = append(events, event)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// HashAuditEvent compute the hash of the event chained with its previous event hash,
+// it can be used to verify that the stored audit trail has not been tampered.
+func HashAuditEvent(event AuditEvent) string {
+	c, _ := json.Marshal([]interface{}{
+		event.PrevHash,
+		event.ActorID.Int64,
+		event.TargetID.Int64,
+		event.Action,
+		string(event.Before),
+		string(event.After),
+		event.RequestID,
+		event.IPAddress,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(c)
+	return hex.EncodeToString(sum[:])
+}
+
+// convert the raw json into nullable sql value, the empty json will be stored as null
+func nullJSON(raw json.RawMessage) sql.NullString {
+	return sql.NullString{
+		String: string(raw),
+		Valid:  len(raw) > 0,
+	}
+}
@@ -2,14 +2,173 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/lib/pq"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
-var mockProfileColumn = []string{"id", "name", "phone", "password", "login_count", "created_at", "updated_at"}
+var (
+	mockTenantColumn     = []string{"id", "slug", "name", "host", "created_at"}
+	mockProfileColumn    = []string{"id", "name", "phone", "email", "email_verified_at", "avatar_key", "deletion_scheduled_at", "status", "status_reason", "password", "login_count", "created_at", "updated_at", "version"}
+	mockHistoryColumn    = []string{"id", "profile_id", "actor_id", "name", "phone", "changed_at"}
+	mockDeviceColumn     = []string{"id", "profile_id", "fingerprint", "user_agent", "created_at", "last_seen_at"}
+	mockAuditColumn      = []string{"id", "actor_id", "target_id", "action", "before", "after", "request_id", "ip_address", "created_at", "prev_hash", "hash"}
+	mockDataExportColumn = []string{"id", "profile_id", "status", "archive_key", "created_at", "finished_at", "expires_at"}
+	mockRoleColumn       = []string{"id", "name", "description", "created_at", "permissions"}
+	mockMembershipColumn = []string{"organization_id", "organization_name", "profile_id", "profile_name", "role", "created_at"}
+)
+
+func TestGetTenant(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		get       func() (Tenant, error)
+		expectErr bool
+	}{
+		{
+			name:      "error get by id",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery("select (.+) from tenant where id =").WillReturnError(mockErr)
+			},
+			get: func() (Tenant, error) { return r.GetTenant(context.Background(), 1) },
+		},
+		{
+			name: "success get by id",
+			mock: func() {
+				mock.ExpectQuery("select (.+) from tenant where id =").WithArgs(int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockTenantColumn).AddRow(1, "default", "Default", "", time.Now()),
+				)
+			},
+			get: func() (Tenant, error) { return r.GetTenant(context.Background(), 1) },
+		},
+		{
+			name:      "error get by slug",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery("select (.+) from tenant where slug =").WillReturnError(sql.ErrNoRows)
+			},
+			get: func() (Tenant, error) { return r.GetTenantBySlug(context.Background(), "konoha") },
+		},
+		{
+			name: "success get by slug",
+			mock: func() {
+				mock.ExpectQuery("select (.+) from tenant where slug =").WithArgs("konoha").WillReturnRows(
+					sqlmock.NewRows(mockTenantColumn).AddRow(2, "konoha", "Konoha", "konoha.id", time.Now()),
+				)
+			},
+			get: func() (Tenant, error) { return r.GetTenantBySlug(context.Background(), "konoha") },
+		},
+		{
+			name:      "error get by host",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery("select (.+) from tenant where host =").WillReturnError(sql.ErrNoRows)
+			},
+			get: func() (Tenant, error) { return r.GetTenantByHost(context.Background(), "konoha.id") },
+		},
+		{
+			name: "success get by host",
+			mock: func() {
+				mock.ExpectQuery("select (.+) from tenant where host =").WithArgs("konoha.id").WillReturnRows(
+					sqlmock.NewRows(mockTenantColumn).AddRow(2, "konoha", "Konoha", "konoha.id", time.Now()),
+				)
+			},
+			get: func() (Tenant, error) { return r.GetTenantByHost(context.Background(), "konoha.id") },
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := tt.get()
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetTenants(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from tenant order by id"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockTenantColumn).
+						AddRow(1, "default", "Default", "", time.Now()).
+						AddRow(2, "konoha", "Konoha", "konoha.id", time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		tenants, err := r.GetTenants(context.Background())
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(tenants) != tt.expectCount {
+			t.Errorf("expect %d tenants, got %d", tt.expectCount, len(tenants))
+		}
+	}
+}
 
 func TestSaveProfile(t *testing.T) {
 	var (
@@ -39,7 +198,7 @@ func TestSaveProfile(t *testing.T) {
 			name: "success",
 			mock: func() {
 				mock.ExpectQuery(mockQuery).WillReturnRows(
-					sqlmock.NewRows([]string{"id"}).AddRow(1),
+					sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()),
 				)
 			},
 		},
@@ -52,18 +211,78 @@ func TestSaveProfile(t *testing.T) {
 			}
 		})
 
-		_, err := r.SaveProfile(context.Background(), User{})
+		_, err := r.SaveProfile(context.Background(), 1, User{})
 		if (err != nil) != tt.expectErr {
 			t.Error(err)
 		}
 	}
 }
 
+func TestSaveProfileWithConsent(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with saved as \\(insert into profile (.+)\\), consent as \\(insert into profile_consent (.+) from saved\\)"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error duplicate phone",
+			expectErr: ErrDuplicate,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(&pq.Error{Code: pqUniqueViolation})
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "narto", "+6281122334455", "hash", "2024-01", "127.0.0.1", "curl/8.0").WillReturnRows(
+					sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.SaveProfileWithConsent(
+			context.Background(),
+			1,
+			User{Name: "narto", Phone: "+6281122334455", Password: "hash"},
+			Consent{TermsVersion: "2024-01", IPAddress: "127.0.0.1", UserAgent: "curl/8.0"},
+		)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
 func TestGetProfileByPhone(t *testing.T) {
 	var (
 		// mock dependencies
 		db, mock, _ = sqlmock.New()
-		mockQuery   = "select (.+) from profile where phone"
+		mockQuery   = "select (.+) from profile where tenant_id = (.+) and phone"
 
 		// mock request and responser
 		mockErr = errors.New("an error")
@@ -88,7 +307,7 @@ func TestGetProfileByPhone(t *testing.T) {
 			mock: func() {
 				mock.ExpectQuery(mockQuery).WillReturnRows(
 					sqlmock.NewRows(mockProfileColumn).
-						AddRow(1, "narto", "+62", "pass", 1, time.Now(), nil),
+						AddRow(1, "narto", "+62", "", nil, "", nil, "active", "", "pass", 1, time.Now(), nil, 1),
 				)
 			},
 		},
@@ -101,18 +320,18 @@ func TestGetProfileByPhone(t *testing.T) {
 			}
 		})
 
-		_, err := r.GetProfileByPhone(context.Background(), "")
+		_, err := r.GetProfileByPhone(context.Background(), 1, "")
 		if (err != nil) != tt.expectErr {
 			t.Error(err)
 		}
 	}
 }
 
-func TestGetProfileByID(t *testing.T) {
+func TestGetProfileByEmail(t *testing.T) {
 	var (
 		// mock dependencies
 		db, mock, _ = sqlmock.New()
-		mockQuery   = "select (.+) from profile (.+) id ="
+		mockQuery   = "select (.+) from profile where tenant_id = (.+) and email = (.+) and email_verified_at is not null"
 
 		// mock request and responser
 		mockErr = errors.New("an error")
@@ -135,9 +354,9 @@ func TestGetProfileByID(t *testing.T) {
 		{
 			name: "success",
 			mock: func() {
-				mock.ExpectQuery(mockQuery).WillReturnRows(
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "narto@example.com").WillReturnRows(
 					sqlmock.NewRows(mockProfileColumn).
-						AddRow(1, "narto", "+62", "pass", 1, time.Now(), nil),
+						AddRow(1, "narto", "+62", "narto@example.com", time.Now(), "", nil, "active", "", "pass", 1, time.Now(), nil, 1),
 				)
 			},
 		},
@@ -150,18 +369,18 @@ func TestGetProfileByID(t *testing.T) {
 			}
 		})
 
-		_, err := r.GetProfileByID(context.Background(), 1)
+		_, err := r.GetProfileByEmail(context.Background(), 1, "narto@example.com")
 		if (err != nil) != tt.expectErr {
 			t.Error(err)
 		}
 	}
 }
 
-func TestGetUpdateLoginCount(t *testing.T) {
+func TestGetProfileByID(t *testing.T) {
 	var (
 		// mock dependencies
 		db, mock, _ = sqlmock.New()
-		mockQuery   = "update profile set login_count (.+) where id ="
+		mockQuery   = "select (.+) from profile where tenant_id = (.+) and id ="
 
 		// mock request and responser
 		mockErr = errors.New("an error")
@@ -178,13 +397,16 @@ func TestGetUpdateLoginCount(t *testing.T) {
 			name:      "error scan",
 			expectErr: true,
 			mock: func() {
-				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
 			},
 		},
 		{
 			name: "success",
 			mock: func() {
-				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockProfileColumn).
+						AddRow(1, "narto", "+62", "", nil, "", nil, "active", "", "pass", 1, time.Now(), nil, 1),
+				)
 			},
 		},
 	}
@@ -196,18 +418,18 @@ func TestGetUpdateLoginCount(t *testing.T) {
 			}
 		})
 
-		err := r.UpdateLoginCount(context.Background(), 1, 1)
+		_, err := r.GetProfileByID(context.Background(), 1, 1)
 		if (err != nil) != tt.expectErr {
 			t.Error(err)
 		}
 	}
 }
 
-func TestUpdateUserByID(t *testing.T) {
+func TestGetUpdateLoginCount(t *testing.T) {
 	var (
 		// mock dependencies
 		db, mock, _ = sqlmock.New()
-		mockQuery   = "update profile (.+) where id ="
+		mockQuery   = "update profile set login_count (.+) where tenant_id = (.+) and id ="
 
 		// mock request and responser
 		mockErr = errors.New("an error")
@@ -242,9 +464,3607 @@ func TestUpdateUserByID(t *testing.T) {
 			}
 		})
 
-		err := r.UpdateUserByID(context.Background(), User{})
+		err := r.UpdateLoginCount(context.Background(), 1, 1, 1)
 		if (err != nil) != tt.expectErr {
 			t.Error(err)
 		}
 	}
 }
+
+func TestUpdateUserByID(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with previous as (.+) from profile where tenant_id = (.+) and id = (.+) and version = (.+)insert into profile_history (.+)update profile (.+) select version, updated_at, email_verified_at from updated"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name          string
+		mock          func()
+		expectErr     error
+		expectVersion int
+	}{
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error version mismatch",
+			expectErr: ErrVersionMismatch,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:          "success",
+			expectVersion: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "narto", "+62", int64(1), int64(1), int64(2), "").WillReturnRows(
+					sqlmock.NewRows([]string{"version", "updated_at", "email_verified_at"}).AddRow(2, time.Now(), nil),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		updated, err := r.UpdateUserByID(context.Background(), 1, User{ID: 1, Name: "narto", Phone: "+62", Version: 1}, 2)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if tt.expectErr == nil && updated.Version != tt.expectVersion {
+			t.Errorf("expect version %d, got %d", tt.expectVersion, updated.Version)
+		}
+		if tt.expectErr == nil && !updated.UpdatedAt.Valid {
+			t.Error("expect updated_at to be set")
+		}
+	}
+}
+
+func TestUpdateProfileAvatar(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with previous as (.+) from profile where tenant_id = (.+) and id = (.+) update profile set avatar_key"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name           string
+		mock           func()
+		expectErr      error
+		expectPrevious string
+	}{
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:           "success",
+			expectPrevious: "avatars/1/old",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "avatars/1/new", int64(1)).WillReturnRows(
+					sqlmock.NewRows([]string{"avatar_key"}).AddRow("avatars/1/old"),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		previous, err := r.UpdateProfileAvatar(context.Background(), 1, 1, "avatars/1/new")
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if previous != tt.expectPrevious {
+			t.Errorf("expect previous key %q, got %q", tt.expectPrevious, previous)
+		}
+	}
+}
+
+func TestScheduleProfileDeletion(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update profile set deletion_scheduled_at = coalesce(.+) where tenant_id = (.+) and id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		purgeAt = time.Now().Add(time.Hour).Truncate(time.Second)
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"deletion_scheduled_at"}))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), purgeAt).WillReturnRows(
+					sqlmock.NewRows([]string{"deletion_scheduled_at"}).AddRow(purgeAt),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		scheduledAt, err := r.ScheduleProfileDeletion(context.Background(), 1, 1, purgeAt)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if err == nil && !scheduledAt.Equal(purgeAt) {
+			t.Errorf("expect scheduled at %v, got %v", purgeAt, scheduledAt)
+		}
+	}
+}
+
+func TestCancelProfileDeletion(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update profile set deletion_scheduled_at = null where tenant_id = (.+) and id = (.+) and deletion_scheduled_at >"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		now     = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), now).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.CancelProfileDeletion(context.Background(), 1, 1, now)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestUpdateProfileStatus(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update profile set status = (.+), status_reason = nullif(.+), status_changed_by = (.+) where tenant_id = (.+) and id = (.+) returning"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows(mockProfileColumn))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(2), ProfileStatusSuspended, "spam", int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockProfileColumn).
+						AddRow(2, "narto", "+62", "", nil, "", nil, ProfileStatusSuspended, "spam", "pass", 1, time.Now(), nil, 1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		updated, err := r.UpdateProfileStatus(context.Background(), 1, 2, ProfileStatusSuspended, "spam", 1)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if err == nil && (updated.Status != ProfileStatusSuspended || updated.StatusReason != "spam") {
+			t.Errorf("unexpected status %q %q", updated.Status, updated.StatusReason)
+		}
+	}
+}
+
+func TestExportProfiles(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _  = sqlmock.New()
+		mockDeclare  = "declare profile_export no scroll cursor for select (.+) from profile where (.+) order by id"
+		mockFetch    = "fetch forward (.+) from profile_export"
+		mockProfiles = func() *sqlmock.Rows {
+			return sqlmock.NewRows(mockProfileColumn).
+				AddRow(1, "narto", "+6281234567890", "", nil, "", nil, ProfileStatusActive, "", "pass", 1, time.Now(), nil, 1).
+				AddRow(2, "sasuke", "+6281234567891", "", nil, "", nil, ProfileStatusActive, "", "pass", 1, time.Now(), nil, 1)
+		}
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		filter  = ProfileFilter{PhonePrefix: "+62", Status: ProfileStatusActive}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		fnErr       error
+		expectErr   error
+		expectCount int
+	}{
+		{
+			name:      "error begin",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin().WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error declare",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockDeclare).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error fetch",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockDeclare).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockFetch).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockDeclare).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockFetch).WillReturnRows(sqlmock.NewRows(mockProfileColumn).AddRow(1, "narto", "+62", "", nil, "", nil, ProfileStatusActive, "", "pass", 1, time.Now(), nil, 1).RowError(0, sql.ErrNoRows))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:        "error fn",
+			fnErr:       mockErr,
+			expectErr:   mockErr,
+			expectCount: 1,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockDeclare).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockFetch).WillReturnRows(mockProfiles())
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 4,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockDeclare).
+					WithArgs(int64(1), "+62", "", nil, nil, ProfileStatusActive, nil, nil).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockFetch).WillReturnRows(mockProfiles())
+				mock.ExpectQuery(mockFetch).WillReturnRows(mockProfiles())
+				mock.ExpectQuery(mockFetch).WillReturnRows(sqlmock.NewRows(mockProfileColumn))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		var count int
+		err := r.ExportProfiles(context.Background(), 1, filter, func(user User) error {
+			count++
+			return tt.fnErr
+		})
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if count != tt.expectCount {
+			t.Errorf("expect %d profiles, got %d", tt.expectCount, count)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestImportProfiles(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into profile (.+) select (.+) from unnest(.+) on conflict do nothing returning id, phone, created_at"
+
+		// mock request and responser
+		mockErr    = errors.New("an error")
+		verifiedAt = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		users      = []User{
+			{Name: "narto", Phone: "+6281234567890", Password: "hash"},
+			{Name: "sasuke", Phone: "+6281234567891", Email: "sasuke@konoha.id", EmailVerifiedAt: sql.NullTime{Time: verifiedAt, Valid: true}, Password: "hash"},
+		}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name         string
+		mock         func()
+		expectErr    error
+		expectPhones []string
+	}{
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "phone", "created_at"}).
+						AddRow(1, users[0].Phone, time.Now()).
+						RowError(0, mockErr),
+				)
+			},
+		},
+		{
+			name:         "success skip registered",
+			expectPhones: []string{users[1].Phone},
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(
+						int64(1),
+						`{"narto","sasuke"}`,
+						`{"+6281234567890","+6281234567891"}`,
+						`{"","sasuke@konoha.id"}`,
+						`{"","2023-01-02 03:04:05"}`,
+						`{"hash","hash"}`,
+					).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "phone", "created_at"}).AddRow(2, users[1].Phone, time.Now()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		imported, err := r.ImportProfiles(context.Background(), 1, users)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		var phones []string
+		for _, user := range imported {
+			if user.ID == 0 || user.Name == "" {
+				t.Errorf("unexpected imported user %+v", user)
+			}
+			phones = append(phones, user.Phone)
+		}
+		if err == nil && !reflect.DeepEqual(phones, tt.expectPhones) {
+			t.Errorf("expect phones %v, got %v", tt.expectPhones, phones)
+		}
+	}
+}
+
+func TestGetRegisteredIdentifiers(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select phone from profile where tenant_id = (.+) and phone = any(.+) union all select email from profile where tenant_id = (.+) and email = any"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name             string
+		mock             func()
+		expectErr        error
+		expectRegistered []string
+	}{
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"phone"}).AddRow("+62").RowError(0, mockErr),
+				)
+			},
+		},
+		{
+			name:             "success",
+			expectRegistered: []string{"+62", "narto@konoha.id"},
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), `{"+62"}`, `{"narto@konoha.id"}`).
+					WillReturnRows(sqlmock.NewRows([]string{"phone"}).AddRow("+62").AddRow("narto@konoha.id"))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		registered, err := r.GetRegisteredIdentifiers(context.Background(), 1, []string{"+62"}, []string{"narto@konoha.id"})
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if err == nil && !reflect.DeepEqual(registered, tt.expectRegistered) {
+			t.Errorf("expect registered %v, got %v", tt.expectRegistered, registered)
+		}
+	}
+}
+
+func TestGetProfileStatus(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select status, deletion_scheduled_at from profile where tenant_id = (.+) and id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name           string
+		mock           func()
+		expectStatus   string
+		expectSchedule bool
+		expectErr      error
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"status", "deletion_scheduled_at"}))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:         "success",
+			expectStatus: ProfileStatusDisabled,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows([]string{"status", "deletion_scheduled_at"}).AddRow(ProfileStatusDisabled, nil),
+				)
+			},
+		},
+		{
+			name:           "success pending deletion",
+			expectStatus:   ProfileStatusActive,
+			expectSchedule: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows([]string{"status", "deletion_scheduled_at"}).AddRow(ProfileStatusActive, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		status, deletionScheduledAt, err := r.GetProfileStatus(context.Background(), 1, 1)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if status != tt.expectStatus {
+			t.Errorf("expect status %q, got %q", tt.expectStatus, status)
+		}
+		if deletionScheduledAt.Valid != tt.expectSchedule {
+			t.Errorf("expect deletion scheduled %v, got %v", tt.expectSchedule, deletionScheduledAt.Valid)
+		}
+	}
+}
+
+func TestGetProfilesToPurge(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from profile where tenant_id = (.+) and deletion_scheduled_at <= (.+) order by deletion_scheduled_at limit"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		now     = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), now, int64(10)).WillReturnRows(
+					sqlmock.NewRows(mockProfileColumn).
+						AddRow(1, "narto", "+62", "", nil, "", now, "active", "", "pass", 1, time.Now(), nil, 1).
+						AddRow(2, "sasuke", "+63", "", nil, "avatars/2/abc", now, "active", "", "pass", 1, time.Now(), nil, 1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		users, err := r.GetProfilesToPurge(context.Background(), 1, now, 10)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(users) != tt.expectCount {
+			t.Errorf("expect %d profiles, got %d", tt.expectCount, len(users))
+		}
+	}
+}
+
+func TestSearchProfiles(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from profile where tenant_id = (.+) and (.+) and \\(\\$8::integer is null or login_count <= \\$8\\) "
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		now     = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		filter      ProfileFilter
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error unknown sort",
+			filter:    ProfileFilter{Sort: "password", Limit: 10},
+			expectErr: true,
+		},
+		{
+			name:      "error query",
+			filter:    ProfileFilter{Sort: ProfileSortCreatedAt, Limit: 10},
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			filter:    ProfileFilter{Sort: ProfileSortCreatedAt, Limit: 10},
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+		{
+			name:        "success first page",
+			filter:      ProfileFilter{PhonePrefix: "+62", Name: "50%_off", Status: ProfileStatusActive, Sort: ProfileSortName, Limit: 10},
+			expectCount: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery+"order by name asc, id asc limit \\$9").
+					WithArgs(int64(1), "+62", `50\%\_off`, sql.NullTime{}, sql.NullTime{}, ProfileStatusActive, sql.NullInt64{}, sql.NullInt64{}, int64(10)).
+					WillReturnRows(
+						sqlmock.NewRows(mockProfileColumn).
+							AddRow(1, "narto", "+62", "", nil, "", nil, "active", "", "pass", 1, now, nil, 1),
+					)
+			},
+		},
+		{
+			name: "success next page",
+			filter: ProfileFilter{
+				CreatedFrom:   sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+				MinLoginCount: sql.NullInt64{Int64: 1, Valid: true},
+				Sort:          ProfileSortCreatedAt,
+				Desc:          true,
+				After:         &ProfileCursor{Value: "2024-01-02T15:04:05Z", ID: 3},
+				Limit:         10,
+			},
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery+"and \\(created_at, id\\) < \\(\\$9, \\$10\\) order by created_at desc, id desc limit \\$11").
+					WithArgs(int64(1), "", "", sql.NullTime{Time: now.Add(-time.Hour), Valid: true}, sql.NullTime{}, "", sql.NullInt64{Int64: 1, Valid: true}, sql.NullInt64{}, "2024-01-02T15:04:05Z", int64(3), int64(10)).
+					WillReturnRows(
+						sqlmock.NewRows(mockProfileColumn).
+							AddRow(2, "narto", "+62", "", nil, "", nil, "active", "", "pass", 1, now, nil, 1).
+							AddRow(1, "sasuke", "+63", "", nil, "", now, "active", "", "pass", 3, now, nil, 1),
+					)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		users, err := r.SearchProfiles(context.Background(), 1, tt.filter)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(users) != tt.expectCount {
+			t.Errorf("expect %d profiles, got %d", tt.expectCount, len(users))
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPurgeProfile(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with purged as \\(delete from profile where tenant_id = (.+) and id = (.+) and deletion_scheduled_at <= (.+)delete from profile_preference (.+)delete from profile_consent (.+)delete from organization_member (.+)sole_owned as (.+)update organization_member m set role = 'owner' (.+)delete from organization g (.+)delete from organization_invitation (.+)update data_export (.+) select id from purged"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		now     = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), now).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.PurgeProfile(context.Background(), 1, 1, now)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSaveEmailVerification(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into email_verification"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.SaveEmailVerification(context.Background(), 1, EmailVerification{ID: "abc", ProfileID: 1, Email: "narto@example.com"})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with used as \\(update email_verification (.+)\\) update profile set email_verified_at"
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error used or expired",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "error verified by another profile",
+			expectErr: ErrDuplicateEmail,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: profileEmailConstraint})
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "abc", int64(1), "narto@example.com").WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.VerifyEmail(context.Background(), 1, EmailVerification{ID: "abc", ProfileID: 1, Email: "narto@example.com"})
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSavePhoneChange(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into phone_change (.+) on conflict"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.SavePhoneChange(context.Background(), 1, PhoneChange{ProfileID: 1})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestIncrementPhoneChangeAttempts(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update phone_change set attempts (.+) where tenant_id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"attempts"}).AddRow(1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.IncrementPhoneChangeAttempts(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDeletePhoneChange(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "delete from phone_change where tenant_id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.DeletePhoneChange(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetPhoneChange(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from phone_change where tenant_id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"profile_id", "phone", "code_hash", "attempts", "expires_at", "created_at"}).
+						AddRow(1, "+6281122334455", "hash", 0, time.Now(), time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.GetPhoneChange(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSavePreferences(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with input as (.+) jsonb_each(.+) insert into profile_preference (.+) on conflict"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WithArgs(int64(1), int64(1), []byte(`{"language":"id","timezone":null}`)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.SavePreferences(context.Background(), 1, 1, Preferences{"language": json.RawMessage(`"id"`), "timezone": json.RawMessage(`null`)})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetPreferences(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select key, value from profile_preference where tenant_id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"key"}).AddRow("language"),
+				)
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows([]string{"key", "value"}).
+						AddRow("language", []byte(`"id"`)).
+						AddRow("timezone", []byte(`"Asia/Jakarta"`)),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		preferences, err := r.GetPreferences(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(preferences) != tt.expectCount {
+			t.Errorf("expect %d preferences, got %d", tt.expectCount, len(preferences))
+		}
+	}
+}
+
+func TestSaveDataExport(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into data_export (.+) on conflict (.+) do nothing"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error in progress",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"status", "created_at"}))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "abc", int64(1)).WillReturnRows(
+					sqlmock.NewRows([]string{"status", "created_at"}).AddRow(DataExportPending, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		saved, err := r.SaveDataExport(context.Background(), 1, DataExport{ID: "abc", ProfileID: 1})
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+		if err == nil && saved.Status != DataExportPending {
+			t.Errorf("expect status %q, got %q", DataExportPending, saved.Status)
+		}
+	}
+}
+
+func TestClaimDataExport(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update data_export set status = 'processing'(.+) for update skip locked"
+
+		// mock request and responser
+		mockErr     = errors.New("an error")
+		staleBefore = time.Now().Add(-time.Hour)
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows(mockDataExportColumn))
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), staleBefore).WillReturnRows(
+					sqlmock.NewRows(mockDataExportColumn).AddRow("abc", 1, DataExportProcessing, "", time.Now(), nil, nil),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.ClaimDataExport(context.Background(), 1, staleBefore)
+		if err != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFinishDataExport(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update data_export set status = (.+), archive_key = (.+) where tenant_id = (.+) and id ="
+
+		// mock request and responser
+		mockErr   = errors.New("an error")
+		expiresAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WithArgs(int64(1), "abc", DataExportCompleted, "exports/1/abc.zip", expiresAt).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.FinishDataExport(context.Background(), 1, DataExport{
+			ID:         "abc",
+			Status:     DataExportCompleted,
+			ArchiveKey: "exports/1/abc.zip",
+			ExpiresAt:  expiresAt,
+		})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDeleteDataExport(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "delete from data_export where tenant_id = (.+) and id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WithArgs(int64(1), "abc").WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.DeleteDataExport(context.Background(), 1, "abc")
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetDataExport(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from data_export where tenant_id = (.+) and id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), "abc", int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockDataExportColumn).
+						AddRow("abc", 1, DataExportCompleted, "exports/1/abc.zip", time.Now(), time.Now(), time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.GetDataExport(context.Background(), 1, 1, "abc")
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetExpiredDataExports(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from data_export where tenant_id = (.+) and expires_at <= (.+) order by expires_at limit"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		now     = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("abc"))
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), now, int64(10)).WillReturnRows(
+					sqlmock.NewRows(mockDataExportColumn).
+						AddRow("abc", 1, DataExportCompleted, "exports/1/abc.zip", time.Now(), time.Now(), now).
+						AddRow("def", 2, DataExportFailed, "", time.Now(), time.Now(), now),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		exports, err := r.GetExpiredDataExports(context.Background(), 1, now, 10)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(exports) != tt.expectCount {
+			t.Errorf("expect %d exports, got %d", tt.expectCount, len(exports))
+		}
+	}
+}
+
+func TestSaveTermsVersion(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into terms_version"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		terms   = TermsVersion{Version: "2024-01", URL: "https://example.com/terms", PublishedAt: time.Now()}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error duplicate",
+			expectErr: ErrDuplicate,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: "terms_version_pkey"})
+			},
+		},
+		{
+			name:      "error exec",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WithArgs(int64(1), terms.Version, terms.URL, terms.PublishedAt).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.SaveTermsVersion(context.Background(), 1, terms)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestSaveConsent(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into profile_consent (.+) returning id, accepted_at"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		consent = Consent{ProfileID: 1, TermsVersion: "2024-01", IPAddress: "127.0.0.1", UserAgent: "curl"}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+		expectID  int64
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:     "success",
+			expectID: 3,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), "2024-01", "127.0.0.1", "curl").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "accepted_at"}).AddRow(3, time.Now()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		saved, err := r.SaveConsent(context.Background(), 1, consent)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if saved.ID != tt.expectID {
+			t.Errorf("expect id %d, got %d", tt.expectID, saved.ID)
+		}
+	}
+}
+
+func TestGetCurrentTerms(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select version, url, published_at from terms_version where tenant_id = (.+) and published_at <= (.+) order by published_at desc"
+
+		// mock request and responser
+		now = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name          string
+		mock          func()
+		expectErr     error
+		expectVersion string
+	}{
+		{
+			name:      "error no rows",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"version", "url", "published_at"}))
+			},
+		},
+		{
+			name:          "success",
+			expectVersion: "2024-01",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), now).WillReturnRows(
+					sqlmock.NewRows([]string{"version", "url", "published_at"}).AddRow("2024-01", "https://example.com/terms", now),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		terms, err := r.GetCurrentTerms(context.Background(), 1, now)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if terms.Version != tt.expectVersion {
+			t.Errorf("expect version %q, got %q", tt.expectVersion, terms.Version)
+		}
+	}
+}
+
+func TestGetTermsAcceptance(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select t.version, t.url, t.published_at, exists \\(select 1 from profile_consent (.+)from terms_version t where t.tenant_id = (.+) and t.published_at <="
+		mockColumn  = []string{"version", "url", "published_at", "accepted"}
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		now     = time.Now()
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name           string
+		mock           func()
+		expectErr      bool
+		expectAccepted bool
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success not accepted",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), now).WillReturnRows(
+					sqlmock.NewRows(mockColumn).AddRow("2024-01", "https://example.com/terms", now, false),
+				)
+			},
+		},
+		{
+			name:           "success accepted",
+			expectAccepted: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), now).WillReturnRows(
+					sqlmock.NewRows(mockColumn).AddRow("2024-01", "https://example.com/terms", now, true),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, accepted, err := r.GetTermsAcceptance(context.Background(), 1, 1, now)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if accepted != tt.expectAccepted {
+			t.Errorf("expect accepted %v, got %v", tt.expectAccepted, accepted)
+		}
+	}
+}
+
+func TestGetConsents(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from profile_consent where tenant_id = (.+) and profile_id = (.+) order by id"
+		mockColumn  = []string{"id", "profile_id", "terms_version", "ip_address", "user_agent", "accepted_at"}
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockColumn).
+						AddRow(1, 1, "2023-01", "127.0.0.1", "curl", time.Now()).
+						AddRow(2, 1, "2024-01", "127.0.0.1", "curl", time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		consents, err := r.GetConsents(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(consents) != tt.expectCount {
+			t.Errorf("expect %d consents, got %d", tt.expectCount, len(consents))
+		}
+	}
+}
+
+func TestCreateRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into role (.+) returning id, created_at"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		role    = Role{Name: "support", Description: "customer support", Permissions: []string{"roles:read", "users:read"}}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+		expectID  int64
+	}{
+		{
+			name:      "error duplicate",
+			expectErr: ErrDuplicate,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: "role_name_key"})
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:     "success",
+			expectID: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), role.Name, role.Description, `{"roles:read","users:read"}`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		saved, err := r.CreateRole(context.Background(), 1, role)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if saved.ID != tt.expectID {
+			t.Errorf("expect id %d, got %d", tt.expectID, saved.ID)
+		}
+	}
+}
+
+func TestUpdateRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with updated as \\(update role (.+) select created_at from updated"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+		role    = Role{ID: 1, Name: "support", Permissions: []string{"users:read"}}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error not found",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "error duplicate",
+			expectErr: ErrDuplicate,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: "role_name_key"})
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), role.ID, role.Name, role.Description, `{"users:read"}`).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		updated, err := r.UpdateRole(context.Background(), 1, role)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if err == nil && updated.CreatedAt.IsZero() {
+			t.Error("expect the creation time of the role")
+		}
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with deleted as \\(delete from role (.+) select id from deleted"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error not found",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.DeleteRole(context.Background(), 1, 1)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into profile_role (.+) on conflict do nothing"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error exec",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WithArgs(int64(1), int64(1), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.AssignRole(context.Background(), 1, 1, 2)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestRevokeRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "delete from profile_role where tenant_id = (.+) and profile_id = (.+) and role_id = (.+)"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error exec",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error rows affected",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewErrorResult(mockErr))
+			},
+		},
+		{
+			name:      "error not assigned",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WithArgs(int64(1), int64(1), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.RevokeRole(context.Background(), 1, 1, 2)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestGetRoles(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from role r left join role_permission p (.+) where r.tenant_id = (.+) group by r.id order by r.name"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockRoleColumn).
+						AddRow(1, "auditor", "", time.Now(), []byte("{audit:read}")).
+						AddRow(2, "empty", "", time.Now(), []byte("{}")),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		roles, err := r.GetRoles(context.Background(), 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(roles) != tt.expectCount {
+			t.Errorf("expect %d roles, got %d", tt.expectCount, len(roles))
+		}
+		if len(roles) > 0 && !reflect.DeepEqual(roles[0].Permissions, []string{"audit:read"}) {
+			t.Errorf("expect the permissions of the role, got %v", roles[0].Permissions)
+		}
+	}
+}
+
+func TestGetRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from role r left join role_permission p (.+) where r.tenant_id = (.+) and r.id = (.+) group by r.id"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+		expectID  int64
+	}{
+		{
+			name:      "error not found",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:     "success",
+			expectID: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockRoleColumn).AddRow(1, "auditor", "", time.Now(), []byte("{audit:read}")),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		role, err := r.GetRole(context.Background(), 1, 1)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if role.ID != tt.expectID {
+			t.Errorf("expect id %d, got %d", tt.expectID, role.ID)
+		}
+	}
+}
+
+func TestGetProfileRoles(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from role r (.+) join profile_role pr (.+) where r.tenant_id = (.+) and pr.tenant_id = (.+) and pr.profile_id = (.+) order by r.name"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockRoleColumn).AddRow(1, "auditor", "", time.Now(), []byte("{audit:read}")),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		roles, err := r.GetProfileRoles(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(roles) != tt.expectCount {
+			t.Errorf("expect %d roles, got %d", tt.expectCount, len(roles))
+		}
+	}
+}
+
+func TestGetProfilePermissions(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select distinct p.permission from profile_role pr (.+) where r.tenant_id = (.+) and pr.tenant_id = (.+) and pr.profile_id = (.+) order by p.permission"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"permission", "extra"}).AddRow("audit:read", 1))
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows([]string{"permission"}).AddRow("audit:read").AddRow("users:read"),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		permissions, err := r.GetProfilePermissions(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(permissions) != tt.expectCount {
+			t.Errorf("expect %d permissions, got %d", tt.expectCount, len(permissions))
+		}
+	}
+}
+
+func TestCreateOrganization(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with saved as \\(insert into organization (.+)insert into organization_member (.+) 'owner' from saved\\) select id, created_at from saved"
+
+		// mock request and responser
+		mockErr      = errors.New("an error")
+		organization = Organization{Name: "Konoha", CreatedBy: 1}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+		expectID  int64
+	}{
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:     "success",
+			expectID: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), organization.Name, organization.CreatedBy).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		saved, err := r.CreateOrganization(context.Background(), 1, organization)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if saved.ID != tt.expectID {
+			t.Errorf("expect id %d, got %d", tt.expectID, saved.ID)
+		}
+	}
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _   = sqlmock.New()
+		mockQuery     = "update organization_member set role = (.+) where tenant_id = (.+) and organization_id = (.+) and profile_id = (.+) and o.role = 'owner'\\)\\)\\) returning profile_id"
+		mockLockQuery = "select pg_advisory_xact_lock\\(hashtext\\('organization_member'\\), (.+)\\)"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error begin",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin().WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error lock",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WithArgs(int64(2)).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error not member or last owner",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"profile_id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error commit",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"profile_id"}).AddRow(3))
+				mock.ExpectCommit().WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), int64(2), int64(3), OrganizationRoleAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"profile_id"}).AddRow(3))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.UpdateMemberRole(context.Background(), 1, 2, 3, OrganizationRoleAdmin)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestDeleteMember(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _   = sqlmock.New()
+		mockQuery     = "delete from organization_member where tenant_id = (.+) and organization_id = (.+) and profile_id = (.+) and o.role = 'owner'\\)\\) returning profile_id"
+		mockLockQuery = "select pg_advisory_xact_lock\\(hashtext\\('organization_member'\\), (.+)\\)"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error begin",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin().WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error lock",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WithArgs(int64(2)).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error not member or last owner",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"profile_id"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error commit",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"profile_id"}).AddRow(3))
+				mock.ExpectCommit().WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), int64(2), int64(3)).
+					WillReturnRows(sqlmock.NewRows([]string{"profile_id"}).AddRow(3))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.DeleteMember(context.Background(), 1, 2, 3)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestSaveInvitation(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into organization_invitation (.+) returning status, created_at"
+
+		// mock request and responser
+		mockErr    = errors.New("an error")
+		expiresAt  = time.Now().Add(time.Hour)
+		invitation = Invitation{ID: "abc", OrganizationID: 2, Phone: "+6281122334455", Role: OrganizationRoleMember, InvitedBy: 1, ExpiresAt: expiresAt}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name         string
+		mock         func()
+		expectErr    error
+		expectStatus string
+	}{
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:         "success",
+			expectStatus: InvitationPending,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), "abc", int64(2), "+6281122334455", OrganizationRoleMember, int64(1), expiresAt).
+					WillReturnRows(sqlmock.NewRows([]string{"status", "created_at"}).AddRow(InvitationPending, time.Now()))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		saved, err := r.SaveInvitation(context.Background(), 1, invitation)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if saved.Status != tt.expectStatus {
+			t.Errorf("expect status %q, got %q", tt.expectStatus, saved.Status)
+		}
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "with accepted as \\(update organization_invitation set status = 'accepted'(.+) where tenant_id = (.+) and id = (.+) and phone = (.+) and status = 'pending' (.+)insert into organization_member (.+) on conflict do nothing returning profile_id"
+
+		// mock request and responser
+		mockErr    = errors.New("an error")
+		invitation = Invitation{ID: "abc", Phone: "+6281122334455"}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error invitation used or already member",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"profile_id"}))
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), "abc", int64(3), "+6281122334455").
+					WillReturnRows(sqlmock.NewRows([]string{"profile_id"}).AddRow(3))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.AcceptInvitation(context.Background(), 1, invitation, 3)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestDeclineInvitation(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update organization_invitation set status = 'declined'(.+) where tenant_id = (.+) and id = (.+) and phone = (.+) and status = 'pending' (.+) returning id"
+
+		// mock request and responser
+		mockErr    = errors.New("an error")
+		invitation = Invitation{ID: "abc", Phone: "+6281122334455"}
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+	}{
+		{
+			name:      "error invitation used",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).
+					WithArgs(int64(1), "abc", "+6281122334455").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("abc"))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.DeclineInvitation(context.Background(), 1, invitation)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+	}
+}
+
+func TestGetOrganization(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select id, name, created_by, created_at from organization where tenant_id = (.+) and id = (.+)"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr error
+		expectID  int64
+	}{
+		{
+			name:      "error not found",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:     "success",
+			expectID: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(2)).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "name", "created_by", "created_at"}).AddRow(2, "Konoha", 1, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		organization, err := r.GetOrganization(context.Background(), 1, 2)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if organization.ID != tt.expectID {
+			t.Errorf("expect id %d, got %d", tt.expectID, organization.ID)
+		}
+	}
+}
+
+func TestGetMembership(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from organization_member m join organization o (.+) join profile p (.+) where m.tenant_id = (.+) and m.organization_id = (.+) and m.profile_id = (.+)"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name       string
+		mock       func()
+		expectErr  error
+		expectRole string
+	}{
+		{
+			name:      "error not member",
+			expectErr: sql.ErrNoRows,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(sql.ErrNoRows)
+			},
+		},
+		{
+			name:      "error query",
+			expectErr: mockErr,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:       "success",
+			expectRole: OrganizationRoleOwner,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(2), int64(3)).WillReturnRows(
+					sqlmock.NewRows(mockMembershipColumn).AddRow(2, "Konoha", 3, "narto", OrganizationRoleOwner, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		membership, err := r.GetMembership(context.Background(), 1, 2, 3)
+		if !errors.Is(err, tt.expectErr) {
+			t.Errorf("expect error %v, got %v", tt.expectErr, err)
+		}
+		if membership.Role != tt.expectRole {
+			t.Errorf("expect role %q, got %q", tt.expectRole, membership.Role)
+		}
+	}
+}
+
+func TestGetMembers(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from organization_member m (.+) where m.tenant_id = (.+) and m.organization_id = (.+) order by p.name, m.profile_id"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockMembershipColumn).AddRow("invalid", "Konoha", 3, "narto", OrganizationRoleOwner, time.Now()),
+				)
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(2)).WillReturnRows(
+					sqlmock.NewRows(mockMembershipColumn).
+						AddRow(2, "Konoha", 3, "narto", OrganizationRoleOwner, time.Now()).
+						AddRow(2, "Konoha", 4, "sasuke", OrganizationRoleMember, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		members, err := r.GetMembers(context.Background(), 1, 2)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(members) != tt.expectCount {
+			t.Errorf("expect %d members, got %d", tt.expectCount, len(members))
+		}
+	}
+}
+
+func TestGetProfileMemberships(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from organization_member m (.+) where m.tenant_id = (.+) and m.profile_id = (.+) order by o.name, m.organization_id"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(3)).WillReturnRows(
+					sqlmock.NewRows(mockMembershipColumn).AddRow(2, "Konoha", 3, "narto", OrganizationRoleOwner, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		memberships, err := r.GetProfileMemberships(context.Background(), 1, 3)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(memberships) != tt.expectCount {
+			t.Errorf("expect %d memberships, got %d", tt.expectCount, len(memberships))
+		}
+	}
+}
+
+func TestGetSoleOwnerMemberships(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from organization_member m (.+) where m.tenant_id = (.+) and m.profile_id = (.+) and m.role = 'owner' and not exists (.+) order by o.name, m.organization_id"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 1,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(3)).WillReturnRows(
+					sqlmock.NewRows(mockMembershipColumn).AddRow(2, "Konoha", 3, "narto", OrganizationRoleOwner, time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		memberships, err := r.GetSoleOwnerMemberships(context.Background(), 1, 3)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(memberships) != tt.expectCount {
+			t.Errorf("expect %d memberships, got %d", tt.expectCount, len(memberships))
+		}
+	}
+}
+
+func TestGetProfileHistory(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from profile_history where tenant_id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectLen int
+		expectErr bool
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+		{
+			name:      "error rows",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockHistoryColumn).
+						AddRow(1, 1, 1, "narto", "+62", time.Now()).
+						RowError(0, mockErr),
+				)
+			},
+		},
+		{
+			name:      "success",
+			expectLen: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1), int64(0), int64(10)).WillReturnRows(
+					sqlmock.NewRows(mockHistoryColumn).
+						AddRow(2, 1, 1, "sasuke", "+62", time.Now()).
+						AddRow(1, 1, 1, "narto", "+62", time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		history, err := r.GetProfileHistory(context.Background(), 1, 1, 0, 10)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(history) != tt.expectLen {
+			t.Errorf("expected %d history, got %d", tt.expectLen, len(history))
+		}
+	}
+}
+
+func TestSaveDevice(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "insert into profile_device"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.SaveDevice(context.Background(), 1, Device{})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestUpdateDeviceLastSeen(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "update profile_device set last_seen_at (.+) where tenant_id = (.+) and id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error exec",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectExec(mockQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		err := r.UpdateDeviceLastSeen(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetDeviceByFingerprint(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from profile_device where tenant_id = (.+) and profile_id = (.+) and fingerprint ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockDeviceColumn).
+						AddRow(1, 1, "abc", "curl/8.0", time.Now(), time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.GetDeviceByFingerprint(context.Background(), 1, 1, "abc")
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from profile_device where tenant_id = (.+) and profile_id = (.+) order by id"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name        string
+		mock        func()
+		expectErr   bool
+		expectCount int
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			},
+		},
+		{
+			name:        "success",
+			expectCount: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(
+					sqlmock.NewRows(mockDeviceColumn).
+						AddRow(1, 1, "abc", "curl/8.0", time.Now(), time.Now()).
+						AddRow(2, 1, "def", "Mozilla/5.0", time.Now(), time.Now()),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		devices, err := r.GetDevices(context.Background(), 1, 1)
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(devices) != tt.expectCount {
+			t.Errorf("expect %d devices, got %d", tt.expectCount, len(devices))
+		}
+	}
+}
+
+func TestHasDevices(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select exists (.+) from profile_device where tenant_id = (.+) and profile_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name         string
+		mock         func()
+		expectErr    bool
+		expectExists bool
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success without device",
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+		},
+		{
+			name:         "success",
+			expectExists: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WithArgs(int64(1), int64(1)).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+
+			exists, err := r.HasDevices(context.Background(), 1, 1)
+			if (err != nil) != tt.expectErr {
+				t.Error(err)
+			}
+			if exists != tt.expectExists {
+				t.Errorf("expect exists %v, got %v", tt.expectExists, exists)
+			}
+		})
+	}
+}
+
+func TestSaveAuditEvent(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _   = sqlmock.New()
+		mockLockQuery = "select pg_advisory_xact_lock"
+		mockHashQuery = "select hash from audit_log"
+		mockQuery     = "insert into audit_log"
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectErr bool
+	}{
+		{
+			name:      "error begin",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectBegin().WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error lock",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error get last hash",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockHashQuery).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error insert",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockHashQuery).WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("abc"))
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name:      "error commit",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockHashQuery).WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("abc"))
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit().WillReturnError(mockErr)
+			},
+		},
+		{
+			name: "success first event",
+			mock: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(mockLockQuery).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(mockHashQuery + " where tenant_id =").WithArgs(int64(1)).WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+				mock.ExpectQuery(mockQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		_, err := r.SaveAuditEvent(context.Background(), 1, AuditEvent{Action: "auth.login"})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetAuditEvents(t *testing.T) {
+	var (
+		// mock dependencies
+		db, mock, _ = sqlmock.New()
+		mockQuery   = "select (.+) from audit_log where tenant_id ="
+
+		// mock request and responser
+		mockErr = errors.New("an error")
+
+		r = NewRepository(NewRepositoryOptions{Db: db})
+	)
+
+	test := []struct {
+		name      string
+		mock      func()
+		expectLen int
+		expectErr bool
+	}{
+		{
+			name:      "error query",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnError(mockErr)
+			},
+		},
+		{
+			name:      "error scan",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows([]string{"id"}).AddRow(1),
+				)
+			},
+		},
+		{
+			name:      "error rows",
+			expectErr: true,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockAuditColumn).
+						AddRow(1, 1, 1, "auth.login", nil, nil, "req", "127.0.0.1", time.Now(), "", "abc").
+						RowError(0, mockErr),
+				)
+			},
+		},
+		{
+			name:      "success",
+			expectLen: 2,
+			mock: func() {
+				mock.ExpectQuery(mockQuery).WillReturnRows(
+					sqlmock.NewRows(mockAuditColumn).
+						AddRow(2, 1, 1, "profile.update", `{"name":"a"}`, `{"name":"b"}`, "req", "127.0.0.1", time.Now(), "abc", "def").
+						AddRow(1, 1, 1, "auth.login", nil, nil, "req", "127.0.0.1", time.Now(), "", "abc"),
+				)
+			},
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock != nil {
+				tt.mock()
+			}
+		})
+
+		events, err := r.GetAuditEvents(context.Background(), 1, AuditEventFilter{Limit: 10})
+		if (err != nil) != tt.expectErr {
+			t.Error(err)
+		}
+		if len(events) != tt.expectLen {
+			t.Errorf("expected %d events, got %d", tt.expectLen, len(events))
+		}
+	}
+}
+
+func TestHashAuditEvent(t *testing.T) {
+	event := AuditEvent{
+		Action:    "profile.update",
+		Before:    []byte(`{"name":"a"}`),
+		After:     []byte(`{"name":"b"}`),
+		CreatedAt: time.Date(2024, 2, 10, 9, 0, 0, 0, time.UTC),
+	}
+	hash := HashAuditEvent(event)
+	if len(hash) != 64 {
+		t.Errorf("expected sha256 hex hash, got %q", hash)
+	}
+
+	tampered := event
+	tampered.After = []byte(`{"name":"c"}`)
+	if HashAuditEvent(tampered) == hash {
+		t.Error("tampered event should have different hash")
+	}
+
+	chained := event
+	chained.PrevHash = hash
+	if HashAuditEvent(chained) == hash {
+		t.Error("chained event should have different hash")
+	}
+}
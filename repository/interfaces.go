@@ -6,16 +6,132 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
+// every method but the tenant queries is scoped to the given tenant, the data of the other tenants is never read or changed
 type RepositoryInterface interface {
+	// tenant queries
+	GetTenant(ctx context.Context, tenantID int64) (tenant Tenant, err error)
+	GetTenantBySlug(ctx context.Context, slug string) (tenant Tenant, err error)
+	GetTenantByHost(ctx context.Context, host string) (tenant Tenant, err error)
+	GetTenants(ctx context.Context) (tenants []Tenant, err error)
+	// end of tenant
+
 	// user profile mutation
-	SaveProfile(ctx context.Context, user User) (id int64, err error)
-	UpdateLoginCount(ctx context.Context, userID int64, loginCount int) (err error)
-	UpdateUserByID(ctx context.Context, user User) error
+	SaveProfile(ctx context.Context, tenantID int64, user User) (saved User, err error)
+	SaveProfileWithConsent(ctx context.Context, tenantID int64, user User, consent Consent) (saved User, err error)
+	UpdateLoginCount(ctx context.Context, tenantID int64, userID int64, loginCount int) (err error)
+	UpdateUserByID(ctx context.Context, tenantID int64, user User, actorID int64) (updated User, err error)
+	UpdateProfileAvatar(ctx context.Context, tenantID int64, profileID int64, avatarKey string) (previousKey string, err error)
+	ScheduleProfileDeletion(ctx context.Context, tenantID int64, profileID int64, purgeAt time.Time) (scheduledAt time.Time, err error)
+	CancelProfileDeletion(ctx context.Context, tenantID int64, profileID int64, now time.Time) (err error)
+	PurgeProfile(ctx context.Context, tenantID int64, profileID int64, now time.Time) (err error)
+	UpdateProfileStatus(ctx context.Context, tenantID int64, profileID int64, status, reason string, actorID int64) (updated User, err error)
+	ImportProfiles(ctx context.Context, tenantID int64, users []User) (imported []User, err error)
 
 	// user profile queries
-	GetProfileByPhone(ctx context.Context, phone string) (user User, err error)
-	GetProfileByID(ctx context.Context, id int64) (user User, err error)
+	GetProfileByPhone(ctx context.Context, tenantID int64, phone string) (user User, err error)
+	GetProfileByEmail(ctx context.Context, tenantID int64, email string) (user User, err error)
+	GetProfileByID(ctx context.Context, tenantID int64, id int64) (user User, err error)
+	GetProfileStatus(ctx context.Context, tenantID int64, profileID int64) (status string, deletionScheduledAt sql.NullTime, err error)
+	GetRegisteredIdentifiers(ctx context.Context, tenantID int64, phones, emails []string) (registered []string, err error)
+	GetProfilesToPurge(ctx context.Context, tenantID int64, now time.Time, limit int) (users []User, err error)
+	SearchProfiles(ctx context.Context, tenantID int64, filter ProfileFilter) (users []User, err error)
+	ExportProfiles(ctx context.Context, tenantID int64, filter ProfileFilter, fn func(user User) error) (err error)
 	// end of user profile
+
+	// email verification mutation
+	SaveEmailVerification(ctx context.Context, tenantID int64, verification EmailVerification) (err error)
+	VerifyEmail(ctx context.Context, tenantID int64, verification EmailVerification) (err error)
+	// end of email verification
+
+	// profile device mutation
+	SaveDevice(ctx context.Context, tenantID int64, device Device) (id int64, err error)
+	UpdateDeviceLastSeen(ctx context.Context, tenantID int64, deviceID int64) (err error)
+
+	// profile device queries
+	GetDeviceByFingerprint(ctx context.Context, tenantID int64, profileID int64, fingerprint string) (device Device, err error)
+	GetDevices(ctx context.Context, tenantID int64, profileID int64) (devices []Device, err error)
+	HasDevices(ctx context.Context, tenantID int64, profileID int64) (exists bool, err error)
+	// end of profile device
+
+	// phone change mutation
+	SavePhoneChange(ctx context.Context, tenantID int64, change PhoneChange) (err error)
+	IncrementPhoneChangeAttempts(ctx context.Context, tenantID int64, profileID int64) (attempts int, err error)
+	DeletePhoneChange(ctx context.Context, tenantID int64, profileID int64) (err error)
+
+	// phone change queries
+	GetPhoneChange(ctx context.Context, tenantID int64, profileID int64) (change PhoneChange, err error)
+	// end of phone change
+
+	// profile preference mutation
+	SavePreferences(ctx context.Context, tenantID int64, profileID int64, preferences Preferences) (err error)
+
+	// profile preference queries
+	GetPreferences(ctx context.Context, tenantID int64, profileID int64) (preferences Preferences, err error)
+	// end of profile preference
+
+	// data export mutation
+	SaveDataExport(ctx context.Context, tenantID int64, export DataExport) (saved DataExport, err error)
+	ClaimDataExport(ctx context.Context, tenantID int64, staleBefore time.Time) (export DataExport, err error)
+	FinishDataExport(ctx context.Context, tenantID int64, export DataExport) (err error)
+	DeleteDataExport(ctx context.Context, tenantID int64, id string) (err error)
+
+	// data export queries
+	GetDataExport(ctx context.Context, tenantID int64, profileID int64, id string) (export DataExport, err error)
+	GetExpiredDataExports(ctx context.Context, tenantID int64, now time.Time, limit int) (exports []DataExport, err error)
+	// end of data export
+
+	// terms of service mutation
+	SaveTermsVersion(ctx context.Context, tenantID int64, terms TermsVersion) (err error)
+	SaveConsent(ctx context.Context, tenantID int64, consent Consent) (saved Consent, err error)
+
+	// terms of service queries
+	GetCurrentTerms(ctx context.Context, tenantID int64, now time.Time) (terms TermsVersion, err error)
+	GetTermsAcceptance(ctx context.Context, tenantID int64, profileID int64, now time.Time) (terms TermsVersion, accepted bool, err error)
+	GetConsents(ctx context.Context, tenantID int64, profileID int64) (consents []Consent, err error)
+	// end of terms of service
+
+	// role mutation
+	CreateRole(ctx context.Context, tenantID int64, role Role) (saved Role, err error)
+	UpdateRole(ctx context.Context, tenantID int64, role Role) (updated Role, err error)
+	DeleteRole(ctx context.Context, tenantID int64, id int64) (err error)
+	AssignRole(ctx context.Context, tenantID int64, profileID, roleID int64) (err error)
+	RevokeRole(ctx context.Context, tenantID int64, profileID, roleID int64) (err error)
+
+	// role queries
+	GetRoles(ctx context.Context, tenantID int64) (roles []Role, err error)
+	GetRole(ctx context.Context, tenantID int64, id int64) (role Role, err error)
+	GetProfileRoles(ctx context.Context, tenantID int64, profileID int64) (roles []Role, err error)
+	GetProfilePermissions(ctx context.Context, tenantID int64, profileID int64) (permissions []string, err error)
+	// end of role
+
+	// organization mutation
+	CreateOrganization(ctx context.Context, tenantID int64, organization Organization) (saved Organization, err error)
+	UpdateMemberRole(ctx context.Context, tenantID int64, organizationID, profileID int64, role string) (err error)
+	DeleteMember(ctx context.Context, tenantID int64, organizationID, profileID int64) (err error)
+	SaveInvitation(ctx context.Context, tenantID int64, invitation Invitation) (saved Invitation, err error)
+	AcceptInvitation(ctx context.Context, tenantID int64, invitation Invitation, profileID int64) (err error)
+	DeclineInvitation(ctx context.Context, tenantID int64, invitation Invitation) (err error)
+
+	// organization queries
+	GetOrganization(ctx context.Context, tenantID int64, id int64) (organization Organization, err error)
+	GetMembership(ctx context.Context, tenantID int64, organizationID, profileID int64) (membership Membership, err error)
+	GetMembers(ctx context.Context, tenantID int64, organizationID int64) (members []Membership, err error)
+	GetProfileMemberships(ctx context.Context, tenantID int64, profileID int64) (memberships []Membership, err error)
+	GetSoleOwnerMemberships(ctx context.Context, tenantID int64, profileID int64) (memberships []Membership, err error)
+	// end of organization
+
+	// profile history queries
+	GetProfileHistory(ctx context.Context, tenantID int64, profileID, beforeID int64, limit int) (history []ProfileHistory, err error)
+	// end of profile history
+
+	// audit log mutation
+	SaveAuditEvent(ctx context.Context, tenantID int64, event AuditEvent) (id int64, err error)
+
+	// audit log queries
+	GetAuditEvents(ctx context.Context, tenantID int64, filter AuditEventFilter) (events []AuditEvent, err error)
+	// end of audit log
 }
@@ -6,7 +6,9 @@ package repository
 
 import (
 	context "context"
+	sql "database/sql"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,75 +36,1019 @@ func (m *MockRepositoryInterface) EXPECT() *MockRepositoryInterfaceMockRecorder
 	return m.recorder
 }
 
+// AcceptInvitation mocks base method.
+func (m *MockRepositoryInterface) AcceptInvitation(ctx context.Context, tenantID int64, invitation Invitation, profileID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptInvitation", ctx, tenantID, invitation, profileID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AcceptInvitation indicates an expected call of AcceptInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) AcceptInvitation(ctx, tenantID, invitation, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).AcceptInvitation), ctx, tenantID, invitation, profileID)
+}
+
+// AssignRole mocks base method.
+func (m *MockRepositoryInterface) AssignRole(ctx context.Context, tenantID, profileID, roleID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AssignRole", ctx, tenantID, profileID, roleID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AssignRole indicates an expected call of AssignRole.
+func (mr *MockRepositoryInterfaceMockRecorder) AssignRole(ctx, tenantID, profileID, roleID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AssignRole", reflect.TypeOf((*MockRepositoryInterface)(nil).AssignRole), ctx, tenantID, profileID, roleID)
+}
+
+// CancelProfileDeletion mocks base method.
+func (m *MockRepositoryInterface) CancelProfileDeletion(ctx context.Context, tenantID, profileID int64, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelProfileDeletion", ctx, tenantID, profileID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelProfileDeletion indicates an expected call of CancelProfileDeletion.
+func (mr *MockRepositoryInterfaceMockRecorder) CancelProfileDeletion(ctx, tenantID, profileID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelProfileDeletion", reflect.TypeOf((*MockRepositoryInterface)(nil).CancelProfileDeletion), ctx, tenantID, profileID, now)
+}
+
+// ClaimDataExport mocks base method.
+func (m *MockRepositoryInterface) ClaimDataExport(ctx context.Context, tenantID int64, staleBefore time.Time) (DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimDataExport", ctx, tenantID, staleBefore)
+	ret0, _ := ret[0].(DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimDataExport indicates an expected call of ClaimDataExport.
+func (mr *MockRepositoryInterfaceMockRecorder) ClaimDataExport(ctx, tenantID, staleBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimDataExport", reflect.TypeOf((*MockRepositoryInterface)(nil).ClaimDataExport), ctx, tenantID, staleBefore)
+}
+
+// CreateOrganization mocks base method.
+func (m *MockRepositoryInterface) CreateOrganization(ctx context.Context, tenantID int64, organization Organization) (Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrganization", ctx, tenantID, organization)
+	ret0, _ := ret[0].(Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrganization indicates an expected call of CreateOrganization.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateOrganization(ctx, tenantID, organization interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrganization", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateOrganization), ctx, tenantID, organization)
+}
+
+// CreateRole mocks base method.
+func (m *MockRepositoryInterface) CreateRole(ctx context.Context, tenantID int64, role Role) (Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRole", ctx, tenantID, role)
+	ret0, _ := ret[0].(Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRole indicates an expected call of CreateRole.
+func (mr *MockRepositoryInterfaceMockRecorder) CreateRole(ctx, tenantID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRole", reflect.TypeOf((*MockRepositoryInterface)(nil).CreateRole), ctx, tenantID, role)
+}
+
+// DeclineInvitation mocks base method.
+func (m *MockRepositoryInterface) DeclineInvitation(ctx context.Context, tenantID int64, invitation Invitation) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeclineInvitation", ctx, tenantID, invitation)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeclineInvitation indicates an expected call of DeclineInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) DeclineInvitation(ctx, tenantID, invitation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeclineInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).DeclineInvitation), ctx, tenantID, invitation)
+}
+
+// DeleteDataExport mocks base method.
+func (m *MockRepositoryInterface) DeleteDataExport(ctx context.Context, tenantID int64, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDataExport", ctx, tenantID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDataExport indicates an expected call of DeleteDataExport.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteDataExport(ctx, tenantID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDataExport", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteDataExport), ctx, tenantID, id)
+}
+
+// DeleteMember mocks base method.
+func (m *MockRepositoryInterface) DeleteMember(ctx context.Context, tenantID, organizationID, profileID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMember", ctx, tenantID, organizationID, profileID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMember indicates an expected call of DeleteMember.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteMember(ctx, tenantID, organizationID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMember", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteMember), ctx, tenantID, organizationID, profileID)
+}
+
+// DeletePhoneChange mocks base method.
+func (m *MockRepositoryInterface) DeletePhoneChange(ctx context.Context, tenantID, profileID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePhoneChange", ctx, tenantID, profileID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePhoneChange indicates an expected call of DeletePhoneChange.
+func (mr *MockRepositoryInterfaceMockRecorder) DeletePhoneChange(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePhoneChange", reflect.TypeOf((*MockRepositoryInterface)(nil).DeletePhoneChange), ctx, tenantID, profileID)
+}
+
+// DeleteRole mocks base method.
+func (m *MockRepositoryInterface) DeleteRole(ctx context.Context, tenantID, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRole", ctx, tenantID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRole indicates an expected call of DeleteRole.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteRole(ctx, tenantID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRole", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteRole), ctx, tenantID, id)
+}
+
+// ExportProfiles mocks base method.
+func (m *MockRepositoryInterface) ExportProfiles(ctx context.Context, tenantID int64, filter ProfileFilter, fn func(User) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportProfiles", ctx, tenantID, filter, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportProfiles indicates an expected call of ExportProfiles.
+func (mr *MockRepositoryInterfaceMockRecorder) ExportProfiles(ctx, tenantID, filter, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportProfiles", reflect.TypeOf((*MockRepositoryInterface)(nil).ExportProfiles), ctx, tenantID, filter, fn)
+}
+
+// FinishDataExport mocks base method.
+func (m *MockRepositoryInterface) FinishDataExport(ctx context.Context, tenantID int64, export DataExport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FinishDataExport", ctx, tenantID, export)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FinishDataExport indicates an expected call of FinishDataExport.
+func (mr *MockRepositoryInterfaceMockRecorder) FinishDataExport(ctx, tenantID, export interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishDataExport", reflect.TypeOf((*MockRepositoryInterface)(nil).FinishDataExport), ctx, tenantID, export)
+}
+
+// GetAuditEvents mocks base method.
+func (m *MockRepositoryInterface) GetAuditEvents(ctx context.Context, tenantID int64, filter AuditEventFilter) ([]AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEvents", ctx, tenantID, filter)
+	ret0, _ := ret[0].([]AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEvents indicates an expected call of GetAuditEvents.
+func (mr *MockRepositoryInterfaceMockRecorder) GetAuditEvents(ctx, tenantID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEvents", reflect.TypeOf((*MockRepositoryInterface)(nil).GetAuditEvents), ctx, tenantID, filter)
+}
+
+// GetConsents mocks base method.
+func (m *MockRepositoryInterface) GetConsents(ctx context.Context, tenantID, profileID int64) ([]Consent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConsents", ctx, tenantID, profileID)
+	ret0, _ := ret[0].([]Consent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetConsents indicates an expected call of GetConsents.
+func (mr *MockRepositoryInterfaceMockRecorder) GetConsents(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConsents", reflect.TypeOf((*MockRepositoryInterface)(nil).GetConsents), ctx, tenantID, profileID)
+}
+
+// GetCurrentTerms mocks base method.
+func (m *MockRepositoryInterface) GetCurrentTerms(ctx context.Context, tenantID int64, now time.Time) (TermsVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCurrentTerms", ctx, tenantID, now)
+	ret0, _ := ret[0].(TermsVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCurrentTerms indicates an expected call of GetCurrentTerms.
+func (mr *MockRepositoryInterfaceMockRecorder) GetCurrentTerms(ctx, tenantID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentTerms", reflect.TypeOf((*MockRepositoryInterface)(nil).GetCurrentTerms), ctx, tenantID, now)
+}
+
+// GetDataExport mocks base method.
+func (m *MockRepositoryInterface) GetDataExport(ctx context.Context, tenantID, profileID int64, id string) (DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDataExport", ctx, tenantID, profileID, id)
+	ret0, _ := ret[0].(DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDataExport indicates an expected call of GetDataExport.
+func (mr *MockRepositoryInterfaceMockRecorder) GetDataExport(ctx, tenantID, profileID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDataExport", reflect.TypeOf((*MockRepositoryInterface)(nil).GetDataExport), ctx, tenantID, profileID, id)
+}
+
+// GetDeviceByFingerprint mocks base method.
+func (m *MockRepositoryInterface) GetDeviceByFingerprint(ctx context.Context, tenantID, profileID int64, fingerprint string) (Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeviceByFingerprint", ctx, tenantID, profileID, fingerprint)
+	ret0, _ := ret[0].(Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeviceByFingerprint indicates an expected call of GetDeviceByFingerprint.
+func (mr *MockRepositoryInterfaceMockRecorder) GetDeviceByFingerprint(ctx, tenantID, profileID, fingerprint interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceByFingerprint", reflect.TypeOf((*MockRepositoryInterface)(nil).GetDeviceByFingerprint), ctx, tenantID, profileID, fingerprint)
+}
+
+// GetDevices mocks base method.
+func (m *MockRepositoryInterface) GetDevices(ctx context.Context, tenantID, profileID int64) ([]Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDevices", ctx, tenantID, profileID)
+	ret0, _ := ret[0].([]Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDevices indicates an expected call of GetDevices.
+func (mr *MockRepositoryInterfaceMockRecorder) GetDevices(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDevices", reflect.TypeOf((*MockRepositoryInterface)(nil).GetDevices), ctx, tenantID, profileID)
+}
+
+// GetExpiredDataExports mocks base method.
+func (m *MockRepositoryInterface) GetExpiredDataExports(ctx context.Context, tenantID int64, now time.Time, limit int) ([]DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredDataExports", ctx, tenantID, now, limit)
+	ret0, _ := ret[0].([]DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredDataExports indicates an expected call of GetExpiredDataExports.
+func (mr *MockRepositoryInterfaceMockRecorder) GetExpiredDataExports(ctx, tenantID, now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredDataExports", reflect.TypeOf((*MockRepositoryInterface)(nil).GetExpiredDataExports), ctx, tenantID, now, limit)
+}
+
+// GetMembers mocks base method.
+func (m *MockRepositoryInterface) GetMembers(ctx context.Context, tenantID, organizationID int64) ([]Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMembers", ctx, tenantID, organizationID)
+	ret0, _ := ret[0].([]Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMembers indicates an expected call of GetMembers.
+func (mr *MockRepositoryInterfaceMockRecorder) GetMembers(ctx, tenantID, organizationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMembers", reflect.TypeOf((*MockRepositoryInterface)(nil).GetMembers), ctx, tenantID, organizationID)
+}
+
+// GetMembership mocks base method.
+func (m *MockRepositoryInterface) GetMembership(ctx context.Context, tenantID, organizationID, profileID int64) (Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMembership", ctx, tenantID, organizationID, profileID)
+	ret0, _ := ret[0].(Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMembership indicates an expected call of GetMembership.
+func (mr *MockRepositoryInterfaceMockRecorder) GetMembership(ctx, tenantID, organizationID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMembership", reflect.TypeOf((*MockRepositoryInterface)(nil).GetMembership), ctx, tenantID, organizationID, profileID)
+}
+
+// GetOrganization mocks base method.
+func (m *MockRepositoryInterface) GetOrganization(ctx context.Context, tenantID, id int64) (Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrganization", ctx, tenantID, id)
+	ret0, _ := ret[0].(Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrganization indicates an expected call of GetOrganization.
+func (mr *MockRepositoryInterfaceMockRecorder) GetOrganization(ctx, tenantID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganization", reflect.TypeOf((*MockRepositoryInterface)(nil).GetOrganization), ctx, tenantID, id)
+}
+
+// GetPhoneChange mocks base method.
+func (m *MockRepositoryInterface) GetPhoneChange(ctx context.Context, tenantID, profileID int64) (PhoneChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPhoneChange", ctx, tenantID, profileID)
+	ret0, _ := ret[0].(PhoneChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPhoneChange indicates an expected call of GetPhoneChange.
+func (mr *MockRepositoryInterfaceMockRecorder) GetPhoneChange(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPhoneChange", reflect.TypeOf((*MockRepositoryInterface)(nil).GetPhoneChange), ctx, tenantID, profileID)
+}
+
+// GetPreferences mocks base method.
+func (m *MockRepositoryInterface) GetPreferences(ctx context.Context, tenantID, profileID int64) (Preferences, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPreferences", ctx, tenantID, profileID)
+	ret0, _ := ret[0].(Preferences)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPreferences indicates an expected call of GetPreferences.
+func (mr *MockRepositoryInterfaceMockRecorder) GetPreferences(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPreferences", reflect.TypeOf((*MockRepositoryInterface)(nil).GetPreferences), ctx, tenantID, profileID)
+}
+
+// GetProfileByEmail mocks base method.
+func (m *MockRepositoryInterface) GetProfileByEmail(ctx context.Context, tenantID int64, email string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileByEmail", ctx, tenantID, email)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileByEmail indicates an expected call of GetProfileByEmail.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileByEmail(ctx, tenantID, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByEmail", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileByEmail), ctx, tenantID, email)
+}
+
 // GetProfileByID mocks base method.
-func (m *MockRepositoryInterface) GetProfileByID(ctx context.Context, id int64) (User, error) {
+func (m *MockRepositoryInterface) GetProfileByID(ctx context.Context, tenantID, id int64) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileByID", ctx, tenantID, id)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileByID indicates an expected call of GetProfileByID.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileByID(ctx, tenantID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByID", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileByID), ctx, tenantID, id)
+}
+
+// GetProfileByPhone mocks base method.
+func (m *MockRepositoryInterface) GetProfileByPhone(ctx context.Context, tenantID int64, phone string) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileByPhone", ctx, tenantID, phone)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileByPhone indicates an expected call of GetProfileByPhone.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileByPhone(ctx, tenantID, phone interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByPhone", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileByPhone), ctx, tenantID, phone)
+}
+
+// GetProfileHistory mocks base method.
+func (m *MockRepositoryInterface) GetProfileHistory(ctx context.Context, tenantID, profileID, beforeID int64, limit int) ([]ProfileHistory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileHistory", ctx, tenantID, profileID, beforeID, limit)
+	ret0, _ := ret[0].([]ProfileHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileHistory indicates an expected call of GetProfileHistory.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileHistory(ctx, tenantID, profileID, beforeID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileHistory", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileHistory), ctx, tenantID, profileID, beforeID, limit)
+}
+
+// GetProfileMemberships mocks base method.
+func (m *MockRepositoryInterface) GetProfileMemberships(ctx context.Context, tenantID, profileID int64) ([]Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileMemberships", ctx, tenantID, profileID)
+	ret0, _ := ret[0].([]Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileMemberships indicates an expected call of GetProfileMemberships.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileMemberships(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileMemberships", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileMemberships), ctx, tenantID, profileID)
+}
+
+// GetProfilePermissions mocks base method.
+func (m *MockRepositoryInterface) GetProfilePermissions(ctx context.Context, tenantID, profileID int64) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfilePermissions", ctx, tenantID, profileID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfilePermissions indicates an expected call of GetProfilePermissions.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfilePermissions(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfilePermissions", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfilePermissions), ctx, tenantID, profileID)
+}
+
+// GetProfileRoles mocks base method.
+func (m *MockRepositoryInterface) GetProfileRoles(ctx context.Context, tenantID, profileID int64) ([]Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileRoles", ctx, tenantID, profileID)
+	ret0, _ := ret[0].([]Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfileRoles indicates an expected call of GetProfileRoles.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileRoles(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileRoles", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileRoles), ctx, tenantID, profileID)
+}
+
+// GetProfileStatus mocks base method.
+func (m *MockRepositoryInterface) GetProfileStatus(ctx context.Context, tenantID, profileID int64) (string, sql.NullTime, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfileStatus", ctx, tenantID, profileID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(sql.NullTime)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetProfileStatus indicates an expected call of GetProfileStatus.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfileStatus(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileStatus", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileStatus), ctx, tenantID, profileID)
+}
+
+// GetProfilesToPurge mocks base method.
+func (m *MockRepositoryInterface) GetProfilesToPurge(ctx context.Context, tenantID int64, now time.Time, limit int) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProfilesToPurge", ctx, tenantID, now, limit)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProfilesToPurge indicates an expected call of GetProfilesToPurge.
+func (mr *MockRepositoryInterfaceMockRecorder) GetProfilesToPurge(ctx, tenantID, now, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfilesToPurge", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfilesToPurge), ctx, tenantID, now, limit)
+}
+
+// GetRegisteredIdentifiers mocks base method.
+func (m *MockRepositoryInterface) GetRegisteredIdentifiers(ctx context.Context, tenantID int64, phones, emails []string) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetProfileByID", ctx, id)
-	ret0, _ := ret[0].(User)
+	ret := m.ctrl.Call(m, "GetRegisteredIdentifiers", ctx, tenantID, phones, emails)
+	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetProfileByID indicates an expected call of GetProfileByID.
-func (mr *MockRepositoryInterfaceMockRecorder) GetProfileByID(ctx, id interface{}) *gomock.Call {
+// GetRegisteredIdentifiers indicates an expected call of GetRegisteredIdentifiers.
+func (mr *MockRepositoryInterfaceMockRecorder) GetRegisteredIdentifiers(ctx, tenantID, phones, emails interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByID", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileByID), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRegisteredIdentifiers", reflect.TypeOf((*MockRepositoryInterface)(nil).GetRegisteredIdentifiers), ctx, tenantID, phones, emails)
 }
 
-// GetProfileByPhone mocks base method.
-func (m *MockRepositoryInterface) GetProfileByPhone(ctx context.Context, phone string) (User, error) {
+// GetRole mocks base method.
+func (m *MockRepositoryInterface) GetRole(ctx context.Context, tenantID, id int64) (Role, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetProfileByPhone", ctx, phone)
-	ret0, _ := ret[0].(User)
+	ret := m.ctrl.Call(m, "GetRole", ctx, tenantID, id)
+	ret0, _ := ret[0].(Role)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetProfileByPhone indicates an expected call of GetProfileByPhone.
-func (mr *MockRepositoryInterfaceMockRecorder) GetProfileByPhone(ctx, phone interface{}) *gomock.Call {
+// GetRole indicates an expected call of GetRole.
+func (mr *MockRepositoryInterfaceMockRecorder) GetRole(ctx, tenantID, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfileByPhone", reflect.TypeOf((*MockRepositoryInterface)(nil).GetProfileByPhone), ctx, phone)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRole", reflect.TypeOf((*MockRepositoryInterface)(nil).GetRole), ctx, tenantID, id)
 }
 
-// SaveProfile mocks base method.
-func (m *MockRepositoryInterface) SaveProfile(ctx context.Context, user User) (int64, error) {
+// GetRoles mocks base method.
+func (m *MockRepositoryInterface) GetRoles(ctx context.Context, tenantID int64) ([]Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoles", ctx, tenantID)
+	ret0, _ := ret[0].([]Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoles indicates an expected call of GetRoles.
+func (mr *MockRepositoryInterfaceMockRecorder) GetRoles(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoles", reflect.TypeOf((*MockRepositoryInterface)(nil).GetRoles), ctx, tenantID)
+}
+
+// GetSoleOwnerMemberships mocks base method.
+func (m *MockRepositoryInterface) GetSoleOwnerMemberships(ctx context.Context, tenantID, profileID int64) ([]Membership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSoleOwnerMemberships", ctx, tenantID, profileID)
+	ret0, _ := ret[0].([]Membership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSoleOwnerMemberships indicates an expected call of GetSoleOwnerMemberships.
+func (mr *MockRepositoryInterfaceMockRecorder) GetSoleOwnerMemberships(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSoleOwnerMemberships", reflect.TypeOf((*MockRepositoryInterface)(nil).GetSoleOwnerMemberships), ctx, tenantID, profileID)
+}
+
+// GetTenant mocks base method.
+func (m *MockRepositoryInterface) GetTenant(ctx context.Context, tenantID int64) (Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenant", ctx, tenantID)
+	ret0, _ := ret[0].(Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTenant indicates an expected call of GetTenant.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTenant(ctx, tenantID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenant", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTenant), ctx, tenantID)
+}
+
+// GetTenantByHost mocks base method.
+func (m *MockRepositoryInterface) GetTenantByHost(ctx context.Context, host string) (Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenantByHost", ctx, host)
+	ret0, _ := ret[0].(Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTenantByHost indicates an expected call of GetTenantByHost.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTenantByHost(ctx, host interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenantByHost", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTenantByHost), ctx, host)
+}
+
+// GetTenantBySlug mocks base method.
+func (m *MockRepositoryInterface) GetTenantBySlug(ctx context.Context, slug string) (Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenantBySlug", ctx, slug)
+	ret0, _ := ret[0].(Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTenantBySlug indicates an expected call of GetTenantBySlug.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTenantBySlug(ctx, slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenantBySlug", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTenantBySlug), ctx, slug)
+}
+
+// GetTenants mocks base method.
+func (m *MockRepositoryInterface) GetTenants(ctx context.Context) ([]Tenant, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenants", ctx)
+	ret0, _ := ret[0].([]Tenant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTenants indicates an expected call of GetTenants.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTenants(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenants", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTenants), ctx)
+}
+
+// GetTermsAcceptance mocks base method.
+func (m *MockRepositoryInterface) GetTermsAcceptance(ctx context.Context, tenantID, profileID int64, now time.Time) (TermsVersion, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTermsAcceptance", ctx, tenantID, profileID, now)
+	ret0, _ := ret[0].(TermsVersion)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTermsAcceptance indicates an expected call of GetTermsAcceptance.
+func (mr *MockRepositoryInterfaceMockRecorder) GetTermsAcceptance(ctx, tenantID, profileID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTermsAcceptance", reflect.TypeOf((*MockRepositoryInterface)(nil).GetTermsAcceptance), ctx, tenantID, profileID, now)
+}
+
+// HasDevices mocks base method.
+func (m *MockRepositoryInterface) HasDevices(ctx context.Context, tenantID, profileID int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasDevices", ctx, tenantID, profileID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasDevices indicates an expected call of HasDevices.
+func (mr *MockRepositoryInterfaceMockRecorder) HasDevices(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasDevices", reflect.TypeOf((*MockRepositoryInterface)(nil).HasDevices), ctx, tenantID, profileID)
+}
+
+// ImportProfiles mocks base method.
+func (m *MockRepositoryInterface) ImportProfiles(ctx context.Context, tenantID int64, users []User) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportProfiles", ctx, tenantID, users)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportProfiles indicates an expected call of ImportProfiles.
+func (mr *MockRepositoryInterfaceMockRecorder) ImportProfiles(ctx, tenantID, users interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportProfiles", reflect.TypeOf((*MockRepositoryInterface)(nil).ImportProfiles), ctx, tenantID, users)
+}
+
+// IncrementPhoneChangeAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementPhoneChangeAttempts(ctx context.Context, tenantID, profileID int64) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementPhoneChangeAttempts", ctx, tenantID, profileID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementPhoneChangeAttempts indicates an expected call of IncrementPhoneChangeAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementPhoneChangeAttempts(ctx, tenantID, profileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementPhoneChangeAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementPhoneChangeAttempts), ctx, tenantID, profileID)
+}
+
+// PurgeProfile mocks base method.
+func (m *MockRepositoryInterface) PurgeProfile(ctx context.Context, tenantID, profileID int64, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeProfile", ctx, tenantID, profileID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeProfile indicates an expected call of PurgeProfile.
+func (mr *MockRepositoryInterfaceMockRecorder) PurgeProfile(ctx, tenantID, profileID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeProfile", reflect.TypeOf((*MockRepositoryInterface)(nil).PurgeProfile), ctx, tenantID, profileID, now)
+}
+
+// RevokeRole mocks base method.
+func (m *MockRepositoryInterface) RevokeRole(ctx context.Context, tenantID, profileID, roleID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRole", ctx, tenantID, profileID, roleID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRole indicates an expected call of RevokeRole.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeRole(ctx, tenantID, profileID, roleID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRole", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeRole), ctx, tenantID, profileID, roleID)
+}
+
+// SaveAuditEvent mocks base method.
+func (m *MockRepositoryInterface) SaveAuditEvent(ctx context.Context, tenantID int64, event AuditEvent) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAuditEvent", ctx, tenantID, event)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveAuditEvent indicates an expected call of SaveAuditEvent.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveAuditEvent(ctx, tenantID, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAuditEvent", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveAuditEvent), ctx, tenantID, event)
+}
+
+// SaveConsent mocks base method.
+func (m *MockRepositoryInterface) SaveConsent(ctx context.Context, tenantID int64, consent Consent) (Consent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveConsent", ctx, tenantID, consent)
+	ret0, _ := ret[0].(Consent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveConsent indicates an expected call of SaveConsent.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveConsent(ctx, tenantID, consent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveConsent", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveConsent), ctx, tenantID, consent)
+}
+
+// SaveDataExport mocks base method.
+func (m *MockRepositoryInterface) SaveDataExport(ctx context.Context, tenantID int64, export DataExport) (DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveDataExport", ctx, tenantID, export)
+	ret0, _ := ret[0].(DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveDataExport indicates an expected call of SaveDataExport.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveDataExport(ctx, tenantID, export interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDataExport", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveDataExport), ctx, tenantID, export)
+}
+
+// SaveDevice mocks base method.
+func (m *MockRepositoryInterface) SaveDevice(ctx context.Context, tenantID int64, device Device) (int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveProfile", ctx, user)
+	ret := m.ctrl.Call(m, "SaveDevice", ctx, tenantID, device)
 	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// SaveDevice indicates an expected call of SaveDevice.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveDevice(ctx, tenantID, device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDevice", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveDevice), ctx, tenantID, device)
+}
+
+// SaveEmailVerification mocks base method.
+func (m *MockRepositoryInterface) SaveEmailVerification(ctx context.Context, tenantID int64, verification EmailVerification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveEmailVerification", ctx, tenantID, verification)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveEmailVerification indicates an expected call of SaveEmailVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveEmailVerification(ctx, tenantID, verification interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveEmailVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveEmailVerification), ctx, tenantID, verification)
+}
+
+// SaveInvitation mocks base method.
+func (m *MockRepositoryInterface) SaveInvitation(ctx context.Context, tenantID int64, invitation Invitation) (Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveInvitation", ctx, tenantID, invitation)
+	ret0, _ := ret[0].(Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveInvitation indicates an expected call of SaveInvitation.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveInvitation(ctx, tenantID, invitation interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveInvitation", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveInvitation), ctx, tenantID, invitation)
+}
+
+// SavePhoneChange mocks base method.
+func (m *MockRepositoryInterface) SavePhoneChange(ctx context.Context, tenantID int64, change PhoneChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePhoneChange", ctx, tenantID, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePhoneChange indicates an expected call of SavePhoneChange.
+func (mr *MockRepositoryInterfaceMockRecorder) SavePhoneChange(ctx, tenantID, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePhoneChange", reflect.TypeOf((*MockRepositoryInterface)(nil).SavePhoneChange), ctx, tenantID, change)
+}
+
+// SavePreferences mocks base method.
+func (m *MockRepositoryInterface) SavePreferences(ctx context.Context, tenantID, profileID int64, preferences Preferences) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePreferences", ctx, tenantID, profileID, preferences)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePreferences indicates an expected call of SavePreferences.
+func (mr *MockRepositoryInterfaceMockRecorder) SavePreferences(ctx, tenantID, profileID, preferences interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePreferences", reflect.TypeOf((*MockRepositoryInterface)(nil).SavePreferences), ctx, tenantID, profileID, preferences)
+}
+
+// SaveProfile mocks base method.
+func (m *MockRepositoryInterface) SaveProfile(ctx context.Context, tenantID int64, user User) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveProfile", ctx, tenantID, user)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // SaveProfile indicates an expected call of SaveProfile.
-func (mr *MockRepositoryInterfaceMockRecorder) SaveProfile(ctx, user interface{}) *gomock.Call {
+func (mr *MockRepositoryInterfaceMockRecorder) SaveProfile(ctx, tenantID, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveProfile", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveProfile), ctx, tenantID, user)
+}
+
+// SaveProfileWithConsent mocks base method.
+func (m *MockRepositoryInterface) SaveProfileWithConsent(ctx context.Context, tenantID int64, user User, consent Consent) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveProfileWithConsent", ctx, tenantID, user, consent)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SaveProfileWithConsent indicates an expected call of SaveProfileWithConsent.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveProfileWithConsent(ctx, tenantID, user, consent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveProfileWithConsent", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveProfileWithConsent), ctx, tenantID, user, consent)
+}
+
+// SaveTermsVersion mocks base method.
+func (m *MockRepositoryInterface) SaveTermsVersion(ctx context.Context, tenantID int64, terms TermsVersion) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTermsVersion", ctx, tenantID, terms)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTermsVersion indicates an expected call of SaveTermsVersion.
+func (mr *MockRepositoryInterfaceMockRecorder) SaveTermsVersion(ctx, tenantID, terms interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTermsVersion", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveTermsVersion), ctx, tenantID, terms)
+}
+
+// ScheduleProfileDeletion mocks base method.
+func (m *MockRepositoryInterface) ScheduleProfileDeletion(ctx context.Context, tenantID, profileID int64, purgeAt time.Time) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScheduleProfileDeletion", ctx, tenantID, profileID, purgeAt)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ScheduleProfileDeletion indicates an expected call of ScheduleProfileDeletion.
+func (mr *MockRepositoryInterfaceMockRecorder) ScheduleProfileDeletion(ctx, tenantID, profileID, purgeAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScheduleProfileDeletion", reflect.TypeOf((*MockRepositoryInterface)(nil).ScheduleProfileDeletion), ctx, tenantID, profileID, purgeAt)
+}
+
+// SearchProfiles mocks base method.
+func (m *MockRepositoryInterface) SearchProfiles(ctx context.Context, tenantID int64, filter ProfileFilter) ([]User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchProfiles", ctx, tenantID, filter)
+	ret0, _ := ret[0].([]User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchProfiles indicates an expected call of SearchProfiles.
+func (mr *MockRepositoryInterfaceMockRecorder) SearchProfiles(ctx, tenantID, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProfiles", reflect.TypeOf((*MockRepositoryInterface)(nil).SearchProfiles), ctx, tenantID, filter)
+}
+
+// UpdateDeviceLastSeen mocks base method.
+func (m *MockRepositoryInterface) UpdateDeviceLastSeen(ctx context.Context, tenantID, deviceID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDeviceLastSeen", ctx, tenantID, deviceID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateDeviceLastSeen indicates an expected call of UpdateDeviceLastSeen.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateDeviceLastSeen(ctx, tenantID, deviceID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveProfile", reflect.TypeOf((*MockRepositoryInterface)(nil).SaveProfile), ctx, user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDeviceLastSeen", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateDeviceLastSeen), ctx, tenantID, deviceID)
 }
 
 // UpdateLoginCount mocks base method.
-func (m *MockRepositoryInterface) UpdateLoginCount(ctx context.Context, userID int64, loginCount int) error {
+func (m *MockRepositoryInterface) UpdateLoginCount(ctx context.Context, tenantID, userID int64, loginCount int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateLoginCount", ctx, userID, loginCount)
+	ret := m.ctrl.Call(m, "UpdateLoginCount", ctx, tenantID, userID, loginCount)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateLoginCount indicates an expected call of UpdateLoginCount.
-func (mr *MockRepositoryInterfaceMockRecorder) UpdateLoginCount(ctx, userID, loginCount interface{}) *gomock.Call {
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateLoginCount(ctx, tenantID, userID, loginCount interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLoginCount", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateLoginCount), ctx, userID, loginCount)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLoginCount", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateLoginCount), ctx, tenantID, userID, loginCount)
 }
 
-// UpdateUserByID mocks base method.
-func (m *MockRepositoryInterface) UpdateUserByID(ctx context.Context, user User) error {
+// UpdateMemberRole mocks base method.
+func (m *MockRepositoryInterface) UpdateMemberRole(ctx context.Context, tenantID, organizationID, profileID int64, role string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUserByID", ctx, user)
+	ret := m.ctrl.Call(m, "UpdateMemberRole", ctx, tenantID, organizationID, profileID, role)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// UpdateMemberRole indicates an expected call of UpdateMemberRole.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateMemberRole(ctx, tenantID, organizationID, profileID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMemberRole", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateMemberRole), ctx, tenantID, organizationID, profileID, role)
+}
+
+// UpdateProfileAvatar mocks base method.
+func (m *MockRepositoryInterface) UpdateProfileAvatar(ctx context.Context, tenantID, profileID int64, avatarKey string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfileAvatar", ctx, tenantID, profileID, avatarKey)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateProfileAvatar indicates an expected call of UpdateProfileAvatar.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateProfileAvatar(ctx, tenantID, profileID, avatarKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfileAvatar", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateProfileAvatar), ctx, tenantID, profileID, avatarKey)
+}
+
+// UpdateProfileStatus mocks base method.
+func (m *MockRepositoryInterface) UpdateProfileStatus(ctx context.Context, tenantID, profileID int64, status, reason string, actorID int64) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProfileStatus", ctx, tenantID, profileID, status, reason, actorID)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateProfileStatus indicates an expected call of UpdateProfileStatus.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateProfileStatus(ctx, tenantID, profileID, status, reason, actorID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfileStatus", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateProfileStatus), ctx, tenantID, profileID, status, reason, actorID)
+}
+
+// UpdateRole mocks base method.
+func (m *MockRepositoryInterface) UpdateRole(ctx context.Context, tenantID int64, role Role) (Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRole", ctx, tenantID, role)
+	ret0, _ := ret[0].(Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateRole indicates an expected call of UpdateRole.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateRole(ctx, tenantID, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRole", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateRole), ctx, tenantID, role)
+}
+
+// UpdateUserByID mocks base method.
+func (m *MockRepositoryInterface) UpdateUserByID(ctx context.Context, tenantID int64, user User, actorID int64) (User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserByID", ctx, tenantID, user, actorID)
+	ret0, _ := ret[0].(User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // UpdateUserByID indicates an expected call of UpdateUserByID.
-func (mr *MockRepositoryInterfaceMockRecorder) UpdateUserByID(ctx, user interface{}) *gomock.Call {
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateUserByID(ctx, tenantID, user, actorID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserByID", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUserByID), ctx, tenantID, user, actorID)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockRepositoryInterface) VerifyEmail(ctx context.Context, tenantID int64, verification EmailVerification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", ctx, tenantID, verification)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockRepositoryInterfaceMockRecorder) VerifyEmail(ctx, tenantID, verification interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserByID", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUserByID), ctx, user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockRepositoryInterface)(nil).VerifyEmail), ctx, tenantID, verification)
 }
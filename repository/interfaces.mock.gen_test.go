@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -17,16 +18,144 @@ func TestMock(t *testing.T) {
 		ctx = context.Background()
 	)
 
-	mock.EXPECT().GetProfileByID(any, any)
-	mock.GetProfileByID(ctx, 1)
-	mock.EXPECT().GetProfileByID(any, any)
-	mock.GetProfileByID(ctx, 1)
-	mock.EXPECT().GetProfileByPhone(any, any)
-	mock.GetProfileByPhone(ctx, "")
-	mock.EXPECT().SaveProfile(any, any)
-	mock.SaveProfile(ctx, User{})
-	mock.EXPECT().UpdateLoginCount(any, any, any)
-	mock.UpdateLoginCount(ctx, 1, 1)
-	mock.EXPECT().UpdateUserByID(any, any)
-	mock.UpdateUserByID(ctx, User{})
+	mock.EXPECT().GetTenant(any, any)
+	mock.GetTenant(ctx, 1)
+	mock.EXPECT().GetTenantBySlug(any, any)
+	mock.GetTenantBySlug(ctx, "")
+	mock.EXPECT().GetTenantByHost(any, any)
+	mock.GetTenantByHost(ctx, "")
+	mock.EXPECT().GetTenants(any)
+	mock.GetTenants(ctx)
+	mock.EXPECT().GetProfileByID(any, any, any)
+	mock.GetProfileByID(ctx, 1, 1)
+	mock.EXPECT().GetProfileByID(any, any, any)
+	mock.GetProfileByID(ctx, 1, 1)
+	mock.EXPECT().GetProfileByPhone(any, any, any)
+	mock.GetProfileByPhone(ctx, 1, "")
+	mock.EXPECT().GetProfileByEmail(any, any, any)
+	mock.GetProfileByEmail(ctx, 1, "")
+	mock.EXPECT().SaveEmailVerification(any, any, any)
+	mock.SaveEmailVerification(ctx, 1, EmailVerification{})
+	mock.EXPECT().VerifyEmail(any, any, any)
+	mock.VerifyEmail(ctx, 1, EmailVerification{})
+	mock.EXPECT().SaveProfile(any, any, any)
+	mock.SaveProfile(ctx, 1, User{})
+	mock.EXPECT().SaveProfileWithConsent(any, any, any, any)
+	mock.SaveProfileWithConsent(ctx, 1, User{}, Consent{})
+	mock.EXPECT().UpdateLoginCount(any, any, any, any)
+	mock.UpdateLoginCount(ctx, 1, 1, 1)
+	mock.EXPECT().UpdateUserByID(any, any, any, any)
+	mock.UpdateUserByID(ctx, 1, User{}, 1)
+	mock.EXPECT().UpdateProfileAvatar(any, any, any, any)
+	mock.UpdateProfileAvatar(ctx, 1, 1, "")
+	mock.EXPECT().ScheduleProfileDeletion(any, any, any, any)
+	mock.ScheduleProfileDeletion(ctx, 1, 1, time.Time{})
+	mock.EXPECT().CancelProfileDeletion(any, any, any, any)
+	mock.CancelProfileDeletion(ctx, 1, 1, time.Time{})
+	mock.EXPECT().GetProfilesToPurge(any, any, any, any)
+	mock.GetProfilesToPurge(ctx, 1, time.Time{}, 1)
+	mock.EXPECT().SearchProfiles(any, any, any)
+	mock.SearchProfiles(ctx, 1, ProfileFilter{})
+	mock.EXPECT().ExportProfiles(any, any, any, any)
+	mock.ExportProfiles(ctx, 1, ProfileFilter{}, nil)
+	mock.EXPECT().PurgeProfile(any, any, any, any)
+	mock.PurgeProfile(ctx, 1, 1, time.Time{})
+	mock.EXPECT().UpdateProfileStatus(any, any, any, any, any, any)
+	mock.UpdateProfileStatus(ctx, 1, 1, "", "", 1)
+	mock.EXPECT().GetProfileStatus(any, any, any)
+	mock.GetProfileStatus(ctx, 1, 1)
+	mock.EXPECT().ImportProfiles(any, any, any)
+	mock.ImportProfiles(ctx, 1, nil)
+	mock.EXPECT().GetRegisteredIdentifiers(any, any, any, any)
+	mock.GetRegisteredIdentifiers(ctx, 1, nil, nil)
+	mock.EXPECT().SaveDevice(any, any, any)
+	mock.SaveDevice(ctx, 1, Device{})
+	mock.EXPECT().UpdateDeviceLastSeen(any, any, any)
+	mock.UpdateDeviceLastSeen(ctx, 1, 1)
+	mock.EXPECT().GetDeviceByFingerprint(any, any, any, any)
+	mock.GetDeviceByFingerprint(ctx, 1, 1, "")
+	mock.EXPECT().GetDevices(any, any, any)
+	mock.GetDevices(ctx, 1, 1)
+	mock.EXPECT().HasDevices(any, any, any)
+	mock.HasDevices(ctx, 1, 1)
+	mock.EXPECT().SavePhoneChange(any, any, any)
+	mock.SavePhoneChange(ctx, 1, PhoneChange{})
+	mock.EXPECT().IncrementPhoneChangeAttempts(any, any, any)
+	mock.IncrementPhoneChangeAttempts(ctx, 1, 1)
+	mock.EXPECT().DeletePhoneChange(any, any, any)
+	mock.DeletePhoneChange(ctx, 1, 1)
+	mock.EXPECT().GetPhoneChange(any, any, any)
+	mock.GetPhoneChange(ctx, 1, 1)
+	mock.EXPECT().SavePreferences(any, any, any, any)
+	mock.SavePreferences(ctx, 1, 1, Preferences{})
+	mock.EXPECT().GetPreferences(any, any, any)
+	mock.GetPreferences(ctx, 1, 1)
+	mock.EXPECT().SaveDataExport(any, any, any)
+	mock.SaveDataExport(ctx, 1, DataExport{})
+	mock.EXPECT().ClaimDataExport(any, any, any)
+	mock.ClaimDataExport(ctx, 1, time.Time{})
+	mock.EXPECT().FinishDataExport(any, any, any)
+	mock.FinishDataExport(ctx, 1, DataExport{})
+	mock.EXPECT().DeleteDataExport(any, any, any)
+	mock.DeleteDataExport(ctx, 1, "")
+	mock.EXPECT().GetDataExport(any, any, any, any)
+	mock.GetDataExport(ctx, 1, 1, "")
+	mock.EXPECT().GetExpiredDataExports(any, any, any, any)
+	mock.GetExpiredDataExports(ctx, 1, time.Time{}, 1)
+	mock.EXPECT().SaveTermsVersion(any, any, any)
+	mock.SaveTermsVersion(ctx, 1, TermsVersion{})
+	mock.EXPECT().SaveConsent(any, any, any)
+	mock.SaveConsent(ctx, 1, Consent{})
+	mock.EXPECT().GetCurrentTerms(any, any, any)
+	mock.GetCurrentTerms(ctx, 1, time.Time{})
+	mock.EXPECT().GetTermsAcceptance(any, any, any, any)
+	mock.GetTermsAcceptance(ctx, 1, 1, time.Time{})
+	mock.EXPECT().GetConsents(any, any, any)
+	mock.GetConsents(ctx, 1, 1)
+	mock.EXPECT().CreateRole(any, any, any)
+	mock.CreateRole(ctx, 1, Role{})
+	mock.EXPECT().UpdateRole(any, any, any)
+	mock.UpdateRole(ctx, 1, Role{})
+	mock.EXPECT().DeleteRole(any, any, any)
+	mock.DeleteRole(ctx, 1, 1)
+	mock.EXPECT().AssignRole(any, any, any, any)
+	mock.AssignRole(ctx, 1, 1, 1)
+	mock.EXPECT().RevokeRole(any, any, any, any)
+	mock.RevokeRole(ctx, 1, 1, 1)
+	mock.EXPECT().GetRoles(any, any)
+	mock.GetRoles(ctx, 1)
+	mock.EXPECT().GetRole(any, any, any)
+	mock.GetRole(ctx, 1, 1)
+	mock.EXPECT().GetProfileRoles(any, any, any)
+	mock.GetProfileRoles(ctx, 1, 1)
+	mock.EXPECT().GetProfilePermissions(any, any, any)
+	mock.GetProfilePermissions(ctx, 1, 1)
+	mock.EXPECT().CreateOrganization(any, any, any)
+	mock.CreateOrganization(ctx, 1, Organization{})
+	mock.EXPECT().UpdateMemberRole(any, any, any, any, any)
+	mock.UpdateMemberRole(ctx, 1, 1, 1, "")
+	mock.EXPECT().DeleteMember(any, any, any, any)
+	mock.DeleteMember(ctx, 1, 1, 1)
+	mock.EXPECT().SaveInvitation(any, any, any)
+	mock.SaveInvitation(ctx, 1, Invitation{})
+	mock.EXPECT().AcceptInvitation(any, any, any, any)
+	mock.AcceptInvitation(ctx, 1, Invitation{}, 1)
+	mock.EXPECT().DeclineInvitation(any, any, any)
+	mock.DeclineInvitation(ctx, 1, Invitation{})
+	mock.EXPECT().GetOrganization(any, any, any)
+	mock.GetOrganization(ctx, 1, 1)
+	mock.EXPECT().GetMembership(any, any, any, any)
+	mock.GetMembership(ctx, 1, 1, 1)
+	mock.EXPECT().GetMembers(any, any, any)
+	mock.GetMembers(ctx, 1, 1)
+	mock.EXPECT().GetProfileMemberships(any, any, any)
+	mock.EXPECT().GetSoleOwnerMemberships(any, any, any)
+	mock.GetProfileMemberships(ctx, 1, 1)
+	mock.GetSoleOwnerMemberships(ctx, 1, 1)
+	mock.EXPECT().GetProfileHistory(any, any, any, any, any)
+	mock.GetProfileHistory(ctx, 1, 1, 0, 1)
+	mock.EXPECT().SaveAuditEvent(any, any, any)
+	mock.SaveAuditEvent(ctx, 1, AuditEvent{})
+	mock.EXPECT().GetAuditEvents(any, any, any)
+	mock.GetAuditEvents(ctx, 1, AuditEventFilter{})
 }
@@ -1,14 +1,252 @@
 package repository
 
+// every query but the tenant ones is scoped to the tenant given as the first argument,
+// the rows of the other tenants are never read or changed
 const (
+	// tenant queries, the tenants are only managed in the database
+	tenantSelectAll      = "select id, slug, name, coalesce(host, ''), created_at from tenant "
+	getTenantQuery       = tenantSelectAll + "where id = $1"
+	getTenantBySlugQuery = tenantSelectAll + "where slug = $1"
+	getTenantByHostQuery = tenantSelectAll + "where host = $1"
+	getTenantsQuery      = tenantSelectAll + "order by id"
+	// end of tenant table query
+
 	// profile table mutation
-	saveProfileQuery       = "insert into profile (name, phone, password) values ($1, $2, $3) returning id"
-	updateLoginCountQuery  = "update profile set login_count = $1 where id = $2"
-	updateProfileByIDQuery = "update profile set name = $1, phone = $2 where id = $3"
+	saveProfileQuery      = "insert into profile (tenant_id, name, phone, password) values ($1, $2, $3, $4) returning id, created_at"
+	updateLoginCountQuery = "update profile set login_count = $2 where tenant_id = $1 and id = $3"
+
+	// the profile is saved together with its acceptance of the terms of service in one statement,
+	// so the profile is never saved without the consent it has been registered with
+	saveProfileWithConsentQuery = "with saved as (insert into profile (tenant_id, name, phone, password) values ($1, $2, $3, $4) returning id, created_at), " +
+		"consent as (insert into profile_consent (tenant_id, profile_id, terms_version, ip_address, user_agent) select $1, id, $5, $6, $7 from saved) " +
+		"select id, created_at from saved"
+
+	// the previous name and phone are saved into profile_history in the same statement when any of them is changed,
+	// the email verification is reset when the email is changed
+	updateProfileByIDQuery = "with previous as (select id, name, phone from profile where tenant_id = $1 and id = $4 and version = $5 for update), " +
+		"history as (insert into profile_history (tenant_id, profile_id, actor_id, name, phone) select $1, id, $6, name, phone from previous where name <> $2 or phone <> $3), " +
+		"updated as (update profile set name = $2, phone = $3, email = nullif($7, ''), email_verified_at = case when profile.email is distinct from nullif($7, '') then null else profile.email_verified_at end, " +
+		"version = profile.version + 1, updated_at = current_timestamp from previous where profile.id = previous.id returning profile.version, profile.updated_at, profile.email_verified_at) " +
+		"select version, updated_at, email_verified_at from updated"
+
+	// the previous avatar key is returned so its blobs can be removed once the new avatar is saved
+	updateProfileAvatarQuery = "with previous as (select id, avatar_key from profile where tenant_id = $1 and id = $3 for update) " +
+		"update profile set avatar_key = $2, version = profile.version + 1, updated_at = current_timestamp from previous where profile.id = previous.id " +
+		"returning coalesce(previous.avatar_key, '')"
+
+	// the verification is marked as used and the email is verified in the same statement,
+	// no row is returned when the verification has been used, expired or the email has been changed,
+	// and the unique violation is returned when another profile has verified the email in the meantime
+	verifyEmailQuery = "with used as (update email_verification set used_at = current_timestamp where tenant_id = $1 and id = $2 and profile_id = $3 and email = $4 and used_at is null and expires_at > current_timestamp returning profile_id, email) " +
+		"update profile set email_verified_at = current_timestamp, version = profile.version + 1, updated_at = current_timestamp from used where profile.tenant_id = $1 and profile.id = used.profile_id and profile.email = used.email returning profile.id"
+
+	// the first schedule is kept when the deletion is requested again so the grace period is never extended
+	scheduleProfileDeletionQuery = "update profile set deletion_scheduled_at = coalesce(deletion_scheduled_at, $3) where tenant_id = $1 and id = $2 returning deletion_scheduled_at"
+	cancelProfileDeletionQuery   = "update profile set deletion_scheduled_at = null where tenant_id = $1 and id = $2 and deletion_scheduled_at > $3 returning id"
+
+	// the imported profiles are inserted in one statement per batch, the arrays are the columns of the batch and the
+	// email verification times are passed in the importTimeLayout so the empty one becomes null.
+	// the profiles whose phone or email has been registered in the meantime are skipped so the rest of the batch is kept
+	importTimeLayout    = "2006-01-02 15:04:05.999999"
+	importProfilesQuery = "insert into profile (tenant_id, name, phone, email, email_verified_at, password) " +
+		"select $1, name, phone, nullif(email, ''), nullif(verified_at, '')::timestamp, password " +
+		"from unnest($2::text[], $3::text[], $4::text[], $5::text[], $6::text[]) as t (name, phone, email, verified_at, password) " +
+		"on conflict do nothing returning id, phone, created_at"
+
+	// the status is not part of the profile representation so the version is kept as is
+	updateProfileStatusQuery = "update profile set status = $3, status_reason = nullif($4, ''), status_changed_by = $5, status_changed_at = current_timestamp " +
+		"where tenant_id = $1 and id = $2 returning " + profileColumns
+
+	// the profile and its related data are removed in the same statement, the audit_log is append-only so it is kept.
+	// the data exports are expired so their archives are removed by the export job. The organization of which the profile is
+	// the last owner is handed over to its longest-standing admin, or member, and is removed when no member is left
+	purgeProfileQuery = "with purged as (delete from profile where tenant_id = $1 and id = $2 and deletion_scheduled_at <= $3 returning id), " +
+		"devices as (delete from profile_device d using purged where d.profile_id = purged.id), " +
+		"history as (delete from profile_history h using purged where h.profile_id = purged.id), " +
+		"phone_changes as (delete from phone_change c using purged where c.profile_id = purged.id), " +
+		"verifications as (delete from email_verification v using purged where v.profile_id = purged.id), " +
+		"preferences as (delete from profile_preference p using purged where p.profile_id = purged.id), " +
+		"consents as (delete from profile_consent k using purged where k.profile_id = purged.id), " +
+		"roles as (delete from profile_role pr using purged where pr.profile_id = purged.id), " +
+		"memberships as (delete from organization_member m using purged where m.profile_id = purged.id), " +
+		"sole_owned as (select m.organization_id from organization_member m join purged on m.profile_id = purged.id where m.tenant_id = $1 and " + soleOwnerCondition + "), " +
+		"successors as (update organization_member m set role = 'owner' from (select distinct on (o.organization_id) o.organization_id, o.profile_id from organization_member o " +
+		"join sole_owned s on s.organization_id = o.organization_id where o.profile_id <> $2 order by o.organization_id, o.role = 'admin' desc, o.created_at, o.profile_id) n " +
+		"where m.organization_id = n.organization_id and m.profile_id = n.profile_id), " +
+		"orphans as (delete from organization g using sole_owned s where g.id = s.organization_id and " +
+		"not exists (select 1 from organization_member o where o.organization_id = g.id and o.profile_id <> $2) returning g.id), " +
+		"invitations as (delete from organization_invitation i using orphans where i.organization_id = orphans.id), " +
+		"exports as (update data_export e set expires_at = $3 from purged where e.profile_id = purged.id) " +
+		"select id from purged"
 
 	// profile queries
-	profileSelectAll       = "select id, name, phone, password, login_count, created_at, updated_at from profile "
-	getProfileByPhoneQuery = profileSelectAll + "where phone = $1"
-	getProfileByIDQuery    = profileSelectAll + "where id = $1"
+	profileColumns          = "id, name, phone, coalesce(email, ''), email_verified_at, coalesce(avatar_key, ''), deletion_scheduled_at, status, coalesce(status_reason, ''), password, login_count, created_at, updated_at, version"
+	profileSelectAll        = "select " + profileColumns + " from profile "
+	getProfileByPhoneQuery  = profileSelectAll + "where tenant_id = $1 and phone = $2"
+	getProfileByIDQuery     = profileSelectAll + "where tenant_id = $1 and id = $2"
+	getProfileByEmailQuery  = profileSelectAll + "where tenant_id = $1 and email = $2 and email_verified_at is not null"
+	getProfilesToPurgeQuery = profileSelectAll + "where tenant_id = $1 and deletion_scheduled_at <= $2 order by deletion_scheduled_at limit $3"
+	getProfileStatusQuery   = "select status, deletion_scheduled_at from profile where tenant_id = $1 and id = $2"
+
+	// the phones and the verified emails of the given ones which have been registered, the unverified email is not unique
+	getRegisteredIdentifiersQuery = "select phone from profile where tenant_id = $1 and phone = any($2) union all select email from profile where tenant_id = $1 and email = any($3) and email_verified_at is not null"
+
+	// the admin search of the profiles, the cursor condition and the order by of the sort field are appended by SearchProfiles.
+	// the phone prefix and the name are LIKE patterns escaped by the caller
+	searchProfilesQuery = profileSelectAll + "where tenant_id = $1 and ($2 = '' or phone like $2 || '%') and ($3 = '' or name ilike '%' || $3 || '%') " +
+		"and ($4::timestamp is null or created_at >= $4) and ($5::timestamp is null or created_at < $5) " +
+		"and ($6 = '' or (case when status = 'active' and deletion_scheduled_at is not null then 'pending_deletion' else status end) = $6) " +
+		"and ($7::integer is null or login_count >= $7) and ($8::integer is null or login_count <= $8) "
+
+	// the export of the profiles matching the filters of the admin search is read through a server-side cursor,
+	// a batch of rows at a time, so the profiles are never loaded into memory at once
+	declareProfileExportQuery = "declare profile_export no scroll cursor for " + searchProfilesQuery + "order by id"
+	fetchProfileExportQuery   = "fetch forward 1000 from profile_export"
 	// end of profile table query
+
+	// profile_device table mutation
+	saveDeviceQuery           = "insert into profile_device (tenant_id, profile_id, fingerprint, user_agent) values ($1, $2, $3, $4) returning id"
+	updateDeviceLastSeenQuery = "update profile_device set last_seen_at = current_timestamp where tenant_id = $1 and id = $2"
+
+	// profile_device queries
+	deviceSelectAll             = "select id, profile_id, fingerprint, user_agent, created_at, last_seen_at from profile_device "
+	getDeviceByFingerprintQuery = deviceSelectAll + "where tenant_id = $1 and profile_id = $2 and fingerprint = $3"
+	getDevicesQuery             = deviceSelectAll + "where tenant_id = $1 and profile_id = $2 order by id"
+	hasDevicesQuery             = "select exists (select 1 from profile_device where tenant_id = $1 and profile_id = $2)"
+	// end of profile_device table query
+
+	// phone_change table mutation, a new request replaces the pending one together with its attempts
+	savePhoneChangeQuery              = "insert into phone_change (tenant_id, profile_id, phone, code_hash, attempts, expires_at) values ($1, $2, $3, $4, $5, $6) on conflict (profile_id) do update set phone = excluded.phone, code_hash = excluded.code_hash, attempts = excluded.attempts, expires_at = excluded.expires_at, created_at = current_timestamp where phone_change.tenant_id = excluded.tenant_id"
+	incrementPhoneChangeAttemptsQuery = "update phone_change set attempts = attempts + 1 where tenant_id = $1 and profile_id = $2 returning attempts"
+	deletePhoneChangeQuery            = "delete from phone_change where tenant_id = $1 and profile_id = $2"
+
+	// phone_change queries
+	getPhoneChangeQuery = "select profile_id, phone, code_hash, attempts, expires_at, created_at from phone_change where tenant_id = $1 and profile_id = $2"
+	// end of phone_change table query
+
+	// email_verification table mutation
+	saveEmailVerificationQuery = "insert into email_verification (tenant_id, id, profile_id, email, expires_at) values ($1, $2, $3, $4, $5)"
+	// end of email_verification table query
+
+	// profile_preference table mutation, the keys with the null value are removed so they use the default value
+	savePreferencesQuery = "with input as (select key, value from jsonb_each($3::jsonb)), " +
+		"deleted as (delete from profile_preference p using input where p.tenant_id = $1 and p.profile_id = $2 and p.key = input.key and input.value = 'null'::jsonb) " +
+		"insert into profile_preference (tenant_id, profile_id, key, value) select $1, $2, key, value from input where value <> 'null'::jsonb " +
+		"on conflict (profile_id, key) do update set value = excluded.value, updated_at = current_timestamp where profile_preference.tenant_id = excluded.tenant_id"
+
+	// profile_preference queries
+	getPreferencesQuery = "select key, value from profile_preference where tenant_id = $1 and profile_id = $2"
+	// end of profile_preference table query
+
+	// data_export table mutation, a new export is only saved when the profile has no export in progress,
+	// the partial unique index of the exports in progress keeps the concurrent requests from saving both
+	saveDataExportQuery = "insert into data_export (tenant_id, id, profile_id) values ($1, $2, $3) " +
+		"on conflict (tenant_id, profile_id) where status in ('pending', 'processing') do nothing returning status, created_at"
+
+	// the oldest pending export, or the export whose worker has stopped before finishing it, is claimed.
+	// skip locked lets the workers of multiple instances claim different exports
+	claimDataExportQuery = "update data_export set status = 'processing', started_at = current_timestamp where id = (select id from data_export where tenant_id = $1 and (status = 'pending' or (status = 'processing' and started_at < $2)) order by created_at limit 1 for update skip locked) " +
+		"returning id, profile_id, status, coalesce(archive_key, ''), created_at, finished_at, expires_at"
+	finishDataExportQuery = "update data_export set status = $3, archive_key = nullif($4, ''), finished_at = current_timestamp, expires_at = $5 where tenant_id = $1 and id = $2"
+	deleteDataExportQuery = "delete from data_export where tenant_id = $1 and id = $2"
+
+	// data_export queries
+	dataExportSelectAll        = "select id, profile_id, status, coalesce(archive_key, ''), created_at, finished_at, expires_at from data_export "
+	getDataExportQuery         = dataExportSelectAll + "where tenant_id = $1 and id = $2 and profile_id = $3"
+	getExpiredDataExportsQuery = dataExportSelectAll + "where tenant_id = $1 and expires_at <= $2 order by expires_at limit $3"
+	// end of data_export table query
+
+	// terms_version and profile_consent table mutation
+	saveTermsVersionQuery = "insert into terms_version (tenant_id, version, url, published_at) values ($1, $2, $3, $4)"
+	saveConsentQuery      = "insert into profile_consent (tenant_id, profile_id, terms_version, ip_address, user_agent) values ($1, $2, $3, $4, $5) returning id, accepted_at"
+
+	// terms_version and profile_consent queries, the current terms is the latest version published at the given time.
+	// the acceptance is read together with the current terms as it is checked by every protected endpoint
+	getCurrentTermsQuery    = "select version, url, published_at from terms_version where tenant_id = $1 and published_at <= $2 order by published_at desc, created_at desc limit 1"
+	getTermsAcceptanceQuery = "select t.version, t.url, t.published_at, exists (select 1 from profile_consent c where c.tenant_id = $1 and c.profile_id = $2 and c.terms_version = t.version) " +
+		"from terms_version t where t.tenant_id = $1 and t.published_at <= $3 order by t.published_at desc, t.created_at desc limit 1"
+	getConsentsQuery = "select id, profile_id, terms_version, ip_address, user_agent, accepted_at from profile_consent where tenant_id = $1 and profile_id = $2 order by id"
+	// end of terms_version and profile_consent table query
+
+	// role, role_permission and profile_role table mutation, the permissions are passed as a text array.
+	// the permissions which are kept are not deleted so they never conflict with the inserted ones.
+	// the role_permission rows belong to the tenant of their role
+	createRoleQuery = "with saved as (insert into role (tenant_id, name, description) values ($1, $2, $3) returning id, created_at), " +
+		"permissions as (insert into role_permission (role_id, permission) select saved.id, unnest($4::text[]) from saved) " +
+		"select id, created_at from saved"
+	updateRoleQuery = "with updated as (update role set name = $3, description = $4 where tenant_id = $1 and id = $2 returning id, created_at), " +
+		"removed as (delete from role_permission p using updated where p.role_id = updated.id and p.permission <> all($5::text[])), " +
+		"added as (insert into role_permission (role_id, permission) select updated.id, unnest($5::text[]) from updated on conflict do nothing) " +
+		"select created_at from updated"
+	deleteRoleQuery = "with deleted as (delete from role where tenant_id = $1 and id = $2 returning id), " +
+		"permissions as (delete from role_permission p using deleted where p.role_id = deleted.id), " +
+		"profiles as (delete from profile_role pr using deleted where pr.role_id = deleted.id) " +
+		"select id from deleted"
+	// the role is only assigned when both the profile and the role belong to the tenant
+	assignRoleQuery = "insert into profile_role (tenant_id, profile_id, role_id) select $1, p.id, r.id from profile p, role r " +
+		"where p.tenant_id = $1 and p.id = $2 and r.tenant_id = $1 and r.id = $3 on conflict do nothing"
+	revokeRoleQuery = "delete from profile_role where tenant_id = $1 and profile_id = $2 and role_id = $3"
+
+	// role, role_permission and profile_role queries, the permissions of the role are aggregated in alphabetical order
+	roleSelectAll = "select r.id, r.name, r.description, r.created_at, " +
+		"coalesce(array_agg(p.permission order by p.permission) filter (where p.permission is not null), '{}') " +
+		"from role r left join role_permission p on p.role_id = r.id "
+	getRolesQuery              = roleSelectAll + "where r.tenant_id = $1 group by r.id order by r.name"
+	getRoleQuery               = roleSelectAll + "where r.tenant_id = $1 and r.id = $2 group by r.id"
+	getProfileRolesQuery       = roleSelectAll + "join profile_role pr on pr.role_id = r.id where r.tenant_id = $1 and pr.tenant_id = $1 and pr.profile_id = $2 group by r.id order by r.name"
+	getProfilePermissionsQuery = "select distinct p.permission from profile_role pr join role r on r.id = pr.role_id join role_permission p on p.role_id = pr.role_id " +
+		"where r.tenant_id = $1 and pr.tenant_id = $1 and pr.profile_id = $2 order by p.permission"
+	// end of role, role_permission and profile_role table query
+
+	// organization, organization_member and organization_invitation table mutation, the profile creating the organization is its first owner
+	createOrganizationQuery = "with saved as (insert into organization (tenant_id, name, created_by) values ($1, $2, $3) returning id, created_at), " +
+		"owner as (insert into organization_member (tenant_id, organization_id, profile_id, role) select $1, saved.id, $3, 'owner' from saved) " +
+		"select id, created_at from saved"
+	// the last owner can neither be demoted nor removed so the organization always has an owner,
+	// the advisory lock of the organization serializes the owner changes so two owners can not remove each other
+	lockOrganizationOwnersQuery = "select pg_advisory_xact_lock(hashtext('organization_member'), $1)"
+	notLastOwnerCondition       = "(role <> 'owner' or exists (select 1 from organization_member o where o.tenant_id = $1 and o.organization_id = $2 and o.profile_id <> $3 and o.role = 'owner'))"
+	updateMemberRoleQuery       = "update organization_member set role = $4 where tenant_id = $1 and organization_id = $2 and profile_id = $3 and ($4 = 'owner' or " + notLastOwnerCondition + ") returning profile_id"
+	deleteMemberQuery           = "delete from organization_member where tenant_id = $1 and organization_id = $2 and profile_id = $3 and " + notLastOwnerCondition + " returning profile_id"
+	saveInvitationQuery         = "insert into organization_invitation (tenant_id, id, organization_id, phone, role, invited_by, expires_at) values ($1, $2, $3, $4, $5, $6, $7) returning status, created_at"
+	// the invitation is only accepted by the profile of the invited phone, the profile which is already a member keeps its role
+	acceptInvitationQuery = "with accepted as (update organization_invitation set status = 'accepted', responded_at = current_timestamp " +
+		"where tenant_id = $1 and id = $2 and phone = $4 and status = 'pending' and expires_at > current_timestamp returning organization_id, role) " +
+		"insert into organization_member (tenant_id, organization_id, profile_id, role) select $1, organization_id, $3, role from accepted on conflict do nothing returning profile_id"
+	declineInvitationQuery = "update organization_invitation set status = 'declined', responded_at = current_timestamp " +
+		"where tenant_id = $1 and id = $2 and phone = $3 and status = 'pending' and expires_at > current_timestamp returning id"
+
+	// organization, organization_member and organization_invitation queries
+	getOrganizationQuery = "select id, name, created_by, created_at from organization where tenant_id = $1 and id = $2"
+	membershipSelectAll  = "select m.organization_id, o.name, m.profile_id, p.name, m.role, m.created_at from organization_member m " +
+		"join organization o on o.id = m.organization_id join profile p on p.id = m.profile_id "
+	getMembershipQuery           = membershipSelectAll + "where m.tenant_id = $1 and m.organization_id = $2 and m.profile_id = $3"
+	getMembersQuery              = membershipSelectAll + "where m.tenant_id = $1 and m.organization_id = $2 order by p.name, m.profile_id"
+	getProfileMembershipsQuery   = membershipSelectAll + "where m.tenant_id = $1 and m.profile_id = $2 order by o.name, m.organization_id"
+	soleOwnerCondition           = "m.role = 'owner' and not exists (select 1 from organization_member x where x.organization_id = m.organization_id and x.profile_id <> m.profile_id and x.role = 'owner')"
+	getSoleOwnerMembershipsQuery = membershipSelectAll + "where m.tenant_id = $1 and m.profile_id = $2 and " + soleOwnerCondition + " order by o.name, m.organization_id"
+	// end of organization, organization_member and organization_invitation table query
+
+	// profile_history queries
+	getProfileHistoryQuery = "select id, profile_id, actor_id, name, phone, changed_at from profile_history where tenant_id = $1 and profile_id = $2 and ($3 = 0 or id < $3) order by id desc limit $4"
+	// end of profile_history table query
+
+	// audit_log table mutation, every tenant has its own hash chain so it can be verified without the events of the other tenants.
+	// the advisory lock of the tenant serializes its writers so the hash chain never forks
+	lockAuditLogQuery     = "select pg_advisory_xact_lock(hashtext('audit_log'), $1)"
+	getLastAuditHashQuery = "select hash from audit_log where tenant_id = $1 order by id desc limit 1"
+	saveAuditEventQuery   = "insert into audit_log (tenant_id, actor_id, target_id, action, before, after, request_id, ip_address, created_at, prev_hash, hash) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning id"
+
+	// audit_log queries
+	auditEventSelectAll = "select id, actor_id, target_id, action, before, after, request_id, ip_address, created_at, prev_hash, hash from audit_log "
+	getAuditEventsQuery = auditEventSelectAll + "where tenant_id = $1 and ($2 = 0 or actor_id = $2) and ($3 = 0 or target_id = $3) and ($4 = '' or action = $4) and ($5::timestamp is null or created_at >= $5) and ($6::timestamp is null or created_at < $6) and ($7 = 0 or id < $7) order by id desc limit $8"
+	// end of audit_log table query
 )
+
+// the column of every profile sort field, only these columns can be used in the order by of the admin search
+var profileSortColumns = map[string]string{
+	ProfileSortID:         "id",
+	ProfileSortName:       "name",
+	ProfileSortLoginCount: "login_count",
+	ProfileSortCreatedAt:  "created_at",
+}
@@ -3,20 +3,249 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+// the status of the profile, only the active profile can sign in and use its tokens.
+// The pending deletion is not stored, it is the active profile scheduled for deletion which can not sign in until the deletion is cancelled
+const (
+	ProfileStatusActive          = "active"
+	ProfileStatusSuspended       = "suspended"
+	ProfileStatusDisabled        = "disabled"
+	ProfileStatusPendingDeletion = "pending_deletion"
+)
+
+// the fields the profiles can be sorted by, the id breaks the ties of the other fields
+const (
+	ProfileSortID         = "id"
+	ProfileSortName       = "name"
+	ProfileSortLoginCount = "login_count"
+	ProfileSortCreatedAt  = "created_at"
+)
+
+// the status of the data export
+const (
+	DataExportPending    = "pending"
+	DataExportProcessing = "processing"
+	DataExportCompleted  = "completed"
+	DataExportFailed     = "failed"
+)
+
+// the roles of the organization members, the owner manages every member, the admin manages the admins and the members,
+// and the member only belongs to the organization
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+// the status of the organization invitation
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
 type (
+	// Tenant is the brand the profiles and every data related to them belong to, the data of a tenant is never
+	// read or changed by the requests of another tenant. The requests are resolved to the tenant by its Host or its Slug
+	Tenant struct {
+		ID        int64     `json:"id"`
+		Slug      string    `json:"slug"`
+		Name      string    `json:"name"`
+		Host      string    `json:"host"`
+		CreatedAt time.Time `json:"created_at"`
+	}
 
 	// Considering the simplicity of the project architecture, authentication, profile, and user phone number will be put into one table to maintain simplicity.
 	// For larger projects, it is recommended to separate authentication, user profile, and user phone into separate tables to increase flexibility in handling future scenarios, such as login with multiple authorization methods, a single user with multiple phone numbers, etc.
 	User struct {
 		ID         int64        `json:"id"`
 		Phone      string       `json:"phone"        validate:"required,phone"`
-		Name       string       `json:"name"         validate:"required,min=3,max=60"`
+		Email      string       `json:"email"        validate:"omitempty,max=254,email"`
+		Name       string       `json:"name"         validate:"required,min=3,max=60,name"`
 		Password   string       `json:"password"     validate:"required,min=6,max=64,password"`
 		LoginCount int          `json:"login_count"`
 		CreatedAt  time.Time    `json:"created_at"`
 		UpdatedAt  sql.NullTime `json:"updated_at"`
+		Version    int          `json:"version"`
+
+		// EmailVerifiedAt is null until the email is verified, the unverified email can not be used to sign in
+		EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+
+		// AvatarKey is the blob key prefix of the avatar images, empty when the profile has no avatar
+		AvatarKey string `json:"avatar_key"`
+
+		// DeletionScheduledAt is set when the user has requested to delete the account,
+		// the account can not be used to sign in and is purged once this time has passed
+		DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
+
+		// Status is either active, suspended or disabled, StatusReason is why the profile has been suspended or disabled
+		Status       string `json:"status"`
+		StatusReason string `json:"status_reason"`
+	}
+
+	// ProfileFilter narrows down the profiles of the tenant searched or exported by the admin, zero values are ignored.
+	// Profiles are sorted by the Sort field and the id, After is the pagination cursor. The export ignores the sort,
+	// the cursor and the limit.
+	ProfileFilter struct {
+		PhonePrefix   string
+		Name          string
+		CreatedFrom   sql.NullTime
+		CreatedTo     sql.NullTime
+		Status        string
+		MinLoginCount sql.NullInt64
+		MaxLoginCount sql.NullInt64
+		Sort          string
+		Desc          bool
+		After         *ProfileCursor
+		Limit         int
+	}
+
+	// ProfileCursor is the sort field value and the id of the last profile of the previous page,
+	// the value is in the text format of the sort column, e.g. RFC 3339 for created_at
+	ProfileCursor struct {
+		Value string
+		ID    int64
+	}
+
+	// Preferences is the JSON value of the profile preferences by key
+	Preferences map[string]json.RawMessage
+
+	// EmailVerification is the single-use verification link sent to the profile email
+	EmailVerification struct {
+		ID        string    `json:"id"`
+		ProfileID int64     `json:"profile_id"`
+		Email     string    `json:"email"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// DataExport is the personal data export requested by the user,
+	// the archive is available from the time the export is completed until ExpiresAt
+	DataExport struct {
+		ID         string       `json:"id"`
+		ProfileID  int64        `json:"profile_id"`
+		Status     string       `json:"status"`
+		ArchiveKey string       `json:"archive_key"`
+		CreatedAt  time.Time    `json:"created_at"`
+		FinishedAt sql.NullTime `json:"finished_at"`
+		ExpiresAt  sql.NullTime `json:"expires_at"`
+	}
+
+	// TermsVersion is a published version of the terms of service, the current version is the latest one published
+	TermsVersion struct {
+		Version     string    `json:"version"      validate:"required,max=32"`
+		URL         string    `json:"url"          validate:"required,max=2048,url"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+
+	// Consent is the acceptance of a terms of service version by the profile and the client it was accepted from
+	Consent struct {
+		ID           int64     `json:"id"`
+		ProfileID    int64     `json:"profile_id"`
+		TermsVersion string    `json:"terms_version"`
+		IPAddress    string    `json:"ip_address"`
+		UserAgent    string    `json:"user_agent"`
+		AcceptedAt   time.Time `json:"accepted_at"`
+	}
+
+	// Role grants its permissions to the profiles it is assigned to, the permissions are the ones declared
+	// by the x-permissions extension of the API operations, e.g. "users:read"
+	Role struct {
+		ID          int64     `json:"id"`
+		Name        string    `json:"name"        validate:"required,min=2,max=64,role_name"`
+		Description string    `json:"description" validate:"max=256"`
+		Permissions []string  `json:"permissions"`
+		CreatedAt   time.Time `json:"created_at"`
+	}
+
+	// Organization groups the profiles of the tenant, the profile creating the organization is its first owner
+	Organization struct {
+		ID        int64     `json:"id"`
+		Name      string    `json:"name"       validate:"required,min=2,max=128"`
+		CreatedBy int64     `json:"created_by"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// Membership is the organization role of the profile, the names are the ones of the organization and the profile
+	Membership struct {
+		OrganizationID   int64     `json:"organization_id"`
+		OrganizationName string    `json:"organization_name"`
+		ProfileID        int64     `json:"profile_id"`
+		ProfileName      string    `json:"profile_name"`
+		Role             string    `json:"role"`
+		CreatedAt        time.Time `json:"created_at"`
+	}
+
+	// Invitation is the invitation of the phone number to join the organization with the role,
+	// it can be accepted by the profile of the phone or declined until ExpiresAt
+	Invitation struct {
+		ID             string    `json:"id"`
+		OrganizationID int64     `json:"organization_id"`
+		Phone          string    `json:"phone"`
+		Role           string    `json:"role"`
+		InvitedBy      int64     `json:"invited_by"`
+		Status         string    `json:"status"`
+		ExpiresAt      time.Time `json:"expires_at"`
+		CreatedAt      time.Time `json:"created_at"`
+	}
+
+	// ProfileHistory is the name and phone of the profile before it was changed by the actor at ChangedAt
+	ProfileHistory struct {
+		ID        int64     `json:"id"`
+		ProfileID int64     `json:"profile_id"`
+		ActorID   int64     `json:"actor_id"`
+		Name      string    `json:"name"`
+		Phone     string    `json:"phone"`
+		ChangedAt time.Time `json:"changed_at"`
+	}
+
+	// PhoneChange is a pending phone number change waiting for the OTP sent to the new phone to be confirmed
+	PhoneChange struct {
+		ProfileID int64     `json:"profile_id"`
+		Phone     string    `json:"phone"`
+		CodeHash  string    `json:"-"`
+		Attempts  int       `json:"attempts"`
+		ExpiresAt time.Time `json:"expires_at"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// Device is a fingerprinted client which has successfully signed in to the profile.
+	Device struct {
+		ID          int64     `json:"id"`
+		ProfileID   int64     `json:"profile_id"`
+		Fingerprint string    `json:"fingerprint"`
+		UserAgent   string    `json:"user_agent"`
+		CreatedAt   time.Time `json:"created_at"`
+		LastSeenAt  time.Time `json:"last_seen_at"`
+	}
+
+	// AuditEvent is a single entry of the append-only security audit trail.
+	// Before and After only contain the fields changed by the action.
+	AuditEvent struct {
+		ID        int64           `json:"id"`
+		ActorID   sql.NullInt64   `json:"actor_id"`
+		TargetID  sql.NullInt64   `json:"target_id"`
+		Action    string          `json:"action"`
+		Before    json.RawMessage `json:"before"`
+		After     json.RawMessage `json:"after"`
+		RequestID string          `json:"request_id"`
+		IPAddress string          `json:"ip_address"`
+		CreatedAt time.Time       `json:"created_at"`
+		PrevHash  string          `json:"prev_hash"`
+		Hash      string          `json:"hash"`
+	}
+
+	// AuditEventFilter narrows down the audit events, zero values are ignored.
+	// Events are sorted from the newest one and BeforeID is used as the pagination cursor.
+	AuditEventFilter struct {
+		ActorID  int64
+		TargetID int64
+		Action   string
+		From     sql.NullTime
+		To       sql.NullTime
+		BeforeID int64
+		Limit    int
 	}
 )